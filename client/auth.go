@@ -0,0 +1,37 @@
+package client
+
+import "net/http"
+
+//Auth adds credentials to the request.
+type Auth interface {
+	Apply(*http.Request)
+}
+
+//BasicAuth authenticates with the username and the password.
+//OTPCode is required for users with two-factor authentication.
+type BasicAuth struct {
+	Username string
+	Password string
+	OTPCode  string
+}
+
+func (a BasicAuth) Apply(r *http.Request) {
+	r.SetBasicAuth(a.Username, a.Password)
+	if a.OTPCode != "" {
+		r.Header.Set("X-OTP-Code", a.OTPCode)
+	}
+}
+
+//BearerToken authenticates with the token issued by POST /login.
+type BearerToken string
+
+func (t BearerToken) Apply(r *http.Request) {
+	r.Header.Set("Authorization", "Bearer "+string(t))
+}
+
+//APIKey authenticates with the API key of a user.
+type APIKey string
+
+func (k APIKey) Apply(r *http.Request) {
+	r.Header.Set("X-API-Key", string(k))
+}
@@ -0,0 +1,210 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxAttempts int           = 3
+	defaultBaseDelay   time.Duration = 100 * time.Millisecond
+	defaultMaxDelay    time.Duration = 5 * time.Second
+
+	maxErrorBody int64 = 4096
+)
+
+//Client calls the user profiles API.
+type Client struct {
+	baseURL     *url.URL
+	http        *http.Client
+	auth        Auth
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+//Option configures the client.
+type Option func(*Client)
+
+//WithHTTPClient sets the HTTP client, http.DefaultClient is used by default.
+func WithHTTPClient(c *http.Client) Option {
+	return func(cl *Client) {
+		cl.http = c
+	}
+}
+
+//WithAuth sets the credentials added to every request.
+func WithAuth(a Auth) Option {
+	return func(cl *Client) {
+		cl.auth = a
+	}
+}
+
+//WithRetry sets the number of attempts and the exponential backoff limits.
+//Requests are retried on 429 and, for idempotent methods, on 5xx responses and network errors.
+func WithRetry(maxAttempts int, baseDelay, maxDelay time.Duration) Option {
+	return func(cl *Client) {
+		cl.maxAttempts = maxAttempts
+		cl.baseDelay = baseDelay
+		cl.maxDelay = maxDelay
+	}
+}
+
+//New creates a client for the service at baseURL, e.g. "http://localhost:8080".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url: %w", err)
+	}
+
+	c := &Client{
+		baseURL:     u,
+		http:        http.DefaultClient,
+		maxAttempts: defaultMaxAttempts,
+		baseDelay:   defaultBaseDelay,
+		maxDelay:    defaultMaxDelay,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.maxAttempts < 1 {
+		c.maxAttempts = 1
+	}
+
+	return c, nil
+}
+
+//do sends the request with retries and decodes the JSON response into out, if it is not nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) (*http.Response, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return nil, err
+		}
+	}
+
+	u := *c.baseURL
+	u.Path += path
+	u.RawQuery = query.Encode()
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(ctx, method, u.String(), body)
+
+		retry, wait := c.shouldRetry(method, resp, err)
+		if !retry || attempt >= c.maxAttempts {
+			if err != nil {
+				return nil, err
+			}
+			return resp, c.decode(resp, out)
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if wait == 0 {
+			wait = c.backoff(attempt)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, u string, body []byte) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	if c.auth != nil {
+		c.auth.Apply(req)
+	}
+
+	return c.http.Do(req)
+}
+
+//shouldRetry decides whether the attempt must be repeated and how long to wait if the server told it.
+func (c *Client) shouldRetry(method string, resp *http.Response, err error) (bool, time.Duration) {
+	idempotent := method != http.MethodPost && method != http.MethodPatch
+
+	if err != nil {
+		return idempotent, 0
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return true, retryAfter(resp)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return idempotent, retryAfter(resp)
+	}
+
+	return false, 0
+}
+
+//backoff returns the exponential delay with full jitter for the attempt.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.baseDelay << (attempt - 1)
+	if d > c.maxDelay || d <= 0 {
+		d = c.maxDelay
+	}
+
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	s, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || s < 0 {
+		return 0
+	}
+
+	return time.Duration(s) * time.Second
+}
+
+func (c *Client) decode(resp *http.Response, out interface{}) error {
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return &APIError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(msg)),
+		}
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("unable to decode response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/api"
+	"github.com/MarySmirnova/api_users/internal/config"
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	adminUname string = "IsAdmin"
+	adminPass  string = "IsAdmin"
+)
+
+func testServer(t *testing.T) *httptest.Server {
+	db := database.New()
+	err := db.NewUser(&database.User{
+		Username: adminUname,
+		Password: adminPass,
+		Admin:    true,
+	})
+	assert.Nil(t, err)
+
+	srv := api.New(config.API{
+		Auth: config.Auth{SessionTTL: time.Hour},
+	}, api.NewStorage(db))
+
+	ts := httptest.NewServer(srv.GetHTTPServer().Handler)
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func testClient(t *testing.T, url string, opts ...Option) *Client {
+	opts = append([]Option{WithAuth(BasicAuth{Username: adminUname, Password: adminPass})}, opts...)
+
+	c, err := New(url, opts...)
+	assert.Nil(t, err)
+
+	return c
+}
+
+func TestClient_UserLifecycle(t *testing.T) {
+	ts := testServer(t)
+	c := testClient(t, ts.URL)
+	ctx := context.Background()
+
+	id, err := c.CreateUser(ctx, NewUser{Email: "e@mail.ru", Username: "user", Password: "pass"})
+	assert.Nil(t, err)
+
+	u, err := c.GetUser(ctx, id)
+	assert.Nil(t, err)
+	assert.Equal(t, "user", u.Username)
+
+	err = c.UpdateUser(ctx, id, UserUpdate{Username: "renamed"})
+	assert.Nil(t, err)
+
+	u, err = c.GetUser(ctx, id)
+	assert.Nil(t, err)
+	assert.Equal(t, "renamed", u.Username)
+	assert.Equal(t, "e@mail.ru", u.Email)
+
+	err = c.DeleteUser(ctx, id)
+	assert.Nil(t, err)
+
+	_, err = c.GetUser(ctx, id)
+	assert.ErrorIs(t, err, ErrUserNotExist)
+	assert.ErrorIs(t, err, ErrBadRequest)
+}
+
+func TestClient_ListUsers_Pagination(t *testing.T) {
+	ts := testServer(t)
+	c := testClient(t, ts.URL)
+	ctx := context.Background()
+
+	for _, name := range []string{"a", "b", "c"} {
+		_, err := c.CreateUser(ctx, NewUser{Email: name + "@mail.ru", Username: name, Password: name})
+		assert.Nil(t, err)
+	}
+
+	page, err := c.ListUsers(ctx, ListOptions{Limit: 2, Offset: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, page.Total)
+	assert.Equal(t, 2, len(page.Users))
+	assert.Equal(t, "a", page.Users[0].Username)
+
+	all, err := c.ListAllUsers(ctx, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(all))
+}
+
+func TestClient_Errors(t *testing.T) {
+	ts := testServer(t)
+	ctx := context.Background()
+
+	c := testClient(t, ts.URL)
+	_, err := c.CreateUser(ctx, NewUser{Email: "e@mail.ru", Username: adminUname, Password: "pass"})
+	assert.ErrorIs(t, err, ErrNameAlreadyExist)
+
+	c = testClient(t, ts.URL, WithAuth(BasicAuth{Username: adminUname, Password: "wrong"}))
+	_, err = c.GetUser(ctx, uuid.New())
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	var apiErr *APIError
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+}
+
+func TestClient_Auth(t *testing.T) {
+	ts := testServer(t)
+	ctx := context.Background()
+
+	token, err := testClient(t, ts.URL).Login(ctx)
+	assert.Nil(t, err)
+
+	c := testClient(t, ts.URL, WithAuth(token))
+	_, err = c.ListUsers(ctx, ListOptions{})
+	assert.Nil(t, err)
+}
+
+func TestClient_Retry(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			_, _ = w.Write([]byte(`[]`))
+		}
+	}))
+	defer ts.Close()
+
+	c := testClient(t, ts.URL, WithRetry(3, time.Millisecond, 10*time.Millisecond))
+
+	page, err := c.ListUsers(context.Background(), ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, page.Total)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestClient_Retry_NotIdempotent(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	c := testClient(t, ts.URL, WithRetry(3, time.Millisecond, 10*time.Millisecond))
+
+	_, err := c.CreateUser(context.Background(), NewUser{})
+	assert.ErrorIs(t, err, ErrServer)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "POST must not be retried on 5xx")
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrBadRequest      error = errors.New("bad request")
+	ErrUnauthorized    error = errors.New("unauthorized")
+	ErrForbidden       error = errors.New("forbidden")
+	ErrNotFound        error = errors.New("not found")
+	ErrTooManyRequests error = errors.New("too many requests")
+	ErrServer          error = errors.New("server error")
+
+	ErrUserNotExist     error = errors.New("user does not exist")
+	ErrNameAlreadyExist error = errors.New("this name already exists")
+	ErrInvalidData      error = errors.New("invalid data passed")
+)
+
+//messageErrors maps error messages of the server to errors of the client.
+var messageErrors = map[string]error{
+	"user does not exist":      ErrUserNotExist,
+	"this name already exists": ErrNameAlreadyExist,
+	"invalid data passed":      ErrInvalidData,
+	"invalid parameter passed": ErrInvalidData,
+	"wrong JSON":               ErrInvalidData,
+}
+
+//APIError is an error response of the server.
+//It matches with errors.Is both the status error (ErrForbidden, ...) and the message error (ErrUserNotExist, ...).
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("api_users: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	return fmt.Sprintf("api_users: %d %s", e.StatusCode, e.Message)
+}
+
+func (e *APIError) Is(target error) bool {
+	if target == e.statusError() {
+		return true
+	}
+
+	for prefix, err := range messageErrors {
+		if target == err && strings.HasPrefix(e.Message, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *APIError) statusError() error {
+	switch {
+	case e.StatusCode == http.StatusBadRequest:
+		return ErrBadRequest
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusForbidden:
+		return ErrForbidden
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrTooManyRequests
+	case e.StatusCode >= http.StatusInternalServerError:
+		return ErrServer
+	}
+
+	return nil
+}
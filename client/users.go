@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+//User is a profile as returned by the service.
+type User struct {
+	ID            uuid.UUID
+	Email         string
+	EmailVerified bool
+	Username      string
+	Password      string
+	Admin         bool
+	Pending       bool
+}
+
+//NewUser is the data for creating a user.
+type NewUser struct {
+	Email    string
+	Username string
+	Password string
+	Admin    bool
+}
+
+//UserUpdate is the data for updating a user. Empty fields are left unchanged,
+//Admin is always sent, so it must hold the wanted value of the flag.
+type UserUpdate struct {
+	Email    string `json:",omitempty"`
+	Username string `json:",omitempty"`
+	Password string `json:",omitempty"`
+	Admin    bool
+}
+
+//ListOptions selects a page of a listing. Zero Limit means all items.
+type ListOptions struct {
+	Limit  int
+	Offset int
+}
+
+//UserPage is a page of users and the total number of users.
+type UserPage struct {
+	Users []User
+	Total int
+}
+
+//CreateUser creates a user and returns its ID.
+func (c *Client) CreateUser(ctx context.Context, u NewUser) (uuid.UUID, error) {
+	var id uuid.UUID
+	_, err := c.do(ctx, http.MethodPost, "/user", nil, u, &id)
+
+	return id, err
+}
+
+//ListUsers returns a page of users sorted by name.
+func (c *Client) ListUsers(ctx context.Context, opts ListOptions) (*UserPage, error) {
+	q := url.Values{}
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset > 0 {
+		q.Set("offset", strconv.Itoa(opts.Offset))
+	}
+
+	page := &UserPage{}
+	resp, err := c.do(ctx, http.MethodGet, "/user", q, nil, &page.Users)
+	if err != nil {
+		return nil, err
+	}
+
+	page.Total = len(page.Users)
+	if total := resp.Header.Get("X-Total-Count"); total != "" {
+		if page.Total, err = strconv.Atoi(total); err != nil {
+			return nil, fmt.Errorf("invalid total count: %w", err)
+		}
+	}
+
+	return page, nil
+}
+
+//ListAllUsers fetches all users page by page.
+func (c *Client) ListAllUsers(ctx context.Context, pageSize int) ([]User, error) {
+	users := []User{}
+
+	for {
+		page, err := c.ListUsers(ctx, ListOptions{Limit: pageSize, Offset: len(users)})
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, page.Users...)
+
+		if len(page.Users) == 0 || pageSize <= 0 || len(users) >= page.Total {
+			return users, nil
+		}
+	}
+}
+
+//GetUser returns a user by ID.
+func (c *Client) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	var u User
+	if _, err := c.do(ctx, http.MethodGet, "/user/"+id.String(), nil, nil, &u); err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+//UpdateUser changes the fields of a user.
+func (c *Client) UpdateUser(ctx context.Context, id uuid.UUID, u UserUpdate) error {
+	_, err := c.do(ctx, http.MethodPatch, "/user/"+id.String(), nil, u, nil)
+	return err
+}
+
+//DeleteUser deletes a user.
+func (c *Client) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	_, err := c.do(ctx, http.MethodDelete, "/user/"+id.String(), nil, nil, nil)
+	return err
+}
+
+type loginResponse struct {
+	Token string `json:"token"`
+}
+
+//Login exchanges the credentials of the client for a bearer token.
+func (c *Client) Login(ctx context.Context) (BearerToken, error) {
+	var resp loginResponse
+	if _, err := c.do(ctx, http.MethodPost, "/login", nil, nil, &resp); err != nil {
+		return "", err
+	}
+
+	return BearerToken(resp.Token), nil
+}
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	HeaderAPIKey string = "X-API-Key"
+
+	ScopeRead  string = "read"
+	ScopeWrite string = "write"
+
+	apiKeyPrefix    string = "ak_"
+	apiKeyPrefixLen int    = 6
+	apiKeySecretLen int    = 32
+)
+
+var ErrScopeDenied error = errors.New("api key scope does not allow this request")
+var ErrUnknownScope error = errors.New("unknown scope")
+
+var knownScopes = map[string]bool{
+	ScopeRead:  true,
+	ScopeWrite: true,
+}
+
+type APIKeyRequest struct {
+	Name      string     `json:"name" validate:"min=1"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type APIKeyResponse struct {
+	*database.APIKey
+	Key string `json:"key"`
+}
+
+func apiKey(r *http.Request) (string, bool) {
+	if key := r.Header.Get(HeaderAPIKey); key != "" {
+		return key, true
+	}
+
+	return authorizationValue(r, "ApiKey ")
+}
+
+//authenticateAPIKey checks the "<prefix>.<secret>" key and returns its owner and scopes.
+func (a *API) authenticateAPIKey(s Storage, key string) (*database.User, []string, error) {
+	prefix, secret, ok := strings.Cut(key, ".")
+	if !ok {
+		return nil, nil, ErrUnauthorized
+	}
+
+	k, err := s.GetAPIKeyByPrefix(prefix)
+	if err != nil {
+		if errors.Is(err, database.ErrAPIKeyNotExist) {
+			return nil, nil, ErrUnauthorized
+		}
+		return nil, nil, err
+	}
+
+	hash := database.HashSecret(secret)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(k.SecretHash)) != 1 {
+		return nil, nil, ErrUnauthorized
+	}
+
+	now := time.Now()
+	if k.IsExpired(now) {
+		return nil, nil, ErrUnauthorized
+	}
+
+	if err := s.TouchAPIKey(k.ID, now.UTC()); err != nil {
+		log.WithError(err).Warn("unable to update api key usage time")
+	}
+
+	user, err := a.userByID(s, k.UserID)
+	return user, k.Scopes, err
+}
+
+//scopesAllow checks the kind of the request against the API key scopes. An empty list allows everything.
+func scopesAllow(scopes []string, write bool) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+
+	need := ScopeRead
+	if write {
+		need = ScopeWrite
+	}
+
+	for _, s := range scopes {
+		if s == need {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *API) NewAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if !canManageUser(r.Context(), uid) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	var req APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.writeResponseError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid data passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	for _, s := range req.Scopes {
+		if !knownScopes[s] {
+			a.writeResponseError(w, fmt.Errorf("%w: %s", ErrUnknownScope, s), http.StatusBadRequest)
+			return
+		}
+	}
+
+	prefix, err := randomToken(apiKeyPrefixLen)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	prefix = apiKeyPrefix + prefix
+
+	secret, err := randomToken(apiKeySecretLen)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	k := &database.APIKey{
+		UserID:     uid,
+		Name:       req.Name,
+		Prefix:     prefix,
+		SecretHash: database.HashSecret(secret),
+		Scopes:     req.Scopes,
+		CreatedAt:  time.Now().UTC(),
+		ExpiresAt:  req.ExpiresAt,
+	}
+
+	if err := a.storeFor(r.Context()).NewAPIKey(k); err != nil {
+		if errors.Is(err, database.ErrUserNotExist) {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(APIKeyResponse{
+		APIKey: k,
+		Key:    prefix + "." + secret,
+	})
+}
+
+func (a *API) GetAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if !canManageUser(r.Context(), uid) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(a.storeFor(r.Context()).GetAPIKeysByUser(uid))
+}
+
+func (a *API) DeleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.Parse(vars["id"])
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	kid, err := uuid.Parse(vars["key_id"])
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if !canManageUser(r.Context(), uid) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	found := false
+	for _, k := range a.storeFor(r.Context()).GetAPIKeysByUser(uid) {
+		if k.ID == kid {
+			found = true
+			break
+		}
+	}
+	if !found {
+		a.writeResponseError(w, database.ErrAPIKeyNotExist, http.StatusBadRequest)
+		return
+	}
+
+	if err := a.storeFor(r.Context()).DeleteAPIKey(kid); err != nil {
+		if errors.Is(err, database.ErrAPIKeyNotExist) {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func createAPIKey(t *testing.T, api *API, id uuid.UUID, req APIKeyRequest) APIKeyResponse {
+	r, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/user/%s/apikeys", id), toJSON(req))
+	r.SetBasicAuth(adminUname, adminPass)
+
+	resp := execRequest(r, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var key APIKeyResponse
+	err := json.Unmarshal(resp.Body.Bytes(), &key)
+	assert.Nil(t, err)
+
+	return key
+}
+
+func TestAPI_NewAPIKeyHandler_PermissionsDenied(t *testing.T) {
+	api, _ := testBootstrap(t)
+
+	admin, _ := api.store.GetUserByName(adminUname)
+
+	req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/user/%s/apikeys", admin.ID), toJSON(APIKeyRequest{Name: "svc"}))
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+}
+
+func TestAPI_AuthMiddleware_APIKey(t *testing.T) {
+	api, id := testBootstrap(t)
+
+	key := createAPIKey(t, api, id, APIKeyRequest{Name: "svc"})
+	assert.Contains(t, key.Key, apiKeyPrefix)
+
+	req, _ := http.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set("Authorization", "ApiKey "+key.Key)
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set(HeaderAPIKey, key.Key)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	keys := api.store.GetAPIKeysByUser(id)
+	assert.Equal(t, 1, len(keys))
+	assert.NotNil(t, keys[0].LastUsedAt)
+
+	req, _ = http.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set(HeaderAPIKey, key.Prefix+".wrong")
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestAPI_AuthMiddleware_APIKeyScopes(t *testing.T) {
+	api, id := testBootstrap(t)
+
+	key := createAPIKey(t, api, id, APIKeyRequest{Name: "svc", Scopes: []string{ScopeRead}})
+
+	req, _ := http.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set(HeaderAPIKey, key.Key)
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodDelete, fmt.Sprintf("/user/%s/apikeys/%s", id, key.ID), nil)
+	req.Header.Set(HeaderAPIKey, key.Key)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Contains(t, resp.Body.String(), ErrScopeDenied.Error())
+}
+
+func TestAPI_AuthMiddleware_APIKeyExpired(t *testing.T) {
+	api, id := testBootstrap(t)
+
+	expired := time.Now().Add(-time.Minute)
+	key := createAPIKey(t, api, id, APIKeyRequest{Name: "svc", ExpiresAt: &expired})
+
+	req, _ := http.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set(HeaderAPIKey, key.Key)
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestAPI_DeleteAPIKeyHandler_GoodWay(t *testing.T) {
+	api, id := testBootstrap(t)
+
+	key := createAPIKey(t, api, id, APIKeyRequest{Name: "svc"})
+
+	req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("/user/%s/apikeys/%s", id, key.ID), nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set(HeaderAPIKey, key.Key)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
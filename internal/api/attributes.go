@@ -0,0 +1,142 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/gorilla/mux"
+)
+
+//attributeFilterPrefix marks the query parameters that filter users by custom attributes, e.g. attr.department=sales.
+const attributeFilterPrefix string = "attr."
+
+//invalidAttributes reports whether the user was rejected because of its custom attributes.
+func invalidAttributes(err error) bool {
+	return errors.Is(err, database.ErrAttributeNotExist) || errors.Is(err, database.ErrAttributeInvalid) ||
+		errors.Is(err, database.ErrAttributeRequired) || errors.Is(err, database.ErrAttributeNotUnique)
+}
+
+//filterByAttributes keeps the users whose attributes match all attr.<name> query parameters.
+//Values are compared as text, so numbers and booleans are passed as they are written in JSON.
+func filterByAttributes(users []*database.User, r *http.Request) []*database.User {
+	filters := make(map[string]string)
+	for key, values := range r.URL.Query() {
+		if name := strings.TrimPrefix(key, attributeFilterPrefix); name != key && len(values) > 0 {
+			filters[name] = values[0]
+		}
+	}
+	if len(filters) == 0 {
+		return users
+	}
+
+	matched := make([]*database.User, 0, len(users))
+	for _, u := range users {
+		ok := true
+		for name, value := range filters {
+			v, exists := u.Attributes[name]
+			ok = ok && exists && fmt.Sprint(v) == value
+		}
+		if ok {
+			matched = append(matched, u)
+		}
+	}
+
+	return matched
+}
+
+func (a *API) writeAttributeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrAttributeNotExist):
+		a.writeResponseError(w, err, http.StatusNotFound)
+	case errors.Is(err, database.ErrAttributeNameExist), errors.Is(err, database.ErrAttributeNotUnique),
+		errors.Is(err, database.ErrAttributeInvalid):
+		a.writeResponseError(w, err, http.StatusConflict)
+	case errors.Is(err, database.ErrAttributeDefinitionInvalid):
+		a.writeResponseError(w, err, http.StatusBadRequest)
+	default:
+		a.internalError(w, err)
+	}
+}
+
+//NewAttributeHandler defines a custom attribute of the users of the tenant.
+//The values the users already have must fit the definition, otherwise 409 is returned.
+func (a *API) NewAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdminUser(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	var d database.AttributeDefinition
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		a.writeResponseError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+	d.CreatedAt = time.Now().UTC()
+
+	if err := a.storeFor(r.Context()).NewAttribute(&d); err != nil {
+		a.writeAttributeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(d)
+}
+
+func (a *API) GetAttributesHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(a.storeFor(r.Context()).GetAttributes())
+}
+
+func (a *API) GetAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	d, err := a.storeFor(r.Context()).GetAttribute(mux.Vars(r)["name"])
+	if err != nil {
+		a.writeAttributeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(d)
+}
+
+//ReplaceAttributeHandler replaces an attribute definition, the name is taken from the path.
+func (a *API) ReplaceAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdminUser(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	var d database.AttributeDefinition
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		a.writeResponseError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+	d.Name = mux.Vars(r)["name"]
+
+	if err := a.storeFor(r.Context()).UpdateAttribute(&d); err != nil {
+		a.writeAttributeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(d)
+}
+
+//DeleteAttributeHandler deletes an attribute definition together with the values of the users.
+func (a *API) DeleteAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdminUser(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	if err := a.storeFor(r.Context()).DeleteAttribute(mux.Vars(r)["name"]); err != nil {
+		a.writeAttributeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
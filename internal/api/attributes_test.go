@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_Attributes(t *testing.T) {
+	api, notAdminID := testBootstrap(t)
+
+	dept := database.AttributeDefinition{Name: "department", Type: database.AttributeString, Enum: []string{"sales", "dev"}}
+
+	req, _ := http.NewRequest(http.MethodPost, "/attributes", toJSON(dept))
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/attributes", toJSON(database.AttributeDefinition{Name: "floor", Type: "date"}))
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	for _, d := range []database.AttributeDefinition{dept, {Name: "floor", Type: database.AttributeNumber, Unique: true}} {
+		req, _ = http.NewRequest(http.MethodPost, "/attributes", toJSON(d))
+		req.SetBasicAuth(adminUname, adminPass)
+		resp = execRequest(req, api.httpServer)
+		assert.Equal(t, http.StatusCreated, resp.Code)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/attributes/department", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodPatch, "/user/"+notAdminID.String(), toJSON(map[string]interface{}{
+		"Attributes": map[string]interface{}{"department": "hr"},
+	}))
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodPatch, "/user/"+notAdminID.String(), toJSON(map[string]interface{}{
+		"Attributes": map[string]interface{}{"department": "dev", "floor": 2},
+	}))
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/user", toJSON(database.User{
+		Username: "floor", Password: "pass", Email: "floor@mail.ru", Attributes: map[string]interface{}{"floor": 2},
+	}))
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusBadRequest, resp.Code, "The floor is unique")
+
+	req, _ = http.NewRequest(http.MethodGet, "/user?attr.department=dev&attr.floor=2", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "1", resp.Header().Get(HeaderTotalCount))
+
+	var users []*database.User
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &users))
+	assert.Equal(t, 1, len(users))
+	assert.Equal(t, notAdminID, users[0].ID)
+	assert.Equal(t, map[string]interface{}{"department": "dev", "floor": 2.0}, users[0].Attributes)
+
+	code, body := execGraphQL(t, api, notAdminUname, notAdminPass, GraphQLRequest{
+		Query: `query($id: ID!) { user(id: $id) { attributes { name value } } }`, Variables: map[string]interface{}{"id": notAdminID.String()},
+	})
+	assert.Equal(t, http.StatusOK, code, body.Errors)
+	assert.Empty(t, body.Errors)
+	assert.JSONEq(t, `{"attributes": [{"name": "department", "value": "dev"}, {"name": "floor", "value": "2"}]}`, string(body.Data["user"]))
+
+	req, _ = http.NewRequest(http.MethodPut, "/attributes/department", toJSON(database.AttributeDefinition{Type: database.AttributeString, Enum: []string{"sales"}}))
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusConflict, resp.Code, "A stored value does not fit the new definition")
+
+	req, _ = http.NewRequest(http.MethodDelete, "/attributes/department", nil)
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/user?attr.department=dev", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, "0", resp.Header().Get(HeaderTotalCount))
+
+	req, _ = http.NewRequest(http.MethodGet, "/attributes/"+uuid.NewString(), nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
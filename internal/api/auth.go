@@ -0,0 +1,298 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	HeaderOTPCode string = "X-OTP-Code"
+
+	sessionTokenLen int = 32
+)
+
+var ErrOTPRequired error = errors.New("one-time code is required")
+var ErrOTPInvalid error = errors.New("invalid one-time code")
+var ErrTwoFactorRequired error = errors.New("administrators must enable two-factor authentication")
+
+var ErrUnauthorized error = errors.New("unauthorized")
+
+//twoFactorSetupRoutes are available to administrators who have not enabled two-factor authentication yet
+//when it is required by the policy.
+var twoFactorSetupRoutes = map[string]bool{
+	"login":      true,
+	"logout":     true,
+	"2fa_enroll": true,
+	"2fa_qr":     true,
+	"2fa_verify": true,
+}
+
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+//Credentials are the authentication data of a request, whatever the transport is.
+type Credentials struct {
+	Username string
+	Password string
+	OTPCode  string
+	Token    string
+	APIKey   string
+	//Session is the token of the session of the login page. Unlike Token it is never an OAuth access token.
+	Session string
+	//Tenant is the tenant of the request, the user is searched only among its users.
+	Tenant uuid.UUID
+}
+
+func requestCredentials(r *http.Request) Credentials {
+	c := Credentials{Tenant: currentTenant(r.Context())}
+
+	if key, ok := apiKey(r); ok {
+		c.APIKey = key
+		return c
+	}
+
+	if token, ok := bearerToken(r); ok {
+		c.Token = token
+		return c
+	}
+
+	c.Username, c.Password, _ = r.BasicAuth()
+	c.OTPCode = r.Header.Get(HeaderOTPCode)
+
+	return c
+}
+
+//Authenticate finds the user by the credentials and checks the access policies: pending accounts,
+//verified emails, two-factor authentication of administrators and API key scopes.
+//write tells whether the request changes data, setup - whether it is a two-factor setup request.
+//REST and gRPC share it, so both follow the same rules.
+func (a *API) Authenticate(c Credentials, write, setup bool) (*database.User, error) {
+	user, scopes, err := a.authenticate(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.Admin && a.grantsAdmin(user) {
+		//права администратора, выданные группой, не сохраняются в профиле
+		admin := *user
+		admin.Admin = true
+		user = &admin
+	}
+
+	if user.Pending {
+		return nil, ErrAccountPending
+	}
+
+	if a.cfg.RequireVerifiedEmail && !user.Admin && !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	if a.cfg.TOTPRequiredForAdmins && user.Admin && !setup {
+		enrolled, err := a.hasTOTP(a.store.WithTenant(user.TenantID), user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !enrolled {
+			return nil, ErrTwoFactorRequired
+		}
+	}
+
+	if !scopesAllow(scopes, write) {
+		return nil, ErrScopeDenied
+	}
+
+	return user, nil
+}
+
+//grantsAdmin reports whether the groups of the user grant the administrator rights.
+func (a *API) grantsAdmin(user *database.User) bool {
+	for _, p := range a.store.WithTenant(user.TenantID).GetUserPermissions(user.ID) {
+		if p == database.PermissionAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+//authenticate finds the user by the API key, the bearer token, the login page session or the basic credentials.
+//A bearer token is either a session or an OAuth access token.
+//Users with two-factor authentication must pass a one-time code along with the basic credentials.
+//The returned scopes are not empty only for API keys restricted by scopes and for OAuth access tokens.
+func (a *API) authenticate(c Credentials) (*database.User, []string, error) {
+	store := a.store.WithTenant(c.Tenant)
+
+	if c.APIKey != "" {
+		return a.authenticateAPIKey(store, c.APIKey)
+	}
+
+	if c.Token != "" {
+		s, err := store.GetSession(c.Token)
+		if err != nil {
+			if errors.Is(err, database.ErrSessionNotExist) {
+				return a.authenticateOAuthToken(store, c.Token)
+			}
+			return nil, nil, err
+		}
+
+		user, err := a.userByID(store, s.UserID)
+		return user, nil, err
+	}
+
+	if c.Session != "" {
+		s, err := store.GetSession(c.Session)
+		if err != nil {
+			if errors.Is(err, database.ErrSessionNotExist) {
+				return nil, nil, ErrUnauthorized
+			}
+			return nil, nil, err
+		}
+
+		user, err := a.userByID(store, s.UserID)
+		return user, nil, err
+	}
+
+	if c.Username == "" {
+		return nil, nil, ErrUnauthorized
+	}
+
+	user, err := store.GetUserByName(c.Username)
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotExist) {
+			return nil, nil, ErrUnauthorized
+		}
+		return nil, nil, err
+	}
+
+	if !user.CheckPassword(c.Password) {
+		return nil, nil, ErrUnauthorized
+	}
+
+	if err := a.checkOTP(store, user.ID, c.OTPCode); err != nil {
+		return nil, nil, err
+	}
+
+	if user.PasswordNeedsUpgrade() {
+		a.upgradePassword(store, user, c.Password)
+	}
+
+	return user, nil, nil
+}
+
+//upgradePassword rehashes an imported password with the current algorithm. The login succeeds
+//even if the upgrade fails, it is retried on the next login.
+func (a *API) upgradePassword(s Storage, user *database.User, password string) {
+	hash, err := user.CreatePasswordHash(password)
+	if err == nil {
+		err = s.UpgradePassword(user.ID, user.Password, hash)
+	}
+	if err != nil {
+		log.WithError(err).WithField("user_id", user.ID).Warn("unable to upgrade password hash")
+	}
+}
+
+func (a *API) userByID(s Storage, uid uuid.UUID) (*database.User, error) {
+	user, err := s.GetUserByID(uid)
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotExist) {
+			return nil, ErrUnauthorized
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	return authorizationValue(r, "Bearer ")
+}
+
+//authorizationValue returns the credentials of the Authorization header with the given scheme.
+func authorizationValue(r *http.Request, scheme string) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < len(scheme) || !strings.EqualFold(h[:len(scheme)], scheme) {
+		return "", false
+	}
+
+	return strings.TrimSpace(h[len(scheme):]), true
+}
+
+func isWriteMethod(method string) bool {
+	return method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions
+}
+
+func isTwoFactorSetupRoute(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+
+	return twoFactorSetupRoutes[route.GetName()]
+}
+
+//LoginHandler exchanges the basic credentials (and the one-time code, if required) for a bearer token.
+//Other credentials are rejected: an API key or an OAuth token must not turn into an unrestricted session,
+//and a session must not extend itself beyond its TTL.
+func (a *API) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	if requestCredentials(r).Username == "" {
+		a.askPassword(w)
+		return
+	}
+
+	token, err := randomToken(sessionTokenLen)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	s := &database.Session{
+		TokenHash: database.HashSecret(token),
+		UserID:    currentUserID(r.Context()),
+		ExpiresAt: time.Now().Add(a.cfg.SessionTTL).UTC(),
+	}
+
+	if err := a.storeFor(r.Context()).NewSession(s); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(LoginResponse{
+		Token:     token,
+		ExpiresAt: s.ExpiresAt,
+	})
+}
+
+//LogoutHandler revokes the bearer token used for the request.
+func (a *API) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if token, ok := bearerToken(r); ok {
+		if err := a.storeFor(r.Context()).DeleteSession(token); err != nil {
+			a.internalError(w, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/MarySmirnova/api_users/internal/avatar"
+	"github.com/MarySmirnova/api_users/internal/blob"
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const avatarSizeThumbnail string = "thumbnail"
+
+var ErrAvatarNotExist error = errors.New("user has no avatar")
+var ErrAvatarTooLarge error = errors.New("avatar file is too large")
+
+func avatarKey(uid uuid.UUID, thumbnail bool) string {
+	if thumbnail {
+		return "avatars/" + uid.String() + "/thumbnail"
+	}
+	return "avatars/" + uid.String() + "/avatar"
+}
+
+//avatarUser parses the user ID and checks that the user exists in the tenant of the request,
+//writes the error response if it fails.
+func (a *API) avatarUser(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	uid, ok := a.pathID(w, r, "id")
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	if _, err := a.storeFor(r.Context()).GetUserByID(uid); err != nil {
+		if errors.Is(err, database.ErrUserNotExist) {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return uuid.Nil, false
+		}
+		a.internalError(w, err)
+		return uuid.Nil, false
+	}
+
+	return uid, true
+}
+
+//UploadAvatarHandler accepts a PNG, JPEG or GIF picture as the request body. The image is re-encoded without
+//metadata, scaled down and stored with a square thumbnail. It is available to administrators and to the user itself.
+func (a *API) UploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	uid, ok := a.avatarUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !canManageUser(r.Context(), uid) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	switch mediaType(r) {
+	case avatar.ContentTypePNG, avatar.ContentTypeJPEG, avatar.ContentTypeGIF:
+	default:
+		a.writeResponseError(w, avatar.ErrUnsupportedFormat, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, a.avatar.AvatarMaxBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		a.writeResponseError(w, ErrAvatarTooLarge, http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("unable to read the image: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	full, thumb, err := avatar.Process(data, avatar.Limits{
+		MaxDimension: a.avatar.AvatarMaxDimension,
+		Size:         a.avatar.AvatarSize,
+		ThumbSize:    a.avatar.AvatarThumbSize,
+	})
+	switch {
+	case errors.Is(err, avatar.ErrUnsupportedFormat):
+		a.writeResponseError(w, err, http.StatusUnsupportedMediaType)
+		return
+	case errors.Is(err, avatar.ErrTooLarge), errors.Is(err, avatar.ErrInvalidImage):
+		a.writeResponseError(w, err, http.StatusBadRequest)
+		return
+	case err != nil:
+		a.internalError(w, err)
+		return
+	}
+
+	//миниатюра сохраняется первой: аватар без миниатюры хуже, чем старая миниатюра
+	if err := a.blobs.Put(r.Context(), avatarKey(uid, true), &blob.Object{Data: thumb.Data, ContentType: thumb.ContentType}); err != nil {
+		a.internalError(w, err)
+		return
+	}
+	if err := a.blobs.Put(r.Context(), avatarKey(uid, false), &blob.Object{Data: full.Data, ContentType: full.ContentType}); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//GetAvatarHandler serves the avatar or, with size=thumbnail, its thumbnail. Responses have an ETag
+//and may be cached by the client, conditional requests are answered with 304.
+func (a *API) GetAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	uid, ok := a.avatarUser(w, r)
+	if !ok {
+		return
+	}
+
+	size := r.URL.Query().Get("size")
+	if size != "" && size != avatarSizeThumbnail {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: size must be %s", avatarSizeThumbnail), http.StatusBadRequest)
+		return
+	}
+
+	o, err := a.blobs.Get(r.Context(), avatarKey(uid, size == avatarSizeThumbnail))
+	if errors.Is(err, blob.ErrNotExist) {
+		a.writeResponseError(w, ErrAvatarNotExist, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	sum := sha256.Sum256(o.Data)
+	w.Header().Set("Content-Type", o.ContentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	//аватары доступны только после аутентификации, поэтому общие кеши их не хранят
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(a.avatar.AvatarCacheMaxAge.Seconds())))
+
+	http.ServeContent(w, r, "", o.ModTime, bytes.NewReader(o.Data))
+}
+
+func (a *API) DeleteAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	uid, ok := a.avatarUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !canManageUser(r.Context(), uid) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	if err := a.deleteAvatar(r.Context(), uid); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) deleteAvatar(ctx context.Context, uid uuid.UUID) error {
+	for _, thumbnail := range []bool{false, true} {
+		if err := a.blobs.Delete(ctx, avatarKey(uid, thumbnail)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//deleteAvatarOfDeletedUser removes the pictures of deleted users, whatever API has deleted them.
+//Listeners are called under the lock of the storage, so the store is called in the background.
+func (a *API) deleteAvatarOfDeletedUser(e database.Event) {
+	if e.Type != database.EventUserDeleted {
+		return
+	}
+
+	uid := e.User.ID
+	go func() {
+		if err := a.deleteAvatar(context.Background(), uid); err != nil {
+			log.WithError(err).WithField("user_id", uid).Error("unable to delete avatar")
+		}
+	}()
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_Avatars(t *testing.T) {
+	api, notAdminID := testBootstrap(t)
+	api.avatar = config.Avatar{AvatarMaxBytes: 1 << 20, AvatarMaxDimension: 1000, AvatarSize: 100, AvatarThumbSize: 16, AvatarCacheMaxAge: time.Hour}
+
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	for x := 0; x < 300; x++ {
+		img.Set(x, x%200, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	assert.Nil(t, png.Encode(&buf, img))
+
+	avatarURL := "/user/" + notAdminID.String() + "/avatar"
+	upload := func(body []byte, contentType, uname, pass string) int {
+		req, _ := http.NewRequest(http.MethodPut, avatarURL, bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.SetBasicAuth(uname, pass)
+		return execRequest(req, api.httpServer).Code
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, avatarURL, nil)
+	req.SetBasicAuth(adminUname, adminPass)
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, upload(buf.Bytes(), "image/svg+xml", notAdminUname, notAdminPass))
+	assert.Equal(t, http.StatusBadRequest, upload(buf.Bytes()[:20], "image/png", notAdminUname, notAdminPass))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, upload(make([]byte, 2<<20), "image/png", notAdminUname, notAdminPass))
+	assert.Equal(t, http.StatusNoContent, upload(buf.Bytes(), "image/png", notAdminUname, notAdminPass))
+
+	req, _ = http.NewRequest(http.MethodGet, avatarURL, nil)
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "image/png", resp.Header().Get("Content-Type"))
+	assert.Equal(t, "private, max-age=3600", resp.Header().Get("Cache-Control"))
+
+	cfg, err := png.DecodeConfig(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, cfg.Width)
+	assert.Equal(t, 66, cfg.Height)
+
+	etag := resp.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	req.Header.Set("If-None-Match", etag)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNotModified, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, avatarURL+"?size=thumbnail", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	cfg, err = png.DecodeConfig(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, 16, cfg.Width)
+	assert.Equal(t, 16, cfg.Height)
+
+	admin, err := api.store.GetUserByName(adminUname)
+	assert.Nil(t, err)
+	req, _ = http.NewRequest(http.MethodPut, "/user/"+admin.ID.String()+"/avatar", bytes.NewReader(buf.Bytes()))
+	req.Header.Set("Content-Type", "image/png")
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodDelete, "/user/"+notAdminID.String(), nil)
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	assert.Eventually(t, func() bool {
+		_, err := api.blobs.Get(req.Context(), avatarKey(notAdminID, false))
+		return err != nil
+	}, time.Second, 10*time.Millisecond, "The avatar of a deleted user is removed")
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+)
+
+var ErrEmptyBatch error = errors.New("batch has no operations")
+var ErrBatchTooLarge error = errors.New("batch has too many operations")
+
+type BatchRequest struct {
+	//Atomic applies all operations or none.
+	Atomic     bool             `json:"atomic"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+//BatchOperation creates, updates or deletes a user. Update changes only passed fields.
+type BatchOperation struct {
+	Op       database.BatchKind `json:"op"`
+	ID       uuid.UUID          `json:"id,omitempty"`
+	Email    string             `json:"email,omitempty"`
+	Username string             `json:"username,omitempty"`
+	Password string             `json:"password,omitempty"`
+	Admin    *bool              `json:"admin,omitempty"`
+	//Attributes are the custom attributes, update changes only the passed ones and removes those set to null.
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+type BatchResult struct {
+	Status int       `json:"status"`
+	ID     uuid.UUID `json:"id,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Applied bool          `json:"applied"`
+	Results []BatchResult `json:"results"`
+}
+
+//BatchHandler applies a list of operations and returns a result for every one in the same order.
+//Passwords are hashed in parallel by a bounded pool of workers before the storage is locked.
+//If an atomic batch is not applied, the response has the status of the first failed operation.
+func (a *API) BatchHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdminUser(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.writeResponseError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Operations) == 0 {
+		a.writeResponseError(w, ErrEmptyBatch, http.StatusBadRequest)
+		return
+	}
+	if a.batch.MaxOperations > 0 && len(req.Operations) > a.batch.MaxOperations {
+		a.writeResponseError(w, fmt.Errorf("%w: limit %d", ErrBatchTooLarge, a.batch.MaxOperations), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	results := make([]BatchResult, len(req.Operations))
+	ops := make([]database.BatchOp, len(req.Operations))
+	valid := true
+	for i, op := range req.Operations {
+		ops[i], results[i] = batchOp(op)
+		valid = valid && results[i].Status == 0
+	}
+
+	if !valid && req.Atomic {
+		a.writeBatchResponse(w, false, results)
+		return
+	}
+
+	a.hashBatchPasswords(ops, results)
+
+	//операции с ошибками не отправляем в хранилище, но сохраняем их позиции в ответе
+	pending := make([]database.BatchOp, 0, len(ops))
+	index := make([]int, 0, len(ops))
+	for i := range ops {
+		if results[i].Status == 0 {
+			pending = append(pending, ops[i])
+			index = append(index, i)
+		}
+	}
+	if len(pending) < len(ops) && req.Atomic {
+		a.writeBatchResponse(w, false, results)
+		return
+	}
+
+	errs := a.storeFor(r.Context()).ApplyBatch(pending, req.Atomic)
+
+	applied := true
+	for j, err := range errs {
+		i := index[j]
+		if err != nil {
+			applied = false
+			results[i] = BatchResult{Status: batchErrorStatus(err), ID: pending[j].User.ID, Error: err.Error()}
+			continue
+		}
+
+		u := pending[j].User
+		results[i].ID = u.ID
+		switch pending[j].Kind {
+		case database.BatchCreate:
+			results[i].Status = http.StatusCreated
+		default:
+			results[i].Status = http.StatusNoContent
+		}
+
+		if u.Email != "" && !u.EmailVerified && (pending[j].Kind == database.BatchCreate || req.Operations[i].Email != "") {
+			if err := a.sendEmailVerification(&u); err != nil {
+				a.internalError(w, err)
+				return
+			}
+		}
+	}
+
+	a.writeBatchResponse(w, applied || !req.Atomic, results)
+}
+
+//batchOp validates the operation and converts it for the storage. A failed validation is returned as a result.
+func batchOp(op BatchOperation) (database.BatchOp, BatchResult) {
+	u := database.User{
+		ID:         op.ID,
+		Email:      op.Email,
+		Username:   op.Username,
+		Password:   op.Password,
+		Attributes: op.Attributes,
+	}
+	if op.Admin != nil {
+		u.Admin = *op.Admin
+	}
+
+	invalid := func(err error) (database.BatchOp, BatchResult) {
+		return database.BatchOp{}, BatchResult{Status: http.StatusBadRequest, ID: op.ID, Error: err.Error()}
+	}
+
+	switch op.Op {
+	case database.BatchCreate:
+		u.ID = uuid.Nil
+		if err := validate.Struct(u); err != nil {
+			return invalid(fmt.Errorf("invalid data passed: %s", err))
+		}
+	case database.BatchUpdate:
+		if op.ID == uuid.Nil {
+			return invalid(errors.New("id is required"))
+		}
+		if op.Email != "" {
+			if err := validate.Var(op.Email, "email"); err != nil {
+				return invalid(fmt.Errorf("invalid data passed: %s", err))
+			}
+		}
+	case database.BatchDelete:
+		if op.ID == uuid.Nil {
+			return invalid(errors.New("id is required"))
+		}
+	default:
+		return invalid(fmt.Errorf("unknown operation %q", op.Op))
+	}
+
+	return database.BatchOp{Kind: op.Op, User: u, KeepAdmin: op.Admin == nil}, BatchResult{}
+}
+
+//hashBatchPasswords replaces passwords of valid operations with hashes using a pool of workers.
+func (a *API) hashBatchPasswords(ops []database.BatchOp, results []BatchResult) {
+	workers := a.batch.HashWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				hash, err := ops[i].User.CreatePasswordHash(ops[i].User.Password)
+				if err != nil {
+					results[i] = BatchResult{Status: http.StatusBadRequest, ID: ops[i].User.ID, Error: err.Error()}
+					continue
+				}
+				ops[i].User.Password = hash
+			}
+		}()
+	}
+
+	for i := range ops {
+		if results[i].Status == 0 && ops[i].User.Password != "" {
+			jobs <- i
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func batchErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrUserNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrNameAlreadyExist), errors.Is(err, database.ErrAttributeNotUnique):
+		return http.StatusConflict
+	case invalidAttributes(err):
+		return http.StatusBadRequest
+	case errors.Is(err, database.ErrBatchRolledBack):
+		return http.StatusFailedDependency
+	}
+
+	return http.StatusInternalServerError
+}
+
+func (a *API) writeBatchResponse(w http.ResponseWriter, applied bool, results []BatchResult) {
+	code := http.StatusOK
+	if !applied {
+		for _, r := range results {
+			if r.Status >= http.StatusBadRequest && r.Status != http.StatusFailedDependency {
+				code = r.Status
+				break
+			}
+		}
+	}
+
+	//в атомарном режиме непримененные операции без своей ошибки помечаем явно
+	for i := range results {
+		if results[i].Status == 0 {
+			results[i] = BatchResult{Status: http.StatusFailedDependency, ID: results[i].ID, Error: database.ErrBatchRolledBack.Error()}
+		}
+	}
+
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(BatchResponse{Applied: applied, Results: results})
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func execBatch(t *testing.T, api *API, req BatchRequest) (int, BatchResponse) {
+	r, _ := http.NewRequest(http.MethodPost, "/user/batch", toJSON(req))
+	r.SetBasicAuth(adminUname, adminPass)
+
+	resp := execRequest(r, api.httpServer)
+
+	var body BatchResponse
+	_ = json.Unmarshal(resp.Body.Bytes(), &body)
+
+	return resp.Code, body
+}
+
+func TestAPI_BatchHandler_PermissionsDenied(t *testing.T) {
+	api, _ := testBootstrap(t)
+
+	r, _ := http.NewRequest(http.MethodPost, "/user/batch", toJSON(BatchRequest{}))
+	r.SetBasicAuth(notAdminUname, notAdminPass)
+
+	resp := execRequest(r, api.httpServer)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+}
+
+func TestAPI_BatchHandler_Partial(t *testing.T) {
+	api, id := testBootstrap(t)
+	api.batch.HashWorkers = 2
+
+	admin := true
+	code, body := execBatch(t, api, BatchRequest{Operations: []BatchOperation{
+		{Op: database.BatchCreate, Email: "a@mail.ru", Username: "a", Password: "a"},
+		{Op: database.BatchCreate, Email: "b@mail.ru", Username: "b", Password: "b"},
+		{Op: database.BatchCreate, Email: "bad", Username: "c", Password: "c"},
+		{Op: database.BatchCreate, Email: "d@mail.ru", Username: adminUname, Password: "d"},
+		{Op: database.BatchUpdate, ID: id, Admin: &admin},
+		{Op: "rename"},
+	}})
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, body.Applied)
+
+	statuses := []int{}
+	for _, r := range body.Results {
+		statuses = append(statuses, r.Status)
+	}
+	assert.Equal(t, []int{http.StatusCreated, http.StatusCreated, http.StatusBadRequest, http.StatusConflict, http.StatusNoContent, http.StatusBadRequest}, statuses)
+
+	u, err := api.store.GetUserByName("b")
+	assert.Nil(t, err)
+	assert.Equal(t, body.Results[1].ID, u.ID)
+	assert.True(t, u.CheckPassword("b"))
+
+	u, _ = api.store.GetUserByID(id)
+	assert.True(t, u.Admin)
+	assert.True(t, u.CheckPassword(notAdminPass))
+}
+
+func TestAPI_BatchHandler_Attributes(t *testing.T) {
+	api, id := testBootstrap(t)
+	assert.Nil(t, api.store.NewAttribute(&database.AttributeDefinition{Name: "department", Type: database.AttributeString, Required: true}))
+
+	code, body := execBatch(t, api, BatchRequest{Operations: []BatchOperation{
+		{Op: database.BatchCreate, Email: "a@mail.ru", Username: "a", Password: "a", Attributes: map[string]interface{}{"department": "sales"}},
+		{Op: database.BatchCreate, Email: "b@mail.ru", Username: "b", Password: "b"},
+		{Op: database.BatchUpdate, ID: id, Attributes: map[string]interface{}{"department": "dev"}},
+		{Op: database.BatchCreate, Email: "c@mail.ru", Username: "c", Password: "c", Attributes: map[string]interface{}{"floor": 2}},
+	}})
+	assert.Equal(t, http.StatusOK, code)
+
+	statuses := []int{}
+	for _, r := range body.Results {
+		statuses = append(statuses, r.Status)
+	}
+	assert.Equal(t, []int{http.StatusCreated, http.StatusBadRequest, http.StatusNoContent, http.StatusBadRequest}, statuses)
+	assert.Contains(t, body.Results[1].Error, database.ErrAttributeRequired.Error())
+
+	u, err := api.store.GetUserByName("a")
+	assert.Nil(t, err)
+	assert.Equal(t, "sales", u.Attributes["department"])
+
+	u, _ = api.store.GetUserByID(id)
+	assert.Equal(t, "dev", u.Attributes["department"])
+}
+
+func TestAPI_BatchHandler_Atomic(t *testing.T) {
+	api, id := testBootstrap(t)
+
+	code, body := execBatch(t, api, BatchRequest{Atomic: true, Operations: []BatchOperation{
+		{Op: database.BatchCreate, Email: "a@mail.ru", Username: "a", Password: "a"},
+		{Op: database.BatchDelete, ID: id},
+		{Op: database.BatchCreate, Email: "b@mail.ru", Username: "a", Password: "b"},
+	}})
+	assert.Equal(t, http.StatusConflict, code)
+	assert.False(t, body.Applied)
+	assert.Equal(t, http.StatusFailedDependency, body.Results[0].Status)
+	assert.Equal(t, http.StatusFailedDependency, body.Results[1].Status)
+	assert.Equal(t, http.StatusConflict, body.Results[2].Status)
+
+	_, err := api.store.GetUserByName("a")
+	assert.ErrorIs(t, err, database.ErrUserNotExist)
+	_, err = api.store.GetUserByID(id)
+	assert.Nil(t, err)
+
+	code, body = execBatch(t, api, BatchRequest{Atomic: true, Operations: []BatchOperation{
+		{Op: database.BatchCreate, Email: "a@mail.ru", Username: "a", Password: "a"},
+		{Op: database.BatchCreate, Email: "bad", Username: "b", Password: "b"},
+	}})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, http.StatusFailedDependency, body.Results[0].Status)
+
+	code, body = execBatch(t, api, BatchRequest{Atomic: true, Operations: []BatchOperation{
+		{Op: database.BatchCreate, Email: "a@mail.ru", Username: "a", Password: "a"},
+		{Op: database.BatchDelete, ID: id},
+	}})
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, body.Applied)
+
+	_, err = api.store.GetUserByID(id)
+	assert.ErrorIs(t, err, database.ErrUserNotExist)
+}
+
+func TestAPI_BatchHandler_Limits(t *testing.T) {
+	api, _ := testBootstrap(t)
+	api.batch.MaxOperations = 1
+
+	code, _ := execBatch(t, api, BatchRequest{})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = execBatch(t, api, BatchRequest{Operations: make([]BatchOperation, 2)})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+}
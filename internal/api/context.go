@@ -1,8 +1,20 @@
 package api
 
-import "context"
+import (
+	"context"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+)
 
 const ContextAdminKey ContextKey = "is_admin"
+const ContextUserIDKey ContextKey = "user_id"
+const ContextActorKey ContextKey = "actor"
+const ContextTenantKey ContextKey = "tenant_id"
+const ContextPermissionsKey ContextKey = "permissions"
+
+//scimActor is the actor of the changes made by the SCIM client.
+const scimActor string = "scim"
 
 type ContextKey string
 
@@ -15,3 +27,60 @@ func isAdminUser(ctx context.Context) bool {
 
 	return isAdmin.(bool)
 }
+
+func currentUserID(ctx context.Context) uuid.UUID {
+	id := ctx.Value(ContextUserIDKey)
+
+	if id == nil {
+		return uuid.Nil
+	}
+
+	return id.(uuid.UUID)
+}
+
+//hasPermission reports whether the current user is an administrator or one of its groups grants the permission.
+func hasPermission(ctx context.Context, p database.Permission) bool {
+	if isAdminUser(ctx) {
+		return true
+	}
+
+	perms, _ := ctx.Value(ContextPermissionsKey).([]database.Permission)
+	for _, granted := range perms {
+		if granted == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+//currentTenant returns the tenant of the request, the default tenant if the request has not selected one.
+func currentTenant(ctx context.Context) uuid.UUID {
+	id, ok := ctx.Value(ContextTenantKey).(uuid.UUID)
+	if !ok {
+		return database.DefaultTenant
+	}
+
+	return id
+}
+
+//isSuperAdmin reports whether the current user is an administrator of the default tenant,
+//they manage the tenants.
+func isSuperAdmin(ctx context.Context) bool {
+	return isAdminUser(ctx) && currentTenant(ctx) == database.DefaultTenant
+}
+
+//canManageUser reports whether the current user is an administrator or the user itself.
+func canManageUser(ctx context.Context, uid uuid.UUID) bool {
+	return isAdminUser(ctx) || currentUserID(ctx) == uid
+}
+
+//actor returns who makes the request: the ID of the authenticated user or the name set by the middleware.
+func actor(ctx context.Context) string {
+	if id := currentUserID(ctx); id != uuid.Nil {
+		return id.String()
+	}
+
+	name, _ := ctx.Value(ContextActorKey).(string)
+	return name
+}
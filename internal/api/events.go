@@ -0,0 +1,208 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/MarySmirnova/api_users/internal/webhook"
+	"github.com/google/uuid"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultEventsHeartbeat time.Duration = 15 * time.Second
+	defaultEventsLogSize   int           = 1000
+
+	//subscriberBuffer is the number of events a client may lag behind before it is disconnected.
+	subscriberBuffer int = 64
+
+	//eventReset tells the client that the missed events are lost and the users must be loaded again.
+	eventReset string = "reset"
+)
+
+type loggedEvent struct {
+	ID    uint64
+	Event database.Event
+}
+
+//eventLog keeps the last user events for resuming the streams by Last-Event-ID and
+//passes new events to the connected streams.
+type eventLog struct {
+	mu     sync.Mutex
+	size   int
+	lastID uint64
+	events []loggedEvent
+	subs   map[chan loggedEvent]struct{}
+}
+
+func newEventLog(size int) *eventLog {
+	if size < 1 {
+		size = defaultEventsLogSize
+	}
+
+	return &eventLog{
+		size: size,
+		subs: make(map[chan loggedEvent]struct{}),
+	}
+}
+
+//publish is the storage listener. A stream that can not keep up is closed, the client
+//reconnects with Last-Event-ID and gets the missed events from the log.
+func (l *eventLog) publish(e database.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lastID++
+	le := loggedEvent{ID: l.lastID, Event: e}
+
+	l.events = append(l.events, le)
+	if len(l.events) > l.size {
+		l.events = l.events[len(l.events)-l.size:]
+	}
+
+	for ch := range l.subs {
+		select {
+		case ch <- le:
+		default:
+			delete(l.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+//subscribe returns the events after lastID and the channel of new events. If resume is set
+//and some events after lastID are not in the log anymore, lost is true.
+func (l *eventLog) subscribe(lastID uint64, resume bool) ([]loggedEvent, chan loggedEvent, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ch := make(chan loggedEvent, subscriberBuffer)
+	l.subs[ch] = struct{}{}
+
+	if !resume {
+		return nil, ch, false
+	}
+
+	if lastID > l.lastID {
+		//идентификаторы начинаются заново после перезапуска
+		return nil, ch, true
+	}
+
+	oldest := l.lastID - uint64(len(l.events)) + 1
+	lost := lastID+1 < oldest
+
+	backlog := make([]loggedEvent, 0)
+	for _, le := range l.events {
+		if le.ID > lastID {
+			backlog = append(backlog, le)
+		}
+	}
+
+	return backlog, ch, lost
+}
+
+func (l *eventLog) unsubscribe(ch chan loggedEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.subs[ch]; ok {
+		delete(l.subs, ch)
+		close(ch)
+	}
+}
+
+//UserEventsHandler streams user changes as Server-Sent Events. Administrators receive the events
+//of all users of their tenant, other users - only of their own profile. The Last-Event-ID header resumes the stream
+//after the given event; if the missed events are not kept anymore, the "reset" event is sent first.
+func (a *API) UserEventsHandler(w http.ResponseWriter, r *http.Request) {
+	var lastID uint64
+	header := r.Header.Get("Last-Event-ID")
+	resume := header != ""
+	if resume {
+		var err error
+		if lastID, err = strconv.ParseUint(header, 10, 64); err != nil {
+			a.writeResponseError(w, fmt.Errorf("invalid Last-Event-ID: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	//поток живет дольше, чем разрешает WriteTimeout сервера
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	backlog, ch, lost := a.events.subscribe(lastID, resume)
+	defer a.events.unsubscribe(ch)
+
+	admin := isAdminUser(r.Context())
+	uid := currentUserID(r.Context())
+	tenant := currentTenant(r.Context())
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if lost {
+		_, _ = fmt.Fprintf(w, "event: %s\ndata: {}\n\n", eventReset)
+	}
+	for _, le := range backlog {
+		if err := writeUserEvent(w, le, admin, uid, tenant); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := a.eventsHeartbeat
+	if heartbeat <= 0 {
+		heartbeat = defaultEventsHeartbeat
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case le, ok := <-ch:
+			if !ok {
+				//клиент не успевает читать, он переподключится с Last-Event-ID
+				return
+			}
+			if err := writeUserEvent(w, le, admin, uid, tenant); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+//writeUserEvent writes the event if the user may see it: administrators see the events of their tenant.
+func writeUserEvent(w http.ResponseWriter, le loggedEvent, admin bool, uid, tenant uuid.UUID) error {
+	if le.Event.User.TenantID != tenant || (!admin && le.Event.User.ID != uid) {
+		return nil
+	}
+
+	data, err := json.Marshal(webhook.NewPayload(le.Event))
+	if err != nil {
+		log.WithError(err).Error("unable to encode user event")
+		return nil
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", le.ID, le.Event.Type, data)
+	return err
+}
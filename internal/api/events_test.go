@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+//openEvents connects to the stream and returns the channel of received events.
+func openEvents(t *testing.T, srv *httptest.Server, uname, pass, lastID string) (<-chan sseEvent, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/user/events", nil)
+	req.SetBasicAuth(uname, pass)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.Nil(t, err) {
+		cancel()
+		return nil, cancel
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer resp.Body.Close()
+		defer close(events)
+
+		var e sseEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if e.Event != "" {
+					events <- e
+				}
+				e = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				e.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				e.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				e.Data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+
+	return events, cancel
+}
+
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+		return sseEvent{}
+	}
+}
+
+func TestAPI_UserEventsHandler(t *testing.T) {
+	api, id := testBootstrap(t)
+	srv := httptest.NewServer(api.httpServer.Handler)
+	defer srv.Close()
+
+	adminEvents, cancelAdmin := openEvents(t, srv, adminUname, adminPass, "")
+	userEvents, cancelUser := openEvents(t, srv, notAdminUname, notAdminPass, "")
+
+	assert.Nil(t, api.store.NewUser(&database.User{Username: "other", Email: "o@mail.ru", Password: "other"}))
+	assert.Nil(t, api.store.UpdateUser(&database.User{ID: id, Email: "me@mail.ru"}))
+
+	e := nextEvent(t, adminEvents)
+	assert.Equal(t, "1", e.ID)
+	assert.Equal(t, string(database.EventUserCreated), e.Event)
+	assert.Contains(t, e.Data, `"username":"other"`)
+	assert.NotContains(t, e.Data, "Password")
+
+	e = nextEvent(t, adminEvents)
+	assert.Equal(t, "2", e.ID)
+	assert.Equal(t, string(database.EventUserUpdated), e.Event)
+
+	e = nextEvent(t, userEvents)
+	assert.Equal(t, "2", e.ID, "Users receive only the events of their own profile")
+
+	cancelAdmin()
+	cancelUser()
+
+	assert.Eventually(t, func() bool {
+		api.events.mu.Lock()
+		defer api.events.mu.Unlock()
+		return len(api.events.subs) == 0
+	}, 5*time.Second, 10*time.Millisecond, "Streams are unsubscribed on disconnect")
+
+	resumed, cancel := openEvents(t, srv, adminUname, adminPass, "1")
+	defer cancel()
+
+	e = nextEvent(t, resumed)
+	assert.Equal(t, "2", e.ID, "The stream is resumed after Last-Event-ID")
+}
+
+func TestAPI_UserEventsHandler_Reset(t *testing.T) {
+	api, _ := testBootstrap(t)
+	api.events = newEventLog(1)
+	api.store.AddListener(api.events.publish)
+
+	srv := httptest.NewServer(api.httpServer.Handler)
+	defer srv.Close()
+
+	assert.Nil(t, api.store.NewUser(&database.User{Username: "first", Email: "f@mail.ru", Password: "first"}))
+	assert.Nil(t, api.store.NewUser(&database.User{Username: "second", Email: "s@mail.ru", Password: "second"}))
+
+	events, cancel := openEvents(t, srv, adminUname, adminPass, "0")
+	defer cancel()
+
+	assert.Equal(t, eventReset, nextEvent(t, events).Event, "The missed event is not in the log anymore")
+	assert.Equal(t, "2", nextEvent(t, events).ID)
+
+	r, _ := http.NewRequest(http.MethodGet, "/user/events", nil)
+	r.SetBasicAuth(adminUname, adminPass)
+	r.Header.Set("Last-Event-ID", "abc")
+	resp := execRequest(r, api.httpServer)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
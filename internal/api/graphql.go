@@ -0,0 +1,217 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+var ErrQueryTooDeep error = errors.New("query is too deep")
+var ErrQueryTooComplex error = errors.New("query is too complex")
+var ErrMutationNotAllowed error = errors.New("mutations are allowed only with POST")
+
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+//GraphQLHandler executes a GraphQL request. Queries can be sent with GET or POST, mutations only with POST,
+//so API keys with the read scope can only query. Requests over the depth or complexity limits are rejected
+//before execution.
+func (a *API) GraphQLHandler(w http.ResponseWriter, r *http.Request) {
+	var req GraphQLRequest
+
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				a.writeGraphQLError(w, fmt.Errorf("wrong variables: %s", err), http.StatusBadRequest)
+				return
+			}
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.writeGraphQLError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(req.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		a.writeGraphQLResult(w, &graphql.Result{Errors: gqlerrors.FormatErrors(err)}, http.StatusBadRequest)
+		return
+	}
+
+	if v := graphql.ValidateDocument(&a.graphQLSchema, doc, nil); !v.IsValid {
+		a.writeGraphQLResult(w, &graphql.Result{Errors: v.Errors}, http.StatusBadRequest)
+		return
+	}
+
+	op := findOperation(doc, req.OperationName)
+	if op == nil {
+		a.writeGraphQLError(w, fmt.Errorf("unknown operation %q", req.OperationName), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodGet && op.Operation == ast.OperationTypeMutation {
+		w.Header().Set("Allow", http.MethodPost)
+		a.writeGraphQLError(w, ErrMutationNotAllowed, http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := a.checkGraphQLLimits(doc, op, req.Variables); err != nil {
+		a.writeGraphQLError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        a.graphQLSchema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       r.Context(),
+	})
+
+	a.writeGraphQLResult(w, result, http.StatusOK)
+}
+
+func (a *API) writeGraphQLError(w http.ResponseWriter, err error, code int) {
+	a.writeGraphQLResult(w, &graphql.Result{Errors: []gqlerrors.FormattedError{gqlerrors.NewFormattedError(err.Error())}}, code)
+}
+
+func (a *API) writeGraphQLResult(w http.ResponseWriter, result *graphql.Result, code int) {
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+//findOperation returns the operation to execute, the name may be empty if the document has only one operation.
+func findOperation(doc *ast.Document, name string) *ast.OperationDefinition {
+	var found *ast.OperationDefinition
+
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			if found != nil {
+				return nil
+			}
+			found = op
+			continue
+		}
+		if op.Name != nil && op.Name.Value == name {
+			return op
+		}
+	}
+
+	return found
+}
+
+//checkGraphQLLimits measures the operation with fragments expanded. Every field costs one,
+//the cost of the selection of a field with the "first" argument is multiplied by the page size.
+//A zero limit is not checked.
+func (a *API) checkGraphQLLimits(doc *ast.Document, op *ast.OperationDefinition, variables map[string]interface{}) error {
+	m := queryMeter{
+		fragments: map[string]*ast.FragmentDefinition{},
+		variables: variables,
+	}
+	for _, def := range doc.Definitions {
+		if f, ok := def.(*ast.FragmentDefinition); ok {
+			m.fragments[f.Name.Value] = f
+		}
+	}
+
+	depth, complexity := m.measure(op.SelectionSet, map[string]bool{})
+
+	if a.graphQL.MaxDepth > 0 && depth > a.graphQL.MaxDepth {
+		return fmt.Errorf("%w: depth %d, limit %d", ErrQueryTooDeep, depth, a.graphQL.MaxDepth)
+	}
+	if a.graphQL.MaxComplexity > 0 && complexity > a.graphQL.MaxComplexity {
+		return fmt.Errorf("%w: complexity %d, limit %d", ErrQueryTooComplex, complexity, a.graphQL.MaxComplexity)
+	}
+
+	return nil
+}
+
+type queryMeter struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+//measure returns the depth and the complexity of the selection set. Visited holds the fragments
+//expanded on the current path, cycles are rejected by the validation but are skipped here too.
+func (m *queryMeter) measure(set *ast.SelectionSet, visited map[string]bool) (int, int) {
+	if set == nil {
+		return 0, 0
+	}
+
+	depth, complexity := 0, 0
+	for _, sel := range set.Selections {
+		var d, c int
+
+		switch s := sel.(type) {
+		case *ast.Field:
+			d, c = m.measure(s.SelectionSet, visited)
+			d++
+			c = 1 + c*m.multiplier(s)
+		case *ast.InlineFragment:
+			d, c = m.measure(s.SelectionSet, visited)
+		case *ast.FragmentSpread:
+			f, ok := m.fragments[s.Name.Value]
+			if !ok || visited[s.Name.Value] {
+				continue
+			}
+			visited[s.Name.Value] = true
+			d, c = m.measure(f.SelectionSet, visited)
+			delete(visited, s.Name.Value)
+		}
+
+		if d > depth {
+			depth = d
+		}
+		complexity += c
+	}
+
+	return depth, complexity
+}
+
+//multiplier returns the page size requested by the "first" argument of the field.
+func (m *queryMeter) multiplier(f *ast.Field) int {
+	for _, arg := range f.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(v.Value); err == nil && n > 0 {
+				return n
+			}
+		case *ast.Variable:
+			if n, ok := m.variables[v.Name.Value].(float64); ok && n > 0 {
+				return int(n)
+			}
+		}
+
+		return 1
+	}
+
+	if f.Name.Value == "users" {
+		return graphQLDefaultPageSize
+	}
+
+	return 1
+}
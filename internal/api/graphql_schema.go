@@ -0,0 +1,385 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	graphQLDefaultPageSize int = 20
+	graphQLMaxPageSize     int = 100
+)
+
+var errInvalidCursor error = errors.New("invalid cursor")
+
+var graphQLUserType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "User",
+	Fields: graphql.Fields{
+		"id":            &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+		"email":         &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"emailVerified": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"username":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"admin":         &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"pending":       &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"attributes": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphQLAttributeType))),
+			Description: "custom attributes sorted by name, values are written as in JSON",
+		},
+	},
+})
+
+var graphQLAttributeType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Attribute",
+	Fields: graphql.Fields{
+		"name":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"value": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+var graphQLUserConnectionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "UserConnection",
+	Fields: graphql.Fields{
+		"edges": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.NewObject(graphql.ObjectConfig{
+			Name: "UserEdge",
+			Fields: graphql.Fields{
+				"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"node":   &graphql.Field{Type: graphql.NewNonNull(graphQLUserType)},
+			},
+		}))))},
+		"pageInfo": &graphql.Field{Type: graphql.NewNonNull(graphql.NewObject(graphql.ObjectConfig{
+			Name: "PageInfo",
+			Fields: graphql.Fields{
+				"hasNextPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+				"endCursor":   &graphql.Field{Type: graphql.String},
+			},
+		}))},
+		"totalCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+	},
+})
+
+var graphQLUserFilterType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "UserFilter",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"username":      &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "part of the username, case insensitive"},
+		"email":         &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "part of the email, case insensitive"},
+		"emailVerified": &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+		"admin":         &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+		"pending":       &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+	},
+})
+
+var graphQLCreateUserInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "CreateUserInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"email":    &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"username": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"password": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"admin":    &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+	},
+})
+
+var graphQLUpdateUserInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "UpdateUserInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"email":    &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"username": &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"password": &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"admin":    &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+	},
+})
+
+//buildGraphQLSchema creates the schema with resolvers working with the store of the API.
+func (a *API) buildGraphQLSchema() graphql.Schema {
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"user": &graphql.Field{
+				Type: graphQLUserType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: a.resolveUser,
+			},
+			"userByName": &graphql.Field{
+				Type: graphQLUserType,
+				Args: graphql.FieldConfigArgument{
+					"username": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: a.resolveUserByName,
+			},
+			"users": &graphql.Field{
+				Type:        graphql.NewNonNull(graphQLUserConnectionType),
+				Description: "users sorted by username",
+				Args: graphql.FieldConfigArgument{
+					"first":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: graphQLDefaultPageSize},
+					"after":  &graphql.ArgumentConfig{Type: graphql.String},
+					"filter": &graphql.ArgumentConfig{Type: graphQLUserFilterType},
+				},
+				Resolve: a.resolveUsers,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createUser": &graphql.Field{
+				Type: graphql.NewNonNull(graphQLUserType),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphQLCreateUserInput)},
+				},
+				Resolve: a.resolveCreateUser,
+			},
+			"updateUser": &graphql.Field{
+				Type: graphql.NewNonNull(graphQLUserType),
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphQLUpdateUserInput)},
+				},
+				Resolve: a.resolveUpdateUser,
+			},
+			"deleteUser": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: a.resolveDeleteUser,
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+	if err != nil {
+		panic(fmt.Sprintf("graphql schema: %s", err))
+	}
+
+	return schema
+}
+
+func (a *API) resolveUser(p graphql.ResolveParams) (interface{}, error) {
+	uid, err := uuid.Parse(p.Args["id"].(string))
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameter passed: %s", err)
+	}
+
+	u, err := a.storeFor(p.Context).GetUserByID(uid)
+	if errors.Is(err, database.ErrUserNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return graphQLUser(u), nil
+}
+
+func (a *API) resolveUserByName(p graphql.ResolveParams) (interface{}, error) {
+	u, err := a.storeFor(p.Context).GetUserByName(p.Args["username"].(string))
+	if errors.Is(err, database.ErrUserNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return graphQLUser(u), nil
+}
+
+//resolveUsers returns a connection of users. The cursor is the encoded username of the edge.
+func (a *API) resolveUsers(p graphql.ResolveParams) (interface{}, error) {
+	first, _ := p.Args["first"].(int)
+	if first < 0 || first > graphQLMaxPageSize {
+		return nil, fmt.Errorf("first must be between 0 and %d", graphQLMaxPageSize)
+	}
+
+	after := ""
+	if cursor, ok := p.Args["after"].(string); ok {
+		name, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, errInvalidCursor
+		}
+		after = string(name)
+	}
+
+	filter, _ := p.Args["filter"].(map[string]interface{})
+
+	users := []*database.User{}
+	for _, u := range a.storeFor(p.Context).GetAllUsers() {
+		if matchUserFilter(u, filter) {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	total := len(users)
+
+	if after != "" {
+		start := sort.Search(len(users), func(i int) bool {
+			return users[i].Username > after
+		})
+		users = users[start:]
+	}
+
+	hasNext := len(users) > first
+	if hasNext {
+		users = users[:first]
+	}
+
+	edges := make([]map[string]interface{}, 0, len(users))
+	var endCursor interface{}
+	for _, u := range users {
+		cursor := base64.RawURLEncoding.EncodeToString([]byte(u.Username))
+		edges = append(edges, map[string]interface{}{"cursor": cursor, "node": graphQLUser(u)})
+		endCursor = cursor
+	}
+
+	return map[string]interface{}{
+		"edges":      edges,
+		"pageInfo":   map[string]interface{}{"hasNextPage": hasNext, "endCursor": endCursor},
+		"totalCount": total,
+	}, nil
+}
+
+func (a *API) resolveCreateUser(p graphql.ResolveParams) (interface{}, error) {
+	if !isAdminUser(p.Context) {
+		return nil, ErrPermissionsDenied
+	}
+
+	input := p.Args["input"].(map[string]interface{})
+	u := database.User{
+		Email:    input["email"].(string),
+		Username: input["username"].(string),
+		Password: input["password"].(string),
+	}
+	u.Admin, _ = input["admin"].(bool)
+
+	if err := validate.Struct(u); err != nil {
+		return nil, fmt.Errorf("invalid data passed: %s", err)
+	}
+
+	if err := a.storeFor(p.Context).NewUser(&u); err != nil {
+		return nil, err
+	}
+
+	if err := a.sendEmailVerification(&u); err != nil {
+		return nil, err
+	}
+
+	return graphQLUser(&u), nil
+}
+
+//resolveUpdateUser changes only the fields passed in the input.
+func (a *API) resolveUpdateUser(p graphql.ResolveParams) (interface{}, error) {
+	if !isAdminUser(p.Context) {
+		return nil, ErrPermissionsDenied
+	}
+
+	uid, err := uuid.Parse(p.Args["id"].(string))
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameter passed: %s", err)
+	}
+
+	old, err := a.storeFor(p.Context).GetUserByID(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	input := p.Args["input"].(map[string]interface{})
+	u := database.User{ID: uid, Admin: old.Admin}
+	u.Email, _ = input["email"].(string)
+	u.Username, _ = input["username"].(string)
+	u.Password, _ = input["password"].(string)
+	if admin, ok := input["admin"].(bool); ok {
+		u.Admin = admin
+	}
+
+	if u.Email != "" {
+		if err := validate.Var(u.Email, "email"); err != nil {
+			return nil, fmt.Errorf("invalid data passed: %s", err)
+		}
+	}
+
+	if err := a.storeFor(p.Context).UpdateUser(&u); err != nil {
+		return nil, err
+	}
+
+	if u.Email != old.Email {
+		if err := a.sendEmailVerification(&u); err != nil {
+			return nil, err
+		}
+	}
+
+	return graphQLUser(&u), nil
+}
+
+func (a *API) resolveDeleteUser(p graphql.ResolveParams) (interface{}, error) {
+	if !isAdminUser(p.Context) {
+		return nil, ErrPermissionsDenied
+	}
+
+	uid, err := uuid.Parse(p.Args["id"].(string))
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameter passed: %s", err)
+	}
+
+	if err := a.storeFor(p.Context).DeleteUser(uid); err != nil {
+		return nil, err
+	}
+
+	return true, nil
+}
+
+func matchUserFilter(u *database.User, filter map[string]interface{}) bool {
+	if name, ok := filter["username"].(string); ok && !strings.Contains(strings.ToLower(u.Username), strings.ToLower(name)) {
+		return false
+	}
+	if email, ok := filter["email"].(string); ok && !strings.Contains(strings.ToLower(u.Email), strings.ToLower(email)) {
+		return false
+	}
+	if v, ok := filter["emailVerified"].(bool); ok && u.EmailVerified != v {
+		return false
+	}
+	if v, ok := filter["admin"].(bool); ok && u.Admin != v {
+		return false
+	}
+	if v, ok := filter["pending"].(bool); ok && u.Pending != v {
+		return false
+	}
+
+	return true
+}
+
+func graphQLUser(u *database.User) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            u.ID.String(),
+		"email":         u.Email,
+		"emailVerified": u.EmailVerified,
+		"username":      u.Username,
+		"admin":         u.Admin,
+		"pending":       u.Pending,
+		"attributes":    graphQLAttributes(u),
+	}
+}
+
+func graphQLAttributes(u *database.User) []map[string]interface{} {
+	names := make([]string, 0, len(u.Attributes))
+	for name := range u.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	attrs := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		attrs = append(attrs, map[string]interface{}{"name": name, "value": fmt.Sprint(u.Attributes[name])})
+	}
+
+	return attrs
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type graphQLResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func execGraphQL(t *testing.T, api *API, username, password string, req GraphQLRequest) (int, graphQLResponse) {
+	r, _ := http.NewRequest(http.MethodPost, "/graphql", toJSON(req))
+	r.SetBasicAuth(username, password)
+
+	resp := execRequest(r, api.httpServer)
+
+	var body graphQLResponse
+	err := json.Unmarshal(resp.Body.Bytes(), &body)
+	assert.Nil(t, err)
+
+	return resp.Code, body
+}
+
+func TestAPI_GraphQLHandler_Users(t *testing.T) {
+	api, id := testBootstrap(t)
+
+	code, body := execGraphQL(t, api, notAdminUname, notAdminPass, GraphQLRequest{
+		Query: `query($first: Int) {
+			users(first: $first, filter: {username: "is"}) {
+				totalCount
+				edges { cursor node { username } }
+				pageInfo { hasNextPage endCursor }
+			}
+		}`,
+		Variables: map[string]interface{}{"first": 1},
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, body.Errors)
+
+	var page struct {
+		TotalCount int
+		Edges      []struct {
+			Cursor string
+			Node   struct{ Username string }
+		}
+		PageInfo struct {
+			HasNextPage bool
+			EndCursor   string
+		}
+	}
+	assert.Nil(t, json.Unmarshal(body.Data["users"], &page))
+	assert.Equal(t, 2, page.TotalCount)
+	assert.Equal(t, 1, len(page.Edges))
+	assert.Equal(t, adminUname, page.Edges[0].Node.Username)
+	assert.True(t, page.PageInfo.HasNextPage)
+
+	code, body = execGraphQL(t, api, notAdminUname, notAdminPass, GraphQLRequest{
+		Query:     `query($after: String) { users(after: $after) { edges { node { id username } } pageInfo { hasNextPage } } }`,
+		Variables: map[string]interface{}{"after": page.PageInfo.EndCursor},
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, string(body.Data["users"]), id.String())
+	assert.Contains(t, string(body.Data["users"]), `"hasNextPage":false`)
+
+	code, body = execGraphQL(t, api, notAdminUname, notAdminPass, GraphQLRequest{
+		Query: `{ userByName(username: "` + notAdminUname + `") { id admin } missing: userByName(username: "nobody") { id } }`,
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"id": "`+id.String()+`", "admin": false}`, string(body.Data["userByName"]))
+	assert.Equal(t, "null", string(body.Data["missing"]))
+}
+
+func TestAPI_GraphQLHandler_Mutations(t *testing.T) {
+	api, id := testBootstrap(t)
+
+	mutation := `mutation { updateUser(id: "` + id.String() + `", input: {username: "renamed"}) { username admin } }`
+
+	code, body := execGraphQL(t, api, notAdminUname, notAdminPass, GraphQLRequest{Query: mutation})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, len(body.Errors))
+	assert.Equal(t, ErrPermissionsDenied.Error(), body.Errors[0].Message)
+
+	code, body = execGraphQL(t, api, adminUname, adminPass, GraphQLRequest{Query: mutation})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, body.Errors)
+	assert.JSONEq(t, `{"username": "renamed", "admin": false}`, string(body.Data["updateUser"]))
+
+	code, body = execGraphQL(t, api, adminUname, adminPass, GraphQLRequest{
+		Query: `mutation { createUser(input: {email: "new@example.com", username: "new", password: "new"}) { id } }`,
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, body.Errors)
+
+	u, err := api.store.GetUserByName("new")
+	assert.Nil(t, err)
+
+	code, body = execGraphQL(t, api, adminUname, adminPass, GraphQLRequest{
+		Query: `mutation { deleteUser(id: "` + u.ID.String() + `") }`,
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "true", string(body.Data["deleteUser"]))
+
+	req, _ := http.NewRequest(http.MethodGet, "/graphql?query="+url.QueryEscape(mutation), nil)
+	req.SetBasicAuth(adminUname, adminPass)
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+}
+
+func TestAPI_GraphQLHandler_Limits(t *testing.T) {
+	api, _ := testBootstrap(t)
+	api.graphQL.MaxDepth = 3
+	api.graphQL.MaxComplexity = 50
+
+	code, body := execGraphQL(t, api, notAdminUname, notAdminPass, GraphQLRequest{
+		Query: `{ users { edges { node { id } } } }`,
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.True(t, strings.HasPrefix(body.Errors[0].Message, ErrQueryTooDeep.Error()))
+
+	code, body = execGraphQL(t, api, notAdminUname, notAdminPass, GraphQLRequest{
+		Query:     `query($n: Int) { users(first: $n) { edges { cursor } } }`,
+		Variables: map[string]interface{}{"n": 30},
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.True(t, strings.HasPrefix(body.Errors[0].Message, ErrQueryTooComplex.Error()))
+
+	code, _ = execGraphQL(t, api, notAdminUname, notAdminPass, GraphQLRequest{
+		Query: `{ users(first: 10) { ...page } } fragment page on UserConnection { edges { cursor } totalCount }`,
+	})
+	assert.Equal(t, http.StatusOK, code)
+
+	code, body = execGraphQL(t, api, notAdminUname, notAdminPass, GraphQLRequest{Query: `{ users { unknown } }`})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.NotEmpty(t, body.Errors)
+}
@@ -0,0 +1,285 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+//GroupRequest creates or replaces a group.
+type GroupRequest struct {
+	Name        string                `json:"name" validate:"min=1"`
+	Description string                `json:"description"`
+	Permissions []database.Permission `json:"permissions"`
+}
+
+//MemberRequest adds a user or a nested group to a group.
+type MemberRequest struct {
+	Kind database.MemberKind `json:"kind"`
+	ID   uuid.UUID           `json:"id"`
+}
+
+//decodeGroupRequest reads and validates the request, writes the error response if it fails.
+func (a *API) decodeGroupRequest(w http.ResponseWriter, r *http.Request) (*GroupRequest, bool) {
+	var req GroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.writeResponseError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
+		return nil, false
+	}
+
+	if err := validate.Struct(req); err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid data passed: %s", err), http.StatusBadRequest)
+		return nil, false
+	}
+	if req.Permissions == nil {
+		req.Permissions = []database.Permission{}
+	}
+
+	return &req, true
+}
+
+//pathID parses the path parameter, writes the error response if it fails.
+func (a *API) pathID(w http.ResponseWriter, r *http.Request, name string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(mux.Vars(r)[name])
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: %s", err), http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+
+	return id, true
+}
+
+//writeGroupError maps the storage errors of groups to the responses.
+func (a *API) writeGroupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrGroupNotExist), errors.Is(err, database.ErrUserNotExist),
+		errors.Is(err, database.ErrMemberNotExist), errors.Is(err, database.ErrGroupNameExist),
+		errors.Is(err, database.ErrUnknownPermission):
+		a.writeResponseError(w, err, http.StatusBadRequest)
+	case errors.Is(err, database.ErrGroupCycle):
+		a.writeResponseError(w, err, http.StatusConflict)
+	default:
+		a.internalError(w, err)
+	}
+}
+
+//writePage writes one page of the items with the total number in the X-Total-Count header.
+func writePage[T any](w http.ResponseWriter, items []T, p page) {
+	w.Header().Set(HeaderTotalCount, strconv.Itoa(len(items)))
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(paginate(items, p))
+}
+
+func (a *API) NewGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdminUser(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	req, ok := a.decodeGroupRequest(w, r)
+	if !ok {
+		return
+	}
+
+	g := &database.Group{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: req.Permissions,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	if err := a.storeFor(r.Context()).NewGroup(g); err != nil {
+		a.writeGroupError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(g)
+}
+
+//GetGroupsHandler returns groups sorted by name, supports the limit and offset query parameters.
+func (a *API) GetGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := parsePage(r)
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	writePage(w, a.storeFor(r.Context()).GetGroups(), p)
+}
+
+func (a *API) GetGroupHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	g, err := a.storeFor(r.Context()).GetGroup(id)
+	if err != nil {
+		a.writeGroupError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(g)
+}
+
+//ReplaceGroupHandler replaces the name, the description and the permissions of a group.
+func (a *API) ReplaceGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdminUser(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	id, ok := a.pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	req, ok := a.decodeGroupRequest(w, r)
+	if !ok {
+		return
+	}
+
+	g := &database.Group{
+		ID:          id,
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: req.Permissions,
+	}
+
+	if err := a.storeFor(r.Context()).UpdateGroup(g); err != nil {
+		a.writeGroupError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(g)
+}
+
+func (a *API) DeleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdminUser(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	id, ok := a.pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	if err := a.storeFor(r.Context()).DeleteGroup(id); err != nil {
+		a.writeGroupError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//GetGroupMembersHandler returns the direct members of a group in the order they were added,
+//supports the limit and offset query parameters.
+func (a *API) GetGroupMembersHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	p, err := parsePage(r)
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	members, err := a.storeFor(r.Context()).GetGroupMembers(id)
+	if err != nil {
+		a.writeGroupError(w, err)
+		return
+	}
+
+	writePage(w, members, p)
+}
+
+//AddGroupMemberHandler adds a user or a nested group to a group, a group can not contain itself.
+func (a *API) AddGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdminUser(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	id, ok := a.pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var req MemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.writeResponseError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	m := &database.GroupMember{GroupID: id, Kind: req.Kind, MemberID: req.ID, AddedAt: time.Now().UTC()}
+	if err := a.storeFor(r.Context()).AddGroupMember(m); err != nil {
+		a.writeGroupError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) RemoveGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdminUser(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	id, ok := a.pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	memberID, ok := a.pathID(w, r, "member_id")
+	if !ok {
+		return
+	}
+
+	if err := a.storeFor(r.Context()).RemoveGroupMember(id, memberID); err != nil {
+		a.writeGroupError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//GetUserGroupsHandler returns the groups of a user, including the groups it belongs to through nested groups.
+//It is available to administrators and to the user itself.
+func (a *API) GetUserGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	uid, ok := a.pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	if !canManageUser(r.Context(), uid) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	p, err := parsePage(r)
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	groups, err := a.storeFor(r.Context()).GetUserGroups(uid)
+	if err != nil {
+		a.writeGroupError(w, err)
+		return
+	}
+
+	writePage(w, groups, p)
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_Groups(t *testing.T) {
+	api, notAdminID := testBootstrap(t)
+
+	newGroup := func(req GroupRequest) (database.Group, int) {
+		r, _ := http.NewRequest(http.MethodPost, "/groups", toJSON(req))
+		r.SetBasicAuth(adminUname, adminPass)
+		resp := execRequest(r, api.httpServer)
+
+		var g database.Group
+		_ = json.Unmarshal(resp.Body.Bytes(), &g)
+		return g, resp.Code
+	}
+
+	addMember := func(gid uuid.UUID, m MemberRequest) int {
+		r, _ := http.NewRequest(http.MethodPost, "/groups/"+gid.String()+"/members", toJSON(m))
+		r.SetBasicAuth(adminUname, adminPass)
+		return execRequest(r, api.httpServer).Code
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/groups", toJSON(GroupRequest{Name: "ops"}))
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	_, code := newGroup(GroupRequest{Name: "ops", Permissions: []database.Permission{"root"}})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	ops, code := newGroup(GroupRequest{Name: "ops", Permissions: []database.Permission{database.PermissionWebhooks}})
+	assert.Equal(t, http.StatusCreated, code)
+	staff, code := newGroup(GroupRequest{Name: "staff"})
+	assert.Equal(t, http.StatusCreated, code)
+	_, code = newGroup(GroupRequest{Name: "staff"})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/webhooks", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	assert.Equal(t, http.StatusNoContent, addMember(staff.ID, MemberRequest{Kind: database.MemberUser, ID: notAdminID}))
+	assert.Equal(t, http.StatusNoContent, addMember(ops.ID, MemberRequest{Kind: database.MemberGroup, ID: staff.ID}))
+	assert.Equal(t, http.StatusConflict, addMember(staff.ID, MemberRequest{Kind: database.MemberGroup, ID: ops.ID}))
+	assert.Equal(t, http.StatusBadRequest, addMember(staff.ID, MemberRequest{Kind: database.MemberUser, ID: uuid.New()}))
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code, "The permission is inherited through the nested group")
+
+	req, _ = http.NewRequest(http.MethodGet, "/user/"+notAdminID.String()+"/groups?limit=1", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "2", resp.Header().Get(HeaderTotalCount))
+
+	var groups []*database.Group
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &groups))
+	assert.Equal(t, 1, len(groups))
+	assert.Equal(t, "ops", groups[0].Name)
+
+	req, _ = http.NewRequest(http.MethodGet, "/groups/"+staff.ID.String()+"/members", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var members []*database.GroupMember
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &members))
+	assert.Equal(t, 1, len(members))
+	assert.Equal(t, notAdminID, members[0].MemberID)
+
+	req, _ = http.NewRequest(http.MethodPut, "/groups/"+staff.ID.String(), toJSON(GroupRequest{Name: "staff", Permissions: []database.Permission{database.PermissionAdmin}}))
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/metrics", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code, "The admin permission of a group grants the administrator rights")
+
+	req, _ = http.NewRequest(http.MethodDelete, "/groups/"+staff.ID.String()+"/members/"+notAdminID.String(), nil)
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/webhooks", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodDelete, "/groups/"+ops.ID.String(), nil)
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/groups", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "1", resp.Header().Get(HeaderTotalCount))
+}
@@ -4,7 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/MarySmirnova/api_users/internal/database"
 	"github.com/go-playground/validator"
@@ -32,8 +36,10 @@ func (a *API) NewUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := a.store.NewUser(&u); err != nil {
-		if errors.Is(err, database.ErrNameAlreadyExist) {
+	u.EmailVerified = false
+
+	if err := a.storeFor(r.Context()).NewUser(&u); err != nil {
+		if errors.Is(err, database.ErrNameAlreadyExist) || errors.Is(err, database.ErrUnknownPasswordHash) || invalidAttributes(err) {
 			a.writeResponseError(w, err, http.StatusBadRequest)
 			return
 		}
@@ -41,12 +47,33 @@ func (a *API) NewUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := a.sendEmailVerification(&u); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(u.ID)
 }
 
+//GetUsersHandler returns users sorted by name. With the limit or offset query parameters returns one page,
+//the total number of users is passed in the X-Total-Count header. The attr.<name> parameters filter users
+//by custom attributes.
 func (a *API) GetUsersHandler(w http.ResponseWriter, r *http.Request) {
-	users := a.store.GetAllUsers()
+	users := filterByAttributes(a.storeFor(r.Context()).GetAllUsers(), r)
+
+	p, err := parsePage(r)
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	w.Header().Set(HeaderTotalCount, strconv.Itoa(len(users)))
+	users = paginate(users, p)
 
 	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(users)
@@ -60,7 +87,17 @@ func (a *API) GetUserByIDHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	u, err := a.store.GetUserByID(uid)
+	var u *database.User
+	if asOf := r.URL.Query().Get("as_of"); asOf != "" {
+		var t time.Time
+		if t, err = time.Parse(time.RFC3339, asOf); err != nil {
+			a.writeResponseError(w, fmt.Errorf("invalid parameter passed: as_of: %s", err), http.StatusBadRequest)
+			return
+		}
+		u, err = a.storeFor(r.Context()).GetUserAsOf(uid, t)
+	} else {
+		u, err = a.storeFor(r.Context()).GetUserByID(uid)
+	}
 	if err != nil {
 		a.writeResponseError(w, err, http.StatusBadRequest)
 		return
@@ -83,24 +120,52 @@ func (a *API) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	switch mediaType(r) {
+	case contentTypeMergePatch, contentTypeJSONPatch:
+		a.patchUser(w, r, uid)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+
 	var u database.User
-	err = json.NewDecoder(r.Body).Decode(&u)
+	err = json.Unmarshal(body, &u)
 	if err != nil {
 		a.writeResponseError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
 		return
 	}
 
+	old, err := a.storeFor(r.Context()).GetUserByID(uid)
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotExist) {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	//без поля Admin в запросе флаг не меняется, false в запросе снимает права администратора
+	if !hasJSONField(body, "Admin") {
+		u.Admin = old.Admin
+	}
+
 	if u.Email != "" {
 		if err := validate.Var(u.Email, "email"); err != nil {
 			a.writeResponseError(w, fmt.Errorf("invalid data passed: %s", err), http.StatusBadRequest)
+			return
 		}
 	}
 
 	u.ID = uid
 
-	err = a.store.UpdateUser(&u)
+	err = a.storeFor(r.Context()).UpdateUser(&u)
 	if err != nil {
-		if errors.Is(err, database.ErrUserNotExist) || errors.Is(err, database.ErrNameAlreadyExist) {
+		if errors.Is(err, database.ErrUserNotExist) || errors.Is(err, database.ErrNameAlreadyExist) || invalidAttributes(err) {
 			a.writeResponseError(w, err, http.StatusBadRequest)
 			return
 		}
@@ -108,6 +173,14 @@ func (a *API) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	//письмо отправляется только на новый адрес, а не при каждом изменении неподтвержденного пользователя
+	if u.Email != "" && u.Email != old.Email {
+		if err := a.sendEmailVerification(&u); err != nil {
+			a.internalError(w, err)
+			return
+		}
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -124,7 +197,7 @@ func (a *API) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = a.store.DeleteUser(uid)
+	err = a.storeFor(r.Context()).DeleteUser(uid)
 	if err != nil {
 		a.writeResponseError(w, err, http.StatusBadRequest)
 		return
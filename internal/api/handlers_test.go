@@ -44,9 +44,16 @@ func testBootstrap(t *testing.T) (*API, uuid.UUID) {
 
 	api := New(config.API{
 		Listen:       ":8080",
+		PublicURL:    "http://localhost:8080",
 		WriteTimeout: 30 * time.Second,
 		ReadTimeout:  30 * time.Second,
-	}, db)
+		Auth: config.Auth{
+			SessionTTL:           time.Hour,
+			PasswordResetTTL:     time.Hour,
+			EmailVerificationTTL: time.Hour,
+			TOTPIssuer:           "api_users_test",
+		},
+	}, NewStorage(db))
 
 	return api, user.ID
 }
@@ -136,6 +143,47 @@ func TestAPI_NewUserHandler_GoodWay(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestAPI_NewUserHandler_PasswordHashed(t *testing.T) {
+	api, _ := testBootstrap(t)
+
+	//sha1("salt" + "legacy")
+	user := database.User{
+		Email:          "legacy@mail.ru",
+		Username:       "legacy",
+		Password:       "sha1$salt$a9f84e6966ef6675c5fcffc0105ac57cbf800ca8",
+		PasswordHashed: true,
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/user", toJSON(database.User{Email: "bad@mail.ru", Username: "bad", Password: "md5$x", PasswordHashed: true}))
+	req.SetBasicAuth(adminUname, adminPass)
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/user", toJSON(user))
+	req.SetBasicAuth(adminUname, adminPass)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/user", nil)
+	req.SetBasicAuth("legacy", "wrong")
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/user", nil)
+	req.SetBasicAuth("legacy", "legacy")
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	u, err := api.store.GetUserByName("legacy")
+	assert.Nil(t, err)
+	assert.False(t, u.PasswordNeedsUpgrade(), "The password is rehashed after login")
+	assert.True(t, u.CheckPassword("legacy"))
+}
+
 func TestAPI_GetUsersHandler(t *testing.T) {
 	api, _ := testBootstrap(t)
 
@@ -156,6 +204,30 @@ func TestAPI_GetUsersHandler(t *testing.T) {
 	assert.Equal(t, wantLen, len(data))
 }
 
+func TestAPI_GetUsersHandler_Pagination(t *testing.T) {
+	api, _ := testBootstrap(t)
+
+	req, _ := http.NewRequest(http.MethodGet, "/user?limit=1&offset=1", nil)
+	req.SetBasicAuth(adminUname, adminPass)
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "2", resp.Header().Get(HeaderTotalCount))
+
+	var data []database.User
+	err := json.Unmarshal(resp.Body.Bytes(), &data)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, len(data))
+	assert.Equal(t, notAdminUname, data[0].Username)
+
+	req, _ = http.NewRequest(http.MethodGet, "/user?limit=-1", nil)
+	req.SetBasicAuth(adminUname, adminPass)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
 func TestAPI_GetUserByIDHandler_InvalidID(t *testing.T) {
 	api, _ := testBootstrap(t)
 
@@ -233,11 +305,14 @@ func TestAPI_UpdateUserHandler_InvalidEmail(t *testing.T) {
 		Email: "qwerty",
 	}
 
-	req, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("/user/{%s}", id), toJSON(user))
+	req, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("/user/%s", id), toJSON(user))
 	req.SetBasicAuth(adminUname, adminPass)
 
 	resp := execRequest(req, api.httpServer)
 	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	got, _ := api.store.GetUserByID(id)
+	assert.NotEqual(t, user.Email, got.Email, "Invalid email must not be saved")
 }
 
 func TestAPI_UpdateUserHandler_ErrUserNotExist(t *testing.T) {
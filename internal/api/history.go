@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+//RevertRequest selects the version of the user to restore.
+type RevertRequest struct {
+	Version int `json:"version"`
+}
+
+//UserHistoryHandler returns all versions of a user, the oldest first. It is available
+//to administrators and to the user itself, the history of deleted users is kept.
+func (a *API) UserHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	uid, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if !canManageUser(r.Context(), uid) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	versions := a.storeFor(r.Context()).GetUserHistory(uid)
+	if len(versions) == 0 {
+		if _, err := a.storeFor(r.Context()).GetUserByID(uid); err != nil {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(versions)
+}
+
+//RevertUserHandler restores a user to the given version, a deleted user is created again.
+func (a *API) RevertUserHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdminUser(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	uid, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var req RevertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.writeResponseError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	u, err := a.storeFor(r.Context()).RevertUser(uid, req.Version)
+	if err != nil {
+		if errors.Is(err, database.ErrVersionNotExist) || errors.Is(err, database.ErrRevertToDeleted) ||
+			errors.Is(err, database.ErrNameAlreadyExist) || invalidAttributes(err) {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(u)
+}
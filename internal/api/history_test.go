@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_UserHistory(t *testing.T) {
+	api, notAdminID := testBootstrap(t)
+	id := notAdminID.String()
+
+	admin, err := api.store.GetUserByName(adminUname)
+	assert.Nil(t, err)
+
+	before, err := api.store.GetUserByID(notAdminID)
+	assert.Nil(t, err)
+
+	req, _ := http.NewRequest(http.MethodPatch, "/user/"+id, toJSON(database.User{Email: "changed@mai.l"}))
+	req.SetBasicAuth(adminUname, adminPass)
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/user/"+admin.ID.String()+"/history", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusForbidden, resp.Code, "Only the user itself and administrators see the history")
+
+	req, _ = http.NewRequest(http.MethodGet, "/user/"+id+"/history", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var versions []database.UserVersion
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &versions))
+	if assert.Equal(t, 2, len(versions)) {
+		assert.Equal(t, database.EventUserCreated, versions[0].Event)
+		assert.Empty(t, versions[0].User.Password, "Password hashes are not returned")
+		assert.Equal(t, []string{"Email"}, versions[1].Changed)
+		assert.Equal(t, admin.ID.String(), versions[1].Actor)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/user/"+id+"?as_of=yesterday", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/user/"+id+"?as_of="+url.QueryEscape(time.Now().Add(-time.Hour).Format(time.RFC3339)), nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusBadRequest, resp.Code, "The user did not exist an hour ago")
+
+	req, _ = http.NewRequest(http.MethodGet, "/user/"+id+"?as_of="+url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339)), nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "changed@mai.l")
+	assert.NotContains(t, resp.Body.String(), before.Password)
+
+	req, _ = http.NewRequest(http.MethodPost, "/user/"+id+"/revert", toJSON(RevertRequest{Version: 1}))
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/user/"+id+"/revert", toJSON(RevertRequest{Version: 10}))
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/user/"+id+"/revert", toJSON(RevertRequest{Version: 1}))
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	u, err := api.store.GetUserByID(notAdminID)
+	assert.Nil(t, err)
+	assert.Equal(t, before.Email, u.Email)
+	assert.Equal(t, 3, len(api.store.GetUserHistory(notAdminID)), "The revert is a new version")
+}
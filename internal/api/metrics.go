@@ -0,0 +1,16 @@
+package api
+
+import (
+	"expvar"
+	"net/http"
+)
+
+//MetricsHandler returns the variables published by expvar, such as the gRPC call counters. Available only to administrators.
+func (a *API) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdminUser(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	expvar.Handler().ServeHTTP(w, r)
+}
@@ -0,0 +1,836 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	oauthSecretLen int = 32
+	oauthCodeLen   int = 32
+	oauthTokenLen  int = 32
+
+	pkceMethodS256     string = "S256"
+	pkceVerifierMinLen int    = 43
+	pkceVerifierMaxLen int    = 128
+)
+
+//OAuth 2.0 error codes, RFC 6749 section 4.1.2.1 and 5.2.
+const (
+	oauthInvalidRequest          string = "invalid_request"
+	oauthInvalidClient           string = "invalid_client"
+	oauthInvalidGrant            string = "invalid_grant"
+	oauthInvalidScope            string = "invalid_scope"
+	oauthUnauthorizedClient      string = "unauthorized_client"
+	oauthUnsupportedGrantType    string = "unsupported_grant_type"
+	oauthUnsupportedResponseType string = "unsupported_response_type"
+)
+
+var ErrInvalidClient error = errors.New("client authentication failed")
+var ErrInvalidRedirectURI error = errors.New("redirect URIs must be absolute URLs without a fragment")
+var ErrUnknownGrantType error = errors.New("unknown grant type")
+
+//oauthScopes are the scopes clients may request. The read and write scopes restrict
+//the requests made with the access tokens like the scopes of API keys, the OpenID Connect scopes
+//select the claims of the ID tokens and the userinfo endpoint.
+var oauthScopes = map[string]bool{
+	ScopeRead:    true,
+	ScopeWrite:   true,
+	ScopeOpenID:  true,
+	ScopeProfile: true,
+	ScopeEmail:   true,
+}
+
+var oauthGrants = map[string]bool{
+	database.GrantAuthorizationCode: true,
+	database.GrantRefreshToken:      true,
+	database.GrantClientCredentials: true,
+}
+
+//OAuthClientRequest registers a client. Without grant types the client gets the authorization code
+//and the refresh token grants. Public clients get no secret and can not use the client credentials grant.
+type OAuthClientRequest struct {
+	Name         string   `json:"name" validate:"min=1"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+}
+
+//OAuthClientResponse describes a client, the secret is returned only on registration.
+type OAuthClientResponse struct {
+	*database.OAuthClient
+	Public bool   `json:"public"`
+	Secret string `json:"client_secret,omitempty"`
+}
+
+//TokenRequest documents the form fields of the token endpoint, the fields used depend on the grant type.
+type TokenRequest struct {
+	GrantType    string `json:"grant_type"`
+	Code         string `json:"code"`
+	RedirectURI  string `json:"redirect_uri"`
+	CodeVerifier string `json:"code_verifier"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+//TokenActionRequest documents the form fields of the revocation and the introspection endpoints.
+type TokenActionRequest struct {
+	Token         string `json:"token"`
+	TokenTypeHint string `json:"token_type_hint"`
+	ClientID      string `json:"client_id"`
+	ClientSecret  string `json:"client_secret"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+	//IDToken is the OpenID Connect ID token, it is issued for the openid scope.
+	IDToken string `json:"id_token,omitempty"`
+}
+
+//IntrospectionResponse is the state of a token, RFC 7662. Inactive tokens have only the active field.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+}
+
+//OAuthError is the error response of the OAuth endpoints, RFC 6749 section 5.2.
+type OAuthError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (req OAuthClientRequest) validate() error {
+	if err := validate.Struct(req); err != nil {
+		return err
+	}
+
+	for _, g := range req.GrantTypes {
+		if !oauthGrants[g] {
+			return fmt.Errorf("%w: %s", ErrUnknownGrantType, g)
+		}
+		if g == database.GrantClientCredentials && req.Public {
+			return errors.New("public clients can not use the client credentials grant")
+		}
+	}
+
+	for _, g := range req.GrantTypes {
+		if g == database.GrantAuthorizationCode && len(req.RedirectURIs) == 0 {
+			return errors.New("the authorization code grant needs redirect URIs")
+		}
+	}
+	for _, uri := range req.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return ErrInvalidRedirectURI
+		}
+	}
+
+	if len(req.Scopes) == 0 {
+		return errors.New("scopes are required")
+	}
+	for _, s := range req.Scopes {
+		if !oauthScopes[s] {
+			return fmt.Errorf("%w: %s", ErrUnknownScope, s)
+		}
+	}
+
+	return nil
+}
+
+func oauthClientResponse(c *database.OAuthClient) *OAuthClientResponse {
+	return &OAuthClientResponse{OAuthClient: c, Public: c.IsPublic()}
+}
+
+//writeOAuthClientError maps the storage errors of clients to the responses.
+func (a *API) writeOAuthClientError(w http.ResponseWriter, err error) {
+	if errors.Is(err, database.ErrOAuthClientNotExist) {
+		a.writeResponseError(w, err, http.StatusNotFound)
+		return
+	}
+
+	a.internalError(w, err)
+}
+
+//NewOAuthClientHandler registers a client of the tenant, the secret of a confidential client is returned only once.
+func (a *API) NewOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdminUser(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	var req OAuthClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.writeResponseError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if req.GrantTypes == nil {
+		req.GrantTypes = []string{database.GrantAuthorizationCode, database.GrantRefreshToken}
+	}
+	if req.RedirectURIs == nil {
+		req.RedirectURIs = []string{}
+	}
+	if err := req.validate(); err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid data passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	c := &database.OAuthClient{
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		GrantTypes:   req.GrantTypes,
+		Scopes:       req.Scopes,
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	secret := ""
+	if !req.Public {
+		var err error
+		if secret, err = randomToken(oauthSecretLen); err != nil {
+			a.internalError(w, err)
+			return
+		}
+		c.SecretHash = database.HashSecret(secret)
+	}
+
+	if err := a.storeFor(r.Context()).NewOAuthClient(c); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	resp := oauthClientResponse(c)
+	resp.Secret = secret
+
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+//GetOAuthClientsHandler returns the clients of the tenant, supports the limit and offset query parameters.
+func (a *API) GetOAuthClientsHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdminUser(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	p, err := parsePage(r)
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	clients := a.storeFor(r.Context()).GetOAuthClients()
+	resp := make([]*OAuthClientResponse, 0, len(clients))
+	for _, c := range clients {
+		resp = append(resp, oauthClientResponse(c))
+	}
+
+	writePage(w, resp, p)
+}
+
+func (a *API) GetOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdminUser(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	id, ok := a.pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	c, err := a.storeFor(r.Context()).GetOAuthClient(id)
+	if err != nil {
+		a.writeOAuthClientError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(oauthClientResponse(c))
+}
+
+//DeleteOAuthClientHandler deletes a client, its tokens are revoked.
+func (a *API) DeleteOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdminUser(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	id, ok := a.pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	if err := a.storeFor(r.Context()).DeleteOAuthClient(id); err != nil {
+		a.writeOAuthClientError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//writeOAuthError writes the error response of the token, revocation and introspection endpoints.
+func (a *API) writeOAuthError(w http.ResponseWriter, code int, errCode, description string) {
+	log.WithField("error", errCode).Error("oauth error: " + description)
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth", charset="UTF-8"`)
+	}
+	writeOAuthJSON(w, code, OAuthError{Error: errCode, Description: description})
+}
+
+//writeOAuthJSON writes the response, the responses of the OAuth endpoints must not be cached.
+func writeOAuthJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+//authenticateClient finds the client by the basic credentials or by the client_id and client_secret
+//form fields. Public clients pass only client_id. The form must be parsed.
+func (a *API) authenticateClient(s Storage, r *http.Request) (*database.OAuthClient, error) {
+	id, secret, basic := r.BasicAuth()
+	if basic {
+		//RFC 6749, 2.3.1: the credentials are form-encoded before they are put to the header
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	cid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrInvalidClient
+	}
+
+	c, err := s.GetOAuthClient(cid)
+	if err != nil {
+		if errors.Is(err, database.ErrOAuthClientNotExist) {
+			return nil, ErrInvalidClient
+		}
+		return nil, err
+	}
+
+	if c.IsPublic() {
+		if secret != "" {
+			return nil, ErrInvalidClient
+		}
+		return c, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(database.HashSecret(secret)), []byte(c.SecretHash)) != 1 {
+		return nil, ErrInvalidClient
+	}
+
+	return c, nil
+}
+
+//requestedScopes parses the space-separated scope parameter, the allowed scopes are granted if it is empty.
+func requestedScopes(scope string, allowed []string) ([]string, bool) {
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return allowed, true
+	}
+
+	for _, s := range requested {
+		if !hasScope(allowed, s) {
+			return nil, false
+		}
+	}
+
+	return requested, true
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+//verifyPKCE checks the code verifier against the S256 challenge, RFC 7636 section 4.6.
+func verifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < pkceVerifierMinLen || len(verifier) > pkceVerifierMaxLen {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+//AuthorizeHandler issues an authorization code to the client on behalf of the user and redirects
+//the user agent back to the client. PKCE with the S256 method is required from all clients.
+//The user is authenticated by the credentials of the request, by the session of a previous login
+//or by the login page, POST submits its form. Errors are reported to the client by the redirect,
+//unless the client or the redirect URI is invalid.
+func (a *API) AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			a.writeOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, err.Error())
+			return
+		}
+		params = r.PostForm
+	}
+
+	store := a.storeFor(r.Context())
+
+	cid, err := uuid.Parse(params.Get("client_id"))
+	if err != nil {
+		a.writeOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, "client_id is invalid")
+		return
+	}
+
+	client, err := store.GetOAuthClient(cid)
+	if err != nil {
+		if errors.Is(err, database.ErrOAuthClientNotExist) {
+			a.writeOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, err.Error())
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	redirectURI := params.Get("redirect_uri")
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !client.HasRedirectURI(redirectURI) {
+		a.writeOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, "redirect_uri is not registered for the client")
+		return
+	}
+
+	redirect := func(values url.Values) {
+		if state := params.Get("state"); state != "" {
+			values.Set("state", state)
+		}
+		u, _ := url.Parse(redirectURI)
+		query := u.Query()
+		for k, v := range values {
+			query[k] = v
+		}
+		u.RawQuery = query.Encode()
+		http.Redirect(w, r, u.String(), http.StatusFound)
+	}
+	fail := func(errCode, description string) {
+		redirect(url.Values{"error": {errCode}, "error_description": {description}})
+	}
+
+	if params.Get("response_type") != "code" {
+		fail(oauthUnsupportedResponseType, "only the code response type is supported")
+		return
+	}
+	if !client.AllowsGrant(database.GrantAuthorizationCode) {
+		fail(oauthUnauthorizedClient, "the client can not use the authorization code grant")
+		return
+	}
+
+	scopes, ok := requestedScopes(params.Get("scope"), client.Scopes)
+	if !ok {
+		fail(oauthInvalidScope, "the scope is not allowed for the client")
+		return
+	}
+
+	challenge := params.Get("code_challenge")
+	if challenge == "" || params.Get("code_challenge_method") != pkceMethodS256 {
+		fail(oauthInvalidRequest, "PKCE with the S256 method is required")
+		return
+	}
+
+	user, ok := a.authorizingUser(w, r, params, client, fail)
+	if !ok {
+		return
+	}
+
+	code, err := randomToken(oauthCodeLen)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	err = store.NewOAuthCode(&database.OAuthCode{
+		CodeHash:            database.HashSecret(code),
+		ClientID:            client.ID,
+		UserID:              user.ID,
+		RedirectURI:         redirectURI,
+		RedirectURIRequired: params.Get("redirect_uri") != "",
+		Scopes:              scopes,
+		CodeChallenge:       challenge,
+		CodeChallengeMethod: pkceMethodS256,
+		Nonce:               params.Get("nonce"),
+		ExpiresAt:           time.Now().Add(a.oauth.OAuthCodeTTL),
+	})
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	redirect(url.Values{"code": {code}})
+}
+
+//TokenHandler issues tokens for the authorization code, the refresh token and the client credentials grants.
+func (a *API) TokenHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.writeOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, err.Error())
+		return
+	}
+
+	store := a.storeFor(r.Context())
+	client, err := a.authenticateClient(store, r)
+	if err != nil {
+		if errors.Is(err, ErrInvalidClient) {
+			a.writeOAuthError(w, http.StatusUnauthorized, oauthInvalidClient, err.Error())
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	grant := r.PostForm.Get("grant_type")
+	if !oauthGrants[grant] {
+		a.writeOAuthError(w, http.StatusBadRequest, oauthUnsupportedGrantType, fmt.Sprintf("%s: %q", ErrUnknownGrantType, grant))
+		return
+	}
+	if !client.AllowsGrant(grant) || (grant == database.GrantClientCredentials && client.IsPublic()) {
+		a.writeOAuthError(w, http.StatusBadRequest, oauthUnauthorizedClient, "the client can not use the "+grant+" grant")
+		return
+	}
+
+	switch grant {
+	case database.GrantAuthorizationCode:
+		a.exchangeCode(w, r, store, client)
+	case database.GrantRefreshToken:
+		a.refreshToken(w, r, store, client)
+	case database.GrantClientCredentials:
+		scopes, ok := requestedScopes(r.PostForm.Get("scope"), client.Scopes)
+		if !ok {
+			a.writeOAuthError(w, http.StatusBadRequest, oauthInvalidScope, "the scope is not allowed for the client")
+			return
+		}
+		//RFC 6749, 4.4.3: refresh tokens are not issued to clients acting on their own behalf
+		a.issueTokens(w, r, store, tokenGrant{client: client, scopes: scopes, grantID: uuid.New()})
+	}
+}
+
+func (a *API) exchangeCode(w http.ResponseWriter, r *http.Request, store Storage, client *database.OAuthClient) {
+	code, err := store.ConsumeOAuthCode(r.PostForm.Get("code"), client.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrOAuthCodeNotExist) {
+			a.writeOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, err.Error())
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	if redirectURI := r.PostForm.Get("redirect_uri"); (code.RedirectURIRequired || redirectURI != "") && redirectURI != code.RedirectURI {
+		a.writeOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, "redirect_uri does not match the authorization request")
+		return
+	}
+	if !verifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		a.writeOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, "code_verifier does not match the code challenge")
+		return
+	}
+
+	if !a.userMayAuthorize(w, store, code.UserID) {
+		return
+	}
+
+	a.issueTokens(w, r, store, tokenGrant{
+		client:  client,
+		userID:  code.UserID,
+		scopes:  code.Scopes,
+		grantID: uuid.New(),
+		refresh: client.AllowsGrant(database.GrantRefreshToken),
+		nonce:   code.Nonce,
+	})
+}
+
+//refreshToken exchanges a refresh token for new tokens. Refresh tokens are rotated: the used one is revoked
+//and a new one is issued for the same grant.
+func (a *API) refreshToken(w http.ResponseWriter, r *http.Request, store Storage, client *database.OAuthClient) {
+	refresh := r.PostForm.Get("refresh_token")
+	t, err := store.GetOAuthToken(refresh)
+	if err != nil && !errors.Is(err, database.ErrOAuthTokenNotExist) {
+		a.internalError(w, err)
+		return
+	}
+	if err != nil || t.Kind != database.OAuthRefreshToken || t.ClientID != client.ID {
+		a.writeOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, database.ErrOAuthTokenNotExist.Error())
+		return
+	}
+
+	scopes, ok := requestedScopes(r.PostForm.Get("scope"), t.Scopes)
+	if !ok {
+		a.writeOAuthError(w, http.StatusBadRequest, oauthInvalidScope, "the scope exceeds the scope of the grant")
+		return
+	}
+
+	if err := store.DeleteOAuthToken(refresh); err != nil {
+		if errors.Is(err, database.ErrOAuthTokenNotExist) {
+			a.writeOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, err.Error())
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	if !a.userMayAuthorize(w, store, t.UserID) {
+		return
+	}
+
+	a.issueTokens(w, r, store, tokenGrant{client: client, userID: t.UserID, scopes: scopes, grantID: t.GrantID, refresh: true})
+}
+
+//userMayAuthorize checks that the user still exists and is not waiting for approval,
+//writes the error response if not.
+func (a *API) userMayAuthorize(w http.ResponseWriter, store Storage, uid uuid.UUID) bool {
+	user, err := store.GetUserByID(uid)
+	if err != nil && !errors.Is(err, database.ErrUserNotExist) {
+		a.internalError(w, err)
+		return false
+	}
+	if err != nil || user.Pending {
+		a.writeOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, "the user can not be authorized")
+		return false
+	}
+
+	return true
+}
+
+//tokenGrant describes the tokens to issue. The tokens of a user with the openid scope come with an ID token.
+type tokenGrant struct {
+	client  *database.OAuthClient
+	userID  uuid.UUID
+	scopes  []string
+	grantID uuid.UUID
+	refresh bool
+	//nonce is the nonce of the authorization request, it is put to the ID token
+	nonce string
+}
+
+//issueTokens saves and writes an access token and, if asked, a refresh token of the grant.
+func (a *API) issueTokens(w http.ResponseWriter, r *http.Request, store Storage, g tokenGrant) {
+	now := time.Now().UTC()
+	resp := TokenResponse{
+		TokenType: "Bearer",
+		ExpiresIn: int64(a.oauth.OAuthAccessTokenTTL.Seconds()),
+		Scope:     strings.Join(g.scopes, " "),
+	}
+
+	newToken := func(kind database.OAuthTokenKind, ttl time.Duration) (string, *database.OAuthToken, error) {
+		token, err := randomToken(oauthTokenLen)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return token, &database.OAuthToken{
+			TokenHash: database.HashSecret(token),
+			Kind:      kind,
+			GrantID:   g.grantID,
+			ClientID:  g.client.ID,
+			UserID:    g.userID,
+			Scopes:    g.scopes,
+			IssuedAt:  now,
+			ExpiresAt: now.Add(ttl),
+		}, nil
+	}
+
+	var access *database.OAuthToken
+	var err error
+	resp.AccessToken, access, err = newToken(database.OAuthAccessToken, a.oauth.OAuthAccessTokenTTL)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	tokens := []*database.OAuthToken{access}
+
+	if g.refresh {
+		var refresh *database.OAuthToken
+		resp.RefreshToken, refresh, err = newToken(database.OAuthRefreshToken, a.oauth.OAuthRefreshTokenTTL)
+		if err != nil {
+			a.internalError(w, err)
+			return
+		}
+		tokens = append(tokens, refresh)
+	}
+
+	if g.userID != uuid.Nil && hasScope(g.scopes, ScopeOpenID) {
+		resp.IDToken, err = a.idToken(r.Context(), store, g, resp.AccessToken, now)
+		if err != nil {
+			if errors.Is(err, database.ErrUserNotExist) {
+				a.writeOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, err.Error())
+				return
+			}
+			a.internalError(w, err)
+			return
+		}
+	}
+
+	if err := store.NewOAuthTokens(tokens...); err != nil {
+		if errors.Is(err, database.ErrUserNotExist) || errors.Is(err, database.ErrOAuthClientNotExist) {
+			a.writeOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, err.Error())
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	writeOAuthJSON(w, http.StatusOK, resp)
+}
+
+//RevokeHandler revokes a token of the client, RFC 7009. Revoking a refresh token revokes all tokens of its grant.
+//Unknown tokens and tokens of other clients are ignored, the response is the same.
+func (a *API) RevokeHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.writeOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, err.Error())
+		return
+	}
+
+	store := a.storeFor(r.Context())
+	client, err := a.authenticateClient(store, r)
+	if err != nil {
+		if errors.Is(err, ErrInvalidClient) {
+			a.writeOAuthError(w, http.StatusUnauthorized, oauthInvalidClient, err.Error())
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		a.writeOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, "token is required")
+		return
+	}
+
+	t, err := store.GetOAuthToken(token)
+	switch {
+	case errors.Is(err, database.ErrOAuthTokenNotExist):
+	case err != nil:
+		a.internalError(w, err)
+		return
+	case t.ClientID != client.ID:
+	case t.Kind == database.OAuthRefreshToken:
+		err = store.RevokeOAuthGrant(t.GrantID)
+	default:
+		err = store.DeleteOAuthToken(token)
+	}
+	if err != nil && !errors.Is(err, database.ErrOAuthTokenNotExist) {
+		a.internalError(w, err)
+		return
+	}
+
+	writeOAuthJSON(w, http.StatusOK, struct{}{})
+}
+
+//IntrospectHandler returns the state of a token of the tenant, RFC 7662. Only confidential clients,
+//e.g. resource servers, may introspect tokens, including the tokens issued to other clients.
+func (a *API) IntrospectHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.writeOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, err.Error())
+		return
+	}
+
+	store := a.storeFor(r.Context())
+	client, err := a.authenticateClient(store, r)
+	if err == nil && client.IsPublic() {
+		err = ErrInvalidClient
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidClient) {
+			a.writeOAuthError(w, http.StatusUnauthorized, oauthInvalidClient, err.Error())
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	t, err := store.GetOAuthToken(r.PostForm.Get("token"))
+	if err != nil {
+		if errors.Is(err, database.ErrOAuthTokenNotExist) {
+			writeOAuthJSON(w, http.StatusOK, IntrospectionResponse{Active: false})
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	resp := IntrospectionResponse{
+		Active:    true,
+		Scope:     strings.Join(t.Scopes, " "),
+		ClientID:  t.ClientID.String(),
+		TokenType: "Bearer",
+		Exp:       t.ExpiresAt.Unix(),
+		Iat:       t.IssuedAt.Unix(),
+		Sub:       t.ClientID.String(),
+	}
+	if t.Kind == database.OAuthRefreshToken {
+		resp.TokenType = string(database.OAuthRefreshToken)
+	}
+
+	if t.UserID != uuid.Nil {
+		user, err := store.GetUserByID(t.UserID)
+		if err != nil {
+			if errors.Is(err, database.ErrUserNotExist) {
+				writeOAuthJSON(w, http.StatusOK, IntrospectionResponse{Active: false})
+				return
+			}
+			a.internalError(w, err)
+			return
+		}
+		resp.Sub = user.ID.String()
+		resp.Username = user.Username
+	}
+
+	writeOAuthJSON(w, http.StatusOK, resp)
+}
+
+//authenticateOAuthToken finds the user of an OAuth access token, the scopes of the token restrict the requests.
+//Tokens of the client credentials grant have no user and can not be used for the API.
+func (a *API) authenticateOAuthToken(s Storage, token string) (*database.User, []string, error) {
+	t, err := s.GetOAuthToken(token)
+	if err != nil {
+		if errors.Is(err, database.ErrOAuthTokenNotExist) {
+			return nil, nil, ErrUnauthorized
+		}
+		return nil, nil, err
+	}
+
+	if t.Kind != database.OAuthAccessToken || t.UserID == uuid.Nil {
+		return nil, nil, ErrUnauthorized
+	}
+
+	user, err := a.userByID(s, t.UserID)
+	return user, t.Scopes, err
+}
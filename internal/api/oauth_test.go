@@ -0,0 +1,274 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/config"
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/MarySmirnova/api_users/internal/oidc"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRedirectURI string = "https://app.example.com/callback"
+
+func testOAuth(t *testing.T) *API {
+	api, _ := testBootstrap(t)
+	api.oauth = config.OAuth{OAuthCodeTTL: time.Minute, OAuthAccessTokenTTL: time.Hour, OAuthRefreshTokenTTL: 24 * time.Hour}
+	api.openID = config.OIDC{OIDCIDTokenTTL: time.Hour, OIDCKeyRetention: time.Hour}
+	api.keys = oidc.NewKeys(api.store, 0, time.Hour)
+
+	return api
+}
+
+func newOAuthClient(t *testing.T, api *API, req OAuthClientRequest) OAuthClientResponse {
+	r, _ := http.NewRequest(http.MethodPost, "/oauth/clients", toJSON(req))
+	r.SetBasicAuth(adminUname, adminPass)
+	resp := execRequest(r, api.httpServer)
+	assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+	var c OAuthClientResponse
+	_ = json.Unmarshal(resp.Body.Bytes(), &c)
+	return c
+}
+
+func postForm(api *API, path string, form url.Values, clientID, secret string) (int, map[string]interface{}) {
+	r, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		r.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(secret))
+	}
+	resp := execRequest(r, api.httpServer)
+
+	body := map[string]interface{}{}
+	_ = json.Unmarshal(resp.Body.Bytes(), &body)
+	return resp.Code, body
+}
+
+//authorize runs the authorization request as the user and returns the redirect location.
+func authorize(api *API, query url.Values, uname, pass string) (int, *url.URL) {
+	r, _ := http.NewRequest(http.MethodGet, "/oauth/authorize?"+query.Encode(), nil)
+	r.SetBasicAuth(uname, pass)
+	resp := execRequest(r, api.httpServer)
+
+	location, _ := url.Parse(resp.Header().Get("Location"))
+	return resp.Code, location
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestAPI_OAuthClients(t *testing.T) {
+	api := testOAuth(t)
+
+	r, _ := http.NewRequest(http.MethodPost, "/oauth/clients", toJSON(OAuthClientRequest{Name: "app", RedirectURIs: []string{testRedirectURI}, Scopes: []string{ScopeRead}}))
+	r.SetBasicAuth(notAdminUname, notAdminPass)
+	assert.Equal(t, http.StatusForbidden, execRequest(r, api.httpServer).Code)
+
+	for _, req := range []OAuthClientRequest{
+		{Name: "app", Scopes: []string{ScopeRead}},
+		{Name: "app", RedirectURIs: []string{"/callback"}, Scopes: []string{ScopeRead}},
+		{Name: "app", RedirectURIs: []string{testRedirectURI + "#top"}, Scopes: []string{ScopeRead}},
+		{Name: "app", RedirectURIs: []string{testRedirectURI}},
+		{Name: "app", RedirectURIs: []string{testRedirectURI}, Scopes: []string{"admin"}},
+		{Name: "app", GrantTypes: []string{"password"}, Scopes: []string{ScopeRead}},
+		{Name: "app", GrantTypes: []string{database.GrantClientCredentials}, Scopes: []string{ScopeRead}, Public: true},
+	} {
+		r, _ := http.NewRequest(http.MethodPost, "/oauth/clients", toJSON(req))
+		r.SetBasicAuth(adminUname, adminPass)
+		assert.Equal(t, http.StatusBadRequest, execRequest(r, api.httpServer).Code, req)
+	}
+
+	confidential := newOAuthClient(t, api, OAuthClientRequest{Name: "app", RedirectURIs: []string{testRedirectURI}, Scopes: []string{ScopeRead}})
+	assert.NotEmpty(t, confidential.Secret)
+	assert.False(t, confidential.Public)
+	assert.Equal(t, []string{database.GrantAuthorizationCode, database.GrantRefreshToken}, confidential.GrantTypes)
+
+	public := newOAuthClient(t, api, OAuthClientRequest{Name: "spa", RedirectURIs: []string{testRedirectURI}, Scopes: []string{ScopeRead}, Public: true})
+	assert.Empty(t, public.Secret)
+	assert.True(t, public.Public)
+
+	r, _ = http.NewRequest(http.MethodGet, "/oauth/clients", nil)
+	r.SetBasicAuth(adminUname, adminPass)
+	resp := execRequest(r, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "2", resp.Header().Get(HeaderTotalCount))
+	assert.NotContains(t, resp.Body.String(), confidential.Secret, "The secret is returned only on registration")
+
+	r, _ = http.NewRequest(http.MethodDelete, "/oauth/clients/"+public.ID.String(), nil)
+	r.SetBasicAuth(adminUname, adminPass)
+	assert.Equal(t, http.StatusNoContent, execRequest(r, api.httpServer).Code)
+
+	r, _ = http.NewRequest(http.MethodGet, "/oauth/clients/"+public.ID.String(), nil)
+	r.SetBasicAuth(adminUname, adminPass)
+	assert.Equal(t, http.StatusNotFound, execRequest(r, api.httpServer).Code)
+}
+
+func TestAPI_OAuthAuthorizationCode(t *testing.T) {
+	api := testOAuth(t)
+	client := newOAuthClient(t, api, OAuthClientRequest{Name: "spa", RedirectURIs: []string{testRedirectURI}, Scopes: []string{ScopeRead, ScopeWrite}, Public: true})
+
+	verifier := strings.Repeat("v", 50)
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ID.String()},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {ScopeRead},
+		"state":                 {"xyz"},
+		"code_challenge":        {pkceChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	code, _ := authorize(api, query, notAdminUname, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, code, "The user must authenticate")
+
+	bad := url.Values{}
+	for k, v := range query {
+		bad[k] = v
+	}
+	bad.Set("redirect_uri", "https://evil.example.com/")
+	code, _ = authorize(api, bad, notAdminUname, notAdminPass)
+	assert.Equal(t, http.StatusBadRequest, code, "Unregistered redirect URIs are not followed")
+
+	bad.Set("redirect_uri", testRedirectURI)
+	bad.Del("code_challenge")
+	code, location := authorize(api, bad, notAdminUname, notAdminPass)
+	assert.Equal(t, http.StatusFound, code)
+	assert.Equal(t, oauthInvalidRequest, location.Query().Get("error"), "PKCE is required")
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+
+	code, location = authorize(api, query, notAdminUname, notAdminPass)
+	assert.Equal(t, http.StatusFound, code)
+	assert.Equal(t, "app.example.com", location.Host)
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+	authCode := location.Query().Get("code")
+	assert.NotEmpty(t, authCode)
+
+	exchange := url.Values{
+		"grant_type":    {database.GrantAuthorizationCode},
+		"code":          {authCode},
+		"redirect_uri":  {testRedirectURI},
+		"client_id":     {client.ID.String()},
+		"code_verifier": {strings.Repeat("w", 50)},
+	}
+	status, body := postForm(api, "/oauth/token", exchange, "", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, oauthInvalidGrant, body["error"], "The verifier must match the challenge")
+
+	other := newOAuthClient(t, api, OAuthClientRequest{Name: "other", RedirectURIs: []string{testRedirectURI}, Scopes: []string{ScopeRead}, Public: true})
+
+	_, location = authorize(api, query, notAdminUname, notAdminPass)
+	exchange.Set("code", location.Query().Get("code"))
+	exchange.Set("code_verifier", verifier)
+	exchange.Set("client_id", other.ID.String())
+	status, body = postForm(api, "/oauth/token", exchange, "", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, oauthInvalidGrant, body["error"], "The code is bound to the client")
+
+	exchange.Set("client_id", client.ID.String())
+	exchange.Del("redirect_uri")
+	status, body = postForm(api, "/oauth/token", exchange, "", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, oauthInvalidGrant, body["error"], "redirect_uri is required if the authorization request included it")
+
+	_, location = authorize(api, query, notAdminUname, notAdminPass)
+	exchange.Set("code", location.Query().Get("code"))
+	exchange.Set("client_id", other.ID.String())
+	status, _ = postForm(api, "/oauth/token", exchange, "", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	exchange.Set("client_id", client.ID.String())
+	exchange.Set("redirect_uri", testRedirectURI)
+	status, body = postForm(api, "/oauth/token", exchange, "", "")
+	assert.Equal(t, http.StatusOK, status, "Another client can not burn the code: %v", body)
+	assert.Equal(t, "Bearer", body["token_type"])
+	assert.Equal(t, ScopeRead, body["scope"])
+	access, _ := body["access_token"].(string)
+	refresh, _ := body["refresh_token"].(string)
+	assert.NotEmpty(t, access)
+	assert.NotEmpty(t, refresh)
+
+	status, body = postForm(api, "/oauth/token", exchange, "", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, oauthInvalidGrant, body["error"], "Codes are single-use")
+
+	req, _ := http.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set("Authorization", "Bearer "+access)
+	assert.Equal(t, http.StatusOK, execRequest(req, api.httpServer).Code, "Access tokens authenticate API requests")
+
+	req, _ = http.NewRequest(http.MethodPost, "/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+access)
+	assert.Equal(t, http.StatusForbidden, execRequest(req, api.httpServer).Code, "The read scope does not allow changes")
+
+	refreshForm := url.Values{"grant_type": {database.GrantRefreshToken}, "refresh_token": {refresh}, "client_id": {client.ID.String()}}
+	status, body = postForm(api, "/oauth/token", refreshForm, "", "")
+	assert.Equal(t, http.StatusOK, status, body)
+	rotated, _ := body["refresh_token"].(string)
+	assert.NotEqual(t, refresh, rotated)
+
+	status, body = postForm(api, "/oauth/token", refreshForm, "", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, oauthInvalidGrant, body["error"], "Refresh tokens are rotated")
+
+	refreshForm.Set("refresh_token", rotated)
+	refreshForm.Set("scope", ScopeWrite)
+	status, body = postForm(api, "/oauth/token", refreshForm, "", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, oauthInvalidScope, body["error"], "The scope can not grow on refresh")
+
+	status, _ = postForm(api, "/oauth/revoke", url.Values{"token": {rotated}, "client_id": {client.ID.String()}}, "", "")
+	assert.Equal(t, http.StatusOK, status)
+
+	req, _ = http.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set("Authorization", "Bearer "+access)
+	assert.Equal(t, http.StatusUnauthorized, execRequest(req, api.httpServer).Code, "Revoking the refresh token revokes the access tokens of the grant")
+}
+
+func TestAPI_OAuthClientCredentials(t *testing.T) {
+	api := testOAuth(t)
+	service := newOAuthClient(t, api, OAuthClientRequest{Name: "service", GrantTypes: []string{database.GrantClientCredentials}, Scopes: []string{ScopeRead}})
+	resource := newOAuthClient(t, api, OAuthClientRequest{Name: "resource", GrantTypes: []string{database.GrantClientCredentials}, Scopes: []string{ScopeRead}})
+
+	form := url.Values{"grant_type": {database.GrantClientCredentials}}
+	status, body := postForm(api, "/oauth/token", form, service.ID.String(), "wrong")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, oauthInvalidClient, body["error"])
+
+	status, body = postForm(api, "/oauth/token", url.Values{"grant_type": {database.GrantAuthorizationCode}}, service.ID.String(), service.Secret)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, oauthUnauthorizedClient, body["error"])
+
+	status, body = postForm(api, "/oauth/token", form, service.ID.String(), service.Secret)
+	assert.Equal(t, http.StatusOK, status, body)
+	assert.Nil(t, body["refresh_token"], "No refresh tokens for the client credentials grant")
+	access, _ := body["access_token"].(string)
+
+	req, _ := http.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set("Authorization", "Bearer "+access)
+	assert.Equal(t, http.StatusUnauthorized, execRequest(req, api.httpServer).Code, "Tokens without a user can not be used for the API")
+
+	introspect := url.Values{"token": {access}}
+	status, body = postForm(api, "/oauth/introspect", introspect, resource.ID.String(), resource.Secret)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, true, body["active"])
+	assert.Equal(t, service.ID.String(), body["client_id"])
+	assert.Equal(t, ScopeRead, body["scope"])
+
+	status, _ = postForm(api, "/oauth/revoke", introspect, resource.ID.String(), resource.Secret)
+	assert.Equal(t, http.StatusOK, status, "Tokens of other clients are ignored")
+	_, body = postForm(api, "/oauth/introspect", introspect, resource.ID.String(), resource.Secret)
+	assert.Equal(t, true, body["active"])
+
+	status, _ = postForm(api, "/oauth/revoke", introspect, service.ID.String(), service.Secret)
+	assert.Equal(t, http.StatusOK, status)
+	_, body = postForm(api, "/oauth/introspect", introspect, resource.ID.String(), resource.Secret)
+	assert.Equal(t, map[string]interface{}{"active": false}, body)
+}
@@ -0,0 +1,418 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/MarySmirnova/api_users/internal/oidc"
+	"github.com/google/uuid"
+)
+
+const (
+	ScopeOpenID  string = "openid"
+	ScopeProfile string = "profile"
+	ScopeEmail   string = "email"
+
+	//loginCookie keeps the session of the login page, so the user signs in to the clients once.
+	loginCookie string = "api_users_session"
+	//loginCSRFCookie keeps the token of the login form, the form is accepted only with the same token,
+	//so another site can not sign the user in with its own account.
+	loginCSRFCookie string = "api_users_csrf"
+	loginCSRFField  string = "csrf_token"
+)
+
+var ErrLoginFormExpired error = errors.New("the login form has expired, please try again")
+
+//go:embed login.html
+var loginHTML string
+
+var loginTemplate = template.Must(template.New("login").Parse(loginHTML))
+
+//loginFields are the fields of the login form, the rest are the parameters of the authorization request.
+var loginFields = map[string]bool{
+	"username": true,
+	"password": true,
+	"otp_code": true,
+	//токен формы подставляется заново при каждом показе страницы
+	loginCSRFField: true,
+}
+
+type hiddenField struct {
+	Name  string
+	Value string
+}
+
+type loginPage struct {
+	Client    string
+	Error     string
+	Username  string
+	CSRFToken string
+	Params    []hiddenField
+}
+
+//LoginForm documents the fields of the login page, the parameters of the authorization request
+//are passed along with them.
+type LoginForm struct {
+	Username            string `json:"username"`
+	Password            string `json:"password"`
+	OTPCode             string `json:"otp_code"`
+	CSRFToken           string `json:"csrf_token"`
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	Nonce               string `json:"nonce"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+//OpenIDConfiguration is the discovery document of the provider, OpenID Connect Discovery 1.0.
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+//authorizingUser authenticates the user of an authorization request. The login form is checked on POST,
+//otherwise the basic credentials of the request or the session cookie are used. API keys and bearer tokens
+//are not accepted: a scoped credential must not obtain the scopes of the client. Without the credentials
+//the login page is written, with prompt=none the error is reported to the client instead.
+func (a *API) authorizingUser(w http.ResponseWriter, r *http.Request, params url.Values, client *database.OAuthClient, fail func(errCode, description string)) (*database.User, bool) {
+	page := loginPage{Client: client.Name}
+	for name, values := range params {
+		if !loginFields[name] && len(values) > 0 {
+			page.Params = append(page.Params, hiddenField{Name: name, Value: values[0]})
+		}
+	}
+	sort.Slice(page.Params, func(i, j int) bool {
+		return page.Params[i].Name < page.Params[j].Name
+	})
+
+	if r.Method == http.MethodPost {
+		page.Username = params.Get("username")
+		if !validLoginCSRF(r, params.Get(loginCSRFField)) {
+			page.Error = ErrLoginFormExpired.Error()
+			a.renderLogin(w, r, http.StatusForbidden, page)
+			return nil, false
+		}
+
+		user, err := a.Authenticate(Credentials{
+			Username: page.Username,
+			Password: params.Get("password"),
+			OTPCode:  params.Get("otp_code"),
+			Tenant:   currentTenant(r.Context()),
+		}, false, false)
+		if err != nil {
+			a.loginFailed(w, r, page, err)
+			return nil, false
+		}
+
+		if err := a.startLoginSession(w, r, user); err != nil {
+			a.internalError(w, err)
+			return nil, false
+		}
+		return user, true
+	}
+
+	prompt := strings.Fields(params.Get("prompt"))
+	if hasScope(prompt, "login") {
+		a.renderLogin(w, r, http.StatusOK, page)
+		return nil, false
+	}
+
+	c := Credentials{Tenant: currentTenant(r.Context())}
+	if _, ok := authorizationValue(r, "Basic "); ok {
+		c.Username, c.Password, _ = r.BasicAuth()
+		c.OTPCode = r.Header.Get(HeaderOTPCode)
+	} else if cookie, err := r.Cookie(loginCookie); err == nil {
+		c.Session = cookie.Value
+	}
+
+	var user *database.User
+	err := ErrUnauthorized
+	if c.Session != "" || c.Username != "" {
+		user, err = a.Authenticate(c, false, false)
+	}
+	if err == nil {
+		return user, true
+	}
+
+	switch {
+	case !isLoginError(err):
+		a.internalError(w, err)
+	case hasScope(prompt, "none"):
+		fail("login_required", "the user is not signed in")
+	case errors.Is(err, ErrUnauthorized) && c.Username == "":
+		//сессия истекла или учетных данных нет - просто показываем форму
+		a.renderLogin(w, r, http.StatusOK, page)
+	default:
+		a.loginFailed(w, r, page, err)
+	}
+
+	return nil, false
+}
+
+//isLoginError reports whether the error of Authenticate is caused by the user, not by the storage.
+func isLoginError(err error) bool {
+	for _, e := range []error{ErrUnauthorized, ErrOTPRequired, ErrOTPInvalid, ErrAccountPending,
+		ErrEmailNotVerified, ErrTwoFactorRequired, ErrScopeDenied} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//loginFailed writes the login page with the reason of the failure.
+func (a *API) loginFailed(w http.ResponseWriter, r *http.Request, page loginPage, err error) {
+	if !isLoginError(err) {
+		a.internalError(w, err)
+		return
+	}
+
+	page.Error = err.Error()
+	if errors.Is(err, ErrUnauthorized) {
+		page.Error = "invalid username or password"
+	}
+	a.renderLogin(w, r, http.StatusUnauthorized, page)
+}
+
+//renderLogin writes the login page. The token of the form is kept in the cookie for the whole browser session,
+//a new one is created if there is no cookie yet.
+func (a *API) renderLogin(w http.ResponseWriter, r *http.Request, code int, page loginPage) {
+	if cookie, err := r.Cookie(loginCSRFCookie); err == nil && cookie.Value != "" {
+		page.CSRFToken = cookie.Value
+	} else {
+		token, err := randomToken(sessionTokenLen)
+		if err != nil {
+			a.internalError(w, err)
+			return
+		}
+		page.CSRFToken = token
+		http.SetCookie(w, &http.Cookie{
+			Name:     loginCSRFCookie,
+			Value:    token,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   strings.HasPrefix(a.publicURL, "https://"),
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	//страницу входа нельзя встраивать в чужие страницы (clickjacking)
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(code)
+	_ = loginTemplate.Execute(w, page)
+}
+
+//validLoginCSRF reports whether the token of the login form matches the token of the cookie.
+func validLoginCSRF(r *http.Request, token string) bool {
+	cookie, err := r.Cookie(loginCSRFCookie)
+	if err != nil || cookie.Value == "" || token == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) == 1
+}
+
+//startLoginSession creates a session for the user signed in by the login page and sets its cookie.
+func (a *API) startLoginSession(w http.ResponseWriter, r *http.Request, user *database.User) error {
+	token, err := randomToken(sessionTokenLen)
+	if err != nil {
+		return err
+	}
+
+	s := &database.Session{
+		TokenHash: database.HashSecret(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(a.cfg.SessionTTL).UTC(),
+	}
+	if err := a.store.WithTenant(user.TenantID).NewSession(s); err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  s.ExpiresAt,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(a.publicURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return nil
+}
+
+//userClaims returns the claims of the user the scopes allow: profile adds the username and the administrator
+//flag, email adds the email.
+func (a *API) userClaims(user *database.User, scopes []string) map[string]interface{} {
+	claims := map[string]interface{}{"sub": user.ID.String()}
+
+	if hasScope(scopes, ScopeProfile) {
+		claims["preferred_username"] = user.Username
+		claims["admin"] = user.Admin || a.grantsAdmin(user)
+	}
+	if hasScope(scopes, ScopeEmail) && user.Email != "" {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerified
+	}
+
+	return claims
+}
+
+//idToken returns the signed ID token of the grant issued along with the access token.
+func (a *API) idToken(ctx context.Context, store Storage, g tokenGrant, accessToken string, now time.Time) (string, error) {
+	user, err := store.GetUserByID(g.userID)
+	if err != nil {
+		return "", err
+	}
+
+	claims := a.userClaims(user, g.scopes)
+	claims["iss"] = a.tenantURL(currentTenant(ctx))
+	claims["aud"] = g.client.ID.String()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(a.openID.OIDCIDTokenTTL).Unix()
+	claims["at_hash"] = oidc.AccessTokenHash(accessToken)
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+
+	return a.keys.Sign(claims)
+}
+
+//DiscoveryHandler returns the OpenID Connect discovery document of the tenant of the request.
+func (a *API) DiscoveryHandler(w http.ResponseWriter, r *http.Request) {
+	issuer := a.tenantURL(currentTenant(r.Context()))
+
+	scopes := make([]string, 0, len(oauthScopes))
+	for s := range oauthScopes {
+		scopes = append(scopes, s)
+	}
+	sort.Strings(scopes)
+
+	writeOAuthJSON(w, http.StatusOK, OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserinfoEndpoint:                  issuer + "/oauth/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		ScopesSupported:                   scopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{database.GrantAuthorizationCode, database.GrantRefreshToken, database.GrantClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{oidc.AlgRS256},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{pkceMethodS256},
+		ClaimsSupported: []string{"sub", "iss", "aud", "exp", "iat", "nonce", "at_hash",
+			"preferred_username", "admin", "email", "email_verified"},
+	})
+}
+
+//JWKSHandler returns the public keys the ID tokens are signed with, including the recently replaced ones.
+func (a *API) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	set, err := a.keys.JWKS()
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	writeOAuthJSON(w, http.StatusOK, set)
+}
+
+//RotateKeysHandler replaces the signing key before its time, e.g. when it may be compromised.
+//The replaced key stays published for the retention period. Only super-admins rotate the keys,
+//they are shared by all tenants.
+func (a *API) RotateKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if !isSuperAdmin(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	if err := a.keys.Rotate(); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//UserInfoHandler returns the claims of the user of the access token, the token must have the openid scope.
+func (a *API) UserInfoHandler(w http.ResponseWriter, r *http.Request) {
+	invalid := func() {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeOAuthJSON(w, http.StatusUnauthorized, OAuthError{Error: "invalid_token"})
+	}
+
+	token, ok := bearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="userinfo"`)
+		writeOAuthJSON(w, http.StatusUnauthorized, OAuthError{Error: oauthInvalidRequest, Description: "access token is required"})
+		return
+	}
+
+	store := a.storeFor(r.Context())
+	t, err := store.GetOAuthToken(token)
+	if err != nil {
+		if errors.Is(err, database.ErrOAuthTokenNotExist) {
+			invalid()
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+	if t.Kind != database.OAuthAccessToken || t.UserID == uuid.Nil {
+		invalid()
+		return
+	}
+
+	if !hasScope(t.Scopes, ScopeOpenID) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		writeOAuthJSON(w, http.StatusForbidden, OAuthError{Error: "insufficient_scope"})
+		return
+	}
+
+	user, err := store.GetUserByID(t.UserID)
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotExist) {
+			invalid()
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+	if user.Pending {
+		invalid()
+		return
+	}
+
+	writeOAuthJSON(w, http.StatusOK, a.userClaims(user, t.Scopes))
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/MarySmirnova/api_users/internal/oidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func getJWKS(t *testing.T, api *API) *oidc.JWKS {
+	r, _ := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	resp := execRequest(r, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var set oidc.JWKS
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &set))
+	return &set
+}
+
+func TestAPI_OIDCDiscovery(t *testing.T) {
+	api := testOAuth(t)
+
+	r, _ := http.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil)
+	resp := execRequest(r, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var conf OpenIDConfiguration
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &conf))
+	assert.Equal(t, "http://localhost:8080", conf.Issuer)
+	assert.Equal(t, "http://localhost:8080/oauth/authorize", conf.AuthorizationEndpoint)
+	assert.Equal(t, "http://localhost:8080/.well-known/jwks.json", conf.JWKSURI)
+	assert.Contains(t, conf.ScopesSupported, ScopeOpenID)
+	assert.Equal(t, []string{oidc.AlgRS256}, conf.IDTokenSigningAlgValuesSupported)
+
+	r, _ = http.NewRequest(http.MethodPost, "/tenants", toJSON(TenantRequest{Name: "acme", Admin: database.User{Username: "acme-admin", Password: "acme-pass", Email: "admin@acme.com"}}))
+	r.SetBasicAuth(adminUname, adminPass)
+	assert.Equal(t, http.StatusCreated, execRequest(r, api.httpServer).Code)
+
+	r, _ = http.NewRequest(http.MethodGet, "/t/acme/.well-known/openid-configuration", nil)
+	resp = execRequest(r, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &conf))
+	assert.Equal(t, "http://localhost:8080/t/acme", conf.Issuer, "Every tenant is a separate issuer")
+	assert.Equal(t, "http://localhost:8080/t/acme/oauth/token", conf.TokenEndpoint)
+}
+
+func TestAPI_OIDCLogin(t *testing.T) {
+	api := testOAuth(t)
+	client := newOAuthClient(t, api, OAuthClientRequest{
+		Name:         "Wiki",
+		RedirectURIs: []string{testRedirectURI},
+		Scopes:       []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopeRead},
+		Public:       true,
+	})
+
+	verifier := strings.Repeat("v", 50)
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ID.String()},
+		"scope":                 {"openid profile email"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6_WzA2Mj"},
+		"code_challenge":        {pkceChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/oauth/authorize?"+query.Encode(), nil)
+	resp := execRequest(r, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, resp.Body.String(), "Sign in to Wiki")
+	assert.Contains(t, resp.Body.String(), `name="nonce" value="n-0S6_WzA2Mj"`, "The authorization request is passed through the form")
+	csrf := resp.Result().Cookies()
+	if !assert.Equal(t, 1, len(csrf)) {
+		return
+	}
+	assert.Equal(t, loginCSRFCookie, csrf[0].Name)
+	assert.Contains(t, resp.Body.String(), `name="csrf_token" value="`+csrf[0].Value+`"`)
+
+	none := url.Values{}
+	for k, v := range query {
+		none[k] = v
+	}
+	none.Set("prompt", "none")
+	code, location := authorize(api, none, "", "")
+	assert.Equal(t, http.StatusFound, code)
+	assert.Equal(t, "login_required", location.Query().Get("error"))
+
+	login := func(pass, token string) *http.Response {
+		form := url.Values{"username": {notAdminUname}, "password": {pass}, "csrf_token": {token}}
+		for k, v := range query {
+			form[k] = v
+		}
+		r, _ := http.NewRequest(http.MethodPost, "/oauth/authorize", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(csrf[0])
+		return execRequest(r, api.httpServer).Result()
+	}
+
+	forged := login(notAdminPass, "forged")
+	assert.Equal(t, http.StatusForbidden, forged.StatusCode, "The form is accepted only with the token of the cookie")
+	assert.Empty(t, forged.Cookies())
+
+	failed := login("wrong", csrf[0].Value)
+	assert.Equal(t, http.StatusUnauthorized, failed.StatusCode)
+	assert.Empty(t, failed.Cookies())
+
+	signedIn := login(notAdminPass, csrf[0].Value)
+	assert.Equal(t, http.StatusFound, signedIn.StatusCode)
+	location, _ = url.Parse(signedIn.Header.Get("Location"))
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+	if !assert.Equal(t, 1, len(signedIn.Cookies())) {
+		return
+	}
+	cookie := signedIn.Cookies()[0]
+	assert.True(t, cookie.HttpOnly)
+
+	r, _ = http.NewRequest(http.MethodGet, "/oauth/authorize?"+query.Encode(), nil)
+	r.AddCookie(cookie)
+	resp = execRequest(r, api.httpServer)
+	assert.Equal(t, http.StatusFound, resp.Code, "The session of the login page signs the user in to the next client")
+
+	status, body := postForm(api, "/oauth/token", url.Values{
+		"grant_type":    {database.GrantAuthorizationCode},
+		"code":          {location.Query().Get("code")},
+		"client_id":     {client.ID.String()},
+		"code_verifier": {verifier},
+	}, "", "")
+	assert.Equal(t, http.StatusOK, status, body)
+	access, _ := body["access_token"].(string)
+	idToken, _ := body["id_token"].(string)
+
+	claims, err := oidc.Verify(idToken, getJWKS(t, api))
+	assert.Nil(t, err)
+	assert.Equal(t, "http://localhost:8080", claims["iss"])
+	assert.Equal(t, client.ID.String(), claims["aud"])
+	assert.Equal(t, "n-0S6_WzA2Mj", claims["nonce"])
+	assert.Equal(t, notAdminUname, claims["preferred_username"])
+	assert.Equal(t, false, claims["admin"])
+	assert.Equal(t, oidc.AccessTokenHash(access), claims["at_hash"])
+
+	r, _ = http.NewRequest(http.MethodGet, "/oauth/userinfo", nil)
+	r.Header.Set("Authorization", "Bearer "+access)
+	resp = execRequest(r, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	info := map[string]interface{}{}
+	_ = json.Unmarshal(resp.Body.Bytes(), &info)
+	assert.Equal(t, claims["sub"], info["sub"])
+	assert.Equal(t, notAdminUname, info["preferred_username"])
+
+	r, _ = http.NewRequest(http.MethodGet, "/user", nil)
+	r.Header.Set("Authorization", "Bearer "+access)
+	assert.Equal(t, http.StatusForbidden, execRequest(r, api.httpServer).Code, "Without the read scope the token can not be used for the API")
+
+	r, _ = http.NewRequest(http.MethodGet, "/oauth/userinfo", nil)
+	r.Header.Set("Authorization", "Bearer wrong")
+	resp = execRequest(r, api.httpServer)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Contains(t, resp.Header().Get("WWW-Authenticate"), "invalid_token")
+}
+
+func TestAPI_OIDCAuthorize_ScopedCredentials(t *testing.T) {
+	api := testOAuth(t)
+	client := newOAuthClient(t, api, OAuthClientRequest{Name: "app", RedirectURIs: []string{testRedirectURI}, Scopes: []string{ScopeRead, ScopeWrite}, Public: true})
+
+	user, err := api.store.GetUserByName(notAdminUname)
+	assert.Nil(t, err)
+	key := createAPIKey(t, api, user.ID, APIKeyRequest{Name: "svc", Scopes: []string{ScopeRead}})
+
+	r, _ := http.NewRequest(http.MethodPost, "/login", nil)
+	r.SetBasicAuth(notAdminUname, notAdminPass)
+	var login LoginResponse
+	assert.Nil(t, json.Unmarshal(execRequest(r, api.httpServer).Body.Bytes(), &login))
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ID.String()},
+		"scope":                 {"read write"},
+		"prompt":                {"none"},
+		"code_challenge":        {pkceChallenge(strings.Repeat("v", 50))},
+		"code_challenge_method": {"S256"},
+	}
+
+	for name, header := range map[string]string{
+		"API key":      "ApiKey " + key.Key,
+		"bearer token": "Bearer " + login.Token,
+	} {
+		r, _ = http.NewRequest(http.MethodGet, "/oauth/authorize?"+query.Encode(), nil)
+		r.Header.Set("Authorization", header)
+		resp := execRequest(r, api.httpServer)
+		assert.Equal(t, http.StatusFound, resp.Code, name)
+
+		location, _ := url.Parse(resp.Header().Get("Location"))
+		assert.Equal(t, "login_required", location.Query().Get("error"), "The %s does not authorize clients", name)
+		assert.Empty(t, location.Query().Get("code"), name)
+	}
+}
+
+func TestAPI_OIDCKeyRotation(t *testing.T) {
+	api := testOAuth(t)
+	token, err := api.keys.Sign(map[string]interface{}{"sub": "user"})
+	assert.Nil(t, err)
+
+	r, _ := http.NewRequest(http.MethodPost, "/oauth/keys/rotate", nil)
+	r.SetBasicAuth(notAdminUname, notAdminPass)
+	assert.Equal(t, http.StatusForbidden, execRequest(r, api.httpServer).Code)
+
+	r, _ = http.NewRequest(http.MethodPost, "/oauth/keys/rotate", nil)
+	r.SetBasicAuth(adminUname, adminPass)
+	assert.Equal(t, http.StatusNoContent, execRequest(r, api.httpServer).Code)
+
+	set := getJWKS(t, api)
+	assert.Equal(t, 2, len(set.Keys))
+	_, err = oidc.Verify(token, set)
+	assert.Nil(t, err, "The replaced key stays published")
+}
@@ -0,0 +1,1006 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/avatar"
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/MarySmirnova/api_users/internal/oidc"
+	"github.com/MarySmirnova/api_users/internal/transfer"
+	"github.com/MarySmirnova/api_users/internal/webhook"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/graphql-go/graphql"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const openAPIVersion string = "3.0.3"
+
+//go:embed docs.html
+var docsPage []byte
+
+//errorText marks responses with the plain text error message written by writeResponseError.
+type errorText struct{}
+
+//pngImage marks responses with a PNG image.
+type pngImage struct{}
+
+//avatarImage marks requests and responses with a PNG, JPEG or GIF image.
+type avatarImage struct{}
+
+//eventStream marks Server-Sent Events responses, the data of the events is webhook.Payload.
+type eventStream struct{}
+
+//formBody marks requests encoded as application/x-www-form-urlencoded, Fields describes the form fields by their JSON names.
+type formBody struct {
+	Fields interface{}
+}
+
+type queryParam struct {
+	Name        string
+	Description string
+	Required    bool
+	Integer     bool
+}
+
+var pageParams = []queryParam{
+	{Name: "limit", Description: "maximum number of items, all items if not set", Integer: true},
+	{Name: "offset", Description: "number of items to skip", Integer: true},
+}
+
+//operation describes a named route for the OpenAPI document.
+type operation struct {
+	Summary    string
+	Tag        string
+	Public     bool
+	Security   string //the only security scheme of the operation instead of the default ones
+	StringPath bool   //path parameters are not UUIDs
+	Query      []queryParam
+	Request    interface{}
+	Consumes   map[string]interface{} //request bodies of other media types than JSON
+	Responses  map[int]interface{}
+}
+
+var (
+	users      = []*database.User{}
+	apiKeyList = []*database.APIKey{}
+	webhooks   = []*database.Webhook{}
+	deliveries = []*database.WebhookDelivery{}
+	versions   = []*database.UserVersion{}
+	tenants    = []*database.Tenant{}
+	groups     = []*database.Group{}
+	members    = []*database.GroupMember{}
+	attributes = []*database.AttributeDefinition{}
+	clients    = []*OAuthClientResponse{}
+)
+
+//operations documents every route registered in New by its name.
+var operations = map[string]operation{
+	"forgot_password": {
+		Summary:   "Send a password reset token to the email of the user",
+		Tag:       "password",
+		Public:    true,
+		Request:   ForgotPasswordRequest{},
+		Responses: map[int]interface{}{http.StatusAccepted: nil, http.StatusBadRequest: errorText{}},
+	},
+	"reset_password": {
+		Summary:   "Set a new password by the reset token",
+		Tag:       "password",
+		Public:    true,
+		Request:   ResetPasswordRequest{},
+		Responses: map[int]interface{}{http.StatusNoContent: nil, http.StatusBadRequest: errorText{}},
+	},
+	"register": {
+		Summary: "Register a user waiting for approval",
+		Tag:     "registration",
+		Public:  true,
+		Request: RegisterRequest{},
+		Responses: map[int]interface{}{
+			http.StatusAccepted:        uuid.UUID{},
+			http.StatusBadRequest:      errorText{},
+			http.StatusNotFound:        nil,
+			http.StatusTooManyRequests: errorText{},
+		},
+	},
+	"verify_email": {
+		Summary:   "Confirm the email by the token from the link",
+		Tag:       "email",
+		Public:    true,
+		Query:     []queryParam{{Name: "token", Description: "verification token", Required: true}},
+		Responses: map[int]interface{}{http.StatusOK: "", http.StatusBadRequest: errorText{}},
+	},
+	"openapi": {
+		Summary:   "This document",
+		Tag:       "docs",
+		Public:    true,
+		Responses: map[int]interface{}{http.StatusOK: map[string]interface{}{}},
+	},
+	"docs": {
+		Summary:   "HTML page for browsing this document",
+		Tag:       "docs",
+		Public:    true,
+		Responses: map[int]interface{}{http.StatusOK: nil},
+	},
+	"create_user": {
+		Summary:   "Create a user",
+		Tag:       "users",
+		Request:   database.User{},
+		Responses: map[int]interface{}{http.StatusOK: uuid.UUID{}, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"user_events": {
+		Summary: "Server-Sent Events stream of user changes, administrators receive the events of all users, " +
+			"other users - only of their own profile. The Last-Event-ID header resumes the stream",
+		Tag:       "users",
+		Responses: map[int]interface{}{http.StatusOK: eventStream{}, http.StatusBadRequest: errorText{}},
+	},
+	"get_all_users": {
+		Summary: "List users sorted by name, the total number is returned in the " + HeaderTotalCount + " header. " +
+			"The attr.<name>=<value> parameters filter the users by custom attributes",
+		Tag:       "users",
+		Query:     pageParams,
+		Responses: map[int]interface{}{http.StatusOK: users, http.StatusBadRequest: errorText{}},
+	},
+	"get_user": {
+		Summary:   "Get a user by ID",
+		Tag:       "users",
+		Query:     []queryParam{{Name: "as_of", Description: "RFC 3339 time, returns the user as it was at that moment"}},
+		Responses: map[int]interface{}{http.StatusOK: database.User{}, http.StatusBadRequest: errorText{}},
+	},
+	"user_history": {
+		Summary:   "List all versions of a user, the oldest first",
+		Tag:       "users",
+		Responses: map[int]interface{}{http.StatusOK: versions, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"revert_user": {
+		Summary:   "Restore a user to a previous version",
+		Tag:       "users",
+		Request:   RevertRequest{},
+		Responses: map[int]interface{}{http.StatusOK: database.User{}, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"upload_avatar": {
+		Summary: "Upload the avatar of a user, the image is re-encoded without metadata and scaled down, " +
+			"a square thumbnail is made. Available to administrators and to the user itself",
+		Tag:     "users",
+		Request: avatarImage{},
+		Responses: map[int]interface{}{http.StatusNoContent: nil, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{},
+			http.StatusRequestEntityTooLarge: errorText{}, http.StatusUnsupportedMediaType: errorText{}},
+	},
+	"get_avatar": {
+		Summary:   "Get the avatar of a user, PNG or JPEG. Responses have ETag and Cache-Control headers",
+		Tag:       "users",
+		Query:     []queryParam{{Name: "size", Description: "thumbnail returns the square thumbnail"}},
+		Responses: map[int]interface{}{http.StatusOK: avatarImage{}, http.StatusNotModified: nil, http.StatusBadRequest: errorText{}, http.StatusNotFound: errorText{}},
+	},
+	"delete_avatar": {
+		Summary:   "Delete the avatar of a user",
+		Tag:       "users",
+		Responses: map[int]interface{}{http.StatusNoContent: nil, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"get_user_groups": {
+		Summary:   "List the groups of a user including the groups of its nested groups",
+		Tag:       "users",
+		Query:     pageParams,
+		Responses: map[int]interface{}{http.StatusOK: groups, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"batch_users": {
+		Summary: "Create, update and delete users in one request",
+		Tag:     "users",
+		Request: BatchRequest{},
+		Responses: map[int]interface{}{
+			http.StatusOK:                    BatchResponse{},
+			http.StatusBadRequest:            BatchResponse{},
+			http.StatusForbidden:             errorText{},
+			http.StatusNotFound:              BatchResponse{},
+			http.StatusConflict:              BatchResponse{},
+			http.StatusRequestEntityTooLarge: errorText{},
+		},
+	},
+	"export_users": {
+		Summary:   "Export all users with password hashes",
+		Tag:       "transfer",
+		Query:     []queryParam{{Name: "format", Description: "ndjson (default) or csv"}},
+		Responses: map[int]interface{}{http.StatusOK: transfer.Record{}, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"import_users": {
+		Summary: "Import users exported by export_users",
+		Tag:     "transfer",
+		Query: []queryParam{
+			{Name: "format", Description: "ndjson (default) or csv"},
+			{Name: "conflict", Description: "what to do with existing users: skip (default), overwrite or fail"},
+			{Name: "dry_run", Description: "only check the file and report what would be done"},
+		},
+		Request:   transfer.Record{},
+		Responses: map[int]interface{}{http.StatusOK: transfer.Report{}, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}, http.StatusConflict: transfer.Report{}},
+	},
+	"replace_user": {
+		Summary:   "Replace a user, missing fields are cleared",
+		Tag:       "users",
+		Request:   database.User{},
+		Responses: map[int]interface{}{http.StatusNoContent: nil, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"update_user": {
+		Summary: "Update fields of a user",
+		Tag:     "users",
+		Request: database.User{},
+		Consumes: map[string]interface{}{
+			contentTypeMergePatch: database.User{},
+			contentTypeJSONPatch:  []JSONPatchOperation{},
+		},
+		Responses: map[int]interface{}{http.StatusNoContent: nil, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}, http.StatusConflict: errorText{}},
+	},
+	"delete_user": {
+		Summary:   "Delete a user",
+		Tag:       "users",
+		Responses: map[int]interface{}{http.StatusNoContent: nil, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"create_api_key": {
+		Summary:   "Create an API key of a user, the key is returned only once",
+		Tag:       "api keys",
+		Request:   APIKeyRequest{},
+		Responses: map[int]interface{}{http.StatusOK: APIKeyResponse{}, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"get_api_keys": {
+		Summary:   "List API keys of a user",
+		Tag:       "api keys",
+		Responses: map[int]interface{}{http.StatusOK: apiKeyList, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"delete_api_key": {
+		Summary:   "Revoke an API key",
+		Tag:       "api keys",
+		Responses: map[int]interface{}{http.StatusNoContent: nil, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"send_email_verification": {
+		Summary:   "Send the email verification link again",
+		Tag:       "email",
+		Responses: map[int]interface{}{http.StatusAccepted: nil, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"reset_user_2fa": {
+		Summary:   "Turn off two-factor authentication of a user",
+		Tag:       "2fa",
+		Responses: map[int]interface{}{http.StatusNoContent: nil, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"get_registrations": {
+		Summary:   "List registrations waiting for approval",
+		Tag:       "registration",
+		Responses: map[int]interface{}{http.StatusOK: users, http.StatusForbidden: errorText{}},
+	},
+	"approve_registration": {
+		Summary:   "Approve a registration",
+		Tag:       "registration",
+		Responses: map[int]interface{}{http.StatusNoContent: nil, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"reject_registration": {
+		Summary:   "Reject a registration and delete the user",
+		Tag:       "registration",
+		Responses: map[int]interface{}{http.StatusNoContent: nil, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"login": {
+		Summary:   "Exchange the credentials for a bearer token",
+		Tag:       "auth",
+		Responses: map[int]interface{}{http.StatusOK: LoginResponse{}},
+	},
+	"logout": {
+		Summary:   "Revoke the bearer token of the request",
+		Tag:       "auth",
+		Responses: map[int]interface{}{http.StatusNoContent: nil},
+	},
+	"2fa_enroll": {
+		Summary:   "Generate a pending TOTP secret",
+		Tag:       "2fa",
+		Responses: map[int]interface{}{http.StatusOK: TOTPEnrollResponse{}, http.StatusBadRequest: errorText{}},
+	},
+	"2fa_qr": {
+		Summary:   "QR code of the pending TOTP secret",
+		Tag:       "2fa",
+		Responses: map[int]interface{}{http.StatusOK: pngImage{}, http.StatusBadRequest: errorText{}, http.StatusNotFound: errorText{}},
+	},
+	"2fa_verify": {
+		Summary:   "Enable two-factor authentication with the first code",
+		Tag:       "2fa",
+		Request:   TOTPVerifyRequest{},
+		Responses: map[int]interface{}{http.StatusOK: TOTPVerifyResponse{}, http.StatusBadRequest: errorText{}},
+	},
+	"2fa_disable": {
+		Summary:   "Turn off two-factor authentication",
+		Tag:       "2fa",
+		Request:   TOTPDisableRequest{},
+		Responses: map[int]interface{}{http.StatusNoContent: nil, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"graphql": {
+		Summary:   "Execute a GraphQL query or mutation",
+		Tag:       "graphql",
+		Request:   GraphQLRequest{},
+		Responses: map[int]interface{}{http.StatusOK: graphql.Result{}, http.StatusBadRequest: graphql.Result{}},
+	},
+	"graphql_query": {
+		Summary: "Execute a GraphQL query",
+		Tag:     "graphql",
+		Query: []queryParam{
+			{Name: "query", Description: "GraphQL document", Required: true},
+			{Name: "operationName", Description: "operation to execute if the document has several"},
+			{Name: "variables", Description: "JSON object with the variables"},
+		},
+		Responses: map[int]interface{}{http.StatusOK: graphql.Result{}, http.StatusBadRequest: graphql.Result{}, http.StatusMethodNotAllowed: graphql.Result{}},
+	},
+	"scim_list_users": {
+		Summary:  "SCIM: list users",
+		Tag:      "scim",
+		Security: "scimToken",
+		Query: []queryParam{
+			{Name: "filter", Description: `SCIM filter, e.g. userName eq "john"`},
+			{Name: "startIndex", Description: "1-based index of the first result", Integer: true},
+			{Name: "count", Description: "maximum number of results", Integer: true},
+		},
+		Responses: map[int]interface{}{http.StatusOK: SCIMListResponse{}, http.StatusBadRequest: SCIMError{}},
+	},
+	"scim_create_user": {
+		Summary:   "SCIM: create a user",
+		Tag:       "scim",
+		Security:  "scimToken",
+		Request:   SCIMUser{},
+		Responses: map[int]interface{}{http.StatusCreated: SCIMUser{}, http.StatusBadRequest: SCIMError{}, http.StatusConflict: SCIMError{}},
+	},
+	"scim_get_user": {
+		Summary:   "SCIM: get a user",
+		Tag:       "scim",
+		Security:  "scimToken",
+		Responses: map[int]interface{}{http.StatusOK: SCIMUser{}, http.StatusNotFound: SCIMError{}},
+	},
+	"scim_replace_user": {
+		Summary:   "SCIM: replace a user",
+		Tag:       "scim",
+		Security:  "scimToken",
+		Request:   SCIMUser{},
+		Responses: map[int]interface{}{http.StatusOK: SCIMUser{}, http.StatusBadRequest: SCIMError{}, http.StatusNotFound: SCIMError{}, http.StatusConflict: SCIMError{}},
+	},
+	"scim_patch_user": {
+		Summary:   "SCIM: patch a user",
+		Tag:       "scim",
+		Security:  "scimToken",
+		Request:   SCIMPatchRequest{},
+		Responses: map[int]interface{}{http.StatusOK: SCIMUser{}, http.StatusBadRequest: SCIMError{}, http.StatusNotFound: SCIMError{}, http.StatusConflict: SCIMError{}},
+	},
+	"scim_delete_user": {
+		Summary:   "SCIM: delete a user",
+		Tag:       "scim",
+		Security:  "scimToken",
+		Responses: map[int]interface{}{http.StatusNoContent: nil, http.StatusNotFound: SCIMError{}},
+	},
+	"scim_service_provider_config": {
+		Summary:   "SCIM: supported features",
+		Tag:       "scim",
+		Security:  "scimToken",
+		Responses: map[int]interface{}{http.StatusOK: map[string]interface{}{}},
+	},
+	"scim_schemas": {
+		Summary:   "SCIM: supported schemas",
+		Tag:       "scim",
+		Security:  "scimToken",
+		Responses: map[int]interface{}{http.StatusOK: SCIMListResponse{}},
+	},
+	"scim_schema": {
+		Summary:    "SCIM: schema by URN",
+		Tag:        "scim",
+		Security:   "scimToken",
+		StringPath: true,
+		Responses:  map[int]interface{}{http.StatusOK: map[string]interface{}{}, http.StatusNotFound: nil},
+	},
+	"scim_resource_types": {
+		Summary:   "SCIM: supported resource types",
+		Tag:       "scim",
+		Security:  "scimToken",
+		Responses: map[int]interface{}{http.StatusOK: SCIMListResponse{}},
+	},
+	"scim_resource_type": {
+		Summary:    "SCIM: resource type by name",
+		Tag:        "scim",
+		Security:   "scimToken",
+		StringPath: true,
+		Responses:  map[int]interface{}{http.StatusOK: map[string]interface{}{}, http.StatusNotFound: nil},
+	},
+	"create_webhook": {
+		Summary:   "Subscribe a URL to user events, the secret is returned only once",
+		Tag:       "webhooks",
+		Request:   WebhookRequest{},
+		Responses: map[int]interface{}{http.StatusCreated: WebhookResponse{}, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"get_webhooks": {
+		Summary:   "List webhooks",
+		Tag:       "webhooks",
+		Responses: map[int]interface{}{http.StatusOK: webhooks, http.StatusForbidden: errorText{}},
+	},
+	"get_webhook": {
+		Summary:   "Get a webhook",
+		Tag:       "webhooks",
+		Responses: map[int]interface{}{http.StatusOK: database.Webhook{}, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"replace_webhook": {
+		Summary:   "Replace the URL and the events of a webhook, the secret is changed only if passed",
+		Tag:       "webhooks",
+		Request:   WebhookRequest{},
+		Responses: map[int]interface{}{http.StatusOK: database.Webhook{}, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"delete_webhook": {
+		Summary:   "Delete a webhook with its deliveries",
+		Tag:       "webhooks",
+		Responses: map[int]interface{}{http.StatusNoContent: nil, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"get_webhook_deliveries": {
+		Summary:   "Delivery history of a webhook, the newest first",
+		Tag:       "webhooks",
+		Responses: map[int]interface{}{http.StatusOK: deliveries, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"get_dead_letters": {
+		Summary:   "Deliveries of all webhooks that have run out of attempts",
+		Tag:       "webhooks",
+		Responses: map[int]interface{}{http.StatusOK: deliveries, http.StatusForbidden: errorText{}},
+	},
+	"redeliver_webhook": {
+		Summary:   "Return a failed delivery to the queue with a new set of attempts",
+		Tag:       "webhooks",
+		Responses: map[int]interface{}{http.StatusAccepted: database.WebhookDelivery{}, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}, http.StatusConflict: errorText{}},
+	},
+	"create_group": {
+		Summary:   "Create a group, the permissions are granted to all its members",
+		Tag:       "groups",
+		Request:   GroupRequest{},
+		Responses: map[int]interface{}{http.StatusCreated: database.Group{}, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"get_groups": {
+		Summary:   "List groups sorted by name, the total number is returned in the " + HeaderTotalCount + " header",
+		Tag:       "groups",
+		Query:     pageParams,
+		Responses: map[int]interface{}{http.StatusOK: groups, http.StatusBadRequest: errorText{}},
+	},
+	"get_group": {
+		Summary:   "Get a group",
+		Tag:       "groups",
+		Responses: map[int]interface{}{http.StatusOK: database.Group{}, http.StatusBadRequest: errorText{}},
+	},
+	"replace_group": {
+		Summary:   "Replace the name, the description and the permissions of a group",
+		Tag:       "groups",
+		Request:   GroupRequest{},
+		Responses: map[int]interface{}{http.StatusOK: database.Group{}, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"delete_group": {
+		Summary:   "Delete a group with its memberships",
+		Tag:       "groups",
+		Responses: map[int]interface{}{http.StatusNoContent: nil, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"get_group_members": {
+		Summary:   "List the direct members of a group in the order they were added",
+		Tag:       "groups",
+		Query:     pageParams,
+		Responses: map[int]interface{}{http.StatusOK: members, http.StatusBadRequest: errorText{}},
+	},
+	"add_group_member": {
+		Summary:   "Add a user or a nested group to a group",
+		Tag:       "groups",
+		Request:   MemberRequest{},
+		Responses: map[int]interface{}{http.StatusNoContent: nil, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}, http.StatusConflict: errorText{}},
+	},
+	"remove_group_member": {
+		Summary:   "Remove a direct member from a group",
+		Tag:       "groups",
+		Responses: map[int]interface{}{http.StatusNoContent: nil, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"create_attribute": {
+		Summary:   "Define a custom attribute of the users, the values the users already have must fit it",
+		Tag:       "attributes",
+		Request:   database.AttributeDefinition{},
+		Responses: map[int]interface{}{http.StatusCreated: database.AttributeDefinition{}, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}, http.StatusConflict: errorText{}},
+	},
+	"get_attributes": {
+		Summary:   "List the custom attributes of the users sorted by name",
+		Tag:       "attributes",
+		Responses: map[int]interface{}{http.StatusOK: attributes},
+	},
+	"get_attribute": {
+		Summary:    "Get a custom attribute",
+		Tag:        "attributes",
+		StringPath: true,
+		Responses:  map[int]interface{}{http.StatusOK: database.AttributeDefinition{}, http.StatusNotFound: errorText{}},
+	},
+	"replace_attribute": {
+		Summary:    "Replace a custom attribute, the values the users already have must fit it",
+		Tag:        "attributes",
+		StringPath: true,
+		Request:    database.AttributeDefinition{},
+		Responses:  map[int]interface{}{http.StatusOK: database.AttributeDefinition{}, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}, http.StatusNotFound: errorText{}, http.StatusConflict: errorText{}},
+	},
+	"delete_attribute": {
+		Summary:    "Delete a custom attribute with its values",
+		Tag:        "attributes",
+		StringPath: true,
+		Responses:  map[int]interface{}{http.StatusNoContent: nil, http.StatusForbidden: errorText{}, http.StatusNotFound: errorText{}},
+	},
+	"oauth_authorize": {
+		Summary: "Issue an authorization code to an OAuth client on behalf of the user and redirect back to the client. " +
+			"Users without credentials or a session of a previous login get the login page",
+		Tag:    "oauth",
+		Public: true,
+		Query: []queryParam{
+			{Name: "response_type", Description: "code", Required: true},
+			{Name: "client_id", Description: "ID of the client", Required: true},
+			{Name: "redirect_uri", Description: "one of the registered redirect URIs, may be omitted if only one is registered"},
+			{Name: "scope", Description: "space-separated scopes, all scopes of the client if not set"},
+			{Name: "state", Description: "opaque value returned to the client"},
+			{Name: "nonce", Description: "OpenID Connect nonce, it is put to the ID token"},
+			{Name: "prompt", Description: "login shows the login page even if the user is signed in, none fails with login_required instead of showing it"},
+			{Name: "code_challenge", Description: "PKCE code challenge", Required: true},
+			{Name: "code_challenge_method", Description: "S256", Required: true},
+		},
+		Responses: map[int]interface{}{http.StatusOK: nil, http.StatusFound: nil, http.StatusBadRequest: OAuthError{}, http.StatusUnauthorized: nil},
+	},
+	"oauth_login": {
+		Summary:   "Submit the login page, the user is signed in and redirected back to the client",
+		Tag:       "oauth",
+		Public:    true,
+		Request:   formBody{LoginForm{}},
+		Responses: map[int]interface{}{http.StatusFound: nil, http.StatusBadRequest: OAuthError{}, http.StatusUnauthorized: nil},
+	},
+	"oauth_userinfo": {
+		Summary:   "Get the claims of the user of an access token with the openid scope",
+		Tag:       "oauth",
+		Security:  "bearerAuth",
+		Responses: map[int]interface{}{http.StatusOK: map[string]interface{}{}, http.StatusUnauthorized: OAuthError{}, http.StatusForbidden: OAuthError{}},
+	},
+	"oauth_userinfo_post": {
+		Summary:   "Get the claims of the user of an access token with the openid scope, same as GET",
+		Tag:       "oauth",
+		Security:  "bearerAuth",
+		Responses: map[int]interface{}{http.StatusOK: map[string]interface{}{}, http.StatusUnauthorized: OAuthError{}, http.StatusForbidden: OAuthError{}},
+	},
+	"openid_configuration": {
+		Summary:   "OpenID Connect discovery document of the tenant",
+		Tag:       "oauth",
+		Public:    true,
+		Responses: map[int]interface{}{http.StatusOK: OpenIDConfiguration{}},
+	},
+	"jwks": {
+		Summary:   "Public keys the ID tokens are signed with",
+		Tag:       "oauth",
+		Public:    true,
+		Responses: map[int]interface{}{http.StatusOK: oidc.JWKS{}},
+	},
+	"rotate_signing_keys": {
+		Summary:   "Replace the key the ID tokens are signed with, only for super-admins",
+		Tag:       "oauth",
+		Responses: map[int]interface{}{http.StatusNoContent: nil, http.StatusForbidden: errorText{}},
+	},
+	"oauth_token": {
+		Summary:   "Issue tokens for the authorization_code, refresh_token and client_credentials grants",
+		Tag:       "oauth",
+		Security:  "oauthClient",
+		Request:   formBody{TokenRequest{}},
+		Responses: map[int]interface{}{http.StatusOK: TokenResponse{}, http.StatusBadRequest: OAuthError{}, http.StatusUnauthorized: OAuthError{}},
+	},
+	"oauth_revoke": {
+		Summary:   "Revoke a token of the client (RFC 7009), revoking a refresh token revokes its access tokens",
+		Tag:       "oauth",
+		Security:  "oauthClient",
+		Request:   formBody{TokenActionRequest{}},
+		Responses: map[int]interface{}{http.StatusOK: nil, http.StatusBadRequest: OAuthError{}, http.StatusUnauthorized: OAuthError{}},
+	},
+	"oauth_introspect": {
+		Summary:   "Get the state of a token (RFC 7662), only for confidential clients",
+		Tag:       "oauth",
+		Security:  "oauthClient",
+		Request:   formBody{TokenActionRequest{}},
+		Responses: map[int]interface{}{http.StatusOK: IntrospectionResponse{}, http.StatusBadRequest: OAuthError{}, http.StatusUnauthorized: OAuthError{}},
+	},
+	"create_oauth_client": {
+		Summary:   "Register an OAuth client, the secret of a confidential client is returned only once",
+		Tag:       "oauth",
+		Request:   OAuthClientRequest{},
+		Responses: map[int]interface{}{http.StatusCreated: OAuthClientResponse{}, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"get_oauth_clients": {
+		Summary:   "List OAuth clients, the total number is returned in the " + HeaderTotalCount + " header",
+		Tag:       "oauth",
+		Query:     pageParams,
+		Responses: map[int]interface{}{http.StatusOK: clients, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"get_oauth_client": {
+		Summary:   "Get an OAuth client",
+		Tag:       "oauth",
+		Responses: map[int]interface{}{http.StatusOK: OAuthClientResponse{}, http.StatusForbidden: errorText{}, http.StatusNotFound: errorText{}},
+	},
+	"delete_oauth_client": {
+		Summary:   "Delete an OAuth client and revoke its tokens",
+		Tag:       "oauth",
+		Responses: map[int]interface{}{http.StatusNoContent: nil, http.StatusForbidden: errorText{}, http.StatusNotFound: errorText{}},
+	},
+	"create_tenant": {
+		Summary:   "Create a tenant with its first administrator, only for super-admins",
+		Tag:       "tenants",
+		Request:   TenantRequest{},
+		Responses: map[int]interface{}{http.StatusCreated: database.Tenant{}, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}},
+	},
+	"get_tenants": {
+		Summary:   "List tenants",
+		Tag:       "tenants",
+		Responses: map[int]interface{}{http.StatusOK: tenants, http.StatusForbidden: errorText{}},
+	},
+	"get_tenant": {
+		Summary:   "Get a tenant",
+		Tag:       "tenants",
+		Responses: map[int]interface{}{http.StatusOK: database.Tenant{}, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}, http.StatusNotFound: errorText{}},
+	},
+	"delete_tenant": {
+		Summary:   "Delete a tenant with all its users and webhooks",
+		Tag:       "tenants",
+		Responses: map[int]interface{}{http.StatusNoContent: nil, http.StatusBadRequest: errorText{}, http.StatusForbidden: errorText{}, http.StatusNotFound: errorText{}},
+	},
+	"metrics": {
+		Summary:   "Runtime and gRPC metrics published by expvar",
+		Tag:       "metrics",
+		Responses: map[int]interface{}{http.StatusOK: map[string]interface{}{}, http.StatusForbidden: errorText{}},
+	},
+}
+
+var pathParamRe = regexp.MustCompile(`{([^}:]+)(:[^}]+)?}`)
+
+//openAPIDocument builds the OpenAPI document from the routes of the router.
+//Names of routes missing in operations are returned, such routes are documented only by the path.
+func openAPIDocument(router *mux.Router) (map[string]interface{}, []string) {
+	schemas := map[string]interface{}{}
+	paths := map[string]map[string]interface{}{}
+	missing := []string{}
+
+	_ = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		name := route.GetName()
+		tpl, err := route.GetPathTemplate()
+		if err != nil || name == "" {
+			return nil
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		op, ok := operations[name]
+		if !ok {
+			missing = append(missing, name)
+			op = operation{Summary: name}
+		}
+
+		path := pathParamRe.ReplaceAllString(tpl, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+
+		for _, m := range methods {
+			paths[path][strings.ToLower(m)] = op.document(name, path, schemas)
+		}
+
+		return nil
+	})
+
+	sort.Strings(missing)
+
+	auth := []interface{}{}
+	for _, scheme := range []string{"basicAuth", "bearerAuth", "apiKeyHeader", "apiKeyAuthorization"} {
+		auth = append(auth, map[string]interface{}{scheme: []string{}})
+	}
+
+	doc := map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{
+			"title":       "User profiles API",
+			"version":     "1.0.0",
+			"description": "Errors are returned as a plain text message.",
+		},
+		"paths":    paths,
+		"security": auth,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"basicAuth": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "basic",
+					"description": "Users with two-factor authentication pass the one-time code in the " + HeaderOTPCode + " header.",
+				},
+				"bearerAuth": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "Token issued by POST /login or an OAuth access token.",
+				},
+				"apiKeyHeader": map[string]interface{}{
+					"type": "apiKey",
+					"in":   "header",
+					"name": HeaderAPIKey,
+				},
+				"apiKeyAuthorization": map[string]interface{}{
+					"type":        "apiKey",
+					"in":          "header",
+					"name":        "Authorization",
+					"description": `API key in the form "ApiKey <key>".`,
+				},
+				"scimToken": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "Token set by SCIM_TOKEN, used only by the SCIM endpoints.",
+				},
+				"oauthClient": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "basic",
+					"description": "client_id and client_secret of an OAuth client, they may be passed as form fields instead. Public clients pass only client_id.",
+				},
+			},
+		},
+	}
+
+	return doc, missing
+}
+
+func (op operation) document(name, path string, schemas map[string]interface{}) map[string]interface{} {
+	doc := map[string]interface{}{
+		"operationId": name,
+		"summary":     op.Summary,
+	}
+
+	if op.Tag != "" {
+		doc["tags"] = []string{op.Tag}
+	}
+
+	if op.Public {
+		doc["security"] = []interface{}{}
+	}
+	if op.Security != "" {
+		doc["security"] = []interface{}{map[string]interface{}{op.Security: []string{}}}
+	}
+
+	params := []interface{}{}
+	for _, m := range pathParamRe.FindAllStringSubmatch(path, -1) {
+		schema := map[string]interface{}{"type": "string", "format": "uuid"}
+		if op.StringPath {
+			schema = map[string]interface{}{"type": "string"}
+		}
+		params = append(params, map[string]interface{}{
+			"name":     m[1],
+			"in":       "path",
+			"required": true,
+			"schema":   schema,
+		})
+	}
+	for _, q := range op.Query {
+		schema := map[string]interface{}{"type": "string"}
+		if q.Integer {
+			schema = map[string]interface{}{"type": "integer", "minimum": 0}
+		}
+		params = append(params, map[string]interface{}{
+			"name":        q.Name,
+			"in":          "query",
+			"required":    q.Required,
+			"description": q.Description,
+			"schema":      schema,
+		})
+	}
+	if len(params) > 0 {
+		doc["parameters"] = params
+	}
+
+	if form, ok := op.Request.(formBody); ok {
+		doc["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/x-www-form-urlencoded": map[string]interface{}{
+					"schema": schemaOf(reflect.TypeOf(form.Fields), schemas),
+				},
+			},
+		}
+	} else if _, ok := op.Request.(avatarImage); ok {
+		doc["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  imageContent(avatar.ContentTypePNG, avatar.ContentTypeJPEG, avatar.ContentTypeGIF),
+		}
+	} else if op.Request != nil {
+		content := map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": schemaOf(reflect.TypeOf(op.Request), schemas),
+			},
+		}
+		for mediaType, body := range op.Consumes {
+			content[mediaType] = map[string]interface{}{
+				"schema": schemaOf(reflect.TypeOf(body), schemas),
+			}
+		}
+		doc["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  content,
+		}
+	}
+
+	responses := map[string]interface{}{}
+	for code, body := range op.Responses {
+		responses[strconv.Itoa(code)] = responseDocument(code, body, schemas)
+	}
+	if _, ok := op.Responses[http.StatusUnauthorized]; !op.Public && !ok {
+		responses[strconv.Itoa(http.StatusUnauthorized)] = responseDocument(http.StatusUnauthorized, errorText{}, schemas)
+	}
+	doc["responses"] = responses
+
+	return doc
+}
+
+func imageContent(mediaTypes ...string) map[string]interface{} {
+	content := map[string]interface{}{}
+	for _, t := range mediaTypes {
+		content[t] = map[string]interface{}{
+			"schema": map[string]interface{}{"type": "string", "format": "binary"},
+		}
+	}
+
+	return content
+}
+
+func responseDocument(code int, body interface{}, schemas map[string]interface{}) map[string]interface{} {
+	doc := map[string]interface{}{
+		"description": http.StatusText(code),
+	}
+
+	switch body.(type) {
+	case nil:
+	case errorText:
+		doc["content"] = map[string]interface{}{
+			"text/plain": map[string]interface{}{
+				"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"},
+			},
+		}
+		schemas["Error"] = map[string]interface{}{
+			"type":        "string",
+			"description": "Error message",
+		}
+	case pngImage:
+		doc["content"] = map[string]interface{}{
+			"image/png": map[string]interface{}{
+				"schema": map[string]interface{}{"type": "string", "format": "binary"},
+			},
+		}
+	case avatarImage:
+		doc["content"] = imageContent(avatar.ContentTypePNG, avatar.ContentTypeJPEG)
+	case eventStream:
+		doc["content"] = map[string]interface{}{
+			"text/event-stream": map[string]interface{}{
+				"schema": map[string]interface{}{"type": "string"},
+			},
+		}
+		schemaOf(reflect.TypeOf(webhook.Payload{}), schemas)
+	default:
+		doc["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": schemaOf(reflect.TypeOf(body), schemas),
+			},
+		}
+	}
+
+	return doc
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+//schemaOf returns the JSON schema of the type as encoding/json marshals it.
+//Named structs are put to the components and referenced.
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case uuidType:
+		return map[string]interface{}{"type": "string", "format": "uuid"}
+	case rawType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+	default:
+		return map[string]interface{}{}
+	}
+
+	ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	if _, ok := schemas[t.Name()]; ok {
+		return ref
+	}
+
+	//регистрируем имя до обхода полей, чтобы рекурсивные типы не зациклились
+	schemas[t.Name()] = map[string]interface{}{}
+
+	props := map[string]interface{}{}
+	structFields(t, props, schemas)
+
+	schemas[t.Name()] = map[string]interface{}{
+		"type":       "object",
+		"properties": props,
+	}
+
+	return ref
+}
+
+func structFields(t reflect.Type, props map[string]interface{}, schemas map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				structFields(ft, props, schemas)
+				continue
+			}
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		props[name] = schemaOf(f.Type, schemas)
+	}
+}
+
+//OpenAPIHandler serves the OpenAPI document of the API.
+func (a *API) OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(a.openAPI)
+}
+
+//DocsHandler serves the HTML page rendering the OpenAPI document.
+func (a *API) DocsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(docsPage)
+}
+
+func (a *API) buildOpenAPI(router *mux.Router) {
+	doc, missing := openAPIDocument(router)
+	if len(missing) > 0 {
+		log.WithField("routes", missing).Warn("routes are missing in the OpenAPI document")
+	}
+
+	a.openAPI = doc
+}
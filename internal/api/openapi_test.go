@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_OpenAPIHandler_DocumentsRouter(t *testing.T) {
+	api, _ := testBootstrap(t)
+
+	req, _ := http.NewRequest(http.MethodGet, "/openapi.json", nil)
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var doc struct {
+		OpenAPI string                                       `json:"openapi"`
+		Paths   map[string]map[string]map[string]interface{} `json:"paths"`
+	}
+	err := json.Unmarshal(resp.Body.Bytes(), &doc)
+	assert.Nil(t, err)
+	assert.Equal(t, openAPIVersion, doc.OpenAPI)
+
+	routes := 0
+	err = api.httpServer.Handler.(*mux.Router).Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		name := route.GetName()
+		if name == "" {
+			return nil
+		}
+		routes++
+
+		_, ok := operations[name]
+		assert.True(t, ok, "Route %s is not described in the operations", name)
+
+		path, _ := route.GetPathTemplate()
+		methods, _ := route.GetMethods()
+		for _, m := range methods {
+			op, ok := doc.Paths[path][strings.ToLower(m)]
+			if assert.True(t, ok, "%s %s is missing in the document", m, path) {
+				assert.Equal(t, name, op["operationId"])
+			}
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+
+	documented := 0
+	for _, ops := range doc.Paths {
+		documented += len(ops)
+	}
+	assert.Equal(t, routes, documented, "The document must not describe routes missing in the router")
+
+	for name := range operations {
+		assert.NotNil(t, api.httpServer.Handler.(*mux.Router).Get(name), "Operation %s has no route", name)
+	}
+}
+
+func TestAPI_OpenAPIHandler_Schemas(t *testing.T) {
+	api, _ := testBootstrap(t)
+
+	schemas := api.openAPI["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	user := schemas["User"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Contains(t, user, "Username")
+	assert.Equal(t, "uuid", user["ID"].(map[string]interface{})["format"])
+
+	key := schemas["APIKeyResponse"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Contains(t, key, "key")
+	assert.Contains(t, key, "prefix", "Embedded struct fields must be flattened")
+	assert.NotContains(t, key, "SecretHash")
+}
+
+func TestAPI_DocsHandler(t *testing.T) {
+	api, _ := testBootstrap(t)
+
+	req, _ := http.NewRequest(http.MethodGet, "/docs", nil)
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, resp.Body.String(), "openapi.json")
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"github.com/MarySmirnova/api_users/internal/blob"
+	"github.com/MarySmirnova/api_users/internal/mail"
+	"github.com/MarySmirnova/api_users/internal/webhook"
+)
+
+//Option configures optional dependencies of the API.
+type Option func(*API)
+
+//WithMailer sets the mailer used to deliver messages to users. Messages are logged by default.
+func WithMailer(m mail.Mailer) Option {
+	return func(a *API) {
+		a.mailer = m
+	}
+}
+
+//WithBlobStore sets the store of avatars. Avatars are kept in memory by default.
+func WithBlobStore(s blob.Store) Option {
+	return func(a *API) {
+		a.blobs = s
+	}
+}
+
+//WithWebhookGuard sets the guard checking the addresses of the webhooks. By default the internal addresses
+//are rejected without exceptions.
+func WithWebhookGuard(g *webhook.Guard) Option {
+	return func(a *API) {
+		a.webhookGuard = g
+	}
+}
+
+//WithRegistrationHooks adds functions called when a registration is approved or rejected.
+func WithRegistrationHooks(hooks ...RegistrationHook) Option {
+	return func(a *API) {
+		a.registrationHooks = append(a.registrationHooks, hooks...)
+	}
+}
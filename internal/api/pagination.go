@@ -0,0 +1,49 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+const HeaderTotalCount string = "X-Total-Count"
+
+var errInvalidPage error = errors.New("limit and offset must be non-negative integers")
+
+//page is a window of a listing. Zero limit means no limit.
+type page struct {
+	Limit  int
+	Offset int
+}
+
+func parsePage(r *http.Request) (page, error) {
+	var p page
+	var err error
+
+	q := r.URL.Query()
+	if v := q.Get("limit"); v != "" {
+		if p.Limit, err = strconv.Atoi(v); err != nil || p.Limit < 0 {
+			return page{}, errInvalidPage
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if p.Offset, err = strconv.Atoi(v); err != nil || p.Offset < 0 {
+			return page{}, errInvalidPage
+		}
+	}
+
+	return p, nil
+}
+
+func paginate[T any](items []T, p page) []T {
+	if p.Offset >= len(items) {
+		return items[:0]
+	}
+	items = items[p.Offset:]
+
+	if p.Limit > 0 && p.Limit < len(items) {
+		items = items[:p.Limit]
+	}
+
+	return items
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/MarySmirnova/api_users/internal/mail"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const resetTokenLen int = 32
+
+type ForgotPasswordRequest struct {
+	Username string `json:"username" validate:"min=1"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"min=1"`
+	Password string `json:"password" validate:"min=1"`
+}
+
+//ForgotPasswordHandler sends a reset token to the email of the user.
+//The response is the same whether the user exists or not.
+func (a *API) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.writeResponseError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid data passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.issuePasswordReset(r.Context(), req.Username); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *API) issuePasswordReset(ctx context.Context, username string) error {
+	user, err := a.storeFor(ctx).GetUserByName(username)
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	if user.Email == "" {
+		log.WithField("username", username).Warn("password reset requested for a user without email")
+		return nil
+	}
+
+	token, err := randomToken(resetTokenLen)
+	if err != nil {
+		return err
+	}
+
+	err = a.storeFor(ctx).NewPasswordReset(&database.PasswordReset{
+		TokenHash: database.HashSecret(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(a.cfg.PasswordResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	a.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Someone requested a password reset for the account %q.\n"+
+			"Use this token to set a new password, it is valid for %s:\n\n%s\n\n"+
+			"If you did not request it, ignore this message.", user.Username, a.cfg.PasswordResetTTL, token),
+	})
+
+	return nil
+}
+
+//ResetPasswordHandler sets a new password by the reset token and ends all sessions of the user.
+func (a *API) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.writeResponseError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid data passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	reset, err := a.storeFor(r.Context()).ConsumePasswordReset(req.Token)
+	if err != nil {
+		if errors.Is(err, database.ErrResetTokenNotExist) {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	user, err := a.storeFor(r.Context()).GetUserByID(reset.UserID)
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotExist) {
+			a.writeResponseError(w, database.ErrResetTokenNotExist, http.StatusBadRequest)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	u := *user
+	u.Password = req.Password
+
+	if err := a.storeFor(r.Context()).WithActor(u.ID.String()).UpdateUser(&u); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	if err := a.storeFor(r.Context()).DeleteUserSessions(u.ID); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//sendMail delivers the message in the background, so the response time does not depend on the mail server.
+func (a *API) sendMail(m mail.Message) {
+	go func() {
+		if err := a.mailer.Send(m); err != nil {
+			log.WithError(err).WithField("to", m.To).Error("unable to send mail")
+		}
+	}()
+}
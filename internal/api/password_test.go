@@ -0,0 +1,93 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/MarySmirnova/api_users/internal/mail"
+	"github.com/stretchr/testify/assert"
+)
+
+type testMailer struct {
+	sent chan mail.Message
+}
+
+func newTestMailer() *testMailer {
+	return &testMailer{
+		sent: make(chan mail.Message, 10),
+	}
+}
+
+func (m *testMailer) Send(msg mail.Message) error {
+	m.sent <- msg
+	return nil
+}
+
+func (m *testMailer) wait(t *testing.T) mail.Message {
+	select {
+	case msg := <-m.sent:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("message was not sent")
+	}
+	return mail.Message{}
+}
+
+func TestAPI_ForgotPasswordHandler_UnknownUser(t *testing.T) {
+	api, _ := testBootstrap(t)
+	mailer := newTestMailer()
+	api.mailer = mailer
+
+	req, _ := http.NewRequest(http.MethodPost, "/password/forgot", toJSON(ForgotPasswordRequest{Username: "tolik"}))
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+
+	select {
+	case <-mailer.sent:
+		t.Fatal("message must not be sent for an unknown user")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestAPI_ResetPasswordHandler_GoodWay(t *testing.T) {
+	api, id := testBootstrap(t)
+	mailer := newTestMailer()
+	api.mailer = mailer
+
+	user, _ := api.store.GetUserByID(id)
+	u := *user
+	u.Email = "not@admin.ru"
+	err := api.store.UpdateUser(&u)
+	assert.Nil(t, err)
+
+	req, _ := http.NewRequest(http.MethodPost, "/password/forgot", toJSON(ForgotPasswordRequest{Username: notAdminUname}))
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+
+	msg := mailer.wait(t)
+	assert.Equal(t, u.Email, msg.To)
+
+	token := regexp.MustCompile(`\n\n(\S+)\n\n`).FindStringSubmatch(msg.Body)[1]
+
+	req, _ = http.NewRequest(http.MethodPost, "/password/reset", toJSON(ResetPasswordRequest{Token: token, Password: "new"}))
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/user", nil)
+	req.SetBasicAuth(notAdminUname, "new")
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/password/reset", toJSON(ResetPasswordRequest{Token: token, Password: "again"}))
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusBadRequest, resp.Code, "Reset token must be single-use")
+	assert.Contains(t, resp.Body.String(), database.ErrResetTokenNotExist.Error())
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	contentTypeMergePatch string = "application/merge-patch+json"
+	contentTypeJSONPatch  string = "application/json-patch+json"
+)
+
+var ErrReadOnlyField error = errors.New("ID, EmailVerified and Pending can not be changed")
+
+//JSONPatchOperation is an operation of RFC 6902 JSON Patch, used only in the documentation.
+type JSONPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+//ReplaceUserHandler replaces the user: missing fields are cleared, Admin is set to false if it is not passed.
+//ID, EmailVerified and Pending are ignored, so a user returned by GET can be sent back. An empty password
+//or the current hash keeps the password.
+func (a *API) ReplaceUserHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdminUser(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	uid, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var u database.User
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		a.writeResponseError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	old, err := a.storeFor(r.Context()).GetUserByID(uid)
+	if err != nil {
+		a.writeResponseError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if u.Password == old.Password {
+		u.Password = ""
+	}
+
+	a.replaceUser(w, r, old, &u)
+}
+
+//patchUser applies a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902) to the user document.
+//The document is the user without the password hash, a patch can set a new password.
+func (a *API) patchUser(w http.ResponseWriter, r *http.Request, uid uuid.UUID) {
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	old, err := a.storeFor(r.Context()).GetUserByID(uid)
+	if err != nil {
+		a.writeResponseError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	doc := *old
+	doc.Password = ""
+	original, err := json.Marshal(doc)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	var patched []byte
+	if mediaType(r) == contentTypeMergePatch {
+		patched, err = jsonpatch.MergePatch(original, patch)
+	} else {
+		var ops jsonpatch.Patch
+		if ops, err = jsonpatch.DecodePatch(patch); err == nil {
+			patched, err = ops.Apply(original)
+		}
+	}
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		a.writeResponseError(w, fmt.Errorf("patch is not applicable: %s", err), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid patch: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var u database.User
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&u); err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid data passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if u.ID != old.ID || u.EmailVerified != old.EmailVerified || u.Pending != old.Pending {
+		a.writeResponseError(w, ErrReadOnlyField, http.StatusBadRequest)
+		return
+	}
+
+	a.replaceUser(w, r, old, &u)
+}
+
+//replaceUser validates and stores the new data of the old user, an empty email is allowed.
+func (a *API) replaceUser(w http.ResponseWriter, r *http.Request, old, u *database.User) {
+	if err := validate.Var(u.Username, "min=1"); err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid data passed: Username: %s", err), http.StatusBadRequest)
+		return
+	}
+	if u.Email != "" {
+		if err := validate.Var(u.Email, "email"); err != nil {
+			a.writeResponseError(w, fmt.Errorf("invalid data passed: Email: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	u.ID = old.ID
+
+	if err := a.storeFor(r.Context()).ReplaceUser(u); err != nil {
+		if errors.Is(err, database.ErrUserNotExist) || errors.Is(err, database.ErrNameAlreadyExist) || invalidAttributes(err) {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	if u.Email != "" && u.Email != old.Email {
+		if err := a.sendEmailVerification(u); err != nil {
+			a.internalError(w, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func mediaType(r *http.Request) string {
+	t, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return t
+}
+
+//hasJSONField reports whether the JSON object has the field, names are matched case insensitive like encoding/json does.
+func hasJSONField(body []byte, name string) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return false
+	}
+
+	for key := range fields {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+
+	return false
+}
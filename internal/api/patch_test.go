@@ -0,0 +1,126 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func patchUser(api *API, id uuid.UUID, contentType, body string) int {
+	req, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("/user/%s", id), strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.SetBasicAuth(adminUname, adminPass)
+
+	return execRequest(req, api.httpServer).Code
+}
+
+func testAdminWithEmail(t *testing.T, api *API, id uuid.UUID) {
+	err := api.store.UpdateUser(&database.User{ID: id, Email: "e@mail.ru", Admin: true})
+	assert.Nil(t, err)
+}
+
+func TestAPI_UpdateUserHandler_KeepsAdmin(t *testing.T) {
+	api, id := testBootstrap(t)
+	testAdminWithEmail(t, api, id)
+
+	code := patchUser(api, id, "application/json", `{"Username": "renamed"}`)
+	assert.Equal(t, http.StatusNoContent, code)
+
+	u, _ := api.store.GetUserByID(id)
+	assert.Equal(t, "renamed", u.Username)
+	assert.True(t, u.Admin, "Admin is kept if it is not passed")
+
+	code = patchUser(api, id, "application/json", `{"admin": false}`)
+	assert.Equal(t, http.StatusNoContent, code)
+
+	u, _ = api.store.GetUserByID(id)
+	assert.False(t, u.Admin)
+}
+
+func TestAPI_UpdateUserHandler_MergePatch(t *testing.T) {
+	api, id := testBootstrap(t)
+	testAdminWithEmail(t, api, id)
+
+	code := patchUser(api, id, contentTypeMergePatch+"; charset=utf-8", `{"Email": null, "Password": "new"}`)
+	assert.Equal(t, http.StatusNoContent, code)
+
+	u, _ := api.store.GetUserByID(id)
+	assert.Equal(t, "", u.Email)
+	assert.Equal(t, notAdminUname, u.Username)
+	assert.True(t, u.Admin)
+	assert.True(t, u.CheckPassword("new"))
+
+	code = patchUser(api, id, contentTypeMergePatch, `{"Admin": false}`)
+	assert.Equal(t, http.StatusNoContent, code)
+
+	u, _ = api.store.GetUserByID(id)
+	assert.False(t, u.Admin)
+
+	code = patchUser(api, id, contentTypeMergePatch, `{"Pending": true}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code = patchUser(api, id, contentTypeMergePatch, `{"Username": null}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code = patchUser(api, id, contentTypeMergePatch, `{"Nickname": "x"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestAPI_UpdateUserHandler_JSONPatch(t *testing.T) {
+	api, id := testBootstrap(t)
+	testAdminWithEmail(t, api, id)
+
+	code := patchUser(api, id, contentTypeJSONPatch, `[
+		{"op": "test", "path": "/Username", "value": "`+notAdminUname+`"},
+		{"op": "replace", "path": "/Username", "value": "renamed"},
+		{"op": "remove", "path": "/Email"}
+	]`)
+	assert.Equal(t, http.StatusNoContent, code)
+
+	u, _ := api.store.GetUserByID(id)
+	assert.Equal(t, "renamed", u.Username)
+	assert.Equal(t, "", u.Email)
+	assert.True(t, u.Admin)
+
+	code = patchUser(api, id, contentTypeJSONPatch, `[{"op": "test", "path": "/Username", "value": "other"}]`)
+	assert.Equal(t, http.StatusConflict, code)
+
+	code = patchUser(api, id, contentTypeJSONPatch, `{"op": "remove"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestAPI_ReplaceUserHandler(t *testing.T) {
+	api, id := testBootstrap(t)
+	testAdminWithEmail(t, api, id)
+
+	old, _ := api.store.GetUserByID(id)
+	hash := old.Password
+
+	req, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("/user/%s", id), toJSON(database.User{
+		ID:       id,
+		Username: "replaced",
+		Password: hash,
+	}))
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	u, _ := api.store.GetUserByID(id)
+	assert.Equal(t, "replaced", u.Username)
+	assert.Equal(t, "", u.Email)
+	assert.False(t, u.Admin)
+	assert.Equal(t, hash, u.Password, "The current hash keeps the password")
+
+	req, _ = http.NewRequest(http.MethodPut, fmt.Sprintf("/user/%s", id), toJSON(database.User{Username: adminUname}))
+	req.SetBasicAuth(adminUname, adminPass)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), database.ErrNameAlreadyExist.Error())
+}
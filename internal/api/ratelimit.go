@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//rateLimiter allows at most limit hits per key within the sliding window.
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	hits   map[string][]time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		window: window,
+		hits:   make(map[string][]time.Time),
+	}
+}
+
+//Allow registers a hit for the key. If the limit is reached, returns false and the time to wait.
+func (l *rateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	from := now.Add(-l.window)
+
+	hits := l.hits[key]
+	i := 0
+	for i < len(hits) && !hits[i].After(from) {
+		i++
+	}
+	hits = hits[i:]
+
+	if len(hits) >= l.limit {
+		l.hits[key] = hits
+		return false, hits[0].Sub(from)
+	}
+
+	l.hits[key] = append(hits, now)
+
+	//чистим ключи, по которым давно не было запросов, чтобы карта не росла бесконечно
+	for k, h := range l.hits {
+		if len(h) == 0 || !h[len(h)-1].After(from) {
+			delete(l.hits, k)
+		}
+	}
+
+	return true, 0
+}
+
+//clientIP returns the address of the client without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
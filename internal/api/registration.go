@@ -0,0 +1,151 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/MarySmirnova/api_users/internal/mail"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+var ErrTooManyRequests error = errors.New("too many requests, try again later")
+var ErrAccountPending error = errors.New("account is waiting for approval")
+
+//RegistrationHook is called after an administrator approves or rejects a registration.
+type RegistrationHook func(u *database.User, approved bool)
+
+type RegisterRequest struct {
+	Email    string `json:"email" validate:"email"`
+	Username string `json:"username" validate:"min=1"`
+	Password string `json:"password" validate:"min=1"`
+	//Attributes are the custom attributes of the user, required ones must be passed
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+//RegisterHandler creates a pending user. The user can log in after an administrator approves it.
+func (a *API) RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.registration.Enabled {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if ok, wait := a.registrationLimiter.Allow(clientIP(r)); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		a.writeResponseError(w, ErrTooManyRequests, http.StatusTooManyRequests)
+		return
+	}
+
+	var req RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.writeResponseError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid data passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	u := database.User{
+		Email:      req.Email,
+		Username:   req.Username,
+		Password:   req.Password,
+		Pending:    true,
+		Attributes: req.Attributes,
+	}
+
+	if err := a.storeFor(r.Context()).NewUser(&u); err != nil {
+		if errors.Is(err, database.ErrNameAlreadyExist) || invalidAttributes(err) {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	if err := a.sendEmailVerification(&u); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(u.ID)
+}
+
+//GetRegistrationsHandler returns the queue of users waiting for approval.
+func (a *API) GetRegistrationsHandler(w http.ResponseWriter, r *http.Request) {
+	if !hasPermission(r.Context(), database.PermissionRegistrations) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(a.storeFor(r.Context()).GetPendingUsers())
+}
+
+func (a *API) ApproveRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	a.decideRegistration(w, r, true)
+}
+
+func (a *API) RejectRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	a.decideRegistration(w, r, false)
+}
+
+func (a *API) decideRegistration(w http.ResponseWriter, r *http.Request, approve bool) {
+	if !hasPermission(r.Context(), database.PermissionRegistrations) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var u *database.User
+	if approve {
+		u, err = a.storeFor(r.Context()).ApproveUser(uid)
+	} else {
+		u, err = a.storeFor(r.Context()).RejectUser(uid)
+	}
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotExist) || errors.Is(err, database.ErrUserNotPending) {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	a.notifyRegistration(u, approve)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//notifyRegistration tells the user about the decision and runs the registration hooks.
+func (a *API) notifyRegistration(u *database.User, approved bool) {
+	if u.Email != "" {
+		msg := mail.Message{
+			To:      u.Email,
+			Subject: "Registration approved",
+			Body:    fmt.Sprintf("The account %q has been approved, you can log in now.", u.Username),
+		}
+		if !approved {
+			msg.Subject = "Registration rejected"
+			msg.Body = fmt.Sprintf("The registration of the account %q has been rejected.", u.Username)
+		}
+		a.sendMail(msg)
+	}
+
+	for _, hook := range a.registrationHooks {
+		hook(u, approved)
+	}
+}
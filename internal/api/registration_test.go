@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func registrationBootstrap(t *testing.T) *API {
+	api, _ := testBootstrap(t)
+	api.registration.Enabled = true
+	api.registrationLimiter = newRateLimiter(2, time.Hour)
+
+	return api
+}
+
+func register(api *API, uname string) *http.Request {
+	req, _ := http.NewRequest(http.MethodPost, "/register", toJSON(RegisterRequest{
+		Email:    uname + "@mail.ru",
+		Username: uname,
+		Password: uname,
+	}))
+	req.RemoteAddr = "10.0.0.1:12345"
+
+	return req
+}
+
+func TestAPI_RegisterHandler_Disabled(t *testing.T) {
+	api, _ := testBootstrap(t)
+
+	resp := execRequest(register(api, "new"), api.httpServer)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestAPI_RegisterHandler_RateLimit(t *testing.T) {
+	api := registrationBootstrap(t)
+
+	resp := execRequest(register(api, "first"), api.httpServer)
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+
+	resp = execRequest(register(api, "second"), api.httpServer)
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+
+	resp = execRequest(register(api, "third"), api.httpServer)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.NotEmpty(t, resp.Header().Get("Retry-After"))
+}
+
+func TestAPI_ApproveRegistrationHandler_GoodWay(t *testing.T) {
+	api := registrationBootstrap(t)
+
+	var approved []uuid.UUID
+	api.registrationHooks = append(api.registrationHooks, func(u *database.User, ok bool) {
+		if ok {
+			approved = append(approved, u.ID)
+		}
+	})
+
+	resp := execRequest(register(api, "new"), api.httpServer)
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+
+	var id uuid.UUID
+	err := json.Unmarshal(resp.Body.Bytes(), &id)
+	assert.Nil(t, err)
+
+	req, _ := http.NewRequest(http.MethodGet, "/user", nil)
+	req.SetBasicAuth("new", "new")
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Contains(t, resp.Body.String(), ErrAccountPending.Error())
+
+	req, _ = http.NewRequest(http.MethodGet, "/registrations", nil)
+	req.SetBasicAuth(adminUname, adminPass)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var pending []database.User
+	err = json.Unmarshal(resp.Body.Bytes(), &pending)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pending))
+
+	req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/registrations/%s/approve", id), nil)
+	req.SetBasicAuth(adminUname, adminPass)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Equal(t, []uuid.UUID{id}, approved)
+
+	req, _ = http.NewRequest(http.MethodGet, "/user", nil)
+	req.SetBasicAuth("new", "new")
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestAPI_RejectRegistrationHandler_GoodWay(t *testing.T) {
+	api := registrationBootstrap(t)
+
+	resp := execRequest(register(api, "new"), api.httpServer)
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+
+	var id uuid.UUID
+	_ = json.Unmarshal(resp.Body.Bytes(), &id)
+
+	req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/registrations/%s/reject", id), nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	req.SetBasicAuth(adminUname, adminPass)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	_, err := api.store.GetUserByName("new")
+	assert.ErrorIs(t, err, database.ErrUserNotExist)
+}
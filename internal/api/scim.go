@@ -0,0 +1,510 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	scimSchemaUser         string = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimSchemaList         string = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimSchemaError        string = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimSchemaPatch        string = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	scimSchemaConfig       string = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimSchemaResourceType string = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	scimSchemaSchema       string = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+
+	scimResourceUser   string = "User"
+	scimEmailType      string = "work"
+	scimContentType    string = "application/scim+json"
+	scimDefaultCount   int    = 100
+	scimMaxResults     int    = 200
+	scimPasswordLength int    = 24
+)
+
+var ErrSCIMUnauthorized error = errors.New("invalid SCIM token")
+
+type SCIMUser struct {
+	Schemas  []string    `json:"schemas"`
+	ID       string      `json:"id,omitempty"`
+	UserName string      `json:"userName"`
+	Emails   []SCIMEmail `json:"emails,omitempty"`
+	Active   *bool       `json:"active,omitempty"`
+	Password string      `json:"password,omitempty"`
+	Meta     *SCIMMeta   `json:"meta,omitempty"`
+}
+
+type SCIMEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type SCIMMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location"`
+}
+
+type SCIMListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+type SCIMError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	SCIMType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+type SCIMPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations"`
+}
+
+type SCIMPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+//SCIMMiddleware checks the SCIM bearer token. SCIM is disabled when the token is not configured.
+func (a *API) SCIMMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", scimContentType)
+
+		if a.scimToken == "" && len(a.scimTenantTokens) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		expected, err := a.scimTokenOf(currentTenant(r.Context()))
+		if err != nil {
+			a.internalError(w, err)
+			return
+		}
+
+		token, ok := bearerToken(r)
+		if !ok || expected == "" || subtle.ConstantTimeCompare([]byte(database.HashSecret(token)), []byte(database.HashSecret(expected))) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+			a.writeSCIMError(w, ErrSCIMUnauthorized, http.StatusUnauthorized, "")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ContextActorKey, scimActor)))
+	})
+}
+
+//scimTokenOf returns the SCIM token of the tenant, empty if the tenant has none. Every token is bound
+//to its tenant, so a provisioning client of one tenant can not reach the users of the others.
+func (a *API) scimTokenOf(tid uuid.UUID) (string, error) {
+	if tid == database.DefaultTenant {
+		return a.scimToken, nil
+	}
+
+	t, err := a.store.GetTenant(tid)
+	if err != nil {
+		if errors.Is(err, database.ErrTenantNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return a.scimTenantTokens[t.Name], nil
+}
+
+//SCIMListUsersHandler returns users sorted by name, supports filter, startIndex and count parameters.
+func (a *API) SCIMListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var filter scimFilter
+	if expr := q.Get("filter"); expr != "" {
+		var err error
+		if filter, err = parseSCIMFilter(expr); err != nil {
+			a.writeSCIMError(w, err, http.StatusBadRequest, "invalidFilter")
+			return
+		}
+	}
+
+	startIndex, count := 1, scimDefaultCount
+	if v := q.Get("startIndex"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			a.writeSCIMError(w, fmt.Errorf("invalid startIndex: %s", err), http.StatusBadRequest, "invalidValue")
+			return
+		}
+		if n > 1 {
+			startIndex = n
+		}
+	}
+	if v := q.Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			a.writeSCIMError(w, fmt.Errorf("invalid count: %s", err), http.StatusBadRequest, "invalidValue")
+			return
+		}
+		count = n
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > scimMaxResults {
+		count = scimMaxResults
+	}
+
+	users := []*database.User{}
+	for _, u := range a.storeFor(r.Context()).GetAllUsers() {
+		if filter == nil || filter.match(u) {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	total := len(users)
+
+	users = paginate(users, page{Offset: startIndex - 1, Limit: count})
+	if count == 0 {
+		users = users[:0]
+	}
+
+	resp := SCIMListResponse{
+		Schemas:      []string{scimSchemaList},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(users),
+		Resources:    make([]interface{}, 0, len(users)),
+	}
+	for _, u := range users {
+		resp.Resources = append(resp.Resources, a.scimUser(u))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (a *API) SCIMGetUserHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := a.scimLookup(w, r)
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(a.scimUser(u))
+}
+
+//SCIMCreateUserHandler creates a user. Without a password a random one is set, the user can change it by the password reset.
+func (a *API) SCIMCreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var req SCIMUser
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.writeSCIMError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest, "invalidSyntax")
+		return
+	}
+
+	u := database.User{
+		Email:    primarySCIMEmail(req.Emails),
+		Username: req.UserName,
+		Password: req.Password,
+		Pending:  req.Active != nil && !*req.Active,
+	}
+
+	if u.Password == "" {
+		password, err := randomToken(scimPasswordLength)
+		if err != nil {
+			a.internalError(w, err)
+			return
+		}
+		u.Password = password
+	}
+
+	if err := validate.Struct(u); err != nil {
+		a.writeSCIMError(w, fmt.Errorf("invalid data passed: %s", err), http.StatusBadRequest, "invalidValue")
+		return
+	}
+
+	if err := a.storeFor(r.Context()).NewUser(&u); err != nil {
+		a.scimStoreError(w, err)
+		return
+	}
+
+	if err := a.sendEmailVerification(&u); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", a.scimLocation(&u))
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(a.scimUser(&u))
+}
+
+//SCIMReplaceUserHandler replaces the user with the passed resource. The password is kept if it is not passed.
+func (a *API) SCIMReplaceUserHandler(w http.ResponseWriter, r *http.Request) {
+	old, ok := a.scimLookup(w, r)
+	if !ok {
+		return
+	}
+
+	var req SCIMUser
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.writeSCIMError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest, "invalidSyntax")
+		return
+	}
+
+	active := req.Active == nil || *req.Active
+	a.scimSave(w, r, old, req.UserName, primarySCIMEmail(req.Emails), req.Password, active)
+}
+
+//SCIMPatchUserHandler applies add, replace and remove operations to userName, emails, active and password.
+func (a *API) SCIMPatchUserHandler(w http.ResponseWriter, r *http.Request) {
+	old, ok := a.scimLookup(w, r)
+	if !ok {
+		return
+	}
+
+	var req SCIMPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.writeSCIMError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest, "invalidSyntax")
+		return
+	}
+
+	patched := SCIMUser{UserName: old.Username, Emails: []SCIMEmail{{Value: old.Email}}}
+	active := !old.Pending
+	patched.Active = &active
+
+	for _, op := range req.Operations {
+		if err := applySCIMPatch(&patched, op); err != nil {
+			a.writeSCIMError(w, err, http.StatusBadRequest, "invalidValue")
+			return
+		}
+	}
+
+	a.scimSave(w, r, old, patched.UserName, primarySCIMEmail(patched.Emails), patched.Password, *patched.Active)
+}
+
+func (a *API) SCIMDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := a.scimLookup(w, r)
+	if !ok {
+		return
+	}
+
+	if err := a.storeFor(r.Context()).DeleteUser(u.ID); err != nil {
+		a.scimStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//applySCIMPatch applies one operation to the resource. Operation names and paths are case insensitive,
+//a filter of the emails path selects the only email of the user.
+func applySCIMPatch(u *SCIMUser, op SCIMPatchOperation) error {
+	kind := strings.ToLower(op.Op)
+	if kind != "add" && kind != "replace" && kind != "remove" {
+		return fmt.Errorf("unknown operation %q", op.Op)
+	}
+
+	path := strings.ToLower(strings.TrimPrefix(strings.ToLower(op.Path), strings.ToLower(scimSchemaUser)+":"))
+	if i := strings.Index(path, "["); i >= 0 {
+		j := strings.Index(path, "]")
+		if j < i {
+			return fmt.Errorf("invalid path %q", op.Path)
+		}
+		path = path[:i] + path[j+1:]
+	}
+
+	if kind == "remove" {
+		return fmt.Errorf("attribute %q can not be removed", op.Path)
+	}
+
+	if path == "" {
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &raw); err != nil {
+			return fmt.Errorf("invalid value: %s", err)
+		}
+		for key, v := range raw {
+			if err := applySCIMPatch(u, SCIMPatchOperation{Op: kind, Path: key, Value: v}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch path {
+	case "username":
+		return json.Unmarshal(op.Value, &u.UserName)
+	case "password":
+		return json.Unmarshal(op.Value, &u.Password)
+	case "active":
+		active, err := scimBool(op.Value)
+		if err != nil {
+			return err
+		}
+		u.Active = &active
+		return nil
+	case "emails":
+		var emails []SCIMEmail
+		if err := json.Unmarshal(op.Value, &emails); err != nil {
+			return fmt.Errorf("invalid emails: %s", err)
+		}
+		if len(emails) > 0 {
+			u.Emails = emails
+		}
+		return nil
+	case "emails.value":
+		var email string
+		if err := json.Unmarshal(op.Value, &email); err != nil {
+			return fmt.Errorf("invalid email: %s", err)
+		}
+		u.Emails = []SCIMEmail{{Value: email}}
+		return nil
+	case "id", "meta", "schemas", "emails.type", "emails.primary":
+		return nil
+	}
+
+	return fmt.Errorf("unknown attribute %q", op.Path)
+}
+
+//scimBool reads a boolean, some identity providers send it as a string.
+func scimBool(raw json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	}
+
+	return false, fmt.Errorf("invalid boolean %s", raw)
+}
+
+//scimSave updates the user with the passed attributes and writes the resulting resource.
+func (a *API) scimSave(w http.ResponseWriter, r *http.Request, old *database.User, username, email, password string, active bool) {
+	if username == "" {
+		a.writeSCIMError(w, errors.New("userName is required"), http.StatusBadRequest, "invalidValue")
+		return
+	}
+	if err := validate.Var(email, "email"); err != nil {
+		a.writeSCIMError(w, fmt.Errorf("invalid data passed: %s", err), http.StatusBadRequest, "invalidValue")
+		return
+	}
+
+	u := database.User{
+		ID:       old.ID,
+		Email:    email,
+		Username: username,
+		Password: password,
+		Admin:    old.Admin,
+	}
+
+	if err := a.storeFor(r.Context()).UpdateUser(&u); err != nil {
+		a.scimStoreError(w, err)
+		return
+	}
+
+	if active == u.Pending {
+		updated, err := a.storeFor(r.Context()).SetUserPending(u.ID, !active)
+		if err != nil {
+			a.scimStoreError(w, err)
+			return
+		}
+		u = *updated
+	}
+
+	if email != old.Email && !u.EmailVerified {
+		if err := a.sendEmailVerification(&u); err != nil {
+			a.internalError(w, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(a.scimUser(&u))
+}
+
+func (a *API) scimLookup(w http.ResponseWriter, r *http.Request) (*database.User, bool) {
+	uid, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		a.writeSCIMError(w, database.ErrUserNotExist, http.StatusNotFound, "")
+		return nil, false
+	}
+
+	u, err := a.storeFor(r.Context()).GetUserByID(uid)
+	if err != nil {
+		a.scimStoreError(w, err)
+		return nil, false
+	}
+
+	return u, true
+}
+
+func (a *API) scimStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrUserNotExist):
+		a.writeSCIMError(w, err, http.StatusNotFound, "")
+	case errors.Is(err, database.ErrNameAlreadyExist), errors.Is(err, database.ErrAttributeNotUnique):
+		a.writeSCIMError(w, err, http.StatusConflict, "uniqueness")
+	case invalidAttributes(err):
+		a.writeSCIMError(w, err, http.StatusBadRequest, "invalidValue")
+	default:
+		a.internalError(w, err)
+	}
+}
+
+func (a *API) writeSCIMError(w http.ResponseWriter, err error, code int, scimType string) {
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(SCIMError{
+		Schemas:  []string{scimSchemaError},
+		Status:   strconv.Itoa(code),
+		SCIMType: scimType,
+		Detail:   err.Error(),
+	})
+}
+
+func (a *API) scimLocation(u *database.User) string {
+	return a.tenantURL(u.TenantID) + "/scim/v2/Users/" + u.ID.String()
+}
+
+func (a *API) scimUser(u *database.User) SCIMUser {
+	active := !u.Pending
+
+	return SCIMUser{
+		Schemas:  []string{scimSchemaUser},
+		ID:       u.ID.String(),
+		UserName: u.Username,
+		Emails:   []SCIMEmail{{Value: u.Email, Type: scimEmailType, Primary: true}},
+		Active:   &active,
+		Meta:     &SCIMMeta{ResourceType: scimResourceUser, Location: a.scimLocation(u)},
+	}
+}
+
+//primarySCIMEmail returns the primary email or the first one.
+func primarySCIMEmail(emails []SCIMEmail) string {
+	for _, e := range emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(emails) > 0 {
+		return emails[0].Value
+	}
+
+	return ""
+}
@@ -0,0 +1,327 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+)
+
+var errInvalidFilter error = errors.New("invalid filter")
+
+//scimFilter is a parsed SCIM filter expression (RFC 7644, section 3.4.2.2).
+type scimFilter interface {
+	match(u *database.User) bool
+}
+
+type scimAnd struct{ left, right scimFilter }
+type scimOr struct{ left, right scimFilter }
+type scimNot struct{ filter scimFilter }
+
+//scimCompare compares an attribute with a value, op is one of eq, ne, co, sw, ew, gt, ge, lt, le or pr.
+type scimCompare struct {
+	attr  string
+	op    string
+	value interface{}
+}
+
+func (f scimAnd) match(u *database.User) bool { return f.left.match(u) && f.right.match(u) }
+func (f scimOr) match(u *database.User) bool  { return f.left.match(u) || f.right.match(u) }
+func (f scimNot) match(u *database.User) bool { return !f.filter.match(u) }
+
+//scimAttributes lists filterable attributes in lower case, ids are compared case sensitive.
+var scimAttributes = map[string]bool{
+	"id":                true,
+	"username":          false,
+	"emails":            false,
+	"emails.value":      false,
+	"emails.type":       false,
+	"emails.primary":    false,
+	"active":            false,
+	"meta.resourcetype": true,
+}
+
+//scimAttribute returns the value of the attribute of the user, the only email is the primary work email.
+func scimAttribute(u *database.User, attr string) interface{} {
+	switch attr {
+	case "id":
+		return u.ID.String()
+	case "username":
+		return u.Username
+	case "emails", "emails.value":
+		return u.Email
+	case "emails.type":
+		return scimEmailType
+	case "emails.primary":
+		return true
+	case "active":
+		return !u.Pending
+	case "meta.resourcetype":
+		return scimResourceUser
+	}
+
+	return nil
+}
+
+func (f scimCompare) match(u *database.User) bool {
+	actual := scimAttribute(u, f.attr)
+
+	if f.op == "pr" {
+		s, ok := actual.(string)
+		return !ok || s != ""
+	}
+
+	switch v := f.value.(type) {
+	case bool:
+		b, ok := actual.(bool)
+		if !ok {
+			return false
+		}
+		switch f.op {
+		case "eq":
+			return b == v
+		case "ne":
+			return b != v
+		}
+		return false
+	case string:
+		s, ok := actual.(string)
+		if !ok {
+			return false
+		}
+		if !scimAttributes[f.attr] {
+			s, v = strings.ToLower(s), strings.ToLower(v)
+		}
+		switch f.op {
+		case "eq":
+			return s == v
+		case "ne":
+			return s != v
+		case "co":
+			return strings.Contains(s, v)
+		case "sw":
+			return strings.HasPrefix(s, v)
+		case "ew":
+			return strings.HasSuffix(s, v)
+		case "gt":
+			return s > v
+		case "ge":
+			return s >= v
+		case "lt":
+			return s < v
+		case "le":
+			return s <= v
+		}
+	case nil:
+		s, ok := actual.(string)
+		switch f.op {
+		case "eq":
+			return ok && s == ""
+		case "ne":
+			return !ok || s != ""
+		}
+	}
+
+	return false
+}
+
+//parseSCIMFilter parses a filter expression. Attribute names are case insensitive and may have
+//the core schema URN prefix, complex attributes can be filtered like emails[type eq "work"].
+func parseSCIMFilter(expr string) (scimFilter, error) {
+	tokens, err := scimTokens(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &scimFilterParser{tokens: tokens}
+	f, err := p.or("")
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("%w: unexpected %q", errInvalidFilter, p.peek())
+	}
+
+	return f, nil
+}
+
+type scimFilterParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *scimFilterParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *scimFilterParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *scimFilterParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *scimFilterParser) keyword(word string) bool {
+	if strings.EqualFold(p.peek(), word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *scimFilterParser) expect(t string) error {
+	if p.next() != t {
+		return fmt.Errorf("%w: %q expected", errInvalidFilter, t)
+	}
+	return nil
+}
+
+//or parses the expression, prefix is the parent attribute inside brackets.
+func (p *scimFilterParser) or(prefix string) (scimFilter, error) {
+	left, err := p.and(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("or") {
+		right, err := p.and(prefix)
+		if err != nil {
+			return nil, err
+		}
+		left = scimOr{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *scimFilterParser) and(prefix string) (scimFilter, error) {
+	left, err := p.factor(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("and") {
+		right, err := p.factor(prefix)
+		if err != nil {
+			return nil, err
+		}
+		left = scimAnd{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *scimFilterParser) factor(prefix string) (scimFilter, error) {
+	if p.keyword("not") {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		f, err := p.or(prefix)
+		if err != nil {
+			return nil, err
+		}
+		return scimNot{f}, p.expect(")")
+	}
+
+	if p.peek() == "(" {
+		p.next()
+		f, err := p.or(prefix)
+		if err != nil {
+			return nil, err
+		}
+		return f, p.expect(")")
+	}
+
+	attr := p.next()
+	if attr == "" || strings.ContainsAny(attr, `()[]"`) {
+		return nil, fmt.Errorf("%w: attribute expected", errInvalidFilter)
+	}
+	attr = strings.ToLower(strings.TrimPrefix(strings.ToLower(attr), strings.ToLower(scimSchemaUser)+":"))
+	if prefix != "" {
+		attr = prefix + "." + attr
+	}
+
+	if p.peek() == "[" {
+		p.next()
+		if prefix != "" {
+			return nil, fmt.Errorf("%w: nested brackets", errInvalidFilter)
+		}
+		f, err := p.or(attr)
+		if err != nil {
+			return nil, err
+		}
+		return f, p.expect("]")
+	}
+
+	if _, ok := scimAttributes[attr]; !ok {
+		return nil, fmt.Errorf("%w: unknown attribute %q", errInvalidFilter, attr)
+	}
+
+	op := strings.ToLower(p.next())
+	switch op {
+	case "pr":
+		return scimCompare{attr: attr, op: op}, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, fmt.Errorf("%w: unknown operator %q", errInvalidFilter, op)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(p.next()), &value); err != nil {
+		return nil, fmt.Errorf("%w: invalid value", errInvalidFilter)
+	}
+	switch value.(type) {
+	case string, bool, nil:
+	default:
+		return nil, fmt.Errorf("%w: unsupported value", errInvalidFilter)
+	}
+
+	return scimCompare{attr: attr, op: op, value: value}, nil
+}
+
+//scimTokens splits the expression to brackets, quoted strings and words.
+func scimTokens(expr string) ([]string, error) {
+	tokens := []string{}
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("()[]", r):
+			tokens = append(tokens, string(r))
+			i++
+		case r == '"':
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("%w: unterminated string", errInvalidFilter)
+			}
+			tokens = append(tokens, string(runes[i:j+1]))
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune(`()[]"`, runes[j]) {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		}
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type scimSchemaAttribute struct {
+	Name          string                `json:"name"`
+	Type          string                `json:"type"`
+	MultiValued   bool                  `json:"multiValued"`
+	Required      bool                  `json:"required"`
+	CaseExact     bool                  `json:"caseExact"`
+	Mutability    string                `json:"mutability"`
+	Returned      string                `json:"returned"`
+	Uniqueness    string                `json:"uniqueness"`
+	SubAttributes []scimSchemaAttribute `json:"subAttributes,omitempty"`
+}
+
+//scimUserSchema describes the supported part of the core User schema.
+var scimUserSchema = map[string]interface{}{
+	"schemas":     []string{scimSchemaSchema},
+	"id":          scimSchemaUser,
+	"name":        "User",
+	"description": "User Account",
+	"attributes": []scimSchemaAttribute{
+		{Name: "userName", Type: "string", Required: true, Mutability: "readWrite", Returned: "default", Uniqueness: "server"},
+		{Name: "password", Type: "string", Mutability: "writeOnly", Returned: "never", Uniqueness: "none"},
+		{Name: "active", Type: "boolean", Mutability: "readWrite", Returned: "default", Uniqueness: "none"},
+		{Name: "emails", Type: "complex", MultiValued: true, Required: true, Mutability: "readWrite", Returned: "default", Uniqueness: "none",
+			SubAttributes: []scimSchemaAttribute{
+				{Name: "value", Type: "string", Required: true, Mutability: "readWrite", Returned: "default", Uniqueness: "none"},
+				{Name: "type", Type: "string", Mutability: "readWrite", Returned: "default", Uniqueness: "none"},
+				{Name: "primary", Type: "boolean", Mutability: "readWrite", Returned: "default", Uniqueness: "none"},
+			},
+		},
+	},
+	"meta": map[string]string{"resourceType": "Schema", "location": "/scim/v2/Schemas/" + scimSchemaUser},
+}
+
+var scimUserResourceType = map[string]interface{}{
+	"schemas":     []string{scimSchemaResourceType},
+	"id":          scimResourceUser,
+	"name":        scimResourceUser,
+	"endpoint":    "/Users",
+	"description": "User Account",
+	"schema":      scimSchemaUser,
+	"meta":        map[string]string{"resourceType": "ResourceType", "location": "/scim/v2/ResourceTypes/" + scimResourceUser},
+}
+
+var scimServiceProviderConfig = map[string]interface{}{
+	"schemas":        []string{scimSchemaConfig},
+	"patch":          map[string]bool{"supported": true},
+	"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+	"filter":         map[string]interface{}{"supported": true, "maxResults": scimMaxResults},
+	"changePassword": map[string]bool{"supported": true},
+	"sort":           map[string]bool{"supported": false},
+	"etag":           map[string]bool{"supported": false},
+	"authenticationSchemes": []map[string]interface{}{{
+		"type":        "oauthbearertoken",
+		"name":        "OAuth Bearer Token",
+		"description": "Token of the tenant configured by SCIM_TOKEN or SCIM_TENANT_TOKENS",
+		"primary":     true,
+	}},
+	"meta": map[string]string{"resourceType": "ServiceProviderConfig", "location": "/scim/v2/ServiceProviderConfig"},
+}
+
+func (a *API) SCIMServiceProviderConfigHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(scimServiceProviderConfig)
+}
+
+func (a *API) SCIMSchemasHandler(w http.ResponseWriter, r *http.Request) {
+	a.writeSCIMList(w, scimUserSchema)
+}
+
+func (a *API) SCIMSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	if mux.Vars(r)["id"] != scimSchemaUser {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(scimUserSchema)
+}
+
+func (a *API) SCIMResourceTypesHandler(w http.ResponseWriter, r *http.Request) {
+	a.writeSCIMList(w, scimUserResourceType)
+}
+
+func (a *API) SCIMResourceTypeHandler(w http.ResponseWriter, r *http.Request) {
+	if mux.Vars(r)["id"] != scimResourceUser {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(scimUserResourceType)
+}
+
+func (a *API) writeSCIMList(w http.ResponseWriter, resources ...interface{}) {
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(SCIMListResponse{
+		Schemas:      []string{scimSchemaList},
+		TotalResults: len(resources),
+		StartIndex:   1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
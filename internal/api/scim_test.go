@@ -0,0 +1,203 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSCIMToken string = "scim-token"
+
+func execSCIM(api *API, method, path string, body interface{}) (int, []byte) {
+	var req *http.Request
+	if body != nil {
+		req, _ = http.NewRequest(method, path, toJSON(body))
+	} else {
+		req, _ = http.NewRequest(method, path, nil)
+	}
+	req.Header.Set("Authorization", "Bearer "+testSCIMToken)
+
+	resp := execRequest(req, api.httpServer)
+	return resp.Code, resp.Body.Bytes()
+}
+
+func TestAPI_SCIMMiddleware(t *testing.T) {
+	api, _ := testBootstrap(t)
+
+	code, _ := execSCIM(api, http.MethodGet, "/scim/v2/Users", nil)
+	assert.Equal(t, http.StatusNotFound, code, "SCIM is disabled without a token")
+
+	api.scimToken = testSCIMToken
+
+	req, _ := http.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+	req.SetBasicAuth(adminUname, adminPass)
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Equal(t, scimContentType, resp.Header().Get("Content-Type"))
+
+	code, _ = execSCIM(api, http.MethodGet, "/scim/v2/Users", nil)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestAPI_SCIMMiddleware_TenantBinding(t *testing.T) {
+	api, _ := testBootstrap(t)
+	api.scimToken = testSCIMToken
+	api.scimTenantTokens = map[string]string{"acme": "acme-scim-token"}
+
+	r, _ := http.NewRequest(http.MethodPost, "/tenants", toJSON(TenantRequest{Name: "acme", Admin: database.User{Username: "acme-admin", Password: "acme-pass", Email: "admin@acme.com"}}))
+	r.SetBasicAuth(adminUname, adminPass)
+	assert.Equal(t, http.StatusCreated, execRequest(r, api.httpServer).Code)
+
+	code, _ := execSCIM(api, http.MethodGet, "/t/acme/scim/v2/Users", nil)
+	assert.Equal(t, http.StatusUnauthorized, code, "The token of the default tenant does not give access to the others")
+
+	r, _ = http.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+	r.Header.Set("X-Tenant", "acme")
+	r.Header.Set("Authorization", "Bearer "+testSCIMToken)
+	assert.Equal(t, http.StatusUnauthorized, execRequest(r, api.httpServer).Code)
+
+	r, _ = http.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+	r.Header.Set("Authorization", "Bearer acme-scim-token")
+	assert.Equal(t, http.StatusUnauthorized, execRequest(r, api.httpServer).Code, "The tenant token does not give access to the default tenant")
+
+	r, _ = http.NewRequest(http.MethodGet, "/t/acme/scim/v2/Users", nil)
+	r.Header.Set("Authorization", "Bearer acme-scim-token")
+	resp := execRequest(r, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var list struct {
+		TotalResults int
+		Resources    []SCIMUser
+	}
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &list))
+	assert.Equal(t, 1, list.TotalResults)
+	assert.Equal(t, "acme-admin", list.Resources[0].UserName)
+}
+
+func TestAPI_SCIMListUsersHandler(t *testing.T) {
+	api, id := testBootstrap(t)
+	api.scimToken = testSCIMToken
+
+	code, body := execSCIM(api, http.MethodGet, "/scim/v2/Users?filter="+url.QueryEscape(`userName eq "isnotadmin"`), nil)
+	assert.Equal(t, http.StatusOK, code)
+
+	var list struct {
+		TotalResults int
+		Resources    []SCIMUser
+	}
+	assert.Nil(t, json.Unmarshal(body, &list))
+	assert.Equal(t, 1, list.TotalResults)
+	assert.Equal(t, id.String(), list.Resources[0].ID)
+
+	code, body = execSCIM(api, http.MethodGet, "/scim/v2/Users?startIndex=2&count=5", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, json.Unmarshal(body, &list))
+	assert.Equal(t, 2, list.TotalResults)
+	assert.Equal(t, notAdminUname, list.Resources[0].UserName)
+
+	code, _ = execSCIM(api, http.MethodGet, "/scim/v2/Users?filter="+url.QueryEscape(`nickName eq "x"`), nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestAPI_SCIM_Lifecycle(t *testing.T) {
+	api, _ := testBootstrap(t)
+	api.scimToken = testSCIMToken
+
+	code, body := execSCIM(api, http.MethodPost, "/scim/v2/Users", SCIMUser{
+		Schemas:  []string{scimSchemaUser},
+		UserName: "jdoe",
+		Emails:   []SCIMEmail{{Value: "other@example.com"}, {Value: "jdoe@example.com", Primary: true}},
+	})
+	assert.Equal(t, http.StatusCreated, code)
+
+	var created SCIMUser
+	assert.Nil(t, json.Unmarshal(body, &created))
+	assert.Equal(t, "jdoe@example.com", created.Emails[0].Value)
+	assert.True(t, *created.Active)
+
+	code, _ = execSCIM(api, http.MethodPost, "/scim/v2/Users", SCIMUser{UserName: "jdoe", Emails: []SCIMEmail{{Value: "jdoe@example.com"}}})
+	assert.Equal(t, http.StatusConflict, code)
+
+	path := "/scim/v2/Users/" + created.ID
+
+	code, body = execSCIM(api, http.MethodPatch, path, SCIMPatchRequest{
+		Schemas: []string{scimSchemaPatch},
+		Operations: []SCIMPatchOperation{
+			{Op: "Replace", Path: "active", Value: json.RawMessage(`"False"`)},
+			{Op: "replace", Path: `emails[type eq "work"].value`, Value: json.RawMessage(`"john@example.com"`)},
+			{Op: "replace", Value: json.RawMessage(`{"userName": "john", "password": "secret"}`)},
+		},
+	})
+	assert.Equal(t, http.StatusOK, code)
+
+	var patched SCIMUser
+	assert.Nil(t, json.Unmarshal(body, &patched))
+	assert.Equal(t, "john", patched.UserName)
+	assert.Equal(t, "john@example.com", patched.Emails[0].Value)
+	assert.False(t, *patched.Active)
+
+	u, err := api.store.GetUserByID(uuid.MustParse(created.ID))
+	assert.Nil(t, err)
+	assert.True(t, u.Pending)
+	assert.True(t, u.CheckPassword("secret"))
+
+	active := true
+	code, _ = execSCIM(api, http.MethodPut, path, SCIMUser{UserName: "john", Emails: []SCIMEmail{{Value: "john@example.com"}}, Active: &active})
+	assert.Equal(t, http.StatusOK, code)
+
+	u, _ = api.store.GetUserByID(uuid.MustParse(created.ID))
+	assert.False(t, u.Pending)
+	assert.True(t, u.CheckPassword("secret"), "Replace without a password keeps it")
+
+	code, _ = execSCIM(api, http.MethodDelete, path, nil)
+	assert.Equal(t, http.StatusNoContent, code)
+
+	code, body = execSCIM(api, http.MethodGet, path, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Contains(t, string(body), scimSchemaError)
+}
+
+func TestAPI_SCIM_Discovery(t *testing.T) {
+	api, _ := testBootstrap(t)
+	api.scimToken = testSCIMToken
+
+	for _, path := range []string{"/scim/v2/ServiceProviderConfig", "/scim/v2/Schemas", "/scim/v2/Schemas/" + scimSchemaUser, "/scim/v2/ResourceTypes", "/scim/v2/ResourceTypes/User"} {
+		code, body := execSCIM(api, http.MethodGet, path, nil)
+		assert.Equal(t, http.StatusOK, code, path)
+		assert.True(t, strings.Contains(string(body), "urn:ietf:params:scim"), path)
+	}
+}
+
+func TestParseSCIMFilter(t *testing.T) {
+	u := &database.User{ID: uuid.New(), Username: "John", Email: "john@example.com", Pending: true}
+
+	cases := map[string]bool{
+		`userName eq "john"`:                                     true,
+		`userName eq "john" and active eq true`:                  false,
+		`userName eq "x" or emails co "example"`:                 true,
+		`not (userName sw "j")`:                                  false,
+		`emails[type eq "work" and value ew ".com"]`:             true,
+		`urn:ietf:params:scim:schemas:core:2.0:User:userName pr`: true,
+		`(active eq false) and meta.resourceType eq "User"`:      true,
+		`id eq "` + strings.ToUpper(u.ID.String()) + `"`:         false,
+	}
+
+	for expr, want := range cases {
+		f, err := parseSCIMFilter(expr)
+		if assert.Nil(t, err, expr) {
+			assert.Equal(t, want, f.match(u), expr)
+		}
+	}
+
+	for _, expr := range []string{`userName`, `userName eq`, `userName xx "a"`, `(userName eq "a"`, `userName eq "a`, `title eq "a"`} {
+		_, err := parseSCIMFilter(expr)
+		assert.ErrorIs(t, err, errInvalidFilter, expr)
+	}
+}
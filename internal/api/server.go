@@ -4,11 +4,18 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/MarySmirnova/api_users/internal/blob"
 	"github.com/MarySmirnova/api_users/internal/config"
 	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/MarySmirnova/api_users/internal/mail"
+	"github.com/MarySmirnova/api_users/internal/oidc"
+	"github.com/MarySmirnova/api_users/internal/webhook"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/graphql-go/graphql"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -21,30 +28,284 @@ type Storage interface {
 	GetUserByID(uuid.UUID) (*database.User, error)
 	GetUserByName(string) (*database.User, error)
 	UpdateUser(*database.User) error
+	ReplaceUser(*database.User) error
+	ApplyBatch([]database.BatchOp, bool) []error
 	DeleteUser(uuid.UUID) error
+	UpgradePassword(uuid.UUID, string, string) error
+
+	SetTOTP(*database.TOTP) error
+	GetTOTP(uuid.UUID) (*database.TOTP, error)
+	DeleteTOTP(uuid.UUID) error
+	ConsumeRecoveryCode(uuid.UUID, string) (bool, error)
+	AcceptTOTPStep(uuid.UUID, int64) (bool, error)
+
+	NewSession(*database.Session) error
+	GetSession(string) (*database.Session, error)
+	DeleteSession(string) error
+
+	NewAPIKey(*database.APIKey) error
+	GetAPIKeysByUser(uuid.UUID) []*database.APIKey
+	GetAPIKeyByPrefix(string) (*database.APIKey, error)
+	TouchAPIKey(uuid.UUID, time.Time) error
+	DeleteAPIKey(uuid.UUID) error
+
+	NewPasswordReset(*database.PasswordReset) error
+	ConsumePasswordReset(string) (*database.PasswordReset, error)
+	DeleteUserSessions(uuid.UUID) error
+
+	NewEmailVerification(*database.EmailVerification) error
+	VerifyEmail(string) (*database.User, error)
+
+	GetPendingUsers() []*database.User
+	ApproveUser(uuid.UUID) (*database.User, error)
+	RejectUser(uuid.UUID) (*database.User, error)
+	SetUserPending(uuid.UUID, bool) (*database.User, error)
+
+	NewWebhook(*database.Webhook) error
+	GetWebhooks() []*database.Webhook
+	GetWebhook(uuid.UUID) (*database.Webhook, error)
+	UpdateWebhook(*database.Webhook) error
+	DeleteWebhook(uuid.UUID) error
+	GetWebhookDelivery(uuid.UUID) (*database.WebhookDelivery, error)
+	GetWebhookDeliveries(uuid.UUID) []*database.WebhookDelivery
+	GetDeliveriesByStatus(database.DeliveryStatus) []*database.WebhookDelivery
+	UpdateWebhookDelivery(*database.WebhookDelivery) error
+
+	AddListener(database.Listener)
+
+	WithActor(string) Storage
+	WithTenant(uuid.UUID) Storage
+	GetUserHistory(uuid.UUID) []*database.UserVersion
+	GetUserAsOf(uuid.UUID, time.Time) (*database.User, error)
+	RevertUser(uuid.UUID, int) (*database.User, error)
+
+	NewTenant(*database.Tenant) error
+	GetTenants() []*database.Tenant
+	GetTenant(uuid.UUID) (*database.Tenant, error)
+	GetTenantByName(string) (*database.Tenant, error)
+	DeleteTenant(uuid.UUID) error
+
+	NewGroup(*database.Group) error
+	GetGroups() []*database.Group
+	GetGroup(uuid.UUID) (*database.Group, error)
+	UpdateGroup(*database.Group) error
+	DeleteGroup(uuid.UUID) error
+	AddGroupMember(*database.GroupMember) error
+	RemoveGroupMember(uuid.UUID, uuid.UUID) error
+	GetGroupMembers(uuid.UUID) ([]*database.GroupMember, error)
+	GetUserGroups(uuid.UUID) ([]*database.Group, error)
+	GetUserPermissions(uuid.UUID) []database.Permission
+
+	NewAttribute(*database.AttributeDefinition) error
+	GetAttributes() []*database.AttributeDefinition
+	GetAttribute(string) (*database.AttributeDefinition, error)
+	UpdateAttribute(*database.AttributeDefinition) error
+	DeleteAttribute(string) error
+
+	NewOAuthClient(*database.OAuthClient) error
+	GetOAuthClients() []*database.OAuthClient
+	GetOAuthClient(uuid.UUID) (*database.OAuthClient, error)
+	DeleteOAuthClient(uuid.UUID) error
+	NewOAuthCode(*database.OAuthCode) error
+	ConsumeOAuthCode(string, uuid.UUID) (*database.OAuthCode, error)
+	NewOAuthTokens(...*database.OAuthToken) error
+	GetOAuthToken(string) (*database.OAuthToken, error)
+	DeleteOAuthToken(string) error
+	RevokeOAuthGrant(uuid.UUID) error
+
+	NewSigningKey(*database.SigningKey) error
+	GetSigningKeys() []*database.SigningKey
+	DeleteSigningKey(string) error
+}
+
+//dbStorage is the Storage backed by the database, the handles made by WithActor and WithTenant are Storage too.
+type dbStorage struct {
+	*database.DB
+}
+
+//NewStorage returns the database as the Storage of the API.
+func NewStorage(db *database.DB) Storage {
+	return dbStorage{DB: db}
+}
+
+func (s dbStorage) WithActor(actor string) Storage {
+	return dbStorage{DB: s.DB.WithActor(actor)}
+}
+
+func (s dbStorage) WithTenant(tid uuid.UUID) Storage {
+	return dbStorage{DB: s.DB.WithTenant(tid)}
 }
 
 type API struct {
-	store      Storage
-	httpServer *http.Server
+	cfg                 config.Auth
+	registration        config.Registration
+	graphQL             config.GraphQL
+	batch               config.Batch
+	publicURL           string
+	scimToken           string
+	scimTenantTokens    map[string]string
+	eventsHeartbeat     time.Duration
+	events              *eventLog
+	avatar              config.Avatar
+	oauth               config.OAuth
+	openID              config.OIDC
+	keys                *oidc.Keys
+	store               Storage
+	mailer              mail.Mailer
+	blobs               blob.Store
+	webhookGuard        *webhook.Guard
+	registrationLimiter *rateLimiter
+	registrationHooks   []RegistrationHook
+	openAPI             map[string]interface{}
+	graphQLSchema       graphql.Schema
+	httpServer          *http.Server
 }
 
-func New(cfg config.API, s Storage) *API {
+func New(cfg config.API, s Storage, opts ...Option) *API {
 	a := &API{
-		store: s,
+		cfg:                 cfg.Auth,
+		registration:        cfg.Registration,
+		graphQL:             cfg.GraphQL,
+		batch:               cfg.Batch,
+		publicURL:           strings.TrimSuffix(cfg.PublicURL, "/"),
+		scimToken:           cfg.SCIMToken,
+		scimTenantTokens:    cfg.SCIMTenantTokens,
+		eventsHeartbeat:     cfg.EventsHeartbeat,
+		events:              newEventLog(cfg.EventsLogSize),
+		avatar:              cfg.Avatar,
+		oauth:               cfg.OAuth,
+		openID:              cfg.OIDC,
+		keys:                oidc.NewKeys(s, cfg.OIDCKeyRotation, cfg.OIDCKeyRetention),
+		store:               s,
+		mailer:              mail.NewLogMailer(),
+		blobs:               blob.NewMemoryStore(),
+		webhookGuard:        &webhook.Guard{},
+		registrationLimiter: newRateLimiter(cfg.RateLimit, cfg.RateWindow),
+	}
+
+	for _, opt := range opts {
+		opt(a)
 	}
 
-	handler := mux.NewRouter()
+	a.graphQLSchema = a.buildGraphQLSchema()
+	s.AddListener(a.events.publish)
+	s.AddListener(a.deleteAvatarOfDeletedUser)
+
+	router := mux.NewRouter()
+	router.Use(a.JSONMiddleware)
+	router.Use(a.TenantMiddleware)
+	router.NotFoundHandler = a.tenantPathHandler(router)
+	router.Name("openapi").Methods(http.MethodGet).Path("/openapi.json").HandlerFunc(a.OpenAPIHandler)
+	router.Name("docs").Methods(http.MethodGet).Path("/docs").HandlerFunc(a.DocsHandler)
+	router.Name("forgot_password").Methods(http.MethodPost).Path("/password/forgot").HandlerFunc(a.ForgotPasswordHandler)
+	router.Name("reset_password").Methods(http.MethodPost).Path("/password/reset").HandlerFunc(a.ResetPasswordHandler)
+	router.Name("register").Methods(http.MethodPost).Path("/register").HandlerFunc(a.RegisterHandler)
+	router.Name("verify_email").Methods(http.MethodGet).Path("/verify-email").HandlerFunc(a.VerifyEmailHandler)
+	router.Name("oauth_authorize").Methods(http.MethodGet).Path("/oauth/authorize").HandlerFunc(a.AuthorizeHandler)
+	router.Name("oauth_login").Methods(http.MethodPost).Path("/oauth/authorize").HandlerFunc(a.AuthorizeHandler)
+	router.Name("oauth_token").Methods(http.MethodPost).Path("/oauth/token").HandlerFunc(a.TokenHandler)
+	router.Name("oauth_revoke").Methods(http.MethodPost).Path("/oauth/revoke").HandlerFunc(a.RevokeHandler)
+	router.Name("oauth_introspect").Methods(http.MethodPost).Path("/oauth/introspect").HandlerFunc(a.IntrospectHandler)
+	router.Name("oauth_userinfo").Methods(http.MethodGet).Path("/oauth/userinfo").HandlerFunc(a.UserInfoHandler)
+	router.Name("oauth_userinfo_post").Methods(http.MethodPost).Path("/oauth/userinfo").HandlerFunc(a.UserInfoHandler)
+	router.Name("openid_configuration").Methods(http.MethodGet).Path("/.well-known/openid-configuration").HandlerFunc(a.DiscoveryHandler)
+	router.Name("jwks").Methods(http.MethodGet).Path("/.well-known/jwks.json").HandlerFunc(a.JWKSHandler)
+
+	scim := router.PathPrefix("/scim/v2").Subrouter()
+	scim.Use(a.SCIMMiddleware)
+	scim.Name("scim_list_users").Methods(http.MethodGet).Path("/Users").HandlerFunc(a.SCIMListUsersHandler)
+	scim.Name("scim_create_user").Methods(http.MethodPost).Path("/Users").HandlerFunc(a.SCIMCreateUserHandler)
+	scim.Name("scim_get_user").Methods(http.MethodGet).Path("/Users/{id}").HandlerFunc(a.SCIMGetUserHandler)
+	scim.Name("scim_replace_user").Methods(http.MethodPut).Path("/Users/{id}").HandlerFunc(a.SCIMReplaceUserHandler)
+	scim.Name("scim_patch_user").Methods(http.MethodPatch).Path("/Users/{id}").HandlerFunc(a.SCIMPatchUserHandler)
+	scim.Name("scim_delete_user").Methods(http.MethodDelete).Path("/Users/{id}").HandlerFunc(a.SCIMDeleteUserHandler)
+	scim.Name("scim_service_provider_config").Methods(http.MethodGet).Path("/ServiceProviderConfig").HandlerFunc(a.SCIMServiceProviderConfigHandler)
+	scim.Name("scim_schemas").Methods(http.MethodGet).Path("/Schemas").HandlerFunc(a.SCIMSchemasHandler)
+	scim.Name("scim_schema").Methods(http.MethodGet).Path("/Schemas/{id}").HandlerFunc(a.SCIMSchemaHandler)
+	scim.Name("scim_resource_types").Methods(http.MethodGet).Path("/ResourceTypes").HandlerFunc(a.SCIMResourceTypesHandler)
+	scim.Name("scim_resource_type").Methods(http.MethodGet).Path("/ResourceTypes/{id}").HandlerFunc(a.SCIMResourceTypeHandler)
+
+	handler := router.NewRoute().Subrouter()
 	handler.Use(a.AuthMiddleware)
 	handler.Name("create_user").Methods(http.MethodPost).Path("/user").HandlerFunc(a.NewUserHandler)
+	handler.Name("batch_users").Methods(http.MethodPost).Path("/user/batch").HandlerFunc(a.BatchHandler)
+	handler.Name("export_users").Methods(http.MethodGet).Path("/user/export").HandlerFunc(a.ExportUsersHandler)
+	handler.Name("import_users").Methods(http.MethodPost).Path("/user/import").HandlerFunc(a.ImportUsersHandler)
+	handler.Name("user_events").Methods(http.MethodGet).Path("/user/events").HandlerFunc(a.UserEventsHandler)
 	handler.Name("get_all_users").Methods(http.MethodGet).Path("/user").HandlerFunc(a.GetUsersHandler)
 	handler.Name("get_user").Methods(http.MethodGet).Path("/user/{id}").HandlerFunc(a.GetUserByIDHandler)
+	handler.Name("replace_user").Methods(http.MethodPut).Path("/user/{id}").HandlerFunc(a.ReplaceUserHandler)
 	handler.Name("update_user").Methods(http.MethodPatch).Path("/user/{id}").HandlerFunc(a.UpdateUserHandler)
 	handler.Name("delete_user").Methods(http.MethodDelete).Path("/user/{id}").HandlerFunc(a.DeleteUserHandler)
+	handler.Name("create_api_key").Methods(http.MethodPost).Path("/user/{id}/apikeys").HandlerFunc(a.NewAPIKeyHandler)
+	handler.Name("get_api_keys").Methods(http.MethodGet).Path("/user/{id}/apikeys").HandlerFunc(a.GetAPIKeysHandler)
+	handler.Name("delete_api_key").Methods(http.MethodDelete).Path("/user/{id}/apikeys/{key_id}").HandlerFunc(a.DeleteAPIKeyHandler)
+	handler.Name("send_email_verification").Methods(http.MethodPost).Path("/user/{id}/verify-email").HandlerFunc(a.SendEmailVerificationHandler)
+	handler.Name("user_history").Methods(http.MethodGet).Path("/user/{id}/history").HandlerFunc(a.UserHistoryHandler)
+	handler.Name("revert_user").Methods(http.MethodPost).Path("/user/{id}/revert").HandlerFunc(a.RevertUserHandler)
+	handler.Name("upload_avatar").Methods(http.MethodPut).Path("/user/{id}/avatar").HandlerFunc(a.UploadAvatarHandler)
+	handler.Name("get_avatar").Methods(http.MethodGet).Path("/user/{id}/avatar").HandlerFunc(a.GetAvatarHandler)
+	handler.Name("delete_avatar").Methods(http.MethodDelete).Path("/user/{id}/avatar").HandlerFunc(a.DeleteAvatarHandler)
+	handler.Name("get_user_groups").Methods(http.MethodGet).Path("/user/{id}/groups").HandlerFunc(a.GetUserGroupsHandler)
+	handler.Name("reset_user_2fa").Methods(http.MethodDelete).Path("/user/{id}/2fa").HandlerFunc(a.ResetUserTOTPHandler)
+
+	handler.Name("get_registrations").Methods(http.MethodGet).Path("/registrations").HandlerFunc(a.GetRegistrationsHandler)
+	handler.Name("approve_registration").Methods(http.MethodPost).Path("/registrations/{id}/approve").HandlerFunc(a.ApproveRegistrationHandler)
+	handler.Name("reject_registration").Methods(http.MethodPost).Path("/registrations/{id}/reject").HandlerFunc(a.RejectRegistrationHandler)
+
+	handler.Name("login").Methods(http.MethodPost).Path("/login").HandlerFunc(a.LoginHandler)
+	handler.Name("logout").Methods(http.MethodPost).Path("/logout").HandlerFunc(a.LogoutHandler)
+
+	handler.Name("2fa_enroll").Methods(http.MethodPost).Path("/2fa/enroll").HandlerFunc(a.EnrollTOTPHandler)
+	handler.Name("2fa_qr").Methods(http.MethodGet).Path("/2fa/qr").HandlerFunc(a.TOTPQRHandler)
+	handler.Name("2fa_verify").Methods(http.MethodPost).Path("/2fa/verify").HandlerFunc(a.VerifyTOTPHandler)
+	handler.Name("2fa_disable").Methods(http.MethodDelete).Path("/2fa").HandlerFunc(a.DisableTOTPHandler)
+
+	handler.Name("graphql").Methods(http.MethodPost).Path("/graphql").HandlerFunc(a.GraphQLHandler)
+	handler.Name("graphql_query").Methods(http.MethodGet).Path("/graphql").HandlerFunc(a.GraphQLHandler)
+
+	handler.Name("create_webhook").Methods(http.MethodPost).Path("/webhooks").HandlerFunc(a.NewWebhookHandler)
+	handler.Name("get_webhooks").Methods(http.MethodGet).Path("/webhooks").HandlerFunc(a.GetWebhooksHandler)
+	handler.Name("get_dead_letters").Methods(http.MethodGet).Path("/webhooks/dead-letters").HandlerFunc(a.GetDeadLettersHandler)
+	handler.Name("redeliver_webhook").Methods(http.MethodPost).Path("/webhooks/deliveries/{delivery_id}/redeliver").HandlerFunc(a.RedeliverHandler)
+	handler.Name("get_webhook").Methods(http.MethodGet).Path("/webhooks/{id}").HandlerFunc(a.GetWebhookHandler)
+	handler.Name("replace_webhook").Methods(http.MethodPut).Path("/webhooks/{id}").HandlerFunc(a.ReplaceWebhookHandler)
+	handler.Name("delete_webhook").Methods(http.MethodDelete).Path("/webhooks/{id}").HandlerFunc(a.DeleteWebhookHandler)
+	handler.Name("get_webhook_deliveries").Methods(http.MethodGet).Path("/webhooks/{id}/deliveries").HandlerFunc(a.GetWebhookDeliveriesHandler)
+
+	handler.Name("create_group").Methods(http.MethodPost).Path("/groups").HandlerFunc(a.NewGroupHandler)
+	handler.Name("get_groups").Methods(http.MethodGet).Path("/groups").HandlerFunc(a.GetGroupsHandler)
+	handler.Name("get_group").Methods(http.MethodGet).Path("/groups/{id}").HandlerFunc(a.GetGroupHandler)
+	handler.Name("replace_group").Methods(http.MethodPut).Path("/groups/{id}").HandlerFunc(a.ReplaceGroupHandler)
+	handler.Name("delete_group").Methods(http.MethodDelete).Path("/groups/{id}").HandlerFunc(a.DeleteGroupHandler)
+	handler.Name("get_group_members").Methods(http.MethodGet).Path("/groups/{id}/members").HandlerFunc(a.GetGroupMembersHandler)
+	handler.Name("add_group_member").Methods(http.MethodPost).Path("/groups/{id}/members").HandlerFunc(a.AddGroupMemberHandler)
+	handler.Name("remove_group_member").Methods(http.MethodDelete).Path("/groups/{id}/members/{member_id}").HandlerFunc(a.RemoveGroupMemberHandler)
+
+	handler.Name("create_attribute").Methods(http.MethodPost).Path("/attributes").HandlerFunc(a.NewAttributeHandler)
+	handler.Name("get_attributes").Methods(http.MethodGet).Path("/attributes").HandlerFunc(a.GetAttributesHandler)
+	handler.Name("get_attribute").Methods(http.MethodGet).Path("/attributes/{name}").HandlerFunc(a.GetAttributeHandler)
+	handler.Name("replace_attribute").Methods(http.MethodPut).Path("/attributes/{name}").HandlerFunc(a.ReplaceAttributeHandler)
+	handler.Name("delete_attribute").Methods(http.MethodDelete).Path("/attributes/{name}").HandlerFunc(a.DeleteAttributeHandler)
+
+	handler.Name("create_oauth_client").Methods(http.MethodPost).Path("/oauth/clients").HandlerFunc(a.NewOAuthClientHandler)
+	handler.Name("get_oauth_clients").Methods(http.MethodGet).Path("/oauth/clients").HandlerFunc(a.GetOAuthClientsHandler)
+	handler.Name("get_oauth_client").Methods(http.MethodGet).Path("/oauth/clients/{id}").HandlerFunc(a.GetOAuthClientHandler)
+	handler.Name("delete_oauth_client").Methods(http.MethodDelete).Path("/oauth/clients/{id}").HandlerFunc(a.DeleteOAuthClientHandler)
+	handler.Name("rotate_signing_keys").Methods(http.MethodPost).Path("/oauth/keys/rotate").HandlerFunc(a.RotateKeysHandler)
+
+	handler.Name("create_tenant").Methods(http.MethodPost).Path("/tenants").HandlerFunc(a.NewTenantHandler)
+	handler.Name("get_tenants").Methods(http.MethodGet).Path("/tenants").HandlerFunc(a.GetTenantsHandler)
+	handler.Name("get_tenant").Methods(http.MethodGet).Path("/tenants/{id}").HandlerFunc(a.GetTenantHandler)
+	handler.Name("delete_tenant").Methods(http.MethodDelete).Path("/tenants/{id}").HandlerFunc(a.DeleteTenantHandler)
+
+	handler.Name("metrics").Methods(http.MethodGet).Path("/metrics").HandlerFunc(a.MetricsHandler)
+
+	a.buildOpenAPI(router)
 
 	a.httpServer = &http.Server{
 		Addr:         cfg.Listen,
-		Handler:      handler,
+		Handler:      router,
 		ReadTimeout:  cfg.ReadTimeout,
 		WriteTimeout: cfg.WriteTimeout,
 	}
@@ -52,40 +313,49 @@ func New(cfg config.API, s Storage) *API {
 	return a
 }
 
+//storeFor returns the storage of the tenant of the request that records the actor of the request
+//in the history of the changes.
+func (a *API) storeFor(ctx context.Context) Storage {
+	return a.store.WithTenant(currentTenant(ctx)).WithActor(actor(ctx))
+}
+
 func (a *API) GetHTTPServer() *http.Server {
 	return a.httpServer
 }
 
 func (a *API) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		username, password, ok := r.BasicAuth()
-		if !ok {
-			a.askPassword(w)
-			return
-		}
-
-		user, err := a.store.GetUserByName(username)
+		user, err := a.Authenticate(requestCredentials(r), isWriteMethod(r.Method), isTwoFactorSetupRoute(r))
 		if err != nil {
-			if errors.Is(err, database.ErrUserNotExist) {
+			switch {
+			case errors.Is(err, ErrUnauthorized):
 				a.askPassword(w)
-				return
+			case errors.Is(err, ErrOTPRequired), errors.Is(err, ErrOTPInvalid):
+				a.writeResponseError(w, err, http.StatusUnauthorized)
+			case errors.Is(err, ErrAccountPending), errors.Is(err, ErrEmailNotVerified),
+				errors.Is(err, ErrTwoFactorRequired), errors.Is(err, ErrScopeDenied):
+				a.writeResponseError(w, err, http.StatusForbidden)
+			default:
+				a.internalError(w, err)
 			}
-			a.internalError(w, err)
-			return
-		}
-
-		if !user.CheckPassword(password) {
-			a.askPassword(w)
 			return
 		}
 
 		ctx := context.WithValue(r.Context(), ContextAdminKey, user.Admin)
+		ctx = context.WithValue(ctx, ContextUserIDKey, user.ID)
+		ctx = context.WithValue(ctx, ContextPermissionsKey, a.store.WithTenant(user.TenantID).GetUserPermissions(user.ID))
 
-		w.Header().Set("Content-Type", "application/json")
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+func (a *API) JSONMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (a *API) askPassword(w http.ResponseWriter) {
 	w.Header().Set("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
 	w.WriteHeader(http.StatusUnauthorized)
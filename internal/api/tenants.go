@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+//HeaderTenant selects the tenant of a request by name, the same as the /t/<name> path prefix.
+const HeaderTenant string = "X-Tenant"
+
+const tenantPathPrefix string = "/t/"
+
+var ErrTenantMismatch error = errors.New("the tenant of the path and of the X-Tenant header differ")
+
+//TenantRequest creates a tenant with its first administrator.
+type TenantRequest struct {
+	Name  string        `json:"name"`
+	Admin database.User `json:"admin"`
+}
+
+//TenantMiddleware resolves the tenant selected by the X-Tenant header. Requests without a tenant
+//work with the default tenant.
+func (a *API) TenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get(HeaderTenant)
+		if name == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		t, err := a.store.GetTenantByName(name)
+		if err != nil {
+			if errors.Is(err, database.ErrTenantNotExist) {
+				a.writeResponseError(w, err, http.StatusNotFound)
+				return
+			}
+			a.internalError(w, err)
+			return
+		}
+
+		if tid, ok := r.Context().Value(ContextTenantKey).(uuid.UUID); ok {
+			if tid != t.ID {
+				a.writeResponseError(w, ErrTenantMismatch, http.StatusBadRequest)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ContextTenantKey, t.ID)))
+	})
+}
+
+//tenantPathHandler serves the requests with the /t/<name> path prefix: it strips the prefix and routes
+//the request again, so the routes are the same for all tenants. It is the NotFoundHandler of the router,
+//because no route matches the prefixed paths.
+func (a *API) tenantPathHandler(router http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, tenantPathPrefix)
+		if _, routed := r.Context().Value(ContextTenantKey).(uuid.UUID); !ok || routed {
+			http.NotFound(w, r)
+			return
+		}
+
+		name, path, _ := strings.Cut(rest, "/")
+		t, err := a.store.GetTenantByName(name)
+		if err != nil {
+			if errors.Is(err, database.ErrTenantNotExist) {
+				a.writeResponseError(w, err, http.StatusNotFound)
+				return
+			}
+			a.internalError(w, err)
+			return
+		}
+
+		//как в http.StripPrefix: запрос копируется, исходный не меняется
+		r2 := r.WithContext(context.WithValue(r.Context(), ContextTenantKey, t.ID))
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = "/" + path
+		r2.URL.RawPath = ""
+
+		router.ServeHTTP(w, r2)
+	})
+}
+
+//tenantURL returns the public URL of the API for the users of the tenant.
+func (a *API) tenantURL(tid uuid.UUID) string {
+	if tid == database.DefaultTenant {
+		return a.publicURL
+	}
+
+	t, err := a.store.GetTenant(tid)
+	if err != nil {
+		return a.publicURL
+	}
+
+	return a.publicURL + tenantPathPrefix + t.Name
+}
+
+//NewTenantHandler creates a tenant and its first administrator. Only super-admins manage tenants.
+func (a *API) NewTenantHandler(w http.ResponseWriter, r *http.Request) {
+	if !isSuperAdmin(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	var req TenantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.writeResponseError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	admin := req.Admin
+	admin.Admin = true
+	if err := validate.Struct(admin); err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid data passed: admin: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	t := &database.Tenant{Name: req.Name, CreatedAt: time.Now().UTC()}
+	if err := a.store.NewTenant(t); err != nil {
+		if errors.Is(err, database.ErrTenantNameInvalid) || errors.Is(err, database.ErrTenantNameExist) {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	if err := a.store.WithTenant(t.ID).WithActor(actor(r.Context())).NewUser(&admin); err != nil {
+		//тенант без администратора никто не сможет настроить
+		_ = a.store.DeleteTenant(t.ID)
+		if errors.Is(err, database.ErrUnknownPasswordHash) {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	if err := a.sendEmailVerification(&admin); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/tenants/"+t.ID.String())
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(t)
+}
+
+func (a *API) GetTenantsHandler(w http.ResponseWriter, r *http.Request) {
+	if !isSuperAdmin(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(a.store.GetTenants())
+}
+
+func (a *API) GetTenantHandler(w http.ResponseWriter, r *http.Request) {
+	if !isSuperAdmin(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	t, err := a.store.GetTenant(id)
+	if err != nil {
+		a.writeResponseError(w, err, http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(t)
+}
+
+//DeleteTenantHandler deletes a tenant with all its users and webhooks.
+func (a *API) DeleteTenantHandler(w http.ResponseWriter, r *http.Request) {
+	if !isSuperAdmin(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.store.WithActor(actor(r.Context())).DeleteTenant(id); err != nil {
+		if errors.Is(err, database.ErrTenantNotExist) {
+			a.writeResponseError(w, err, http.StatusNotFound)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
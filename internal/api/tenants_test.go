@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_Tenants(t *testing.T) {
+	api, _ := testBootstrap(t)
+
+	acmeAdmin := database.User{Username: "acme-admin", Password: "acme-pass", Email: "admin@acme.com"}
+
+	req, _ := http.NewRequest(http.MethodPost, "/tenants", toJSON(TenantRequest{Name: "acme", Admin: acmeAdmin}))
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/tenants", toJSON(TenantRequest{Name: "Acme", Admin: acmeAdmin}))
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/tenants", toJSON(TenantRequest{Name: "acme", Admin: acmeAdmin}))
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var acme database.Tenant
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &acme))
+	assert.Equal(t, "acme", acme.Name)
+
+	req, _ = http.NewRequest(http.MethodPost, "/t/acme/user", toJSON(database.User{Username: notAdminUname, Password: "other", Email: "user@acme.com"}))
+	req.SetBasicAuth("acme-admin", "acme-pass")
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code, "The same username may be used in another tenant")
+
+	req, _ = http.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set(HeaderTenant, "acme")
+	req.SetBasicAuth("acme-admin", "acme-pass")
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var users []*database.User
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &users))
+	assert.Equal(t, 2, len(users), "Only the users of the tenant are listed")
+	for _, u := range users {
+		assert.Equal(t, acme.ID, u.TenantID)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/user", nil)
+	req.SetBasicAuth("acme-admin", "acme-pass")
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code, "Users log in only to their tenant")
+
+	req, _ = http.NewRequest(http.MethodGet, "/t/acme/user", nil)
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/t/acme/tenants", nil)
+	req.SetBasicAuth("acme-admin", "acme-pass")
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusForbidden, resp.Code, "Tenant administrators are not super-admins")
+
+	req, _ = http.NewRequest(http.MethodGet, "/t/acme/user", nil)
+	req.Header.Set(HeaderTenant, "other")
+	req.SetBasicAuth("acme-admin", "acme-pass")
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	assert.Nil(t, api.store.NewTenant(&database.Tenant{Name: "other"}))
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusBadRequest, resp.Code, "The path and the header select different tenants")
+
+	req, _ = http.NewRequest(http.MethodGet, "/t/missing/user", nil)
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/tenants", nil)
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var list []*database.Tenant
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &list))
+	assert.Equal(t, 2, len(list))
+
+	req, _ = http.NewRequest(http.MethodDelete, "/tenants/"+acme.ID.String(), nil)
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	assert.Empty(t, api.store.WithTenant(acme.ID).GetAllUsers())
+
+	req, _ = http.NewRequest(http.MethodGet, "/t/acme/user", nil)
+	req.SetBasicAuth("acme-admin", "acme-pass")
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
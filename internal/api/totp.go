@@ -0,0 +1,351 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	recoveryCodesCount int = 10
+	recoveryCodeLen    int = 10
+	qrSize             int = 256
+	//totpPeriod is the time step of the one-time codes in seconds, the default of RFC 6238.
+	totpPeriod int64 = 30
+)
+
+var ErrTOTPAlreadyEnabled error = errors.New("two-factor authentication is already enabled")
+var ErrTOTPDisableDenied error = errors.New("a one-time code, a recovery code or the password is required")
+
+type TOTPEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TOTPVerifyRequest struct {
+	Code string `json:"code"`
+}
+
+type TOTPVerifyResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+//TOTPDisableRequest proves that the second factor is turned off by its owner: one of the fields is required.
+type TOTPDisableRequest struct {
+	Code     string `json:"code,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+//checkOTP validates the one-time or recovery code if the user has two-factor authentication enabled.
+func (a *API) checkOTP(s Storage, uid uuid.UUID, code string) error {
+	t, err := s.GetTOTP(uid)
+	if err != nil {
+		if errors.Is(err, database.ErrTOTPNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	if !t.Enabled {
+		return nil
+	}
+
+	if code == "" {
+		return ErrOTPRequired
+	}
+
+	return verifyOTP(s, t, code)
+}
+
+//verifyOTP accepts a one-time code of a time step not used before or an unused recovery code.
+//Both are checked and spent by the storage under one lock, so concurrent requests can not use a code twice.
+func verifyOTP(s Storage, t *database.TOTP, code string) error {
+	key, err := otp.NewKeyFromURL(t.URL)
+	if err != nil {
+		return err
+	}
+
+	code = strings.TrimSpace(code)
+	if step, ok := totpStep(key.Secret(), code); ok {
+		return otpAccepted(s.AcceptTOTPStep(t.UserID, step))
+	}
+
+	return otpAccepted(s.ConsumeRecoveryCode(t.UserID, code))
+}
+
+func otpAccepted(ok bool, err error) error {
+	switch {
+	case errors.Is(err, database.ErrTOTPNotExist):
+		//двухфакторную аутентификацию отключили, пока проверялся код
+		return ErrOTPInvalid
+	case err != nil:
+		return err
+	case !ok:
+		return ErrOTPInvalid
+	}
+
+	return nil
+}
+
+//totpStep returns the time step the code belongs to. Like totp.Validate, the codes of the previous
+//and the next steps are accepted to allow for clock drift.
+func totpStep(secret, code string) (int64, bool) {
+	now := time.Now().Unix() / totpPeriod
+	for step := now - 1; step <= now+1; step++ {
+		expected, err := totp.GenerateCode(secret, time.Unix(step*totpPeriod, 0))
+		if err == nil && subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+func (a *API) hasTOTP(s Storage, uid uuid.UUID) (bool, error) {
+	t, err := s.GetTOTP(uid)
+	if err != nil {
+		if errors.Is(err, database.ErrTOTPNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return t.Enabled, nil
+}
+
+//EnrollTOTPHandler generates a new pending TOTP secret for the current user.
+func (a *API) EnrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	uid := currentUserID(r.Context())
+
+	enabled, err := a.hasTOTP(a.storeFor(r.Context()), uid)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	if enabled {
+		a.writeResponseError(w, ErrTOTPAlreadyEnabled, http.StatusBadRequest)
+		return
+	}
+
+	user, err := a.storeFor(r.Context()).GetUserByID(uid)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      a.cfg.TOTPIssuer,
+		AccountName: user.Username,
+	})
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	if err := a.storeFor(r.Context()).SetTOTP(&database.TOTP{UserID: uid, URL: key.URL()}); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(TOTPEnrollResponse{
+		Secret: key.Secret(),
+		URI:    key.URL(),
+	})
+}
+
+//TOTPQRHandler renders the pending TOTP secret of the current user as a QR code.
+func (a *API) TOTPQRHandler(w http.ResponseWriter, r *http.Request) {
+	t, err := a.storeFor(r.Context()).GetTOTP(currentUserID(r.Context()))
+	if err != nil {
+		if errors.Is(err, database.ErrTOTPNotExist) {
+			a.writeResponseError(w, err, http.StatusNotFound)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	if t.Enabled {
+		a.writeResponseError(w, ErrTOTPAlreadyEnabled, http.StatusBadRequest)
+		return
+	}
+
+	key, err := otp.NewKeyFromURL(t.URL)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	img, err := key.Image(qrSize, qrSize)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.WriteHeader(http.StatusOK)
+	_ = png.Encode(w, img)
+}
+
+//VerifyTOTPHandler enables two-factor authentication after the first valid code and returns recovery codes.
+func (a *API) VerifyTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var req TOTPVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.writeResponseError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	t, err := a.storeFor(r.Context()).GetTOTP(currentUserID(r.Context()))
+	if err != nil {
+		if errors.Is(err, database.ErrTOTPNotExist) {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	if t.Enabled {
+		a.writeResponseError(w, ErrTOTPAlreadyEnabled, http.StatusBadRequest)
+		return
+	}
+
+	key, err := otp.NewKeyFromURL(t.URL)
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	if !totp.Validate(strings.TrimSpace(req.Code), key.Secret()) {
+		a.writeResponseError(w, ErrOTPInvalid, http.StatusBadRequest)
+		return
+	}
+
+	codes := make([]string, 0, recoveryCodesCount)
+	t.RecoveryCodes = make([]string, 0, recoveryCodesCount)
+	for i := 0; i < recoveryCodesCount; i++ {
+		code, err := randomToken(recoveryCodeLen)
+		if err != nil {
+			a.internalError(w, err)
+			return
+		}
+		codes = append(codes, code)
+		t.RecoveryCodes = append(t.RecoveryCodes, database.HashSecret(code))
+	}
+	t.Enabled = true
+
+	if err := a.storeFor(r.Context()).SetTOTP(t); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(TOTPVerifyResponse{RecoveryCodes: codes})
+}
+
+//DisableTOTPHandler turns off two-factor authentication for the current user. An enabled second factor
+//is turned off only with a one-time code, a recovery code or the password, a stolen token is not enough.
+func (a *API) DisableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var req TOTPDisableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		a.writeResponseError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	s := a.storeFor(r.Context())
+	uid := currentUserID(r.Context())
+
+	t, err := s.GetTOTP(uid)
+	if err != nil {
+		if errors.Is(err, database.ErrTOTPNotExist) {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	if t.Enabled {
+		if err := a.confirmTOTPOwner(s, t, req); err != nil {
+			if errors.Is(err, ErrTOTPDisableDenied) || errors.Is(err, ErrOTPInvalid) {
+				a.writeResponseError(w, err, http.StatusForbidden)
+				return
+			}
+			a.internalError(w, err)
+			return
+		}
+	}
+
+	err = s.DeleteTOTP(uid)
+	if err != nil {
+		if errors.Is(err, database.ErrTOTPNotExist) {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//confirmTOTPOwner checks the password or the code of the request to turn off two-factor authentication.
+func (a *API) confirmTOTPOwner(s Storage, t *database.TOTP, req TOTPDisableRequest) error {
+	if req.Code != "" {
+		return verifyOTP(s, t, req.Code)
+	}
+
+	if req.Password == "" {
+		return ErrTOTPDisableDenied
+	}
+
+	user, err := s.GetUserByID(t.UserID)
+	if err != nil {
+		return err
+	}
+	if !user.CheckPassword(req.Password) {
+		return ErrTOTPDisableDenied
+	}
+
+	return nil
+}
+
+//ResetUserTOTPHandler lets an administrator turn off two-factor authentication of a user who lost the device.
+func (a *API) ResetUserTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdminUser(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	err = a.storeFor(r.Context()).DeleteTOTP(uid)
+	if err != nil {
+		if errors.Is(err, database.ErrTOTPNotExist) {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
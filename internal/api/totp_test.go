@@ -0,0 +1,204 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+)
+
+func enrollTOTP(t *testing.T, api *API, uname, pass string) (string, []string) {
+	req, _ := http.NewRequest(http.MethodPost, "/2fa/enroll", nil)
+	req.SetBasicAuth(uname, pass)
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var enroll TOTPEnrollResponse
+	err := json.Unmarshal(resp.Body.Bytes(), &enroll)
+	assert.Nil(t, err)
+
+	code, err := totp.GenerateCode(enroll.Secret, time.Now())
+	assert.Nil(t, err)
+
+	req, _ = http.NewRequest(http.MethodPost, "/2fa/verify", toJSON(TOTPVerifyRequest{Code: code}))
+	req.SetBasicAuth(uname, pass)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var verify TOTPVerifyResponse
+	err = json.Unmarshal(resp.Body.Bytes(), &verify)
+	assert.Nil(t, err)
+	assert.Equal(t, recoveryCodesCount, len(verify.RecoveryCodes))
+
+	return enroll.Secret, verify.RecoveryCodes
+}
+
+func TestAPI_LoginHandler_BearerToken(t *testing.T) {
+	api, _ := testBootstrap(t)
+
+	req, _ := http.NewRequest(http.MethodPost, "/login", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var login LoginResponse
+	err := json.Unmarshal(resp.Body.Bytes(), &login)
+	assert.Nil(t, err)
+
+	req, _ = http.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set("Authorization", "Bearer "+login.Token)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+login.Token)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set("Authorization", "Bearer "+login.Token)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestAPI_LoginHandler_BasicOnly(t *testing.T) {
+	api, id := testBootstrap(t)
+
+	req, _ := http.NewRequest(http.MethodPost, "/login", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var login LoginResponse
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &login))
+
+	req, _ = http.NewRequest(http.MethodPost, "/login", nil)
+	req.Header.Set("Authorization", "Bearer "+login.Token)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code, "A session can not extend itself")
+
+	key := createAPIKey(t, api, id, APIKeyRequest{Name: "svc", Scopes: []string{ScopeWrite}})
+	req, _ = http.NewRequest(http.MethodPost, "/login", nil)
+	req.Header.Set(HeaderAPIKey, key.Key)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code, "An API key does not turn into a session")
+}
+
+func TestAPI_AuthMiddleware_OTPRequired(t *testing.T) {
+	api, _ := testBootstrap(t)
+	secret, recovery := enrollTOTP(t, api, notAdminUname, notAdminPass)
+
+	req, _ := http.NewRequest(http.MethodGet, "/user", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Contains(t, resp.Body.String(), ErrOTPRequired.Error())
+
+	code, _ := totp.GenerateCode(secret, time.Now())
+	req.Header.Set(HeaderOTPCode, code)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req.Header.Set(HeaderOTPCode, recovery[0])
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code, "Recovery code must be single-use")
+}
+
+func TestAPI_AuthMiddleware_TwoFactorRequiredForAdmins(t *testing.T) {
+	api, _ := testBootstrap(t)
+	api.cfg.TOTPRequiredForAdmins = true
+
+	req, _ := http.NewRequest(http.MethodGet, "/user", nil)
+	req.SetBasicAuth(adminUname, adminPass)
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	secret, _ := enrollTOTP(t, api, adminUname, adminPass)
+
+	code, _ := totp.GenerateCode(secret, time.Now())
+	req.Header.Set(HeaderOTPCode, code)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/user", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code, "The policy applies only to administrators")
+}
+
+func TestAPI_AuthMiddleware_OTPReplay(t *testing.T) {
+	api, _ := testBootstrap(t)
+	secret, _ := enrollTOTP(t, api, notAdminUname, notAdminPass)
+
+	code, _ := totp.GenerateCode(secret, time.Now().Add(time.Duration(totpPeriod)*time.Second))
+
+	req, _ := http.NewRequest(http.MethodPost, "/login", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	req.Header.Set(HeaderOTPCode, code)
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code, "One-time code must not be replayed")
+	assert.Contains(t, resp.Body.String(), ErrOTPInvalid.Error())
+}
+
+func TestAPI_DisableTOTPHandler(t *testing.T) {
+	api, _ := testBootstrap(t)
+	_, recovery := enrollTOTP(t, api, notAdminUname, notAdminPass)
+
+	req, _ := http.NewRequest(http.MethodPost, "/login", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	req.Header.Set(HeaderOTPCode, recovery[0])
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var login LoginResponse
+	_ = json.Unmarshal(resp.Body.Bytes(), &login)
+
+	req, _ = http.NewRequest(http.MethodDelete, "/2fa", http.NoBody)
+	req.Header.Set("Authorization", "Bearer "+login.Token)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusForbidden, resp.Code, "A token alone is not enough to turn off the second factor")
+
+	for _, proof := range []TOTPDisableRequest{{Password: "wrong"}, {Code: recovery[0]}} {
+		req, _ = http.NewRequest(http.MethodDelete, "/2fa", toJSON(proof))
+		req.Header.Set("Authorization", "Bearer "+login.Token)
+
+		resp = execRequest(req, api.httpServer)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+	}
+
+	req, _ = http.NewRequest(http.MethodDelete, "/2fa", toJSON(TOTPDisableRequest{Code: recovery[1]}))
+	req.Header.Set("Authorization", "Bearer "+login.Token)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/user", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
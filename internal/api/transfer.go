@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/MarySmirnova/api_users/internal/transfer"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//ExportUsersHandler streams all users with password hashes in the format of the format parameter (ndjson or csv).
+func (a *API) ExportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdminUser(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	format, err := transfer.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		a.writeResponseError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="users.`+string(format)+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	if err := transfer.Export(w, format, a.storeFor(r.Context())); err != nil {
+		log.WithError(err).Error("unable to export users")
+	}
+}
+
+//ImportUsersHandler imports users from the request body. The format, conflict and dry_run parameters
+//set the options, the response is the import report.
+func (a *API) ImportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdminUser(r.Context()) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	q := r.URL.Query()
+
+	format, err := transfer.ParseFormat(q.Get("format"))
+	if err != nil {
+		a.writeResponseError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	conflict, err := transfer.ParseConflictPolicy(q.Get("conflict"))
+	if err != nil {
+		a.writeResponseError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	dryRun := false
+	if v := q.Get("dry_run"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			a.writeResponseError(w, errors.New("dry_run must be a boolean"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := transfer.Import(r.Body, transfer.Options{Format: format, Conflict: conflict, DryRun: dryRun}, a.storeFor(r.Context()))
+	if err != nil && report == nil {
+		a.writeResponseError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	code := http.StatusOK
+	if errors.Is(err, transfer.ErrConflict) {
+		code = http.StatusConflict
+	}
+
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/MarySmirnova/api_users/internal/transfer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_ExportImportHandlers(t *testing.T) {
+	api, _ := testBootstrap(t)
+
+	r, _ := http.NewRequest(http.MethodGet, "/user/export?format=csv", nil)
+	r.SetBasicAuth(notAdminUname, notAdminPass)
+	resp := execRequest(r, api.httpServer)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	r, _ = http.NewRequest(http.MethodGet, "/user/export?format=csv", nil)
+	r.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(r, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "text/csv", resp.Header().Get("Content-Type"))
+	exported := resp.Body.Bytes()
+
+	r, _ = http.NewRequest(http.MethodPost, "/user/import?format=csv&conflict=fail&dry_run=true", bytes.NewReader(exported))
+	r.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(r, api.httpServer)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+
+	r, _ = http.NewRequest(http.MethodPost, "/user/import?format=csv&conflict=overwrite", bytes.NewReader(exported))
+	r.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(r, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var report transfer.Report
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &report))
+	assert.Equal(t, 2, report.Overwritten)
+
+	r, _ = http.NewRequest(http.MethodPost, "/user/import?conflict=merge", nil)
+	r.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(r, api.httpServer)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/MarySmirnova/api_users/internal/mail"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const verificationTokenLen int = 32
+
+var ErrEmailNotVerified error = errors.New("email is not verified")
+var ErrNoEmail error = errors.New("user has no email")
+var ErrEmailAlreadyVerified error = errors.New("email is already verified")
+
+//sendEmailVerification issues a verification token for the current email of the user and mails the link.
+func (a *API) sendEmailVerification(u *database.User) error {
+	token, err := randomToken(verificationTokenLen)
+	if err != nil {
+		return err
+	}
+
+	err = a.store.WithTenant(u.TenantID).NewEmailVerification(&database.EmailVerification{
+		TokenHash: database.HashSecret(token),
+		UserID:    u.ID,
+		Email:     u.Email,
+		ExpiresAt: time.Now().Add(a.cfg.EmailVerificationTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", a.tenantURL(u.TenantID), url.QueryEscape(token))
+
+	a.sendMail(mail.Message{
+		To:      u.Email,
+		Subject: "Confirm your email",
+		Body: fmt.Sprintf("Confirm the email of the account %q by opening the link, it is valid for %s:\n\n%s\n",
+			u.Username, a.cfg.EmailVerificationTTL, link),
+	})
+
+	return nil
+}
+
+//VerifyEmailHandler marks the email as verified by the token from the link.
+func (a *API) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		a.writeResponseError(w, database.ErrVerificationNotExist, http.StatusBadRequest)
+		return
+	}
+
+	u, err := a.storeFor(r.Context()).VerifyEmail(token)
+	if err != nil {
+		if errors.Is(err, database.ErrVerificationNotExist) {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(u.Email)
+}
+
+//SendEmailVerificationHandler sends the verification link again.
+func (a *API) SendEmailVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if !canManageUser(r.Context(), uid) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	u, err := a.storeFor(r.Context()).GetUserByID(uid)
+	if err != nil {
+		a.writeResponseError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if u.Email == "" {
+		a.writeResponseError(w, ErrNoEmail, http.StatusBadRequest)
+		return
+	}
+
+	if u.EmailVerified {
+		a.writeResponseError(w, ErrEmailAlreadyVerified, http.StatusBadRequest)
+		return
+	}
+
+	if err := a.sendEmailVerification(u); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func verificationLink(t *testing.T, m *testMailer) string {
+	msg := m.wait(t)
+
+	link, err := url.Parse(regexp.MustCompile(`http\S+`).FindString(msg.Body))
+	assert.Nil(t, err)
+
+	return link.RequestURI()
+}
+
+func TestAPI_VerifyEmailHandler_GoodWay(t *testing.T) {
+	api, _ := testBootstrap(t)
+	mailer := newTestMailer()
+	api.mailer = mailer
+
+	user := database.User{
+		Email:    "new@user.ru",
+		Username: "new",
+		Password: "user",
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/user", toJSON(user))
+	req.SetBasicAuth(adminUname, adminPass)
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	link := verificationLink(t, mailer)
+
+	req, _ = http.NewRequest(http.MethodGet, link, nil)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	got, _ := api.store.GetUserByName(user.Username)
+	assert.True(t, got.EmailVerified)
+
+	req, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/user/%s", got.ID), toJSON(database.User{Email: "other@user.ru"}))
+	req.SetBasicAuth(adminUname, adminPass)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	got, _ = api.store.GetUserByName(user.Username)
+	assert.False(t, got.EmailVerified, "Changed email must be verified again")
+
+	msg := mailer.wait(t)
+	assert.Equal(t, "other@user.ru", msg.To)
+
+	req, _ = http.NewRequest(http.MethodGet, link, nil)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusBadRequest, resp.Code, "Verification token must be single-use")
+}
+
+func TestAPI_AuthMiddleware_EmailNotVerified(t *testing.T) {
+	api, _ := testBootstrap(t)
+	api.cfg.RequireVerifiedEmail = true
+
+	req, _ := http.NewRequest(http.MethodGet, "/user", nil)
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Contains(t, resp.Body.String(), ErrEmailNotVerified.Error())
+
+	req, _ = http.NewRequest(http.MethodGet, "/user", nil)
+	req.SetBasicAuth(adminUname, adminPass)
+
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code, "Administrators are not blocked")
+}
+
+func TestAPI_UpdateUser_SameEmailNotVerifiedAgain(t *testing.T) {
+	api, _ := testBootstrap(t)
+	mailer := newTestMailer()
+	api.mailer = mailer
+
+	req, _ := http.NewRequest(http.MethodPost, "/user", toJSON(database.User{Email: "new@user.ru", Username: "new", Password: "user"}))
+	req.SetBasicAuth(adminUname, adminPass)
+	assert.Equal(t, http.StatusOK, execRequest(req, api.httpServer).Code)
+	mailer.wait(t)
+
+	got, _ := api.store.GetUserByName("new")
+
+	req, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/user/%s", got.ID), toJSON(database.User{Username: "renamed", Email: "new@user.ru"}))
+	req.SetBasicAuth(adminUname, adminPass)
+	assert.Equal(t, http.StatusNoContent, execRequest(req, api.httpServer).Code)
+
+	assert.Equal(t, http.StatusNoContent, patchUser(api, got.ID, contentTypeMergePatch, `{"Username": "again"}`))
+
+	code, _ := execGraphQL(t, api, adminUname, adminPass, GraphQLRequest{
+		Query: `mutation { updateUser(id: "` + got.ID.String() + `", input: {email: "new@user.ru"}) { username } }`,
+	})
+	assert.Equal(t, http.StatusOK, code)
+
+	select {
+	case msg := <-mailer.sent:
+		t.Fatalf("message must not be sent when the email has not changed, sent to %s", msg.To)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,297 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const webhookSecretLen int = 32
+
+var ErrUnknownEvent error = errors.New("unknown event type")
+var ErrInvalidWebhookURL error = errors.New("url must be an absolute http or https URL")
+var ErrDeliveryNotFailed error = errors.New("only failed deliveries can be redelivered")
+
+//WebhookRequest creates or replaces a webhook. Without events the webhook receives all events.
+//Without a secret a random one is generated on creation and the current one is kept on replacement.
+type WebhookRequest struct {
+	URL    string               `json:"url"`
+	Events []database.EventType `json:"events"`
+	Secret string               `json:"secret"`
+}
+
+type WebhookResponse struct {
+	*database.Webhook
+	Secret string `json:"secret,omitempty"`
+}
+
+var knownEvents = func() map[database.EventType]bool {
+	m := make(map[database.EventType]bool, len(database.EventTypes))
+	for _, t := range database.EventTypes {
+		m[t] = true
+	}
+	return m
+}()
+
+func (req WebhookRequest) validate() error {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+
+	for _, e := range req.Events {
+		if !knownEvents[e] {
+			return fmt.Errorf("%w: %s", ErrUnknownEvent, e)
+		}
+	}
+
+	return nil
+}
+
+//decodeWebhookRequest reads and validates the request, writes the error response if it fails.
+func (a *API) decodeWebhookRequest(w http.ResponseWriter, r *http.Request) (*WebhookRequest, bool) {
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.writeResponseError(w, fmt.Errorf("wrong JSON: %s", err), http.StatusBadRequest)
+		return nil, false
+	}
+
+	if err := req.validate(); err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid data passed: %s", err), http.StatusBadRequest)
+		return nil, false
+	}
+
+	if err := a.webhookGuard.CheckURL(r.Context(), req.URL); err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid data passed: url: %s", err), http.StatusBadRequest)
+		return nil, false
+	}
+
+	return &req, true
+}
+
+//webhookID parses the id path parameter, writes the error response if it fails.
+func (a *API) webhookID(w http.ResponseWriter, r *http.Request, name string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(mux.Vars(r)[name])
+	if err != nil {
+		a.writeResponseError(w, fmt.Errorf("invalid parameter passed: %s", err), http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+
+	return id, true
+}
+
+//NewWebhookHandler subscribes a URL to user events, the secret is returned only once.
+func (a *API) NewWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !hasPermission(r.Context(), database.PermissionWebhooks) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	req, ok := a.decodeWebhookRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if req.Secret == "" {
+		secret, err := randomToken(webhookSecretLen)
+		if err != nil {
+			a.internalError(w, err)
+			return
+		}
+		req.Secret = secret
+	}
+
+	h := &database.Webhook{
+		URL:       req.URL,
+		Events:    req.Events,
+		Secret:    req.Secret,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := a.storeFor(r.Context()).NewWebhook(h); err != nil {
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(WebhookResponse{Webhook: h, Secret: h.Secret})
+}
+
+func (a *API) GetWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	if !hasPermission(r.Context(), database.PermissionWebhooks) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(a.storeFor(r.Context()).GetWebhooks())
+}
+
+func (a *API) GetWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !hasPermission(r.Context(), database.PermissionWebhooks) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	id, ok := a.webhookID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	h, err := a.storeFor(r.Context()).GetWebhook(id)
+	if err != nil {
+		a.writeResponseError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(h)
+}
+
+//ReplaceWebhookHandler replaces the URL and the events of a webhook, the secret is changed only if passed.
+func (a *API) ReplaceWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !hasPermission(r.Context(), database.PermissionWebhooks) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	id, ok := a.webhookID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	req, ok := a.decodeWebhookRequest(w, r)
+	if !ok {
+		return
+	}
+
+	store := a.storeFor(r.Context())
+	h, err := store.GetWebhook(id)
+	if err != nil {
+		a.writeResponseError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	h.URL = req.URL
+	h.Events = req.Events
+	if req.Secret != "" {
+		h.Secret = req.Secret
+	}
+
+	if err := store.UpdateWebhook(h); err != nil {
+		if errors.Is(err, database.ErrWebhookNotExist) {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(h)
+}
+
+func (a *API) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !hasPermission(r.Context(), database.PermissionWebhooks) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	id, ok := a.webhookID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	if err := a.storeFor(r.Context()).DeleteWebhook(id); err != nil {
+		if errors.Is(err, database.ErrWebhookNotExist) {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//GetWebhookDeliveriesHandler returns the delivery history of a webhook, the newest first.
+func (a *API) GetWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	if !hasPermission(r.Context(), database.PermissionWebhooks) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	id, ok := a.webhookID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	store := a.storeFor(r.Context())
+	if _, err := store.GetWebhook(id); err != nil {
+		a.writeResponseError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(store.GetWebhookDeliveries(id))
+}
+
+//GetDeadLettersHandler returns the deliveries of the webhooks of the tenant that have run out of attempts.
+func (a *API) GetDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	if !hasPermission(r.Context(), database.PermissionWebhooks) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(a.storeFor(r.Context()).GetDeliveriesByStatus(database.DeliveryFailed))
+}
+
+//RedeliverHandler returns a dead letter to the queue with a new set of attempts.
+func (a *API) RedeliverHandler(w http.ResponseWriter, r *http.Request) {
+	if !hasPermission(r.Context(), database.PermissionWebhooks) {
+		a.writeResponseError(w, ErrPermissionsDenied, http.StatusForbidden)
+		return
+	}
+
+	id, ok := a.webhookID(w, r, "delivery_id")
+	if !ok {
+		return
+	}
+
+	store := a.storeFor(r.Context())
+	d, err := store.GetWebhookDelivery(id)
+	if err != nil {
+		a.writeResponseError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if d.Status != database.DeliveryFailed {
+		a.writeResponseError(w, ErrDeliveryNotFailed, http.StatusConflict)
+		return
+	}
+
+	now := time.Now().UTC()
+	d.Status = database.DeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = &now
+
+	if err := store.UpdateWebhookDelivery(d); err != nil {
+		if errors.Is(err, database.ErrDeliveryNotExist) {
+			a.writeResponseError(w, err, http.StatusBadRequest)
+			return
+		}
+		a.internalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(d)
+}
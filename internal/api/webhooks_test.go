@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_WebhookHandlers(t *testing.T) {
+	api, _ := testBootstrap(t)
+
+	req, _ := http.NewRequest(http.MethodPost, "/webhooks", toJSON(WebhookRequest{URL: "http://example.com/hook"}))
+	req.SetBasicAuth(notAdminUname, notAdminPass)
+	resp := execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	for _, bad := range []WebhookRequest{
+		{URL: "example.com/hook"},
+		{URL: "ftp://example.com/hook"},
+		{URL: "http://example.com/hook", Events: []database.EventType{"user.renamed"}},
+		{URL: "http://127.0.0.1:8080/user"},
+		{URL: "http://169.254.169.254/latest/meta-data"},
+		{URL: "http://10.0.0.1/hook"},
+		{URL: "https://[::1]/hook"},
+		{URL: "http://localhost/hook"},
+	} {
+		req, _ = http.NewRequest(http.MethodPost, "/webhooks", toJSON(bad))
+		req.SetBasicAuth(adminUname, adminPass)
+		resp = execRequest(req, api.httpServer)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, bad)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, "/webhooks", toJSON(WebhookRequest{URL: "http://example.com/hook", Events: []database.EventType{database.EventUserCreated}}))
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var created WebhookResponse
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.Secret, "A secret is generated")
+	id := created.ID.String()
+
+	req, _ = http.NewRequest(http.MethodPut, "/webhooks/"+id, toJSON(WebhookRequest{URL: "https://example.com/new"}))
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NotContains(t, resp.Body.String(), created.Secret)
+
+	h, err := api.store.GetWebhook(created.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/new", h.URL)
+	assert.Empty(t, h.Events)
+	assert.Equal(t, created.Secret, h.Secret, "The secret is kept")
+
+	req, _ = http.NewRequest(http.MethodGet, "/webhooks", nil)
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NotContains(t, resp.Body.String(), created.Secret)
+
+	d := &database.WebhookDelivery{WebhookID: created.ID, Event: database.EventUserCreated, Status: database.DeliveryFailed, Attempts: 8}
+	assert.Nil(t, api.store.(dbStorage).NewWebhookDeliveries([]*database.WebhookDelivery{d}))
+
+	req, _ = http.NewRequest(http.MethodGet, "/webhooks/dead-letters", nil)
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var dead []*database.WebhookDelivery
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &dead))
+	assert.Equal(t, 1, len(dead))
+
+	req, _ = http.NewRequest(http.MethodPost, "/webhooks/deliveries/"+d.ID.String()+"/redeliver", nil)
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/webhooks/deliveries/"+d.ID.String()+"/redeliver", nil)
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusConflict, resp.Code, "Only failed deliveries can be redelivered")
+
+	req, _ = http.NewRequest(http.MethodGet, "/webhooks/"+id+"/deliveries", nil)
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var history []*database.WebhookDelivery
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &history))
+	if assert.Equal(t, 1, len(history)) {
+		assert.Equal(t, database.DeliveryPending, history[0].Status)
+		assert.Equal(t, 0, history[0].Attempts)
+	}
+
+	req, _ = http.NewRequest(http.MethodDelete, "/webhooks/"+id, nil)
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/webhooks/"+id, nil)
+	req.SetBasicAuth(adminUname, adminPass)
+	resp = execRequest(req, api.httpServer)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
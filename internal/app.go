@@ -1,18 +1,32 @@
 package internal
 
 import (
+	"context"
+	"net"
 	"net/http"
 
 	"github.com/MarySmirnova/api_users/internal/api"
+	"github.com/MarySmirnova/api_users/internal/blob"
+	"github.com/MarySmirnova/api_users/internal/bootstrap"
 	"github.com/MarySmirnova/api_users/internal/config"
 	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/MarySmirnova/api_users/internal/grpcapi"
+	"github.com/MarySmirnova/api_users/internal/mail"
+	"github.com/MarySmirnova/api_users/internal/outbox"
+	"github.com/MarySmirnova/api_users/internal/webhook"
 
 	log "github.com/sirupsen/logrus"
 )
 
 type Application struct {
-	cfg config.Application
-	db  *database.DB
+	cfg          config.Application
+	db           *database.DB
+	mailer       mail.Mailer
+	blobs        blob.Store
+	webhookGuard *webhook.Guard
+	webhooks     *webhook.Dispatcher
+	outbox       *outbox.Relay
+	unlockDB     func() error
 }
 
 func NewApplication(cfg config.Application) (*Application, error) {
@@ -20,6 +34,55 @@ func NewApplication(cfg config.Application) (*Application, error) {
 		cfg: cfg,
 	}
 
+	if err := app.initDatabase(); err != nil {
+		return nil, err
+	}
+	if err := bootstrap.Admin(cfg.Bootstrap, cfg.IsProduction(), app.db); err != nil {
+		return nil, err
+	}
+
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		return nil, err
+	}
+	app.mailer = mailer
+
+	blobs, err := blob.New(cfg.Blob)
+	if err != nil {
+		return nil, err
+	}
+	app.blobs = blobs
+
+	guard, err := webhook.NewGuard(cfg.Webhooks.WebhookAllowedNetworks)
+	if err != nil {
+		return nil, err
+	}
+	app.webhookGuard = guard
+	app.webhooks = webhook.New(cfg.Webhooks, app.db, guard)
+
+	//ошибка настройки брокера должна остановить запуск, а не обнаружиться после старта
+	pub, err := outbox.NewPublisher(cfg.Outbox)
+	if err != nil {
+		return nil, err
+	}
+	if pub != nil {
+		app.outbox = outbox.NewRelay(cfg.Outbox, app.db, pub)
+	}
+
+	return app, nil
+}
+
+//NewCommandApplication creates an application for a command line command: only the storage, locked
+//for the time of the command. The commands refuse to run while the server uses the database file.
+func NewCommandApplication(cfg config.Application) (*Application, error) {
+	if cfg.DBFile == "" {
+		return nil, ErrNoDBFile
+	}
+
+	app := &Application{
+		cfg: cfg,
+	}
+
 	if err := app.initDatabase(); err != nil {
 		return nil, err
 	}
@@ -27,25 +90,54 @@ func NewApplication(cfg config.Application) (*Application, error) {
 	return app, nil
 }
 
+//initDatabase opens the database. The database file is locked until the process exits or Close is called.
 func (a *Application) initDatabase() error {
 	db := database.New()
-	err := db.NewUser(&database.User{
-		Username: a.cfg.AdminUsername,
-		Password: a.cfg.AdminPass,
-		Admin:    true,
-	})
-	if err != nil {
-		return err
+	if a.cfg.DBFile != "" {
+		unlock, err := database.Lock(a.cfg.DBFile)
+		if err != nil {
+			return err
+		}
+		if db, err = database.Open(a.cfg.DBFile); err != nil {
+			_ = unlock()
+			return err
+		}
+		a.unlockDB = unlock
+	}
+
+	//аутбокс включается до первых изменений, чтобы не потерять их события, в том числе при запуске команд
+	if a.cfg.OutboxPublisher != "" {
+		db.EnableOutbox()
 	}
 
 	a.db = db
 	return nil
 }
 
+//Close releases the lock of the database file.
+func (a *Application) Close() error {
+	if a.unlockDB == nil {
+		return nil
+	}
+
+	return a.unlockDB()
+}
+
 func (a *Application) StartServer() {
-	srv := api.New(a.cfg.API, a.db)
+	store := api.NewStorage(a.db)
+	srv := api.New(a.cfg.API, store, api.WithMailer(a.mailer), api.WithBlobStore(a.blobs), api.WithWebhookGuard(a.webhookGuard))
 	s := srv.GetHTTPServer()
 
+	go a.webhooks.Run(context.Background())
+
+	if a.outbox != nil {
+		go a.outbox.Run(context.Background())
+	}
+
+	if a.cfg.GRPCListen != "" {
+		go a.startGRPCServer(grpcapi.New(a.cfg.GRPC, store, srv))
+	}
+
 	log.WithField("listen", s.Addr).Info("start server")
 
 	err := s.ListenAndServe()
@@ -55,3 +147,17 @@ func (a *Application) StartServer() {
 		return
 	}
 }
+
+func (a *Application) startGRPCServer(srv *grpcapi.Server) {
+	lis, err := net.Listen("tcp", srv.Listen())
+	if err != nil {
+		log.WithError(err).Error("unable to start grpc server")
+		return
+	}
+
+	log.WithField("listen", srv.Listen()).Info("start grpc server")
+
+	if err := srv.GetGRPCServer().Serve(lis); err != nil {
+		log.WithError(err).Error("the grpc server raised an error")
+	}
+}
@@ -0,0 +1,169 @@
+//Package avatar prepares uploaded profile pictures: checks the format and the size, re-encodes
+//the image to drop metadata such as EXIF and location, scales it down and makes a square thumbnail.
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+const (
+	ContentTypePNG  string = "image/png"
+	ContentTypeJPEG string = "image/jpeg"
+	ContentTypeGIF  string = "image/gif"
+)
+
+const jpegQuality int = 90
+
+var ErrUnsupportedFormat error = errors.New("unsupported image format, PNG, JPEG and GIF are accepted")
+var ErrInvalidImage error = errors.New("invalid image")
+var ErrTooLarge error = errors.New("image dimensions are too large")
+
+//Limits of the processing. Images wider or higher than MaxDimension are rejected before they are decoded,
+//avatars are scaled down to fit Size, thumbnails are ThumbSize squares.
+type Limits struct {
+	MaxDimension int
+	Size         int
+	ThumbSize    int
+}
+
+//Image is an encoded picture ready to be stored.
+type Image struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+//Process decodes the upload and returns the avatar and its thumbnail. JPEG stays JPEG, PNG and GIF
+//become PNG, only the first frame of an animated GIF is kept.
+func Process(data []byte, l Limits) (*Image, *Image, error) {
+	//размеры проверяются по заголовку, чтобы не распаковывать огромные изображения
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) {
+		return nil, nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, nil, ErrInvalidImage
+	}
+	if format != "png" && format != "jpeg" && format != "gif" {
+		return nil, nil, ErrUnsupportedFormat
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, nil, ErrInvalidImage
+	}
+	if cfg.Width > l.MaxDimension || cfg.Height > l.MaxDimension {
+		return nil, nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, ErrInvalidImage
+	}
+
+	rgba := toRGBA(src)
+
+	w, h := fit(rgba.Bounds().Dx(), rgba.Bounds().Dy(), l.Size)
+	full, err := encode(scale(rgba, w, h), format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	side := min(rgba.Bounds().Dx(), rgba.Bounds().Dy())
+	x0 := (rgba.Bounds().Dx() - side) / 2
+	y0 := (rgba.Bounds().Dy() - side) / 2
+	square := rgba.SubImage(image.Rect(x0, y0, x0+side, y0+side)).(*image.RGBA)
+	thumbSide := min(side, l.ThumbSize)
+	thumb, err := encode(scale(square, thumbSide, thumbSide), format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return full, thumb, nil
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+
+	return dst
+}
+
+//fit returns the size scaled down to fit the square with the side, keeping the aspect ratio.
+//Images are never scaled up.
+func fit(w, h, side int) (int, int) {
+	if w <= side && h <= side {
+		return w, h
+	}
+
+	if w >= h {
+		return side, max(1, h*side/w)
+	}
+	return max(1, w*side/h), side
+}
+
+//scale resizes the image with area averaging, every destination pixel is the mean of the source pixels it covers.
+func scale(src *image.RGBA, w, h int) *image.RGBA {
+	b := src.Bounds()
+	if b.Dx() == w && b.Dy() == h {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		sy0 := b.Min.Y + y*b.Dy()/h
+		sy1 := max(sy0+1, b.Min.Y+(y+1)*b.Dy()/h)
+
+		for x := 0; x < w; x++ {
+			sx0 := b.Min.X + x*b.Dx()/w
+			sx1 := max(sx0+1, b.Min.X+(x+1)*b.Dx()/w)
+
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					i := src.PixOffset(sx, sy)
+					r += uint64(src.Pix[i])
+					g += uint64(src.Pix[i+1])
+					bl += uint64(src.Pix[i+2])
+					a += uint64(src.Pix[i+3])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+//encode writes the image without metadata: JPEG uploads stay JPEG, others become PNG.
+func encode(img *image.RGBA, format string) (*Image, error) {
+	var buf bytes.Buffer
+	out := &Image{Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+
+	if format == "jpeg" {
+		out.ContentType = ContentTypeJPEG
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+	} else {
+		out.ContentType = ContentTypePNG
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+	}
+
+	out.Data = buf.Bytes()
+	return out, nil
+}
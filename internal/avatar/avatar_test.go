@@ -0,0 +1,80 @@
+package avatar
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testLimits = Limits{MaxDimension: 1000, Size: 100, ThumbSize: 20}
+
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+
+	return img
+}
+
+func TestProcess(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, jpeg.Encode(&buf, testImage(400, 200), nil))
+
+	full, thumb, err := Process(buf.Bytes(), testLimits)
+	assert.Nil(t, err)
+	assert.Equal(t, ContentTypeJPEG, full.ContentType)
+	assert.Equal(t, 100, full.Width)
+	assert.Equal(t, 50, full.Height)
+	assert.Equal(t, 20, thumb.Width)
+	assert.Equal(t, 20, thumb.Height)
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(thumb.Data))
+	assert.Nil(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, 20, cfg.Width)
+
+	buf.Reset()
+	assert.Nil(t, gif.Encode(&buf, testImage(10, 30), nil))
+	full, thumb, err = Process(buf.Bytes(), testLimits)
+	assert.Nil(t, err)
+	assert.Equal(t, ContentTypePNG, full.ContentType, "GIF is converted to PNG")
+	assert.Equal(t, 10, full.Width, "Small images are not scaled up")
+	assert.Equal(t, 30, full.Height)
+	assert.Equal(t, 10, thumb.Width)
+	assert.Equal(t, 10, thumb.Height)
+
+	buf.Reset()
+	assert.Nil(t, png.Encode(&buf, testImage(1001, 1)))
+	_, _, err = Process(buf.Bytes(), testLimits)
+	assert.ErrorIs(t, err, ErrTooLarge)
+
+	_, _, err = Process([]byte("<svg></svg>"), testLimits)
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+
+	buf.Reset()
+	assert.Nil(t, png.Encode(&buf, testImage(10, 10)))
+	_, _, err = Process(buf.Bytes()[:60], testLimits)
+	assert.ErrorIs(t, err, ErrInvalidImage)
+}
+
+func TestProcess_StripsMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, jpeg.Encode(&buf, testImage(20, 20), nil))
+
+	//APP1-сегмент EXIF сразу после SOI
+	exif := append([]byte{0xFF, 0xE1, 0x00, 0x10}, []byte("Exif\x00\x00GPS-SECRET")...)
+	data := append(append([]byte{0xFF, 0xD8}, exif...), buf.Bytes()[2:]...)
+
+	full, _, err := Process(data, testLimits)
+	assert.Nil(t, err)
+	assert.False(t, bytes.Contains(full.Data, []byte("GPS-SECRET")))
+}
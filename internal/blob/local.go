@@ -0,0 +1,175 @@
+package blob
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+//MemoryStore keeps objects in memory, it is a stand-in for a real store in tests.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	objects map[string]*Object
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		objects: make(map[string]*Object),
+	}
+}
+
+func (s *MemoryStore) Put(_ context.Context, key string, o *Object) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	c := *o
+	c.Data = append([]byte(nil), o.Data...)
+	c.ModTime = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[key] = &c
+	return nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (*Object, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	o, ok := s.objects[key]
+	if !ok {
+		return nil, ErrNotExist
+	}
+
+	c := *o
+	return &c, nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.objects, key)
+	return nil
+}
+
+//FileStore keeps every object in a file under the directory, the media type is kept
+//in a file next to it with the .meta suffix.
+type FileStore struct {
+	dir string
+}
+
+type fileMeta struct {
+	ContentType string `json:"content_type"`
+}
+
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{
+		dir: dir,
+	}
+}
+
+func (s *FileStore) path(key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+func (s *FileStore) Put(_ context.Context, key string, o *Object) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	meta, err := json.Marshal(fileMeta{ContentType: o.ContentType})
+	if err != nil {
+		return err
+	}
+
+	if err := writeFile(path+".meta", meta); err != nil {
+		return err
+	}
+
+	return writeFile(path, o.Data)
+}
+
+//writeFile replaces the file atomically, so readers never see a partly written object.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FileStore) Get(_ context.Context, key string) (*Object, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &Object{Data: data, ModTime: info.ModTime().UTC()}
+
+	meta, err := os.ReadFile(path + ".meta")
+	if err == nil {
+		var m fileMeta
+		if err := json.Unmarshal(meta, &m); err != nil {
+			return nil, err
+		}
+		o.ContentType = m.ContentType
+	}
+
+	return o, nil
+}
+
+func (s *FileStore) Delete(_ context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range []string{path, path + ".meta"} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package blob
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	s := NewFileStore(t.TempDir())
+	ctx := context.Background()
+
+	_, err := s.Get(ctx, "avatars/1/avatar")
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	assert.Nil(t, s.Put(ctx, "avatars/1/avatar", &Object{Data: []byte("first"), ContentType: "image/png"}))
+	assert.Nil(t, s.Put(ctx, "avatars/1/avatar", &Object{Data: []byte("second"), ContentType: "image/jpeg"}))
+
+	o, err := s.Get(ctx, "avatars/1/avatar")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("second"), o.Data)
+	assert.Equal(t, "image/jpeg", o.ContentType)
+	assert.False(t, o.ModTime.IsZero())
+
+	assert.Nil(t, s.Delete(ctx, "avatars/1/avatar"))
+	assert.Nil(t, s.Delete(ctx, "avatars/1/avatar"))
+	_, err = s.Get(ctx, "avatars/1/avatar")
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	for _, key := range []string{"", "/etc/passwd", "../x", "a//b", "a/./b"} {
+		assert.ErrorIs(t, s.Put(ctx, key, &Object{}), ErrInvalidKey, key)
+	}
+}
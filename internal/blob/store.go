@@ -0,0 +1,66 @@
+//Package blob stores binary objects such as avatars outside the user database.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/config"
+)
+
+const (
+	DriverMemory string = "memory"
+	DriverFile   string = "file"
+	DriverS3     string = "s3"
+)
+
+var ErrNotExist error = errors.New("object does not exist")
+var ErrInvalidKey error = errors.New("invalid object key")
+
+//Object is a stored blob with its media type.
+type Object struct {
+	Data        []byte
+	ContentType string
+	ModTime     time.Time
+}
+
+//Store keeps objects by keys like "avatars/<id>/thumbnail". Keys are relative slash-separated paths.
+type Store interface {
+	Put(ctx context.Context, key string, o *Object) error
+	//Get returns ErrNotExist if there is no object with the key.
+	Get(ctx context.Context, key string) (*Object, error)
+	//Delete does nothing if there is no object with the key.
+	Delete(ctx context.Context, key string) error
+}
+
+//New creates the store for the driver set in the config.
+func New(cfg config.Blob) (Store, error) {
+	switch cfg.BlobDriver {
+	case DriverMemory:
+		return NewMemoryStore(), nil
+	case DriverFile, "":
+		return NewFileStore(cfg.BlobDir), nil
+	case DriverS3:
+		return NewS3Store(cfg), nil
+	}
+
+	return nil, fmt.Errorf("unknown blob driver: %s", cfg.BlobDriver)
+}
+
+//checkKey rejects keys that could leave the root of the store.
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return ErrInvalidKey
+		}
+	}
+
+	return nil
+}
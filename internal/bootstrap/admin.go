@@ -0,0 +1,106 @@
+package bootstrap
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/MarySmirnova/api_users/internal/config"
+	"github.com/MarySmirnova/api_users/internal/database"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//legacyDefaultPass is the password the service used to create the admin with out of the box.
+const legacyDefaultPass string = "Admin"
+
+const generatedPassLen int = 18
+
+var ErrDefaultCredentials error = errors.New("admin credentials must be set explicitly in production mode")
+var ErrNotAdmin error = errors.New("bootstrap user exists but is not an administrator")
+
+type Storage interface {
+	NewUser(*database.User) error
+	GetUserByName(string) (*database.User, error)
+}
+
+//Admin makes sure the administrator account exists.
+//An existing administrator is left untouched, so calling Admin on every start is safe.
+//If no password is supplied, a one-time password is generated and printed to the log.
+func Admin(cfg config.Bootstrap, production bool, s Storage) error {
+	user, err := s.GetUserByName(cfg.AdminUsername)
+	if err == nil {
+		if !user.Admin {
+			return fmt.Errorf("%w: %s", ErrNotAdmin, cfg.AdminUsername)
+		}
+		log.WithField("username", cfg.AdminUsername).Info("admin account already exists, skip bootstrap")
+		return nil
+	}
+	if !errors.Is(err, database.ErrUserNotExist) {
+		return err
+	}
+
+	pass, err := adminPassword(cfg)
+	if err != nil {
+		return err
+	}
+
+	if production && (pass == "" || pass == legacyDefaultPass) {
+		return ErrDefaultCredentials
+	}
+
+	generated := pass == ""
+	if generated {
+		if pass, err = generatePassword(); err != nil {
+			return err
+		}
+	}
+
+	err = s.NewUser(&database.User{
+		Username: cfg.AdminUsername,
+		Password: pass,
+		Admin:    true,
+	})
+	if err != nil {
+		return err
+	}
+
+	if generated {
+		log.WithFields(log.Fields{
+			"username": cfg.AdminUsername,
+			"password": pass,
+		}).Warn("admin account created with a one-time password, change it after the first login")
+	}
+
+	return nil
+}
+
+//adminPassword returns the password from the config or from the secret file.
+func adminPassword(cfg config.Bootstrap) (string, error) {
+	if cfg.AdminPass != "" {
+		return cfg.AdminPass, nil
+	}
+
+	if cfg.AdminPassFile == "" {
+		return "", nil
+	}
+
+	data, err := os.ReadFile(cfg.AdminPassFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to read admin password file: %w", err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+func generatePassword() (string, error) {
+	b := make([]byte, generatedPassLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
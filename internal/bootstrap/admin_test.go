@@ -0,0 +1,78 @@
+package bootstrap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MarySmirnova/api_users/internal/config"
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdmin_GeneratedPassword(t *testing.T) {
+	db := database.New()
+
+	err := Admin(config.Bootstrap{AdminUsername: "root"}, false, db)
+	assert.Nil(t, err)
+
+	u, err := db.GetUserByName("root")
+	assert.Nil(t, err)
+	assert.True(t, u.Admin)
+	assert.False(t, u.CheckPassword(legacyDefaultPass))
+}
+
+func TestAdmin_PasswordFile(t *testing.T) {
+	db := database.New()
+
+	file := filepath.Join(t.TempDir(), "admin_pass")
+	err := os.WriteFile(file, []byte("secret\n"), 0600)
+	assert.Nil(t, err)
+
+	err = Admin(config.Bootstrap{AdminUsername: "root", AdminPassFile: file}, false, db)
+	assert.Nil(t, err)
+
+	u, err := db.GetUserByName("root")
+	assert.Nil(t, err)
+	assert.True(t, u.CheckPassword("secret"))
+}
+
+func TestAdmin_ProductionDefaults(t *testing.T) {
+	db := database.New()
+
+	err := Admin(config.Bootstrap{AdminUsername: "root"}, true, db)
+	assert.ErrorIs(t, err, ErrDefaultCredentials)
+
+	err = Admin(config.Bootstrap{AdminUsername: "root", AdminPass: legacyDefaultPass}, true, db)
+	assert.ErrorIs(t, err, ErrDefaultCredentials)
+}
+
+func TestAdmin_Idempotent(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "db.json")
+	cfg := config.Bootstrap{AdminUsername: "root", AdminPass: "first"}
+
+	db, err := database.Open(file)
+	assert.Nil(t, err)
+	assert.Nil(t, Admin(cfg, true, db))
+
+	db, err = database.Open(file)
+	assert.Nil(t, err)
+
+	cfg.AdminPass = "second"
+	assert.Nil(t, Admin(cfg, true, db))
+
+	u, err := db.GetUserByName("root")
+	assert.Nil(t, err)
+	assert.True(t, u.CheckPassword("first"))
+	assert.Equal(t, 1, len(db.GetAllUsers()))
+}
+
+func TestAdmin_ErrNotAdmin(t *testing.T) {
+	db := database.New()
+
+	err := db.NewUser(&database.User{Username: "root", Password: "pass"})
+	assert.Nil(t, err)
+
+	err = Admin(config.Bootstrap{AdminUsername: "root", AdminPass: "pass"}, false, db)
+	assert.ErrorIs(t, err, ErrNotAdmin)
+}
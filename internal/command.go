@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/MarySmirnova/api_users/internal/transfer"
+)
+
+var ErrNoDBFile error = errors.New("DB_FILE must be set to run commands")
+
+const usage string = `usage:
+  api_users export [-format ndjson|csv] [-o file]
+  api_users import [-format ndjson|csv] [-conflict skip|overwrite|fail] [-dry-run] file
+  api_users outbox-retry`
+
+//RunCommand runs a command line command against the database file instead of starting the server.
+//The application must be created by NewCommandApplication. Output goes to stdout, the import report
+//is printed as JSON.
+func (a *Application) RunCommand(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	switch args[0] {
+	case "export":
+		return a.exportCommand(args[1:], stdout)
+	case "import":
+		return a.importCommand(args[1:], stdout)
+	case "outbox-retry":
+		return a.outboxRetryCommand(stdout)
+	}
+
+	return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+}
+
+func (a *Application) exportCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	formatName := fs.String("format", string(transfer.FormatNDJSON), "file format: ndjson or csv")
+	output := fs.String("o", "", "output file, stdout if not set")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	format, err := transfer.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		return transfer.Export(stdout, format, a.db)
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+
+	if err := transfer.Export(f, format, a.db); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func (a *Application) importCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	formatName := fs.String("format", string(transfer.FormatNDJSON), "file format: ndjson or csv")
+	conflictName := fs.String("conflict", string(transfer.ConflictSkip), "existing users: skip, overwrite or fail")
+	dryRun := fs.Bool("dry-run", false, "only check the file and report what would be done")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New(usage)
+	}
+
+	format, err := transfer.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	conflict, err := transfer.ParseConflictPolicy(*conflictName)
+	if err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if name := fs.Arg(0); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	report, err := transfer.Import(in, transfer.Options{Format: format, Conflict: conflict, DryRun: *dryRun}, a.db)
+	if report != nil {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if encErr := enc.Encode(report); encErr != nil {
+			return encErr
+		}
+	}
+
+	return err
+}
+
+//outboxRetryCommand returns the dead letters of the outbox to the queue, e.g. after the broker has been fixed.
+func (a *Application) outboxRetryCommand(stdout io.Writer) error {
+	n, err := a.db.RetryOutboxDeadLetters()
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(stdout, "%d messages returned to the outbox\n", n)
+	return err
+}
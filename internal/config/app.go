@@ -1,10 +1,22 @@
 package config
 
+const ModeProduction string = "production"
+
 type Application struct {
 	LogLevel string `env:"LOG_LEVEL" envDefault:"INFO"`
+	Mode     string `env:"APP_MODE" envDefault:"development"`
+	DBFile   string `env:"DB_FILE"`
 
-	AdminUsername string `env:"ADMIN_USERNAME" envDefault:"Admin"`
-	AdminPass     string `env:"ADMIN_PASS" envDefault:"Admin"`
-
+	Bootstrap
+	Mail
 	API
+	GRPC
+	Webhooks
+	Outbox
+	Blob
+}
+
+//IsProduction reports whether the application runs in production mode.
+func (a Application) IsProduction() bool {
+	return a.Mode == ModeProduction
 }
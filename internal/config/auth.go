@@ -0,0 +1,12 @@
+package config
+
+import "time"
+
+type Auth struct {
+	SessionTTL            time.Duration `env:"AUTH_SESSION_TTL" envDefault:"12h"`
+	PasswordResetTTL      time.Duration `env:"AUTH_PASSWORD_RESET_TTL" envDefault:"1h"`
+	EmailVerificationTTL  time.Duration `env:"AUTH_EMAIL_VERIFICATION_TTL" envDefault:"24h"`
+	RequireVerifiedEmail  bool          `env:"AUTH_REQUIRE_VERIFIED_EMAIL" envDefault:"false"`
+	TOTPIssuer            string        `env:"AUTH_TOTP_ISSUER" envDefault:"api_users"`
+	TOTPRequiredForAdmins bool          `env:"AUTH_TOTP_REQUIRED_FOR_ADMINS" envDefault:"false"`
+}
@@ -0,0 +1,11 @@
+package config
+
+import "time"
+
+type Avatar struct {
+	AvatarMaxBytes     int64         `env:"AVATAR_MAX_BYTES" envDefault:"5242880"`
+	AvatarMaxDimension int           `env:"AVATAR_MAX_DIMENSION" envDefault:"4096"`
+	AvatarSize         int           `env:"AVATAR_SIZE" envDefault:"512"`
+	AvatarThumbSize    int           `env:"AVATAR_THUMB_SIZE" envDefault:"64"`
+	AvatarCacheMaxAge  time.Duration `env:"AVATAR_CACHE_MAX_AGE" envDefault:"1h"`
+}
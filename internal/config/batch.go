@@ -0,0 +1,6 @@
+package config
+
+type Batch struct {
+	MaxOperations int `env:"BATCH_MAX_OPERATIONS" envDefault:"1000"`
+	HashWorkers   int `env:"BATCH_HASH_WORKERS" envDefault:"0"`
+}
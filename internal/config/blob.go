@@ -0,0 +1,13 @@
+package config
+
+type Blob struct {
+	BlobDriver      string `env:"BLOB_DRIVER" envDefault:"file"`
+	BlobDir         string `env:"BLOB_DIR" envDefault:"blobs"`
+	BlobS3Endpoint  string `env:"BLOB_S3_ENDPOINT" envDefault:"https://s3.amazonaws.com"`
+	BlobS3Region    string `env:"BLOB_S3_REGION" envDefault:"us-east-1"`
+	BlobS3Bucket    string `env:"BLOB_S3_BUCKET"`
+	BlobS3AccessKey string `env:"BLOB_S3_ACCESS_KEY"`
+	BlobS3SecretKey string `env:"BLOB_S3_SECRET_KEY"`
+	//BlobS3PathStyle puts the bucket in the path instead of the host name, MinIO and most S3-compatible servers need it
+	BlobS3PathStyle bool `env:"BLOB_S3_PATH_STYLE" envDefault:"true"`
+}
@@ -0,0 +1,7 @@
+package config
+
+type Bootstrap struct {
+	AdminUsername string `env:"ADMIN_USERNAME" envDefault:"Admin"`
+	AdminPass     string `env:"ADMIN_PASS"`
+	AdminPassFile string `env:"ADMIN_PASS_FILE"`
+}
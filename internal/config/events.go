@@ -0,0 +1,8 @@
+package config
+
+import "time"
+
+type Events struct {
+	EventsHeartbeat time.Duration `env:"EVENTS_HEARTBEAT" envDefault:"15s"`
+	EventsLogSize   int           `env:"EVENTS_LOG_SIZE" envDefault:"1000"`
+}
@@ -0,0 +1,6 @@
+package config
+
+type GraphQL struct {
+	MaxDepth      int `env:"GRAPHQL_MAX_DEPTH" envDefault:"10"`
+	MaxComplexity int `env:"GRAPHQL_MAX_COMPLEXITY" envDefault:"1000"`
+}
@@ -0,0 +1,5 @@
+package config
+
+type GRPC struct {
+	GRPCListen string `env:"GRPC_LISTEN" envDefault:":9090"`
+}
@@ -0,0 +1,10 @@
+package config
+
+type Mail struct {
+	Driver       string `env:"MAIL_DRIVER" envDefault:"log"`
+	From         string `env:"MAIL_FROM" envDefault:"api_users@localhost"`
+	FilePath     string `env:"MAIL_FILE" envDefault:"mail.log"`
+	SMTPAddr     string `env:"MAIL_SMTP_ADDR" envDefault:"localhost:25"`
+	SMTPUsername string `env:"MAIL_SMTP_USERNAME"`
+	SMTPPassword string `env:"MAIL_SMTP_PASSWORD"`
+}
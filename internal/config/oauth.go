@@ -0,0 +1,9 @@
+package config
+
+import "time"
+
+type OAuth struct {
+	OAuthCodeTTL         time.Duration `env:"OAUTH_CODE_TTL" envDefault:"1m"`
+	OAuthAccessTokenTTL  time.Duration `env:"OAUTH_ACCESS_TOKEN_TTL" envDefault:"1h"`
+	OAuthRefreshTokenTTL time.Duration `env:"OAUTH_REFRESH_TOKEN_TTL" envDefault:"720h"`
+}
@@ -0,0 +1,11 @@
+package config
+
+import "time"
+
+type OIDC struct {
+	OIDCIDTokenTTL time.Duration `env:"OIDC_ID_TOKEN_TTL" envDefault:"1h"`
+	//OIDCKeyRotation is the age of the signing key it is replaced at, 0 turns the automatic rotation off
+	OIDCKeyRotation time.Duration `env:"OIDC_KEY_ROTATION" envDefault:"720h"`
+	//OIDCKeyRetention is how long a replaced key stays published, it must not be shorter than OIDCIDTokenTTL
+	OIDCKeyRetention time.Duration `env:"OIDC_KEY_RETENTION" envDefault:"24h"`
+}
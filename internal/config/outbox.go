@@ -0,0 +1,18 @@
+package config
+
+import "time"
+
+type Outbox struct {
+	OutboxPublisher    string        `env:"OUTBOX_PUBLISHER"`
+	OutboxBatchSize    int           `env:"OUTBOX_BATCH_SIZE" envDefault:"100"`
+	OutboxPollInterval time.Duration `env:"OUTBOX_POLL_INTERVAL" envDefault:"1s"`
+	//OutboxMaxAttempts is the number of attempts before a message becomes a dead letter, 0 retries forever
+	OutboxMaxAttempts  int           `env:"OUTBOX_MAX_ATTEMPTS" envDefault:"16"`
+	OutboxBaseDelay    time.Duration `env:"OUTBOX_BASE_DELAY" envDefault:"1s"`
+	OutboxMaxDelay     time.Duration `env:"OUTBOX_MAX_DELAY" envDefault:"10m"`
+	OutboxNATSURL      string        `env:"OUTBOX_NATS_URL" envDefault:"nats://localhost:4222"`
+	OutboxNATSSubject  string        `env:"OUTBOX_NATS_SUBJECT" envDefault:"users"`
+	OutboxKafkaBrokers []string      `env:"OUTBOX_KAFKA_BROKERS" envSeparator:"," envDefault:"localhost:9092"`
+	OutboxKafkaTopic   string        `env:"OUTBOX_KAFKA_TOPIC" envDefault:"users"`
+	OutboxFile         string        `env:"OUTBOX_FILE" envDefault:"outbox.ndjson"`
+}
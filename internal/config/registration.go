@@ -0,0 +1,9 @@
+package config
+
+import "time"
+
+type Registration struct {
+	Enabled    bool          `env:"REGISTRATION_ENABLED" envDefault:"false"`
+	RateLimit  int           `env:"REGISTRATION_RATE_LIMIT" envDefault:"5"`
+	RateWindow time.Duration `env:"REGISTRATION_RATE_WINDOW" envDefault:"1h"`
+}
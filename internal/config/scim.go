@@ -0,0 +1,8 @@
+package config
+
+type SCIM struct {
+	//SCIMToken gives access to the users of the default tenant only
+	SCIMToken string `env:"SCIM_TOKEN"`
+	//SCIMTenantTokens are the tokens of the other tenants by tenant name: acme:token1,globex:token2
+	SCIMTenantTokens map[string]string `env:"SCIM_TENANT_TOKENS"`
+}
@@ -0,0 +1,14 @@
+package config
+
+import "time"
+
+type Webhooks struct {
+	WebhookMaxAttempts  int           `env:"WEBHOOK_MAX_ATTEMPTS" envDefault:"8"`
+	WebhookBaseDelay    time.Duration `env:"WEBHOOK_BASE_DELAY" envDefault:"10s"`
+	WebhookMaxDelay     time.Duration `env:"WEBHOOK_MAX_DELAY" envDefault:"1h"`
+	WebhookTimeout      time.Duration `env:"WEBHOOK_TIMEOUT" envDefault:"10s"`
+	WebhookWorkers      int           `env:"WEBHOOK_WORKERS" envDefault:"4"`
+	WebhookPollInterval time.Duration `env:"WEBHOOK_POLL_INTERVAL" envDefault:"1s"`
+	//WebhookAllowedNetworks are the CIDRs webhooks may be sent to even though they are private, loopback or link-local
+	WebhookAllowedNetworks []string `env:"WEBHOOK_ALLOWED_NETWORKS" envSeparator:","`
+}
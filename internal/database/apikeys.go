@@ -0,0 +1,121 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+//APIKey is a long-lived credential of a user for service-to-service access.
+//The key is shown to the user as "<Prefix>.<secret>", only the secret hash is stored.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	SecretHash string     `json:"-"`
+	Scopes     []string   `json:"scopes,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+//apiKeyRecord is the on-disk representation of APIKey, it keeps the secret hash.
+type apiKeyRecord struct {
+	APIKey
+	SecretHash string
+}
+
+//IsExpired reports whether the key has expired at the moment t.
+func (k *APIKey) IsExpired(t time.Time) bool {
+	return k.ExpiresAt != nil && t.After(*k.ExpiresAt)
+}
+
+//NewAPIKey saves a key, generates its ID. The prefix must be unique.
+func (db *DB) NewAPIKey(k *APIKey) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.user(k.UserID); !ok {
+		return ErrUserNotExist
+	}
+
+	if _, ok := db.apiKeyPrefixes[k.Prefix]; ok {
+		return ErrAPIKeyPrefixExist
+	}
+
+	k.ID = uuid.New()
+	db.apiKeys[k.ID] = k
+	db.apiKeyPrefixes[k.Prefix] = k.ID
+
+	return db.persist()
+}
+
+//GetAPIKeysByUser returns copies of all keys of a user.
+func (db *DB) GetAPIKeysByUser(uid uuid.UUID) []*APIKey {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	keys := make([]*APIKey, 0)
+	if _, ok := db.user(uid); !ok {
+		return keys
+	}
+
+	for _, k := range db.apiKeys {
+		if k.UserID == uid {
+			c := *k
+			keys = append(keys, &c)
+		}
+	}
+
+	return keys
+}
+
+//GetAPIKeyByPrefix finds a key by its public prefix, returns a copy.
+func (db *DB) GetAPIKeyByPrefix(prefix string) (*APIKey, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	id, ok := db.apiKeyPrefixes[prefix]
+	if !ok {
+		return nil, ErrAPIKeyNotExist
+	}
+
+	c := *db.apiKeys[id]
+	return &c, nil
+}
+
+//TouchAPIKey sets the last usage time of a key.
+//The time is not written to the database file on its own to keep authentication cheap,
+//it is saved with the next mutation.
+func (db *DB) TouchAPIKey(id uuid.UUID, t time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	k, ok := db.apiKeys[id]
+	if !ok {
+		return ErrAPIKeyNotExist
+	}
+
+	k.LastUsedAt = &t
+	return nil
+}
+
+//DeleteAPIKey revokes a key by ID.
+func (db *DB) DeleteAPIKey(id uuid.UUID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	k, ok := db.apiKeys[id]
+	if !ok {
+		return ErrAPIKeyNotExist
+	}
+	if _, ok := db.user(k.UserID); !ok {
+		return ErrAPIKeyNotExist
+	}
+
+	delete(db.apiKeyPrefixes, k.Prefix)
+	delete(db.apiKeys, id)
+
+	return db.persist()
+}
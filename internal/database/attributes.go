@@ -0,0 +1,350 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrAttributeNotExist error = errors.New("attribute does not exist")
+var ErrAttributeNameExist error = errors.New("attribute with this name already exists")
+var ErrAttributeDefinitionInvalid error = errors.New("invalid attribute definition")
+var ErrAttributeInvalid error = errors.New("invalid attribute value")
+var ErrAttributeRequired error = errors.New("attribute is required")
+var ErrAttributeNotUnique error = errors.New("attribute value is already used by another user")
+
+var attributeNameRe = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+
+type AttributeType string
+
+const (
+	AttributeString  AttributeType = "string"
+	AttributeNumber  AttributeType = "number"
+	AttributeBoolean AttributeType = "boolean"
+)
+
+//AttributeDefinition describes a custom attribute of the users of a tenant. Pattern and Enum restrict
+//the values of string attributes, Unique values can not repeat among the users of the tenant.
+type AttributeDefinition struct {
+	Name      string        `json:"name"`
+	TenantID  uuid.UUID     `json:"tenant_id,omitzero"`
+	Type      AttributeType `json:"type"`
+	Required  bool          `json:"required"`
+	Unique    bool          `json:"unique"`
+	Pattern   string        `json:"pattern,omitempty"`
+	Enum      []string      `json:"enum,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+//attrKey is the key of the attribute definitions, names are unique within a tenant.
+type attrKey struct {
+	Tenant uuid.UUID
+	Name   string
+}
+
+//validate checks the definition itself.
+func (d *AttributeDefinition) validate() error {
+	if !attributeNameRe.MatchString(d.Name) {
+		return fmt.Errorf("%w: name must be 1-63 lowercase letters, digits and underscores", ErrAttributeDefinitionInvalid)
+	}
+
+	switch d.Type {
+	case AttributeString:
+	case AttributeNumber, AttributeBoolean:
+		if d.Pattern != "" || len(d.Enum) > 0 {
+			return fmt.Errorf("%w: pattern and enum are allowed only for strings", ErrAttributeDefinitionInvalid)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrAttributeDefinitionInvalid, d.Type)
+	}
+
+	if _, err := regexp.Compile(d.Pattern); err != nil {
+		return fmt.Errorf("%w: %s", ErrAttributeDefinitionInvalid, err)
+	}
+
+	return nil
+}
+
+//normalize checks the value against the definition and returns it in the form it is stored:
+//numbers are kept as float64, as they are decoded from JSON.
+func (d *AttributeDefinition) normalize(v interface{}) (interface{}, error) {
+	invalid := fmt.Errorf("%w: %s must be a %s", ErrAttributeInvalid, d.Name, d.Type)
+
+	switch d.Type {
+	case AttributeNumber:
+		switch n := v.(type) {
+		case float64:
+			return n, nil
+		case int:
+			return float64(n), nil
+		case int64:
+			return float64(n), nil
+		}
+		return nil, invalid
+	case AttributeBoolean:
+		if _, ok := v.(bool); !ok {
+			return nil, invalid
+		}
+		return v, nil
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return nil, invalid
+	}
+
+	if d.Pattern != "" && !regexp.MustCompile(d.Pattern).MatchString(s) {
+		return nil, fmt.Errorf("%w: %s does not match %s", ErrAttributeInvalid, d.Name, d.Pattern)
+	}
+
+	if len(d.Enum) > 0 {
+		allowed := false
+		for _, e := range d.Enum {
+			allowed = allowed || e == s
+		}
+		if !allowed {
+			return nil, fmt.Errorf("%w: %s must be one of %v", ErrAttributeInvalid, d.Name, d.Enum)
+		}
+	}
+
+	return s, nil
+}
+
+//tenantAttributes returns the definitions of the tenant of the handle sorted by name. The caller must hold the lock.
+func (db *DB) tenantAttributes() []*AttributeDefinition {
+	defs := make([]*AttributeDefinition, 0)
+	for key, d := range db.attributes {
+		if key.Tenant == db.tenant {
+			defs = append(defs, d)
+		}
+	}
+
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Name < defs[j].Name
+	})
+
+	return defs
+}
+
+//checkAttributes validates the attributes of the user against the definitions of its tenant and normalizes
+//their values. Empty attributes are dropped. The caller must hold the lock.
+func (db *DB) checkAttributes(u *User) error {
+	attrs := make(map[string]interface{}, len(u.Attributes))
+
+	for name, v := range u.Attributes {
+		d, ok := db.attributes[attrKey{Tenant: u.TenantID, Name: name}]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrAttributeNotExist, name)
+		}
+		if v == nil || v == "" {
+			continue
+		}
+
+		nv, err := d.normalize(v)
+		if err != nil {
+			return err
+		}
+		attrs[name] = nv
+	}
+
+	for key, d := range db.attributes {
+		if key.Tenant != u.TenantID {
+			continue
+		}
+
+		v, ok := attrs[d.Name]
+		if d.Required && !ok {
+			return fmt.Errorf("%w: %s", ErrAttributeRequired, d.Name)
+		}
+		if d.Unique && ok && db.attributeTaken(d, v, u.ID) {
+			return fmt.Errorf("%w: %s", ErrAttributeNotUnique, d.Name)
+		}
+	}
+
+	u.Attributes = nil
+	if len(attrs) > 0 {
+		u.Attributes = attrs
+	}
+
+	return nil
+}
+
+//attributeTaken reports whether another user of the tenant of the definition has the value. The caller must hold the lock.
+func (db *DB) attributeTaken(d *AttributeDefinition, v interface{}, except uuid.UUID) bool {
+	for _, u := range db.store {
+		if u.TenantID == d.TenantID && u.ID != except && u.Attributes[d.Name] == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+//checkStoredValues checks that the values the users already have fit a new or changed definition.
+//Required is not checked, it applies only to the following changes of the users. The caller must hold the lock.
+func (db *DB) checkStoredValues(d *AttributeDefinition) error {
+	seen := make(map[interface{}]bool)
+
+	for _, u := range db.store {
+		v, ok := u.Attributes[d.Name]
+		if u.TenantID != d.TenantID || !ok {
+			continue
+		}
+
+		if _, err := d.normalize(v); err != nil {
+			return err
+		}
+		if d.Unique && seen[v] {
+			return fmt.Errorf("%w: %s", ErrAttributeNotUnique, d.Name)
+		}
+		seen[v] = true
+	}
+
+	return nil
+}
+
+//NewAttribute saves an attribute definition of the tenant of the handle.
+//The values the users already have must fit it.
+func (db *DB) NewAttribute(d *AttributeDefinition) error {
+	if err := d.validate(); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	d.TenantID = db.tenant
+	key := attrKey{Tenant: db.tenant, Name: d.Name}
+	if _, ok := db.attributes[key]; ok {
+		return ErrAttributeNameExist
+	}
+
+	if err := db.checkStoredValues(d); err != nil {
+		return err
+	}
+
+	c := *d
+	db.attributes[key] = &c
+
+	return db.persist()
+}
+
+//GetAttributes returns copies of the attribute definitions of the tenant sorted by name.
+func (db *DB) GetAttributes() []*AttributeDefinition {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	defs := db.tenantAttributes()
+	for i, d := range defs {
+		c := *d
+		defs[i] = &c
+	}
+
+	return defs
+}
+
+//GetAttribute finds an attribute definition by name, returns a copy.
+func (db *DB) GetAttribute(name string) (*AttributeDefinition, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	d, ok := db.attributes[attrKey{Tenant: db.tenant, Name: name}]
+	if !ok {
+		return nil, ErrAttributeNotExist
+	}
+
+	c := *d
+	return &c, nil
+}
+
+//UpdateAttribute replaces an attribute definition, the name can not be changed.
+//The values the users already have must fit the new definition.
+func (db *DB) UpdateAttribute(d *AttributeDefinition) error {
+	if err := d.validate(); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := attrKey{Tenant: db.tenant, Name: d.Name}
+	old, ok := db.attributes[key]
+	if !ok {
+		return ErrAttributeNotExist
+	}
+
+	d.TenantID = old.TenantID
+	d.CreatedAt = old.CreatedAt
+	if err := db.checkStoredValues(d); err != nil {
+		return err
+	}
+
+	c := *d
+	db.attributes[key] = &c
+
+	return db.persist()
+}
+
+//DeleteAttribute deletes an attribute definition and removes its values from the users.
+func (db *DB) DeleteAttribute(name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := attrKey{Tenant: db.tenant, Name: name}
+	if _, ok := db.attributes[key]; !ok {
+		return ErrAttributeNotExist
+	}
+
+	delete(db.attributes, key)
+	for _, u := range db.store {
+		if _, ok := u.Attributes[name]; !ok || u.TenantID != db.tenant {
+			continue
+		}
+
+		changed := *u
+		changed.Attributes = make(map[string]interface{}, len(u.Attributes))
+		for k, v := range u.Attributes {
+			if k != name {
+				changed.Attributes[k] = v
+			}
+		}
+		if len(changed.Attributes) == 0 {
+			changed.Attributes = nil
+		}
+
+		db.store[u.ID] = &changed
+		db.emit(EventUserUpdated, &changed)
+	}
+
+	return db.persist()
+}
+
+//mergeAttributes returns the old attributes with the passed ones set, a nil value removes the attribute.
+func mergeAttributes(old, set map[string]interface{}) map[string]interface{} {
+	if len(old)+len(set) == 0 {
+		return nil
+	}
+
+	merged := make(map[string]interface{}, len(old)+len(set))
+	for k, v := range old {
+		merged[k] = v
+	}
+	for k, v := range set {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = v
+	}
+
+	return merged
+}
+
+func attributesChanged(prev, u *User) bool {
+	return len(prev.Attributes)+len(u.Attributes) > 0 && !reflect.DeepEqual(prev.Attributes, u.Attributes)
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Attributes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	db, err := Open(path)
+	assert.Nil(t, err)
+
+	old := &User{Username: "old", Password: "pass"}
+	assert.Nil(t, db.NewUser(old))
+
+	assert.ErrorIs(t, db.NewAttribute(&AttributeDefinition{Name: "Dept", Type: AttributeString}), ErrAttributeDefinitionInvalid)
+	assert.ErrorIs(t, db.NewAttribute(&AttributeDefinition{Name: "age", Type: AttributeNumber, Enum: []string{"1"}}), ErrAttributeDefinitionInvalid)
+	assert.ErrorIs(t, db.NewAttribute(&AttributeDefinition{Name: "phone", Type: AttributeString, Pattern: "("}), ErrAttributeDefinitionInvalid)
+
+	defs := []*AttributeDefinition{
+		{Name: "department", Type: AttributeString, Required: true, Enum: []string{"sales", "dev"}},
+		{Name: "phone", Type: AttributeString, Unique: true, Pattern: `^\+[0-9]+$`},
+		{Name: "floor", Type: AttributeNumber},
+		{Name: "remote", Type: AttributeBoolean},
+	}
+	for _, d := range defs {
+		assert.Nil(t, db.NewAttribute(d))
+	}
+	assert.ErrorIs(t, db.NewAttribute(&AttributeDefinition{Name: "floor", Type: AttributeNumber}), ErrAttributeNameExist)
+
+	u := &User{Username: "user", Password: "pass"}
+	assert.ErrorIs(t, db.NewUser(u), ErrAttributeRequired)
+
+	u = &User{Username: "user", Password: "pass", Attributes: map[string]interface{}{"department": "hr"}}
+	assert.ErrorIs(t, db.NewUser(u), ErrAttributeInvalid)
+
+	u = &User{Username: "user", Password: "pass", Attributes: map[string]interface{}{"department": "dev", "color": "red"}}
+	assert.ErrorIs(t, db.NewUser(u), ErrAttributeNotExist)
+
+	u = &User{Username: "user", Password: "pass", Attributes: map[string]interface{}{"department": "dev", "floor": "3"}}
+	assert.ErrorIs(t, db.NewUser(u), ErrAttributeInvalid)
+
+	u = &User{Username: "user", Password: "pass", Attributes: map[string]interface{}{"department": "dev", "phone": "+100", "floor": 3}}
+	assert.Nil(t, db.NewUser(u))
+	assert.Equal(t, 3.0, u.Attributes["floor"], "Numbers are stored as float64")
+
+	other := &User{Username: "other", Password: "pass", Attributes: map[string]interface{}{"department": "sales", "phone": "+100"}}
+	assert.ErrorIs(t, db.NewUser(other), ErrAttributeNotUnique)
+
+	assert.ErrorIs(t, db.UpdateUser(&User{ID: old.ID}), ErrAttributeRequired, "Required attributes apply to the following changes")
+
+	assert.Nil(t, db.UpdateUser(&User{ID: u.ID, Attributes: map[string]interface{}{"remote": true, "phone": nil}}))
+	stored, _ := db.GetUserByID(u.ID)
+	assert.Equal(t, map[string]interface{}{"department": "dev", "floor": 3.0, "remote": true}, stored.Attributes)
+
+	history := db.GetUserHistory(u.ID)
+	assert.Equal(t, []string{"Attributes"}, history[len(history)-1].Changed)
+
+	assert.ErrorIs(t, db.UpdateAttribute(&AttributeDefinition{Name: "floor", Type: AttributeBoolean}), ErrAttributeInvalid,
+		"The stored values must fit the changed definition")
+
+	assert.Nil(t, db.DeleteAttribute("remote"))
+	stored, _ = db.GetUserByID(u.ID)
+	_, ok := stored.Attributes["remote"]
+	assert.False(t, ok)
+
+	db, err = Open(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(db.GetAttributes()))
+	stored, _ = db.GetUserByID(u.ID)
+	assert.Equal(t, "dev", stored.Attributes["department"])
+}
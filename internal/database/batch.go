@@ -0,0 +1,179 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+var ErrBatchRolledBack error = errors.New("not applied: another operation of the batch failed")
+var ErrIDAlreadyExist error = errors.New("user with this id already exists")
+
+type BatchKind string
+
+const (
+	BatchCreate BatchKind = "create"
+	BatchUpdate BatchKind = "update"
+	BatchDelete BatchKind = "delete"
+	//BatchReplace stores the user as passed, including the email verification and pending states.
+	BatchReplace BatchKind = "replace"
+)
+
+//BatchOp is an operation of a batch. Passwords must be already hashed by CreatePasswordHash,
+//so the slow hashing is done out of the lock. Create keeps a passed ID. Update leaves empty fields
+//unchanged like UpdateUser, with KeepAdmin the admin flag is not changed too. Delete uses only the ID of the user.
+type BatchOp struct {
+	Kind      BatchKind
+	User      User
+	KeepAdmin bool
+}
+
+//ApplyBatch applies the operations in order and returns an error for every operation, nil if it succeeded.
+//The users of created and updated operations are filled with the stored data. In the atomic mode
+//either all operations are applied or none, operations that could succeed get ErrBatchRolledBack.
+func (db *DB) ApplyBatch(ops []BatchOp, atomic bool) []error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if atomic {
+		//сначала прогоняем операции на копии индексов, чтобы не откатывать изменения
+		dry := &DB{tenant: db.tenant, state: &state{
+			unamesUniqKey: make(map[unameKey]uuid.UUID, len(db.unamesUniqKey)),
+			store:         make(map[uuid.UUID]*User, len(db.store)),
+			attributes:    db.attributes,
+			dryRun:        true,
+		}}
+		for name, id := range db.unamesUniqKey {
+			dry.unamesUniqKey[name] = id
+		}
+		for id, u := range db.store {
+			dry.store[id] = u
+		}
+
+		errs := dry.applyBatch(append([]BatchOp(nil), ops...))
+		failed := false
+		for _, err := range errs {
+			failed = failed || err != nil
+		}
+		if failed {
+			for i := range errs {
+				if errs[i] == nil {
+					errs[i] = ErrBatchRolledBack
+				}
+			}
+			return errs
+		}
+	}
+
+	errs := db.applyBatch(ops)
+	if err := db.persist(); err != nil {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = err
+			}
+		}
+	}
+
+	return errs
+}
+
+//applyBatch applies the operations one by one. The caller must hold the lock.
+func (db *DB) applyBatch(ops []BatchOp) []error {
+	errs := make([]error, len(ops))
+
+	for i := range ops {
+		switch ops[i].Kind {
+		case BatchCreate:
+			errs[i] = db.batchCreate(&ops[i].User)
+		case BatchUpdate:
+			errs[i] = db.batchUpdate(&ops[i].User, ops[i].KeepAdmin)
+		case BatchReplace:
+			errs[i] = db.batchReplace(&ops[i].User)
+		case BatchDelete:
+			user, ok := db.user(ops[i].User.ID)
+			if !ok {
+				errs[i] = ErrUserNotExist
+				continue
+			}
+			db.deleteUser(user)
+		default:
+			errs[i] = errors.New("unknown operation")
+		}
+	}
+
+	return errs
+}
+
+func (db *DB) batchCreate(u *User) error {
+	if u.ID == uuid.Nil {
+		u.ID = uuid.New()
+	}
+	if _, ok := db.store[u.ID]; ok {
+		return ErrIDAlreadyExist
+	}
+
+	u.TenantID = db.tenant
+	if _, ok := db.unamesUniqKey[nameKey(u)]; ok {
+		return ErrNameAlreadyExist
+	}
+	if err := db.checkAttributes(u); err != nil {
+		return err
+	}
+
+	stored := *u
+	db.unamesUniqKey[nameKey(u)] = u.ID
+	db.store[u.ID] = &stored
+	db.emit(EventUserCreated, &stored)
+
+	return nil
+}
+
+func (db *DB) batchUpdate(u *User, keepAdmin bool) error {
+	user, ok := db.user(u.ID)
+	if !ok {
+		return ErrUserNotExist
+	}
+
+	if u.Username == "" {
+		u.Username = user.Username
+	}
+	if u.Email == "" {
+		u.Email = user.Email
+	}
+	if u.Password == "" {
+		u.Password = user.Password
+	}
+	if keepAdmin {
+		u.Admin = user.Admin
+	}
+	u.Attributes = mergeAttributes(user.Attributes, u.Attributes)
+	u.keepState(user)
+
+	return db.batchReplace(u)
+}
+
+func (db *DB) batchReplace(u *User) error {
+	user, ok := db.user(u.ID)
+	if !ok {
+		return ErrUserNotExist
+	}
+
+	u.TenantID = user.TenantID
+	if err := db.checkAttributes(u); err != nil {
+		return err
+	}
+	if u.Username != user.Username {
+		if _, ok := db.unamesUniqKey[nameKey(u)]; ok {
+			return ErrNameAlreadyExist
+		}
+
+		delete(db.unamesUniqKey, nameKey(user))
+		db.unamesUniqKey[nameKey(u)] = u.ID
+	}
+
+	stored := *u
+	db.store[u.ID] = &stored
+	db.emit(EventUserUpdated, &stored)
+
+	return nil
+}
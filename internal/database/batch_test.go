@@ -0,0 +1,64 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_ApplyBatch_Atomic(t *testing.T) {
+	db := New()
+
+	existing := &User{Username: "existing", Email: "e@mai.l", Password: "pass", Admin: true}
+	err := db.NewUser(existing)
+	assert.Nil(t, err)
+
+	ops := []BatchOp{
+		{Kind: BatchCreate, User: User{Username: "first", Email: "f@mai.l", Password: "hash"}},
+		{Kind: BatchCreate, User: User{Username: "existing", Email: "x@mai.l", Password: "hash"}},
+		{Kind: BatchDelete, User: User{ID: existing.ID}},
+	}
+
+	errs := db.ApplyBatch(ops, true)
+	assert.ErrorIs(t, errs[0], ErrBatchRolledBack)
+	assert.ErrorIs(t, errs[1], ErrNameAlreadyExist)
+	assert.ErrorIs(t, errs[2], ErrBatchRolledBack)
+
+	assert.Equal(t, 1, len(db.GetAllUsers()))
+	_, err = db.GetUserByName("first")
+	assert.ErrorIs(t, err, ErrUserNotExist)
+	_, err = db.GetUserByID(existing.ID)
+	assert.Nil(t, err)
+}
+
+func TestDB_ApplyBatch_Partial(t *testing.T) {
+	db := New()
+
+	existing := &User{Username: "existing", Email: "e@mai.l", Password: "pass", Admin: true}
+	err := db.NewUser(existing)
+	assert.Nil(t, err)
+	hash := existing.Password
+
+	ops := []BatchOp{
+		{Kind: BatchCreate, User: User{Username: "first", Email: "f@mai.l", Password: "hash"}},
+		{Kind: BatchUpdate, User: User{ID: existing.ID, Username: "renamed"}, KeepAdmin: true},
+		{Kind: BatchDelete, User: User{ID: uuid.New()}},
+	}
+
+	errs := db.ApplyBatch(ops, false)
+	assert.Nil(t, errs[0])
+	assert.Nil(t, errs[1])
+	assert.ErrorIs(t, errs[2], ErrUserNotExist)
+
+	created, err := db.GetUserByName("first")
+	assert.Nil(t, err)
+	assert.Equal(t, ops[0].User.ID, created.ID)
+	assert.Equal(t, "hash", created.Password, "Batch passwords are stored as passed")
+
+	updated, err := db.GetUserByName("renamed")
+	assert.Nil(t, err)
+	assert.Equal(t, hash, updated.Password)
+	assert.True(t, updated.Admin)
+	assert.Equal(t, "e@mai.l", updated.Email)
+}
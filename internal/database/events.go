@@ -0,0 +1,67 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type EventType string
+
+const (
+	EventUserCreated  EventType = "user.created"
+	EventUserUpdated  EventType = "user.updated"
+	EventUserDisabled EventType = "user.disabled"
+	EventUserEnabled  EventType = "user.enabled"
+	EventUserDeleted  EventType = "user.deleted"
+)
+
+//EventTypes lists all user lifecycle events.
+var EventTypes = []EventType{EventUserCreated, EventUserUpdated, EventUserDisabled, EventUserEnabled, EventUserDeleted}
+
+//Event is a change of a user. User is a copy of the user after the change, for deletion - before it.
+type Event struct {
+	ID    uuid.UUID
+	Type  EventType
+	User  User
+	Time  time.Time
+	Actor string `json:",omitempty"`
+}
+
+//Listener is called for every change of users while the database is locked,
+//so it must return quickly and must not call the database.
+type Listener func(Event)
+
+//AddListener subscribes to changes of users made by any mutation, whatever API has called it.
+func (db *DB) AddListener(l Listener) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.listeners = append(db.listeners, l)
+}
+
+//emit records the version of the user, writes the change to the outbox, if it is enabled,
+//and notifies the listeners. The caller must hold the lock and persist the changes.
+func (db *DB) emit(t EventType, u *User) {
+	if db.dryRun {
+		return
+	}
+
+	e := Event{
+		ID:    uuid.New(),
+		Type:  t,
+		User:  *u,
+		Time:  time.Now().UTC(),
+		Actor: db.actor,
+	}
+
+	db.recordVersion(e)
+
+	if db.outboxEnabled {
+		db.addToOutbox(e)
+	}
+
+	for _, l := range db.listeners {
+		l(e)
+	}
+}
@@ -0,0 +1,369 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrGroupNotExist error = errors.New("group does not exist")
+var ErrGroupNameExist error = errors.New("group with this name already exists")
+var ErrGroupCycle error = errors.New("the group would contain itself")
+var ErrMemberNotExist error = errors.New("member does not exist")
+var ErrUnknownPermission error = errors.New("unknown permission")
+
+//Permission is a right granted to the members of a group in addition to their own.
+type Permission string
+
+const (
+	//PermissionAdmin grants all the rights of an administrator.
+	PermissionAdmin Permission = "admin"
+	//PermissionRegistrations allows to approve and reject registrations.
+	PermissionRegistrations Permission = "registrations"
+	//PermissionWebhooks allows to manage webhooks and their deliveries.
+	PermissionWebhooks Permission = "webhooks"
+)
+
+var Permissions = []Permission{PermissionAdmin, PermissionRegistrations, PermissionWebhooks}
+
+//Group is a team of users. Groups may be members of other groups: the members of a nested group
+//are members of the parent group too and get its permissions.
+type Group struct {
+	ID          uuid.UUID    `json:"id"`
+	TenantID    uuid.UUID    `json:"tenant_id,omitzero"`
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Permissions []Permission `json:"permissions"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+type MemberKind string
+
+const (
+	MemberUser  MemberKind = "user"
+	MemberGroup MemberKind = "group"
+)
+
+//GroupMember is a direct member of a group, a user or a nested group.
+type GroupMember struct {
+	GroupID  uuid.UUID  `json:"group_id"`
+	Kind     MemberKind `json:"kind"`
+	MemberID uuid.UUID  `json:"member_id"`
+	AddedAt  time.Time  `json:"added_at"`
+}
+
+//ValidPermissions checks that all permissions are known.
+func ValidPermissions(ps []Permission) error {
+	for _, p := range ps {
+		known := false
+		for _, k := range Permissions {
+			known = known || p == k
+		}
+		if !known {
+			return ErrUnknownPermission
+		}
+	}
+
+	return nil
+}
+
+//group finds a group of the tenant of the handle. The caller must hold the lock.
+func (db *DB) group(id uuid.UUID) (*Group, bool) {
+	g, ok := db.groups[id]
+	if !ok || g.TenantID != db.tenant {
+		return nil, false
+	}
+
+	return g, true
+}
+
+func (db *DB) groupNameTaken(name string, except uuid.UUID) bool {
+	for _, g := range db.groups {
+		if g.TenantID == db.tenant && g.Name == name && g.ID != except {
+			return true
+		}
+	}
+
+	return false
+}
+
+//NewGroup saves a group of the tenant of the handle, generates its ID. The name must be unique within the tenant.
+func (db *DB) NewGroup(g *Group) error {
+	if err := ValidPermissions(g.Permissions); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.groupNameTaken(g.Name, uuid.Nil) {
+		return ErrGroupNameExist
+	}
+
+	g.ID = uuid.New()
+	g.TenantID = db.tenant
+	c := *g
+	db.groups[g.ID] = &c
+	db.members[g.ID] = make(map[uuid.UUID]*GroupMember)
+
+	return db.persist()
+}
+
+//GetGroups returns copies of all groups of the tenant sorted by name.
+func (db *DB) GetGroups() []*Group {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	groups := make([]*Group, 0)
+	for _, g := range db.groups {
+		if g.TenantID == db.tenant {
+			c := *g
+			groups = append(groups, &c)
+		}
+	}
+
+	sortGroups(groups)
+	return groups
+}
+
+//GetGroup finds a group by ID, returns a copy.
+func (db *DB) GetGroup(id uuid.UUID) (*Group, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	g, ok := db.group(id)
+	if !ok {
+		return nil, ErrGroupNotExist
+	}
+
+	c := *g
+	return &c, nil
+}
+
+//UpdateGroup replaces the name, the description and the permissions of a group.
+func (db *DB) UpdateGroup(g *Group) error {
+	if err := ValidPermissions(g.Permissions); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	old, ok := db.group(g.ID)
+	if !ok {
+		return ErrGroupNotExist
+	}
+
+	if db.groupNameTaken(g.Name, g.ID) {
+		return ErrGroupNameExist
+	}
+
+	g.TenantID = old.TenantID
+	g.CreatedAt = old.CreatedAt
+	c := *g
+	db.groups[g.ID] = &c
+
+	return db.persist()
+}
+
+//DeleteGroup deletes a group, its members and its membership in other groups.
+func (db *DB) DeleteGroup(id uuid.UUID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.group(id); !ok {
+		return ErrGroupNotExist
+	}
+
+	db.deleteGroup(id)
+	return db.persist()
+}
+
+//deleteGroup removes the group and all its memberships. The caller must hold the lock.
+func (db *DB) deleteGroup(id uuid.UUID) {
+	delete(db.groups, id)
+	delete(db.members, id)
+	db.deleteMemberships(id)
+}
+
+//deleteMemberships removes the user or the group from all groups. The caller must hold the lock.
+func (db *DB) deleteMemberships(memberID uuid.UUID) {
+	for _, ms := range db.members {
+		delete(ms, memberID)
+	}
+}
+
+//AddGroupMember adds a user or a nested group to a group. Adding an existing member does nothing.
+//A group can not become a member of itself, even through other groups.
+func (db *DB) AddGroupMember(m *GroupMember) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.group(m.GroupID); !ok {
+		return ErrGroupNotExist
+	}
+
+	switch m.Kind {
+	case MemberUser:
+		if _, ok := db.user(m.MemberID); !ok {
+			return ErrUserNotExist
+		}
+	case MemberGroup:
+		if _, ok := db.group(m.MemberID); !ok {
+			return ErrGroupNotExist
+		}
+		if m.MemberID == m.GroupID || db.containsGroup(m.MemberID, m.GroupID) {
+			return ErrGroupCycle
+		}
+	default:
+		return ErrMemberNotExist
+	}
+
+	if _, ok := db.members[m.GroupID][m.MemberID]; ok {
+		return nil
+	}
+
+	c := *m
+	db.members[m.GroupID][m.MemberID] = &c
+
+	return db.persist()
+}
+
+//containsGroup reports whether the target is nested in the group at any depth. The caller must hold the lock.
+func (db *DB) containsGroup(gid, target uuid.UUID) bool {
+	seen := map[uuid.UUID]bool{gid: true}
+	queue := []uuid.UUID{gid}
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		for _, m := range db.members[id] {
+			if m.Kind != MemberGroup || seen[m.MemberID] {
+				continue
+			}
+			if m.MemberID == target {
+				return true
+			}
+			seen[m.MemberID] = true
+			queue = append(queue, m.MemberID)
+		}
+	}
+
+	return false
+}
+
+//RemoveGroupMember removes a direct member from a group.
+func (db *DB) RemoveGroupMember(gid, memberID uuid.UUID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.group(gid); !ok {
+		return ErrGroupNotExist
+	}
+
+	if _, ok := db.members[gid][memberID]; !ok {
+		return ErrMemberNotExist
+	}
+
+	delete(db.members[gid], memberID)
+	return db.persist()
+}
+
+//GetGroupMembers returns copies of the direct members of a group in the order they were added.
+func (db *DB) GetGroupMembers(gid uuid.UUID) ([]*GroupMember, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if _, ok := db.group(gid); !ok {
+		return nil, ErrGroupNotExist
+	}
+
+	members := make([]*GroupMember, 0, len(db.members[gid]))
+	for _, m := range db.members[gid] {
+		c := *m
+		members = append(members, &c)
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		if !members[i].AddedAt.Equal(members[j].AddedAt) {
+			return members[i].AddedAt.Before(members[j].AddedAt)
+		}
+		return members[i].MemberID.String() < members[j].MemberID.String()
+	})
+
+	return members, nil
+}
+
+//GetUserGroups returns copies of the groups the user belongs to, directly or through nested groups, sorted by name.
+func (db *DB) GetUserGroups(uid uuid.UUID) ([]*Group, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if _, ok := db.user(uid); !ok {
+		return nil, ErrUserNotExist
+	}
+
+	groups := make([]*Group, 0)
+	for _, gid := range db.userGroups(uid) {
+		c := *db.groups[gid]
+		groups = append(groups, &c)
+	}
+
+	sortGroups(groups)
+	return groups, nil
+}
+
+//GetUserPermissions returns the permissions the groups of the user grant.
+func (db *DB) GetUserPermissions(uid uuid.UUID) []Permission {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	perms := make([]Permission, 0)
+	if _, ok := db.user(uid); !ok {
+		return perms
+	}
+
+	seen := make(map[Permission]bool)
+	for _, gid := range db.userGroups(uid) {
+		for _, p := range db.groups[gid].Permissions {
+			if !seen[p] {
+				seen[p] = true
+				perms = append(perms, p)
+			}
+		}
+	}
+
+	return perms
+}
+
+//userGroups walks from the groups with the member up to the groups containing them. The caller must hold the lock.
+func (db *DB) userGroups(memberID uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool)
+	queue := []uuid.UUID{memberID}
+	groups := make([]uuid.UUID, 0)
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		for gid, ms := range db.members {
+			if _, ok := ms[id]; !ok || seen[gid] {
+				continue
+			}
+			seen[gid] = true
+			groups = append(groups, gid)
+			queue = append(queue, gid)
+		}
+	}
+
+	return groups
+}
+
+func sortGroups(groups []*Group) {
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+}
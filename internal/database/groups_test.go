@@ -0,0 +1,74 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Groups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	db, err := Open(path)
+	assert.Nil(t, err)
+
+	u := &User{Username: "user", Password: "pass"}
+	assert.Nil(t, db.NewUser(u))
+
+	assert.ErrorIs(t, db.NewGroup(&Group{Name: "bad", Permissions: []Permission{"root"}}), ErrUnknownPermission)
+
+	staff := &Group{Name: "staff", Permissions: []Permission{PermissionRegistrations}}
+	dev := &Group{Name: "dev"}
+	ops := &Group{Name: "ops", Permissions: []Permission{PermissionWebhooks, PermissionRegistrations}}
+	for _, g := range []*Group{staff, dev, ops} {
+		assert.Nil(t, db.NewGroup(g))
+	}
+	assert.ErrorIs(t, db.NewGroup(&Group{Name: "dev"}), ErrGroupNameExist)
+
+	now := time.Now()
+	assert.Nil(t, db.AddGroupMember(&GroupMember{GroupID: staff.ID, Kind: MemberGroup, MemberID: dev.ID, AddedAt: now}))
+	assert.Nil(t, db.AddGroupMember(&GroupMember{GroupID: dev.ID, Kind: MemberGroup, MemberID: ops.ID, AddedAt: now}))
+	assert.Nil(t, db.AddGroupMember(&GroupMember{GroupID: ops.ID, Kind: MemberUser, MemberID: u.ID, AddedAt: now}))
+	assert.Nil(t, db.AddGroupMember(&GroupMember{GroupID: ops.ID, Kind: MemberUser, MemberID: u.ID, AddedAt: now}), "Adding twice does nothing")
+
+	assert.ErrorIs(t, db.AddGroupMember(&GroupMember{GroupID: ops.ID, Kind: MemberGroup, MemberID: staff.ID}), ErrGroupCycle)
+	assert.ErrorIs(t, db.AddGroupMember(&GroupMember{GroupID: dev.ID, Kind: MemberGroup, MemberID: dev.ID}), ErrGroupCycle)
+	assert.ErrorIs(t, db.AddGroupMember(&GroupMember{GroupID: dev.ID, Kind: MemberUser, MemberID: dev.ID}), ErrUserNotExist)
+
+	reopened, err := Open(path)
+	assert.Nil(t, err)
+
+	groups, err := reopened.GetUserGroups(u.ID)
+	assert.Nil(t, err)
+	if assert.Equal(t, 3, len(groups), "Users belong to the groups containing their groups") {
+		assert.Equal(t, "dev", groups[0].Name)
+		assert.Equal(t, "ops", groups[1].Name)
+		assert.Equal(t, "staff", groups[2].Name)
+	}
+	assert.ElementsMatch(t, []Permission{PermissionWebhooks, PermissionRegistrations}, reopened.GetUserPermissions(u.ID))
+
+	members, err := reopened.GetGroupMembers(ops.ID)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(members)) {
+		assert.Equal(t, MemberUser, members[0].Kind)
+		assert.Equal(t, u.ID, members[0].MemberID)
+	}
+
+	assert.Nil(t, reopened.DeleteGroup(dev.ID))
+	groups, err = reopened.GetUserGroups(u.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(groups), "Deleting a group cuts the nesting")
+
+	assert.ErrorIs(t, reopened.RemoveGroupMember(staff.ID, dev.ID), ErrMemberNotExist)
+	assert.Nil(t, reopened.DeleteUser(u.ID))
+	members, err = reopened.GetGroupMembers(ops.ID)
+	assert.Nil(t, err)
+	assert.Empty(t, members, "Deleted users leave their groups")
+
+	other := &Tenant{Name: "other"}
+	assert.Nil(t, reopened.NewTenant(other))
+	_, err = reopened.WithTenant(other.ID).GetGroup(ops.ID)
+	assert.ErrorIs(t, err, ErrGroupNotExist, "Groups of other tenants are not visible")
+	assert.Nil(t, reopened.WithTenant(other.ID).NewGroup(&Group{Name: "ops"}), "Group names are unique within a tenant")
+}
@@ -0,0 +1,210 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrVersionNotExist error = errors.New("version does not exist")
+var ErrRevertToDeleted error = errors.New("the version is a deletion, delete the user instead")
+
+//maxVersionsPerUser limits the history of a user, the oldest versions are removed.
+//The whole history is written to the database file on every change.
+const maxVersionsPerUser int = 100
+
+//UserVersion is the state of a user after a change. Changed lists the fields that differ
+//from the previous version, Actor is who has made the change if it is known. The password hash
+//is kept only to detect and revert its changes, it is never returned.
+type UserVersion struct {
+	Version int       `json:"version"`
+	Event   EventType `json:"event"`
+	User    User      `json:"user"`
+	Changed []string  `json:"changed"`
+	Actor   string    `json:"actor,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+//recordVersion appends the version of the user changed by the event. The caller must hold the lock.
+func (db *DB) recordVersion(e Event) {
+	versions := db.history[e.User.ID]
+
+	var prev *User
+	number := 1
+	if len(versions) > 0 {
+		prev = &versions[len(versions)-1].User
+		number = versions[len(versions)-1].Version + 1
+	}
+
+	changed := []string{}
+	if e.Type != EventUserDeleted {
+		changed = changedFields(prev, &e.User)
+	}
+
+	versions = append(versions, &UserVersion{
+		Version: number,
+		Event:   e.Type,
+		User:    e.User,
+		Changed: changed,
+		Actor:   e.Actor,
+		Time:    e.Time,
+	})
+	if len(versions) > maxVersionsPerUser {
+		versions = append([]*UserVersion(nil), versions[len(versions)-maxVersionsPerUser:]...)
+	}
+
+	db.history[e.User.ID] = versions
+}
+
+//changedFields compares the users field by field, without the previous version all set fields are changed.
+func changedFields(prev, u *User) []string {
+	if prev == nil {
+		prev = &User{}
+	}
+
+	fields := []struct {
+		name    string
+		changed bool
+	}{
+		{"Email", prev.Email != u.Email},
+		{"EmailVerified", prev.EmailVerified != u.EmailVerified},
+		{"Username", prev.Username != u.Username},
+		{"Password", prev.Password != u.Password},
+		{"Admin", prev.Admin != u.Admin},
+		{"Pending", prev.Pending != u.Pending},
+		{"Attributes", attributesChanged(prev, u)},
+	}
+
+	changed := []string{}
+	for _, f := range fields {
+		if f.changed {
+			changed = append(changed, f.name)
+		}
+	}
+
+	return changed
+}
+
+//userHistory returns the versions of a user of the tenant of the handle. The caller must hold the lock.
+func (db *DB) userHistory(uid uuid.UUID) []*UserVersion {
+	versions := db.history[uid]
+	if len(versions) == 0 || versions[0].User.TenantID != db.tenant {
+		return nil
+	}
+
+	return versions
+}
+
+//GetUserHistory returns copies of the last versions of a user without the password hashes, the oldest first.
+//The history is kept after the user is deleted.
+func (db *DB) GetUserHistory(uid uuid.UUID) []*UserVersion {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	versions := make([]*UserVersion, 0, len(db.history[uid]))
+	for _, v := range db.userHistory(uid) {
+		c := *v
+		c.User.Password = ""
+		versions = append(versions, &c)
+	}
+
+	return versions
+}
+
+//GetUserAsOf returns the user as it was at the moment t, without the password hash. Users without
+//the recorded history, e.g. created before it was introduced, are returned as they are now.
+func (db *DB) GetUserAsOf(uid uuid.UUID, t time.Time) (*User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	versions := db.userHistory(uid)
+	if len(versions) == 0 {
+		u, ok := db.user(uid)
+		if !ok {
+			return nil, ErrUserNotExist
+		}
+		c := *u
+		c.Password = ""
+		return &c, nil
+	}
+
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		if v.Time.After(t) {
+			continue
+		}
+		if v.Event == EventUserDeleted {
+			break
+		}
+
+		u := v.User
+		u.Password = ""
+		return &u, nil
+	}
+
+	return nil, ErrUserNotExist
+}
+
+//RevertUser restores the data of a user from the version: the name, the email with its verification,
+//the password, the admin flag and the pending state. A deleted user is created again with the same ID.
+//The name must still be unique. The revert is recorded as a new version. If the password is changed
+//by the revert, the sessions of the user are removed as after a password reset.
+func (db *DB) RevertUser(uid uuid.UUID, version int) (*User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var v *UserVersion
+	for _, ver := range db.userHistory(uid) {
+		if ver.Version == version {
+			v = ver
+			break
+		}
+	}
+	if v == nil {
+		return nil, ErrVersionNotExist
+	}
+
+	if v.Event == EventUserDeleted {
+		return nil, ErrRevertToDeleted
+	}
+
+	restored := v.User
+	current, exists := db.user(uid)
+
+	if id, ok := db.unamesUniqKey[nameKey(&restored)]; ok && id != uid {
+		return nil, ErrNameAlreadyExist
+	}
+	//версия проверяется по текущим определениям атрибутов
+	if err := db.checkAttributes(&restored); err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		db.unamesUniqKey[nameKey(&restored)] = uid
+		db.store[uid] = &restored
+		db.emit(EventUserCreated, &restored)
+
+		return &restored, db.persist()
+	}
+
+	delete(db.unamesUniqKey, nameKey(current))
+	db.unamesUniqKey[nameKey(&restored)] = uid
+	db.store[uid] = &restored
+
+	if restored.Password != current.Password {
+		db.deleteUserSessions(uid)
+	}
+
+	switch {
+	case restored.Pending && !current.Pending:
+		db.deleteUserSessions(uid)
+		db.emit(EventUserDisabled, &restored)
+	case !restored.Pending && current.Pending:
+		db.emit(EventUserEnabled, &restored)
+	default:
+		db.emit(EventUserUpdated, &restored)
+	}
+
+	return &restored, db.persist()
+}
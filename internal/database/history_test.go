@@ -0,0 +1,137 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_History(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	db, err := Open(path)
+	assert.Nil(t, err)
+
+	u := &User{Username: "user", Email: "u@mai.l", Password: "pass"}
+	assert.Nil(t, db.NewUser(u))
+	assert.Nil(t, db.WithActor("admin").UpdateUser(&User{ID: u.ID, Email: "new@mai.l"}))
+	_, err = db.SetUserPending(u.ID, true)
+	assert.Nil(t, err)
+
+	errs := db.ApplyBatch([]BatchOp{{Kind: BatchUpdate, User: User{ID: u.ID, Username: "batch"}}}, true)
+	assert.Nil(t, errs[0])
+	errs = db.ApplyBatch([]BatchOp{
+		{Kind: BatchUpdate, User: User{ID: u.ID, Username: "rolled back"}},
+		{Kind: BatchCreate, User: User{Username: "rolled back", Password: "hash"}},
+	}, true)
+	assert.ErrorIs(t, errs[1], ErrNameAlreadyExist)
+
+	reopened, err := Open(path)
+	assert.Nil(t, err)
+
+	versions := reopened.GetUserHistory(u.ID)
+	if assert.Equal(t, 4, len(versions), "Rolled back batches are not recorded") {
+		assert.Equal(t, 1, versions[0].Version)
+		assert.Equal(t, EventUserCreated, versions[0].Event)
+		assert.Equal(t, []string{"Email", "Username", "Password"}, versions[0].Changed)
+		assert.Empty(t, versions[0].Actor)
+		assert.Empty(t, versions[0].User.Password, "Password hashes are not returned")
+
+		assert.Equal(t, EventUserUpdated, versions[1].Event)
+		assert.Equal(t, []string{"Email"}, versions[1].Changed)
+		assert.Equal(t, "admin", versions[1].Actor)
+		assert.Equal(t, "new@mai.l", versions[1].User.Email)
+
+		assert.Equal(t, EventUserDisabled, versions[2].Event)
+		assert.Equal(t, []string{"Pending"}, versions[2].Changed)
+
+		assert.Equal(t, []string{"Username"}, versions[3].Changed)
+		assert.Equal(t, "batch", versions[3].User.Username)
+	}
+
+	asOf, err := reopened.GetUserAsOf(u.ID, versions[1].Time)
+	assert.Nil(t, err)
+	assert.Equal(t, "new@mai.l", asOf.Email)
+	assert.False(t, asOf.Pending)
+	assert.Empty(t, asOf.Password)
+
+	_, err = reopened.GetUserAsOf(u.ID, versions[0].Time.Add(-time.Second))
+	assert.ErrorIs(t, err, ErrUserNotExist, "The user did not exist before it was created")
+
+	assert.Nil(t, reopened.DeleteUser(u.ID))
+	_, err = reopened.GetUserAsOf(u.ID, time.Now())
+	assert.ErrorIs(t, err, ErrUserNotExist)
+	assert.Equal(t, 5, len(reopened.GetUserHistory(u.ID)), "The history is kept after deletion")
+}
+
+func TestDB_RevertUser(t *testing.T) {
+	db := New()
+
+	u := &User{Username: "user", Email: "u@mai.l", Password: "pass"}
+	assert.Nil(t, db.NewUser(u))
+	assert.Nil(t, db.UpdateUser(&User{ID: u.ID, Username: "renamed", Password: "new"}))
+	_, err := db.SetUserPending(u.ID, false)
+	assert.Nil(t, err)
+	assert.Nil(t, db.NewSession(&Session{TokenHash: HashSecret("token"), UserID: u.ID, ExpiresAt: time.Now().Add(time.Hour)}))
+	_, err = db.SetUserPending(u.ID, true)
+	assert.Nil(t, err)
+
+	_, err = db.RevertUser(u.ID, 5)
+	assert.ErrorIs(t, err, ErrVersionNotExist)
+
+	reverted, err := db.WithActor("admin").RevertUser(u.ID, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "user", reverted.Username)
+	assert.False(t, reverted.Pending)
+	assert.True(t, reverted.CheckPassword("pass"))
+	_, err = db.GetSession("token")
+	assert.ErrorIs(t, err, ErrSessionNotExist, "Sessions are removed when the password is reverted")
+
+	_, err = db.GetUserByName("renamed")
+	assert.ErrorIs(t, err, ErrUserNotExist, "The old name is released")
+
+	versions := db.GetUserHistory(u.ID)
+	if assert.Equal(t, 4, len(versions)) {
+		assert.Equal(t, EventUserEnabled, versions[3].Event)
+		assert.Equal(t, []string{"Username", "Password", "Pending"}, versions[3].Changed)
+		assert.Equal(t, "admin", versions[3].Actor)
+	}
+
+	assert.Nil(t, db.DeleteUser(u.ID))
+	_, err = db.RevertUser(u.ID, 5)
+	assert.ErrorIs(t, err, ErrRevertToDeleted)
+
+	assert.Nil(t, db.NewUser(&User{Username: "user", Password: "pass"}))
+	_, err = db.RevertUser(u.ID, 1)
+	assert.ErrorIs(t, err, ErrNameAlreadyExist, "The name is taken by another user")
+
+	restored, err := db.RevertUser(u.ID, 2)
+	assert.Nil(t, err, "A deleted user is created again")
+	assert.Equal(t, u.ID, restored.ID)
+
+	found, err := db.GetUserByName("renamed")
+	assert.Nil(t, err)
+	assert.Equal(t, u.ID, found.ID)
+}
+
+func TestDB_HistoryLimit(t *testing.T) {
+	db := New()
+
+	u := &User{Username: "user", Password: "pass"}
+	assert.Nil(t, db.NewUser(u))
+	for i := 0; i < maxVersionsPerUser+5; i++ {
+		_, err := db.SetUserPending(u.ID, i%2 == 0)
+		assert.Nil(t, err)
+	}
+
+	versions := db.GetUserHistory(u.ID)
+	assert.Equal(t, maxVersionsPerUser, len(versions), "The oldest versions are removed")
+	assert.Equal(t, 7, versions[0].Version, "Versions keep their numbers")
+	assert.Equal(t, maxVersionsPerUser+6, versions[len(versions)-1].Version)
+
+	_, err := db.RevertUser(u.ID, 1)
+	assert.ErrorIs(t, err, ErrVersionNotExist)
+	_, err = db.RevertUser(u.ID, 7)
+	assert.Nil(t, err)
+}
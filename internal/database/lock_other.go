@@ -0,0 +1,8 @@
+//go:build !unix
+
+package database
+
+//Lock does not lock the database file on the systems without flock, only one process must use the file.
+func Lock(path string) (func() error, error) {
+	return func() error { return nil }, nil
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+
+	unlock, err := Lock(path)
+	assert.Nil(t, err)
+
+	_, err = Lock(path)
+	assert.ErrorIs(t, err, ErrDatabaseLocked, "Only one process may use the database file")
+
+	assert.Nil(t, unlock())
+	unlock, err = Lock(path)
+	assert.Nil(t, err, "The lock is released")
+	assert.Nil(t, unlock())
+}
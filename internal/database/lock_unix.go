@@ -0,0 +1,31 @@
+//go:build unix
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+//Lock takes the exclusive lock of the database file. The lock is kept in the file path + ".lock" and is released
+//by the returned function or when the process exits, so a crashed process does not leave it behind.
+//Only one process may hold it: every change rewrites the whole file, so the changes of a second process
+//would be silently discarded by the next write of the first one.
+func Lock(path string) (func() error, error) {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database lock file: %w", err)
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrDatabaseLocked
+		}
+		return nil, fmt.Errorf("unable to lock database file: %w", err)
+	}
+
+	return f.Close, nil
+}
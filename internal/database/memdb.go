@@ -10,20 +10,38 @@ import (
 
 var ErrNameAlreadyExist error = errors.New("this name already exists")
 var ErrUserNotExist error = errors.New("user does not exist")
+var ErrTOTPNotExist error = errors.New("two-factor authentication is not configured")
+var ErrSessionNotExist error = errors.New("session does not exist")
+var ErrAPIKeyNotExist error = errors.New("api key does not exist")
+var ErrAPIKeyPrefixExist error = errors.New("api key prefix already exists")
+var ErrResetTokenNotExist error = errors.New("reset token is invalid or expired")
+var ErrVerificationNotExist error = errors.New("verification token is invalid or expired")
+var ErrUserNotPending error = errors.New("user is not waiting for approval")
 
 type User struct {
-	ID       uuid.UUID
-	Email    string `validate:"email"`
-	Username string `validate:"min=1"`
-	Password string `validate:"min=1"`
-	Admin    bool
+	ID            uuid.UUID
+	TenantID      uuid.UUID `json:",omitzero"`
+	Email         string    `validate:"email"`
+	EmailVerified bool
+	Username      string `validate:"min=1"`
+	Password      string `validate:"min=1"`
+	Admin         bool
+	Pending       bool
+	//Attributes are the custom attributes defined by the administrators of the tenant, see AttributeDefinition.
+	Attributes map[string]interface{} `json:",omitempty"`
+	//PasswordHashed tells that Password is already hashed in one of the formats of ValidPasswordHash,
+	//it is used only when the user is created and never stored.
+	PasswordHashed bool `json:",omitempty"`
 }
 
-//CheckPassword compares a hashed password with string password.
+//CheckPassword compares a hashed password with string password. The hash may be in any format of ValidPasswordHash.
 func (u *User) CheckPassword(password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
+	verify, err := passwordVerifier(u.Password)
+	if err != nil {
+		return false
+	}
 
-	return err == nil
+	return verify(password)
 }
 
 //CreatePasswordHash creates a hashed password from a string.
@@ -37,6 +55,8 @@ func (u *User) CreatePasswordHash(password string) (string, error) {
 }
 
 //UpdateFields updates empty fields in the struct with data from the passed struct.
+//Only the passed attributes are changed, a null value removes the attribute.
+//The email stays verified only if it has not changed, the pending state is kept.
 //When changing the password, hashes it.
 func (u *User) UpdateFields(oldUser *User) error {
 	if u.Username == "" {
@@ -45,6 +65,16 @@ func (u *User) UpdateFields(oldUser *User) error {
 	if u.Email == "" {
 		u.Email = oldUser.Email
 	}
+	u.Attributes = mergeAttributes(oldUser.Attributes, u.Attributes)
+
+	return u.ReplaceFields(oldUser)
+}
+
+//ReplaceFields keeps only the state that can not be replaced: the email stays verified only if it has not changed,
+//the pending state is kept, an empty password keeps the current one. When changing the password, hashes it.
+func (u *User) ReplaceFields(oldUser *User) error {
+	u.keepState(oldUser)
+	u.PasswordHashed = false
 	if u.Password == "" {
 		u.Password = oldUser.Password
 		return nil
@@ -59,21 +89,85 @@ func (u *User) UpdateFields(oldUser *User) error {
 	return nil
 }
 
+//keepState copies the state the user data can not change: the email stays verified only if it has not changed,
+//the pending state and the tenant are kept.
+func (u *User) keepState(oldUser *User) {
+	u.TenantID = oldUser.TenantID
+	u.EmailVerified = u.Email == oldUser.Email && oldUser.EmailVerified
+	u.Pending = oldUser.Pending
+}
+
+//DB is a handle of the storage. Handles made by WithActor and WithTenant share the data and differ
+//by the actor recorded in the history of the changes they make and by the tenant of the users they see.
 type DB struct {
-	mu            sync.RWMutex
-	unamesUniqKey map[string]uuid.UUID
-	store         map[uuid.UUID]*User
+	*state
+	actor  string
+	tenant uuid.UUID
+}
+
+type state struct {
+	mu             sync.RWMutex
+	unamesUniqKey  map[unameKey]uuid.UUID
+	store          map[uuid.UUID]*User
+	totp           map[uuid.UUID]*TOTP
+	sessions       map[string]*Session
+	apiKeys        map[uuid.UUID]*APIKey
+	apiKeyPrefixes map[string]uuid.UUID
+	resets         map[string]*PasswordReset
+	verifications  map[string]*EmailVerification
+	webhooks       map[uuid.UUID]*Webhook
+	deliveries     map[uuid.UUID]*WebhookDelivery
+	listeners      []Listener
+	outboxEnabled  bool
+	outbox         []*OutboxMessage
+	outboxDead     []*OutboxMessage
+	outboxSeq      uint64
+	history        map[uuid.UUID][]*UserVersion
+	tenants        map[uuid.UUID]*Tenant
+	groups         map[uuid.UUID]*Group
+	members        map[uuid.UUID]map[uuid.UUID]*GroupMember
+	attributes     map[attrKey]*AttributeDefinition
+	oauthClients   map[uuid.UUID]*OAuthClient
+	oauthCodes     map[string]*OAuthCode
+	oauthTokens    map[string]*OAuthToken
+	signingKeys    map[string]*SigningKey
+	//dryRun databases do not record the changes, they are used to check batches
+	dryRun bool
+	path   string
 }
 
 func New() *DB {
-	return &DB{
-		mu:            sync.RWMutex{},
-		unamesUniqKey: make(map[string]uuid.UUID),
-		store:         make(map[uuid.UUID]*User),
-	}
+	return &DB{state: &state{
+		mu:             sync.RWMutex{},
+		unamesUniqKey:  make(map[unameKey]uuid.UUID),
+		store:          make(map[uuid.UUID]*User),
+		totp:           make(map[uuid.UUID]*TOTP),
+		sessions:       make(map[string]*Session),
+		apiKeys:        make(map[uuid.UUID]*APIKey),
+		apiKeyPrefixes: make(map[string]uuid.UUID),
+		resets:         make(map[string]*PasswordReset),
+		verifications:  make(map[string]*EmailVerification),
+		webhooks:       make(map[uuid.UUID]*Webhook),
+		deliveries:     make(map[uuid.UUID]*WebhookDelivery),
+		history:        make(map[uuid.UUID][]*UserVersion),
+		tenants:        make(map[uuid.UUID]*Tenant),
+		groups:         make(map[uuid.UUID]*Group),
+		members:        make(map[uuid.UUID]map[uuid.UUID]*GroupMember),
+		attributes:     make(map[attrKey]*AttributeDefinition),
+		oauthClients:   make(map[uuid.UUID]*OAuthClient),
+		oauthCodes:     make(map[string]*OAuthCode),
+		oauthTokens:    make(map[string]*OAuthToken),
+		signingKeys:    make(map[string]*SigningKey),
+	}}
 }
 
-//NewUser creates a user, returns id.
+//WithActor returns a handle of the same storage that records the actor, e.g. the ID of the
+//authenticated user, in the history of the changes made through it.
+func (db *DB) WithActor(actor string) *DB {
+	return &DB{state: db.state, actor: actor, tenant: db.tenant}
+}
+
+//NewUser creates a user of the tenant of the handle, returns id. The password is hashed unless PasswordHashed is set.
 func (db *DB) NewUser(u *User) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
@@ -83,30 +177,45 @@ func (db *DB) NewUser(u *User) error {
 		return errors.New("id is not unique")
 	}
 
-	if _, ok := db.unamesUniqKey[u.Username]; ok {
+	u.TenantID = db.tenant
+	if _, ok := db.unamesUniqKey[nameKey(u)]; ok {
 		return ErrNameAlreadyExist
 	}
 
-	hashedPass, err := u.CreatePasswordHash(u.Password)
-	if err != nil {
+	if err := db.checkAttributes(u); err != nil {
 		return err
 	}
-	u.Password = hashedPass
 
-	db.unamesUniqKey[u.Username] = u.ID
+	if u.PasswordHashed {
+		if err := ValidPasswordHash(u.Password); err != nil {
+			return err
+		}
+		u.PasswordHashed = false
+	} else {
+		hashedPass, err := u.CreatePasswordHash(u.Password)
+		if err != nil {
+			return err
+		}
+		u.Password = hashedPass
+	}
+
+	db.unamesUniqKey[nameKey(u)] = u.ID
 	db.store[u.ID] = u
+	db.emit(EventUserCreated, u)
 
-	return nil
+	return db.persist()
 }
 
-//GetAllUsers returns a list of all users.
+//GetAllUsers returns a list of all users of the tenant.
 func (db *DB) GetAllUsers() []*User {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
 	users := make([]*User, 0, len(db.store))
 	for _, u := range db.store {
-		users = append(users, u)
+		if u.TenantID == db.tenant {
+			users = append(users, u)
+		}
 	}
 
 	return users
@@ -117,7 +226,7 @@ func (db *DB) GetUserByName(uname string) (*User, error) {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
-	id, ok := db.unamesUniqKey[uname]
+	id, ok := db.unamesUniqKey[unameKey{Tenant: db.tenant, Username: uname}]
 	if !ok {
 		return nil, ErrUserNotExist
 	}
@@ -130,7 +239,7 @@ func (db *DB) GetUserByID(uid uuid.UUID) (*User, error) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	u, ok := db.store[uid]
+	u, ok := db.user(uid)
 	if !ok {
 		return nil, ErrUserNotExist
 	}
@@ -138,31 +247,46 @@ func (db *DB) GetUserByID(uid uuid.UUID) (*User, error) {
 	return u, nil
 }
 
-//UpdateUser updates user data. The username must be unique.
+//UpdateUser updates user data, empty fields are left unchanged. The username must be unique.
 func (db *DB) UpdateUser(u *User) error {
+	return db.saveUser(u, (*User).UpdateFields)
+}
+
+//ReplaceUser replaces user data, so the email can be cleared. An empty password keeps the current one.
+//The username must be unique.
+func (db *DB) ReplaceUser(u *User) error {
+	return db.saveUser(u, (*User).ReplaceFields)
+}
+
+func (db *DB) saveUser(u *User, merge func(u, oldUser *User) error) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	user, ok := db.store[u.ID]
+	user, ok := db.user(u.ID)
 	if !ok {
 		return ErrUserNotExist
 	}
 
-	if err := u.UpdateFields(user); err != nil {
+	if err := merge(u, user); err != nil {
+		return err
+	}
+	if err := db.checkAttributes(u); err != nil {
 		return err
 	}
 
 	if u.Username != user.Username {
-		if _, ok := db.unamesUniqKey[u.Username]; ok {
+		if _, ok := db.unamesUniqKey[nameKey(u)]; ok {
 			return ErrNameAlreadyExist
 		}
 
-		delete(db.unamesUniqKey, user.Username)
-		db.unamesUniqKey[u.Username] = u.ID
+		delete(db.unamesUniqKey, nameKey(user))
+		db.unamesUniqKey[nameKey(u)] = u.ID
 	}
 
 	db.store[u.ID] = u
-	return nil
+	db.emit(EventUserUpdated, u)
+
+	return db.persist()
 }
 
 //DeleteUser deletes a user by ID.
@@ -170,13 +294,40 @@ func (db *DB) DeleteUser(uid uuid.UUID) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	user, ok := db.store[uid]
+	user, ok := db.user(uid)
 	if !ok {
 		return ErrUserNotExist
 	}
 
-	delete(db.unamesUniqKey, user.Username)
-	delete(db.store, uid)
+	db.deleteUser(user)
+	return db.persist()
+}
 
-	return nil
+//deleteUser removes the user and everything that belongs to it. The caller must hold the lock.
+func (db *DB) deleteUser(user *User) {
+	uid := user.ID
+	db.emit(EventUserDeleted, user)
+
+	delete(db.unamesUniqKey, nameKey(user))
+	delete(db.store, uid)
+	delete(db.totp, uid)
+	db.deleteUserSessions(uid)
+	db.deleteUserOAuth(uid)
+	db.deleteMemberships(uid)
+	for hash, p := range db.resets {
+		if p.UserID == uid {
+			delete(db.resets, hash)
+		}
+	}
+	for hash, v := range db.verifications {
+		if v.UserID == uid {
+			delete(db.verifications, hash)
+		}
+	}
+	for id, k := range db.apiKeys {
+		if k.UserID == uid {
+			delete(db.apiKeyPrefixes, k.Prefix)
+			delete(db.apiKeys, id)
+		}
+	}
 }
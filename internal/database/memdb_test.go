@@ -230,6 +230,40 @@ func TestDB_UpdateUser_GoodWay(t *testing.T) {
 	assert.Equal(t, wantUser, gotUser)
 }
 
+func TestDB_ReplaceUser_ClearsFields(t *testing.T) {
+	db := New()
+
+	oldUser := &User{
+		Username:      "old",
+		Email:         "e@mai.l",
+		EmailVerified: true,
+		Password:      "pass",
+		Admin:         true,
+	}
+
+	err := db.NewUser(oldUser)
+	assert.Nil(t, err)
+
+	wantPassword := oldUser.Password
+
+	err = db.ReplaceUser(&User{
+		ID:       oldUser.ID,
+		Username: "new",
+	})
+	assert.Nil(t, err)
+
+	gotUser, err := db.GetUserByID(oldUser.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, &User{
+		ID:       oldUser.ID,
+		Username: "new",
+		Password: wantPassword,
+	}, gotUser)
+
+	_, err = db.GetUserByName("old")
+	assert.ErrorIs(t, err, ErrUserNotExist)
+}
+
 func TestDB_DeleteUser_ErrUserNotExist(t *testing.T) {
 	db := New()
 
@@ -0,0 +1,322 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrOAuthClientNotExist error = errors.New("oauth client does not exist")
+var ErrOAuthCodeNotExist error = errors.New("authorization code is invalid or expired")
+var ErrOAuthTokenNotExist error = errors.New("oauth token is invalid or expired")
+
+const (
+	GrantAuthorizationCode string = "authorization_code"
+	GrantRefreshToken      string = "refresh_token"
+	GrantClientCredentials string = "client_credentials"
+)
+
+//OAuthClient is an application registered to obtain tokens of the users of a tenant.
+//Public clients, e.g. mobile and single-page applications, have no secret.
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	TenantID     uuid.UUID `json:"tenant_id,omitzero"`
+	Name         string    `json:"name"`
+	SecretHash   string    `json:"-"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	GrantTypes   []string  `json:"grant_types"`
+	Scopes       []string  `json:"scopes"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+//oauthClientRecord is the on-disk representation of OAuthClient, it keeps the secret hash.
+type oauthClientRecord struct {
+	OAuthClient
+	SecretHash string
+}
+
+//IsPublic reports whether the client has no secret.
+func (c *OAuthClient) IsPublic() bool {
+	return c.SecretHash == ""
+}
+
+//AllowsGrant reports whether the client is registered for the grant type.
+func (c *OAuthClient) AllowsGrant(grant string) bool {
+	for _, g := range c.GrantTypes {
+		if g == grant {
+			return true
+		}
+	}
+
+	return false
+}
+
+//HasRedirectURI reports whether the URI is registered for the client, URIs are compared exactly.
+func (c *OAuthClient) HasRedirectURI(uri string) bool {
+	for _, u := range c.RedirectURIs {
+		if u == uri {
+			return true
+		}
+	}
+
+	return false
+}
+
+//OAuthCode is an authorization code issued to a client on behalf of a user. Codes are single-use
+//and short-lived, they are not written to the database file. Only the code hash is stored.
+type OAuthCode struct {
+	CodeHash    string
+	ClientID    uuid.UUID
+	UserID      uuid.UUID
+	RedirectURI string
+	//RedirectURIRequired is set when the authorization request included the redirect URI,
+	//then the token request must include the same URI (RFC 6749 4.1.3).
+	RedirectURIRequired bool
+	Scopes              []string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	//Nonce is the OpenID Connect nonce of the authorization request, it is put to the ID token.
+	Nonce     string
+	ExpiresAt time.Time
+}
+
+type OAuthTokenKind string
+
+const (
+	OAuthAccessToken  OAuthTokenKind = "access_token"
+	OAuthRefreshToken OAuthTokenKind = "refresh_token"
+)
+
+//OAuthToken is an access or a refresh token issued to a client. UserID is empty for the tokens
+//of the client credentials grant. The tokens issued for one authorization share GrantID,
+//so the whole chain of refreshed tokens can be revoked at once. Like sessions, tokens are kept
+//only in memory and only their hashes are stored.
+type OAuthToken struct {
+	TokenHash string
+	Kind      OAuthTokenKind
+	GrantID   uuid.UUID
+	ClientID  uuid.UUID
+	TenantID  uuid.UUID
+	UserID    uuid.UUID
+	Scopes    []string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+//oauthClient finds a client of the tenant of the handle. The caller must hold the lock.
+func (db *DB) oauthClient(id uuid.UUID) (*OAuthClient, bool) {
+	c, ok := db.oauthClients[id]
+	if !ok || c.TenantID != db.tenant {
+		return nil, false
+	}
+
+	return c, true
+}
+
+//NewOAuthClient saves a client of the tenant of the handle, generates its ID.
+func (db *DB) NewOAuthClient(c *OAuthClient) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c.ID = uuid.New()
+	c.TenantID = db.tenant
+	cp := *c
+	db.oauthClients[c.ID] = &cp
+
+	return db.persist()
+}
+
+//GetOAuthClients returns copies of the clients of the tenant sorted by creation time.
+func (db *DB) GetOAuthClients() []*OAuthClient {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	clients := make([]*OAuthClient, 0)
+	for _, c := range db.oauthClients {
+		if c.TenantID == db.tenant {
+			cp := *c
+			clients = append(clients, &cp)
+		}
+	}
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].CreatedAt.Before(clients[j].CreatedAt)
+	})
+
+	return clients
+}
+
+//GetOAuthClient finds a client by ID, returns a copy.
+func (db *DB) GetOAuthClient(id uuid.UUID) (*OAuthClient, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	c, ok := db.oauthClient(id)
+	if !ok {
+		return nil, ErrOAuthClientNotExist
+	}
+
+	cp := *c
+	return &cp, nil
+}
+
+//DeleteOAuthClient deletes a client and revokes its codes and tokens.
+func (db *DB) DeleteOAuthClient(id uuid.UUID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.oauthClient(id); !ok {
+		return ErrOAuthClientNotExist
+	}
+
+	db.deleteOAuthClient(id)
+	return db.persist()
+}
+
+//deleteOAuthClient removes the client with its codes and tokens. The caller must hold the lock.
+func (db *DB) deleteOAuthClient(id uuid.UUID) {
+	delete(db.oauthClients, id)
+	for hash, c := range db.oauthCodes {
+		if c.ClientID == id {
+			delete(db.oauthCodes, hash)
+		}
+	}
+	for hash, t := range db.oauthTokens {
+		if t.ClientID == id {
+			delete(db.oauthTokens, hash)
+		}
+	}
+}
+
+//deleteUserOAuth removes the codes and the tokens issued on behalf of the user. The caller must hold the lock.
+func (db *DB) deleteUserOAuth(uid uuid.UUID) {
+	for hash, c := range db.oauthCodes {
+		if c.UserID == uid {
+			delete(db.oauthCodes, hash)
+		}
+	}
+	for hash, t := range db.oauthTokens {
+		if t.UserID == uid {
+			delete(db.oauthTokens, hash)
+		}
+	}
+}
+
+//NewOAuthCode saves an authorization code. The client and the user must belong to the tenant of the handle.
+func (db *DB) NewOAuthCode(c *OAuthCode) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.oauthClient(c.ClientID); !ok {
+		return ErrOAuthClientNotExist
+	}
+	if _, ok := db.user(c.UserID); !ok {
+		return ErrUserNotExist
+	}
+
+	db.oauthCodes[c.CodeHash] = c
+	return nil
+}
+
+//ConsumeOAuthCode finds an unexpired authorization code issued to the client and deletes it, so it can be
+//exchanged only once. A code presented by another client is left intact: it must not be burned by a client
+//that has only intercepted it.
+func (db *DB) ConsumeOAuthCode(code string, clientID uuid.UUID) (*OAuthCode, error) {
+	hash := HashSecret(code)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c, ok := db.oauthCodes[hash]
+	if !ok || c.ClientID != clientID {
+		return nil, ErrOAuthCodeNotExist
+	}
+	if _, ok := db.oauthClient(c.ClientID); !ok {
+		return nil, ErrOAuthCodeNotExist
+	}
+
+	delete(db.oauthCodes, hash)
+	if time.Now().After(c.ExpiresAt) {
+		return nil, ErrOAuthCodeNotExist
+	}
+
+	return c, nil
+}
+
+//NewOAuthTokens saves tokens of a client of the tenant of the handle.
+func (db *DB) NewOAuthTokens(ts ...*OAuthToken) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, t := range ts {
+		if _, ok := db.oauthClient(t.ClientID); !ok {
+			return ErrOAuthClientNotExist
+		}
+		if t.UserID != uuid.Nil {
+			if _, ok := db.user(t.UserID); !ok {
+				return ErrUserNotExist
+			}
+		}
+	}
+
+	for _, t := range ts {
+		t.TenantID = db.tenant
+		db.oauthTokens[t.TokenHash] = t
+	}
+
+	return nil
+}
+
+//GetOAuthToken finds an unexpired token of the tenant of the handle, returns a copy.
+func (db *DB) GetOAuthToken(token string) (*OAuthToken, error) {
+	hash := HashSecret(token)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, ok := db.oauthTokens[hash]
+	if !ok || t.TenantID != db.tenant {
+		return nil, ErrOAuthTokenNotExist
+	}
+
+	if time.Now().After(t.ExpiresAt) {
+		delete(db.oauthTokens, hash)
+		return nil, ErrOAuthTokenNotExist
+	}
+
+	c := *t
+	return &c, nil
+}
+
+//DeleteOAuthToken removes a token. It fails if the token has already been removed,
+//so a refresh token can be exchanged only once.
+func (db *DB) DeleteOAuthToken(token string) error {
+	hash := HashSecret(token)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, ok := db.oauthTokens[hash]
+	if !ok || t.TenantID != db.tenant {
+		return ErrOAuthTokenNotExist
+	}
+
+	delete(db.oauthTokens, hash)
+	return nil
+}
+
+//RevokeOAuthGrant removes all tokens issued for the authorization.
+func (db *DB) RevokeOAuthGrant(grantID uuid.UUID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for hash, t := range db.oauthTokens {
+		if t.GrantID == grantID && t.TenantID == db.tenant {
+			delete(db.oauthTokens, hash)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_OAuthClients(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	db, err := Open(path)
+	assert.Nil(t, err)
+
+	c := &OAuthClient{
+		Name:         "app",
+		SecretHash:   HashSecret("secret"),
+		RedirectURIs: []string{"https://app.example.com/cb"},
+		GrantTypes:   []string{GrantAuthorizationCode},
+		Scopes:       []string{"read"},
+		CreatedAt:    time.Now(),
+	}
+	assert.Nil(t, db.NewOAuthClient(c))
+
+	reopened, err := Open(path)
+	assert.Nil(t, err)
+
+	stored, err := reopened.GetOAuthClient(c.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, HashSecret("secret"), stored.SecretHash, "The secret hash is saved to the file")
+	assert.False(t, stored.IsPublic())
+	assert.True(t, stored.AllowsGrant(GrantAuthorizationCode))
+	assert.False(t, stored.AllowsGrant(GrantClientCredentials))
+	assert.True(t, stored.HasRedirectURI("https://app.example.com/cb"))
+	assert.False(t, stored.HasRedirectURI("https://app.example.com/cb/"))
+
+	tenant := &Tenant{Name: "acme"}
+	assert.Nil(t, reopened.NewTenant(tenant))
+	_, err = reopened.WithTenant(tenant.ID).GetOAuthClient(c.ID)
+	assert.ErrorIs(t, err, ErrOAuthClientNotExist, "Clients are not visible to other tenants")
+	assert.Equal(t, 0, len(reopened.WithTenant(tenant.ID).GetOAuthClients()))
+}
+
+func TestDB_OAuthTokens(t *testing.T) {
+	db := New()
+
+	u := &User{Username: "user", Password: "pass"}
+	assert.Nil(t, db.NewUser(u))
+	c := &OAuthClient{Name: "app", GrantTypes: []string{GrantAuthorizationCode, GrantRefreshToken}}
+	assert.Nil(t, db.NewOAuthClient(c))
+
+	code := &OAuthCode{CodeHash: HashSecret("code"), ClientID: c.ID, UserID: u.ID, ExpiresAt: time.Now().Add(time.Minute)}
+	assert.Nil(t, db.NewOAuthCode(code))
+	assert.ErrorIs(t, db.NewOAuthCode(&OAuthCode{CodeHash: "x", ClientID: uuid.New(), UserID: u.ID}), ErrOAuthClientNotExist)
+
+	_, err := db.ConsumeOAuthCode("code", uuid.New())
+	assert.ErrorIs(t, err, ErrOAuthCodeNotExist, "Codes are bound to the client")
+
+	consumed, err := db.ConsumeOAuthCode("code", c.ID)
+	assert.Nil(t, err, "A code presented by another client is not consumed")
+	assert.Equal(t, u.ID, consumed.UserID)
+	_, err = db.ConsumeOAuthCode("code", c.ID)
+	assert.ErrorIs(t, err, ErrOAuthCodeNotExist, "Codes are single-use")
+
+	assert.Nil(t, db.NewOAuthCode(&OAuthCode{CodeHash: HashSecret("old"), ClientID: c.ID, UserID: u.ID, ExpiresAt: time.Now().Add(-time.Second)}))
+	_, err = db.ConsumeOAuthCode("old", c.ID)
+	assert.ErrorIs(t, err, ErrOAuthCodeNotExist, "Expired codes can not be exchanged")
+
+	grant := uuid.New()
+	access := &OAuthToken{TokenHash: HashSecret("access"), Kind: OAuthAccessToken, GrantID: grant, ClientID: c.ID, UserID: u.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	refresh := &OAuthToken{TokenHash: HashSecret("refresh"), Kind: OAuthRefreshToken, GrantID: grant, ClientID: c.ID, UserID: u.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	assert.Nil(t, db.NewOAuthTokens(access, refresh))
+
+	tenant := &Tenant{Name: "acme"}
+	assert.Nil(t, db.NewTenant(tenant))
+	_, err = db.WithTenant(tenant.ID).GetOAuthToken("access")
+	assert.ErrorIs(t, err, ErrOAuthTokenNotExist, "Tokens are valid only within their tenant")
+
+	assert.Nil(t, db.DeleteOAuthToken("refresh"))
+	assert.ErrorIs(t, db.DeleteOAuthToken("refresh"), ErrOAuthTokenNotExist)
+
+	stored, err := db.GetOAuthToken("access")
+	assert.Nil(t, err)
+	assert.Equal(t, OAuthAccessToken, stored.Kind)
+
+	assert.Nil(t, db.RevokeOAuthGrant(grant))
+	_, err = db.GetOAuthToken("access")
+	assert.ErrorIs(t, err, ErrOAuthTokenNotExist, "Revoking the grant revokes all its tokens")
+
+	assert.Nil(t, db.NewOAuthTokens(access))
+	assert.Nil(t, db.DeleteUser(u.ID))
+	_, err = db.GetOAuthToken("access")
+	assert.ErrorIs(t, err, ErrOAuthTokenNotExist, "Tokens of deleted users are revoked")
+
+	client := &OAuthToken{TokenHash: HashSecret("client"), Kind: OAuthAccessToken, ClientID: c.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	assert.Nil(t, db.NewOAuthTokens(client))
+	assert.Nil(t, db.DeleteOAuthClient(c.ID))
+	_, err = db.GetOAuthToken("client")
+	assert.ErrorIs(t, err, ErrOAuthTokenNotExist, "Tokens of deleted clients are revoked")
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrOutboxMessageNotExist error = errors.New("outbox message does not exist")
+
+//OutboxMessage is an event waiting to be published to the message broker. The outbox is saved
+//together with the change that has produced the event, so an event can not be lost or published
+//for a change that has not been saved.
+type OutboxMessage struct {
+	Seq           uint64
+	Event         Event
+	Attempts      int        `json:",omitempty"`
+	LastError     string     `json:",omitempty"`
+	NextAttemptAt *time.Time `json:",omitempty"`
+	//FailedAt is set when the message is moved to the dead letters after the last attempt.
+	FailedAt *time.Time `json:",omitempty"`
+}
+
+//EnableOutbox starts writing events of all mutations to the outbox. Messages stay there until
+//they are deleted by DeleteOutbox after publishing.
+func (db *DB) EnableOutbox() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.outboxEnabled = true
+}
+
+//addToOutbox appends the event to the outbox. The caller must hold the lock and persist the changes.
+func (db *DB) addToOutbox(e Event) {
+	//хеш пароля не нужен подписчикам и не должен попадать в брокер
+	e.User.Password = ""
+
+	db.outboxSeq++
+	db.outbox = append(db.outbox, &OutboxMessage{Seq: db.outboxSeq, Event: e})
+}
+
+//GetOutbox returns copies of up to limit oldest messages in the order they were written.
+func (db *DB) GetOutbox(limit int) []*OutboxMessage {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if limit <= 0 || limit > len(db.outbox) {
+		limit = len(db.outbox)
+	}
+
+	msgs := make([]*OutboxMessage, 0, limit)
+	for _, m := range db.outbox[:limit] {
+		c := *m
+		msgs = append(msgs, &c)
+	}
+
+	return msgs
+}
+
+//GetDueOutbox returns copies of up to limit oldest messages that can be published at the moment now.
+//A message waiting for its next attempt holds back the later messages of the same user to keep their order,
+//the messages of the other users are returned past it.
+func (db *DB) GetDueOutbox(limit int, now time.Time) []*OutboxMessage {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	msgs := []*OutboxMessage{}
+	waiting := make(map[uuid.UUID]bool)
+	for _, m := range db.outbox {
+		if limit > 0 && len(msgs) == limit {
+			break
+		}
+
+		uid := m.Event.User.ID
+		if waiting[uid] {
+			continue
+		}
+		if m.NextAttemptAt != nil && m.NextAttemptAt.After(now) {
+			waiting[uid] = true
+			continue
+		}
+
+		c := *m
+		msgs = append(msgs, &c)
+	}
+
+	return msgs
+}
+
+//DeleteOutbox removes published messages.
+func (db *DB) DeleteOutbox(seqs ...uint64) error {
+	if len(seqs) == 0 {
+		return nil
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	published := make(map[uint64]bool, len(seqs))
+	for _, s := range seqs {
+		published[s] = true
+	}
+
+	kept := make([]*OutboxMessage, 0, len(db.outbox))
+	for _, m := range db.outbox {
+		if !published[m.Seq] {
+			kept = append(kept, m)
+		}
+	}
+	db.outbox = kept
+
+	return db.persist()
+}
+
+//FailOutbox records a failed attempt to publish a message. The message is retried not earlier than next,
+//without next it is moved to the dead letters, so it no longer holds back the later messages of the user.
+func (db *DB) FailOutbox(seq uint64, lastError string, next *time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, m := range db.outbox {
+		if m.Seq != seq {
+			continue
+		}
+
+		failed := *m
+		failed.Attempts++
+		failed.LastError = lastError
+		failed.NextAttemptAt = next
+
+		if next != nil {
+			db.outbox[i] = &failed
+			return db.persist()
+		}
+
+		now := time.Now().UTC()
+		failed.FailedAt = &now
+		db.outbox = append(db.outbox[:i], db.outbox[i+1:]...)
+		db.outboxDead = append(db.outboxDead, &failed)
+		return db.persist()
+	}
+
+	return ErrOutboxMessageNotExist
+}
+
+//GetOutboxDeadLetters returns copies of the messages that have not been published after the last attempt.
+func (db *DB) GetOutboxDeadLetters() []*OutboxMessage {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	msgs := make([]*OutboxMessage, 0, len(db.outboxDead))
+	for _, m := range db.outboxDead {
+		c := *m
+		msgs = append(msgs, &c)
+	}
+
+	return msgs
+}
+
+//RetryOutboxDeadLetters returns the dead letters to the outbox with the attempts reset, in the order
+//they were written. Returns the number of the returned messages.
+func (db *DB) RetryOutboxDeadLetters() (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	n := len(db.outboxDead)
+	if n == 0 {
+		return 0, nil
+	}
+
+	for _, m := range db.outboxDead {
+		db.outbox = append(db.outbox, &OutboxMessage{Seq: m.Seq, Event: m.Event})
+	}
+	db.outboxDead = nil
+
+	sort.Slice(db.outbox, func(i, j int) bool {
+		return db.outbox[i].Seq < db.outbox[j].Seq
+	})
+
+	return n, db.persist()
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Outbox(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	db, err := Open(path)
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.NewUser(&User{Username: "before", Password: "pass"}))
+	assert.Empty(t, db.GetOutbox(0), "Nothing is written while the outbox is disabled")
+
+	db.EnableOutbox()
+
+	u := &User{Username: "user", Email: "u@mai.l", Password: "pass"}
+	assert.Nil(t, db.NewUser(u))
+	assert.Nil(t, db.UpdateUser(&User{ID: u.ID, Email: "new@mai.l"}))
+
+	errs := db.ApplyBatch([]BatchOp{
+		{Kind: BatchDelete, User: User{ID: u.ID}},
+		{Kind: BatchCreate, User: User{Username: "before", Password: "hash"}},
+	}, true)
+	assert.ErrorIs(t, errs[1], ErrNameAlreadyExist)
+
+	reopened, err := Open(path)
+	assert.Nil(t, err)
+
+	msgs := reopened.GetOutbox(0)
+	if assert.Equal(t, 2, len(msgs), "The outbox is saved with the changes, rolled back batches are not written") {
+		assert.Equal(t, EventUserCreated, msgs[0].Event.Type)
+		assert.Equal(t, EventUserUpdated, msgs[1].Event.Type)
+		assert.Equal(t, "new@mai.l", msgs[1].Event.User.Email)
+		assert.Empty(t, msgs[0].Event.User.Password, "Password hashes are not written to the outbox")
+		assert.Less(t, msgs[0].Seq, msgs[1].Seq)
+	}
+
+	assert.Equal(t, 1, len(db.GetOutbox(1)))
+
+	assert.Nil(t, db.DeleteOutbox(msgs[0].Seq))
+	left := db.GetOutbox(0)
+	if assert.Equal(t, 1, len(left)) {
+		assert.Equal(t, msgs[1].Seq, left[0].Seq)
+	}
+
+	assert.Nil(t, db.DeleteUser(u.ID))
+	assert.Nil(t, db.DeleteOutbox(left[0].Seq))
+
+	reopened, err = Open(path)
+	assert.Nil(t, err)
+	msgs = reopened.GetOutbox(0)
+	if assert.Equal(t, 1, len(msgs)) {
+		assert.Equal(t, EventUserDeleted, msgs[0].Event.Type)
+		assert.Greater(t, msgs[0].Seq, left[0].Seq, "Sequence numbers are not reused after a restart")
+	}
+}
+
+func TestDB_OutboxDeadLetters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	db, err := Open(path)
+	assert.Nil(t, err)
+	db.EnableOutbox()
+
+	u := &User{Username: "user", Password: "pass"}
+	assert.Nil(t, db.NewUser(u))
+	assert.Nil(t, db.UpdateUser(&User{ID: u.ID, Email: "new@mai.l"}))
+	msgs := db.GetOutbox(0)
+
+	next := time.Now().Add(time.Minute)
+	assert.Nil(t, db.FailOutbox(msgs[0].Seq, "broker is unavailable", &next))
+	left := db.GetOutbox(0)
+	if assert.Equal(t, 2, len(left)) {
+		assert.Equal(t, 1, left[0].Attempts)
+		assert.Equal(t, "broker is unavailable", left[0].LastError)
+	}
+
+	assert.Nil(t, db.FailOutbox(msgs[0].Seq, "message too large", nil))
+	assert.ErrorIs(t, db.FailOutbox(msgs[0].Seq, "", nil), ErrOutboxMessageNotExist)
+
+	reopened, err := Open(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(reopened.GetOutbox(0)))
+	dead := reopened.GetOutboxDeadLetters()
+	if assert.Equal(t, 1, len(dead), "Dead letters are saved") {
+		assert.Equal(t, msgs[0].Seq, dead[0].Seq)
+		assert.Equal(t, 2, dead[0].Attempts)
+		assert.NotNil(t, dead[0].FailedAt)
+	}
+
+	n, err := reopened.RetryOutboxDeadLetters()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Empty(t, reopened.GetOutboxDeadLetters())
+	retried := reopened.GetOutbox(0)
+	if assert.Equal(t, 2, len(retried)) {
+		assert.Equal(t, msgs[0].Seq, retried[0].Seq, "Retried messages keep their place in the order")
+		assert.Equal(t, 0, retried[0].Attempts)
+		assert.Nil(t, retried[0].FailedAt)
+	}
+}
+
+func TestDB_GetDueOutbox(t *testing.T) {
+	db := New()
+	db.EnableOutbox()
+
+	first := &User{Username: "first", Password: "pass"}
+	assert.Nil(t, db.NewUser(first))
+	assert.Nil(t, db.UpdateUser(&User{ID: first.ID, Email: "f@mai.l"}))
+	second := &User{Username: "second", Password: "pass"}
+	assert.Nil(t, db.NewUser(second))
+
+	msgs := db.GetOutbox(0)
+	next := time.Now().Add(time.Hour)
+	assert.Nil(t, db.FailOutbox(msgs[0].Seq, "failed", &next))
+
+	due := db.GetDueOutbox(0, time.Now())
+	if assert.Equal(t, 1, len(due), "The later messages of the waiting user are held back") {
+		assert.Equal(t, second.ID, due[0].Event.User.ID)
+	}
+	assert.Equal(t, 1, len(db.GetDueOutbox(1, next.Add(time.Second))))
+	assert.Equal(t, 3, len(db.GetDueOutbox(0, next.Add(time.Second))))
+}
@@ -0,0 +1,187 @@
+package database
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+//Prefixes of the supported password hash formats. Hashes other than bcrypt come from other systems
+//and are replaced with bcrypt on the first successful login.
+const (
+	hashPrefixArgon2id string = "$argon2id$"
+	hashPrefixPBKDF2   string = "pbkdf2_sha256$"
+	hashPrefixSHA1     string = "sha1$"
+)
+
+//Limits of the cost parameters of the imported hashes. The parameters come from the hash itself, so without
+//the limits a single imported row could make every login attempt allocate gigabytes or run for minutes.
+//The limits are well above the defaults of the libraries the hashes come from.
+const (
+	maxBcryptCost    int    = 14
+	maxArgon2Memory  uint32 = 256 * 1024 //KiB
+	maxArgon2Time    uint32 = 16
+	maxArgon2Threads uint8  = 16
+	maxPBKDF2Iter    int    = 2000000
+	maxHashKeyLen    int    = 128
+)
+
+var ErrUnknownPasswordHash error = errors.New("unknown password hash format, use bcrypt, argon2id, pbkdf2_sha256 or sha1")
+
+//ValidPasswordHash checks that the hash is in one of the supported formats:
+//bcrypt, argon2id ($argon2id$v=19$m=...,t=...,p=...$salt$hash), PBKDF2-SHA256 (pbkdf2_sha256$iterations$salt$hash)
+//or the legacy salted SHA-1 (sha1$salt$hexhash).
+func ValidPasswordHash(hash string) error {
+	_, err := passwordVerifier(hash)
+	return err
+}
+
+//PasswordNeedsUpgrade tells whether the password hash was imported in a format other than bcrypt.
+func (u *User) PasswordNeedsUpgrade() bool {
+	return !isBcryptHash(u.Password)
+}
+
+func isBcryptHash(hash string) bool {
+	_, err := bcrypt.Cost([]byte(hash))
+	return err == nil
+}
+
+//passwordVerifier parses the hash and returns the function that compares a password with it.
+func passwordVerifier(hash string) (func(password string) bool, error) {
+	switch {
+	case isBcryptHash(hash):
+		return bcryptVerifier(hash)
+	case strings.HasPrefix(hash, hashPrefixArgon2id):
+		return argon2idVerifier(strings.TrimPrefix(hash, hashPrefixArgon2id))
+	case strings.HasPrefix(hash, hashPrefixPBKDF2):
+		return pbkdf2Verifier(strings.TrimPrefix(hash, hashPrefixPBKDF2))
+	case strings.HasPrefix(hash, hashPrefixSHA1):
+		return sha1Verifier(strings.TrimPrefix(hash, hashPrefixSHA1))
+	}
+
+	return nil, ErrUnknownPasswordHash
+}
+
+//bcryptVerifier checks the cost of the hash: bcrypt allows costs up to 31, a single check would run for days.
+func bcryptVerifier(hash string) (func(string) bool, error) {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed bcrypt hash", ErrUnknownPasswordHash)
+	}
+	if cost > maxBcryptCost {
+		return nil, fmt.Errorf("%w: bcrypt cost exceeds %d", ErrUnknownPasswordHash, maxBcryptCost)
+	}
+
+	return func(password string) bool {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}, nil
+}
+
+//argon2idVerifier parses the PHC string v=19$m=65536,t=3,p=4$salt$hash with unpadded base64 salt and hash.
+func argon2idVerifier(s string) (func(string) bool, error) {
+	parts := strings.Split(s, "$")
+	if len(parts) != 4 || parts[0] != "v="+strconv.Itoa(argon2.Version) {
+		return nil, fmt.Errorf("%w: malformed argon2id hash", ErrUnknownPasswordHash)
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil || time == 0 || threads == 0 {
+		return nil, fmt.Errorf("%w: malformed argon2id parameters", ErrUnknownPasswordHash)
+	}
+	if memory > maxArgon2Memory || time > maxArgon2Time || threads > maxArgon2Threads {
+		return nil, fmt.Errorf("%w: argon2id parameters exceed m=%d,t=%d,p=%d", ErrUnknownPasswordHash, maxArgon2Memory, maxArgon2Time, maxArgon2Threads)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed argon2id salt", ErrUnknownPasswordHash)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 || len(key) > maxHashKeyLen {
+		return nil, fmt.Errorf("%w: malformed argon2id hash", ErrUnknownPasswordHash)
+	}
+
+	return func(password string) bool {
+		got := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(got, key) == 1
+	}, nil
+}
+
+//pbkdf2Verifier parses iterations$salt$hash, the format of Django, with a base64 hash.
+func pbkdf2Verifier(s string) (func(string) bool, error) {
+	parts := strings.Split(s, "$")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed pbkdf2_sha256 hash", ErrUnknownPasswordHash)
+	}
+
+	iter, err := strconv.Atoi(parts[0])
+	if err != nil || iter < 1 {
+		return nil, fmt.Errorf("%w: malformed pbkdf2_sha256 iterations", ErrUnknownPasswordHash)
+	}
+	if iter > maxPBKDF2Iter {
+		return nil, fmt.Errorf("%w: pbkdf2_sha256 iterations exceed %d", ErrUnknownPasswordHash, maxPBKDF2Iter)
+	}
+
+	salt := parts[1]
+	key, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil || len(key) == 0 || len(key) > maxHashKeyLen {
+		return nil, fmt.Errorf("%w: malformed pbkdf2_sha256 hash", ErrUnknownPasswordHash)
+	}
+
+	return func(password string) bool {
+		got, err := pbkdf2.Key(sha256.New, password, []byte(salt), iter, len(key))
+		return err == nil && subtle.ConstantTimeCompare(got, key) == 1
+	}, nil
+}
+
+//sha1Verifier parses salt$hexhash, where the hash is sha1(salt + password).
+func sha1Verifier(s string) (func(string) bool, error) {
+	salt, hexKey, ok := strings.Cut(s, "$")
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed sha1 hash", ErrUnknownPasswordHash)
+	}
+
+	key, err := hex.DecodeString(hexKey)
+	if err != nil || len(key) != sha1.Size {
+		return nil, fmt.Errorf("%w: malformed sha1 hash", ErrUnknownPasswordHash)
+	}
+
+	return func(password string) bool {
+		got := sha1.Sum([]byte(salt + password))
+		return subtle.ConstantTimeCompare(got[:], key) == 1
+	}, nil
+}
+
+//UpgradePassword replaces an imported password hash with a new one. If the password has been changed
+//since oldHash was read, the user is left unchanged.
+func (db *DB) UpgradePassword(uid uuid.UUID, oldHash, newHash string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	u, ok := db.user(uid)
+	if !ok {
+		return ErrUserNotExist
+	}
+
+	if u.Password != oldHash {
+		return nil
+	}
+
+	upgraded := *u
+	upgraded.Password = newHash
+	db.store[uid] = &upgraded
+
+	return db.persist()
+}
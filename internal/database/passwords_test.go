@@ -0,0 +1,82 @@
+package database
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/argon2"
+)
+
+func TestUser_CheckPassword_ImportedHashes(t *testing.T) {
+	salt := []byte("somesalt")
+	argonKey := argon2.IDKey([]byte("secret"), salt, 1, 64*1024, 2, 32)
+
+	hashes := map[string]string{
+		"argon2id": "$argon2id$v=19$m=65536,t=1,p=2$" + base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(argonKey),
+		"pbkdf2":   "pbkdf2_sha256$1000$salt$qN+JnzxPIE2WfgrWPAkph8EAVeuwF7PZ0ordIY1Peq0=",
+		"sha1":     "sha1$salt$da00ec2e6ff9ed4d342b24a16e262c82f3c8b10b",
+	}
+
+	bcryptHash, err := (&User{}).CreatePasswordHash("secret")
+	assert.Nil(t, err)
+	hashes["bcrypt"] = bcryptHash
+
+	for name, hash := range hashes {
+		assert.Nil(t, ValidPasswordHash(hash), name)
+
+		u := &User{Password: hash}
+		assert.True(t, u.CheckPassword("secret"), name)
+		assert.False(t, u.CheckPassword("Secret"), name)
+		assert.Equal(t, name != "bcrypt", u.PasswordNeedsUpgrade(), name)
+	}
+
+	for _, hash := range []string{"secret", "md5$salt$abc", "sha1$salt$xyz", "pbkdf2_sha256$0$salt$qN+J", "$argon2id$v=16$m=1,t=1,p=1$c2FsdA$a2V5"} {
+		assert.ErrorIs(t, ValidPasswordHash(hash), ErrUnknownPasswordHash, hash)
+		assert.False(t, (&User{Password: hash}).CheckPassword("secret"), hash)
+	}
+}
+
+func TestValidPasswordHash_CostLimits(t *testing.T) {
+	salt := base64.RawStdEncoding.EncodeToString([]byte("somesalt"))
+	key := base64.RawStdEncoding.EncodeToString(make([]byte, 32))
+	pbkdf2Key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	for _, hash := range []string{
+		"$argon2id$v=19$m=4194304,t=1,p=1$" + salt + "$" + key,
+		"$argon2id$v=19$m=65536,t=1000,p=1$" + salt + "$" + key,
+		"$argon2id$v=19$m=65536,t=1,p=255$" + salt + "$" + key,
+		"$argon2id$v=19$m=65536,t=1,p=1$" + salt + "$" + base64.RawStdEncoding.EncodeToString(make([]byte, 1<<20)),
+		"pbkdf2_sha256$1000000000$salt$" + pbkdf2Key,
+		"$2a$31$" + strings.Repeat("a", 53),
+	} {
+		assert.ErrorIs(t, ValidPasswordHash(hash), ErrUnknownPasswordHash, "Hashes with too high costs are rejected on import")
+		assert.False(t, (&User{Password: hash}).CheckPassword("secret"))
+	}
+
+	assert.Nil(t, ValidPasswordHash("$argon2id$v=19$m=262144,t=4,p=8$"+salt+"$"+key))
+	assert.Nil(t, ValidPasswordHash("pbkdf2_sha256$1000000$salt$"+pbkdf2Key), "The current Django default is accepted")
+	assert.Nil(t, ValidPasswordHash("$2a$14$"+strings.Repeat("a", 53)))
+}
+
+func TestDB_NewUser_PasswordHashed(t *testing.T) {
+	db := New()
+
+	hash := "sha1$salt$da00ec2e6ff9ed4d342b24a16e262c82f3c8b10b"
+	u := &User{Username: "legacy", Password: hash, PasswordHashed: true}
+	assert.Nil(t, db.NewUser(u))
+	assert.Equal(t, hash, u.Password)
+	assert.False(t, u.PasswordHashed)
+
+	err := db.NewUser(&User{Username: "plain", Password: "secret", PasswordHashed: true})
+	assert.ErrorIs(t, err, ErrUnknownPasswordHash)
+
+	assert.Nil(t, db.UpgradePassword(u.ID, "outdated", "new"))
+	got, _ := db.GetUserByID(u.ID)
+	assert.Equal(t, hash, got.Password, "The password changed since it was read is not replaced")
+
+	assert.Nil(t, db.UpgradePassword(u.ID, hash, "new"))
+	got, _ = db.GetUserByID(u.ID)
+	assert.Equal(t, "new", got.Password)
+}
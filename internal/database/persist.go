@@ -0,0 +1,185 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+var ErrDatabaseLocked error = errors.New("the database file is used by another process, stop the server first")
+
+//snapshot is the on-disk representation of the database.
+type snapshot struct {
+	Users []*User
+	TOTP  []*TOTP
+	Keys  []*apiKeyRecord
+
+	Webhooks   []*webhookRecord   `json:",omitempty"`
+	Deliveries []*WebhookDelivery `json:",omitempty"`
+
+	Outbox    []*OutboxMessage `json:",omitempty"`
+	OutboxSeq uint64           `json:",omitempty"`
+	//OutboxDead are the dead letters of the outbox.
+	OutboxDead []*OutboxMessage `json:",omitempty"`
+
+	History map[uuid.UUID][]*UserVersion `json:",omitempty"`
+
+	Tenants []*Tenant `json:",omitempty"`
+
+	Groups  []*Group       `json:",omitempty"`
+	Members []*GroupMember `json:",omitempty"`
+
+	Attributes []*AttributeDefinition `json:",omitempty"`
+
+	OAuthClients []*oauthClientRecord `json:",omitempty"`
+	SigningKeys  []*SigningKey        `json:",omitempty"`
+}
+
+//Open creates a database backed by the file at path.
+//If the file exists, its content is loaded; every mutation is written back to it.
+func Open(path string) (*DB, error) {
+	db := New()
+	db.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read database file: %w", err)
+	}
+
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("unable to decode database file: %w", err)
+	}
+
+	for _, u := range s.Users {
+		db.unamesUniqKey[nameKey(u)] = u.ID
+		db.store[u.ID] = u
+	}
+	for _, t := range s.TOTP {
+		db.totp[t.UserID] = t
+	}
+	for _, r := range s.Keys {
+		k := r.APIKey
+		k.SecretHash = r.SecretHash
+		db.apiKeys[k.ID] = &k
+		db.apiKeyPrefixes[k.Prefix] = k.ID
+	}
+	for _, r := range s.Webhooks {
+		h := r.Webhook
+		h.Secret = r.Secret
+		db.webhooks[h.ID] = &h
+	}
+	for _, d := range s.Deliveries {
+		db.deliveries[d.ID] = d
+	}
+	db.outbox = s.Outbox
+	db.outboxSeq = s.OutboxSeq
+	db.outboxDead = s.OutboxDead
+	for uid, versions := range s.History {
+		db.history[uid] = versions
+	}
+	for _, t := range s.Tenants {
+		db.tenants[t.ID] = t
+	}
+	for _, g := range s.Groups {
+		db.groups[g.ID] = g
+		db.members[g.ID] = make(map[uuid.UUID]*GroupMember)
+	}
+	for _, m := range s.Members {
+		db.members[m.GroupID][m.MemberID] = m
+	}
+	for _, d := range s.Attributes {
+		db.attributes[attrKey{Tenant: d.TenantID, Name: d.Name}] = d
+	}
+	for _, r := range s.OAuthClients {
+		c := r.OAuthClient
+		c.SecretHash = r.SecretHash
+		db.oauthClients[c.ID] = &c
+	}
+	for _, k := range s.SigningKeys {
+		db.signingKeys[k.ID] = k
+	}
+
+	return db, nil
+}
+
+//persist writes the current state to the database file. The caller must hold the lock.
+func (db *DB) persist() error {
+	if db.path == "" {
+		return nil
+	}
+
+	s := snapshot{
+		Users: make([]*User, 0, len(db.store)),
+		TOTP:  make([]*TOTP, 0, len(db.totp)),
+		Keys:  make([]*apiKeyRecord, 0, len(db.apiKeys)),
+	}
+	for _, u := range db.store {
+		s.Users = append(s.Users, u)
+	}
+	for _, t := range db.totp {
+		s.TOTP = append(s.TOTP, t)
+	}
+	for _, k := range db.apiKeys {
+		s.Keys = append(s.Keys, &apiKeyRecord{APIKey: *k, SecretHash: k.SecretHash})
+	}
+	for _, h := range db.webhooks {
+		s.Webhooks = append(s.Webhooks, &webhookRecord{Webhook: *h, Secret: h.Secret})
+	}
+	for _, d := range db.deliveries {
+		s.Deliveries = append(s.Deliveries, d)
+	}
+	s.Outbox = db.outbox
+	s.OutboxSeq = db.outboxSeq
+	s.OutboxDead = db.outboxDead
+	s.History = db.history
+	for _, t := range db.tenants {
+		s.Tenants = append(s.Tenants, t)
+	}
+	for _, g := range db.groups {
+		s.Groups = append(s.Groups, g)
+	}
+	for _, ms := range db.members {
+		for _, m := range ms {
+			s.Members = append(s.Members, m)
+		}
+	}
+	for _, d := range db.attributes {
+		s.Attributes = append(s.Attributes, d)
+	}
+	for _, c := range db.oauthClients {
+		s.OAuthClients = append(s.OAuthClients, &oauthClientRecord{OAuthClient: *c, SecretHash: c.SecretHash})
+	}
+	for _, k := range db.signingKeys {
+		s.SigningKeys = append(s.SigningKeys, k)
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	//пишем во временный файл и переименовываем, чтобы не оставить файл недописанным при падении
+	tmp, err := os.CreateTemp(filepath.Dir(db.path), filepath.Base(db.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), db.path)
+}
@@ -0,0 +1,86 @@
+package database
+
+import "github.com/google/uuid"
+
+//GetPendingUsers returns users of the tenant waiting for approval.
+func (db *DB) GetPendingUsers() []*User {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	users := make([]*User, 0)
+	for _, u := range db.store {
+		if u.Pending && u.TenantID == db.tenant {
+			users = append(users, u)
+		}
+	}
+
+	return users
+}
+
+//ApproveUser activates a pending user.
+func (db *DB) ApproveUser(uid uuid.UUID) (*User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	u, ok := db.user(uid)
+	if !ok {
+		return nil, ErrUserNotExist
+	}
+
+	if !u.Pending {
+		return nil, ErrUserNotPending
+	}
+
+	approved := *u
+	approved.Pending = false
+	db.store[uid] = &approved
+	db.emit(EventUserEnabled, &approved)
+
+	return &approved, db.persist()
+}
+
+//RejectUser deletes a pending user, so the username becomes free.
+func (db *DB) RejectUser(uid uuid.UUID) (*User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	u, ok := db.user(uid)
+	if !ok {
+		return nil, ErrUserNotExist
+	}
+
+	if !u.Pending {
+		return nil, ErrUserNotPending
+	}
+
+	db.deleteUser(u)
+	return u, db.persist()
+}
+
+//SetUserPending activates or deactivates a user without deleting it. A deactivated user
+//loses its sessions and cannot log in like a user waiting for approval.
+func (db *DB) SetUserPending(uid uuid.UUID, pending bool) (*User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	u, ok := db.user(uid)
+	if !ok {
+		return nil, ErrUserNotExist
+	}
+
+	updated := *u
+	updated.Pending = pending
+	db.store[uid] = &updated
+	if pending {
+		db.deleteUserSessions(uid)
+	}
+	if pending != u.Pending {
+		t := EventUserEnabled
+		if pending {
+			t = EventUserDisabled
+		}
+		db.emit(t, &updated)
+	}
+
+	return &updated, db.persist()
+}
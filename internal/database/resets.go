@@ -0,0 +1,52 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+//PasswordReset is a single-use token to set a new password. Only the token hash is stored.
+type PasswordReset struct {
+	TokenHash string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+//NewPasswordReset saves a reset token.
+func (db *DB) NewPasswordReset(p *PasswordReset) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.user(p.UserID); !ok {
+		return ErrUserNotExist
+	}
+
+	db.resets[p.TokenHash] = p
+	return nil
+}
+
+//ConsumePasswordReset finds an unexpired reset token and removes it, so it can be used only once.
+func (db *DB) ConsumePasswordReset(token string) (*PasswordReset, error) {
+	hash := HashSecret(token)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	p, ok := db.resets[hash]
+	if !ok {
+		return nil, ErrResetTokenNotExist
+	}
+	//токен другого тенанта не расходуется
+	if _, ok := db.user(p.UserID); !ok {
+		return nil, ErrResetTokenNotExist
+	}
+
+	delete(db.resets, hash)
+
+	if time.Now().After(p.ExpiresAt) {
+		return nil, ErrResetTokenNotExist
+	}
+
+	return p, nil
+}
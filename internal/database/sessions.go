@@ -0,0 +1,73 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+//Session is a bearer token issued after a successful login. Only the token hash is stored.
+type Session struct {
+	TokenHash string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+//NewSession saves a session.
+func (db *DB) NewSession(s *Session) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.user(s.UserID); !ok {
+		return ErrUserNotExist
+	}
+
+	db.sessions[s.TokenHash] = s
+	return nil
+}
+
+//GetSession finds an unexpired session by the token.
+func (db *DB) GetSession(token string) (*Session, error) {
+	hash := HashSecret(token)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	s, ok := db.sessions[hash]
+	if !ok {
+		return nil, ErrSessionNotExist
+	}
+
+	if time.Now().After(s.ExpiresAt) {
+		delete(db.sessions, hash)
+		return nil, ErrSessionNotExist
+	}
+
+	return s, nil
+}
+
+//DeleteSession removes a session by the token.
+func (db *DB) DeleteSession(token string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.sessions, HashSecret(token))
+	return nil
+}
+
+//DeleteUserSessions removes all sessions of a user.
+func (db *DB) DeleteUserSessions(uid uuid.UUID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.deleteUserSessions(uid)
+	return nil
+}
+
+func (db *DB) deleteUserSessions(uid uuid.UUID) {
+	for hash, s := range db.sessions {
+		if s.UserID == uid {
+			delete(db.sessions, hash)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var ErrSigningKeyNotExist error = errors.New("signing key does not exist")
+
+//SigningKey is a private key the ID tokens are signed with, it is shared by all tenants.
+//The newest key signs, the retired ones are kept for a while to verify the tokens they have signed.
+type SigningKey struct {
+	ID string
+	//PrivateKey is the key in the PKCS #8 DER form.
+	PrivateKey []byte
+	CreatedAt  time.Time
+	RetiredAt  *time.Time `json:",omitempty"`
+}
+
+//NewSigningKey saves a key, the keys saved before it are retired.
+func (db *DB) NewSigningKey(k *SigningKey) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, old := range db.signingKeys {
+		if old.RetiredAt == nil {
+			retired := k.CreatedAt
+			old.RetiredAt = &retired
+		}
+	}
+
+	c := *k
+	db.signingKeys[k.ID] = &c
+
+	return db.persist()
+}
+
+//GetSigningKeys returns copies of all keys, the newest first.
+func (db *DB) GetSigningKeys() []*SigningKey {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	keys := make([]*SigningKey, 0, len(db.signingKeys))
+	for _, k := range db.signingKeys {
+		c := *k
+		keys = append(keys, &c)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+
+	return keys
+}
+
+//DeleteSigningKey deletes a key by ID.
+func (db *DB) DeleteSigningKey(id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.signingKeys[id]; !ok {
+		return ErrSigningKeyNotExist
+	}
+
+	delete(db.signingKeys, id)
+	return db.persist()
+}
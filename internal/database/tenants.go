@@ -0,0 +1,166 @@
+package database
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrTenantNotExist error = errors.New("tenant does not exist")
+var ErrTenantNameExist error = errors.New("tenant with this name already exists")
+var ErrTenantNameInvalid error = errors.New("tenant name must be 1-63 lowercase letters, digits and dashes")
+
+var tenantNameRe = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?$`)
+
+//DefaultTenant is the tenant of the users created without a tenant, its administrators are super-admins.
+var DefaultTenant uuid.UUID = uuid.Nil
+
+//Tenant is an organization with its own users, administrators and username namespace.
+//Name is used in the path prefix and the header that select the tenant of a request.
+type Tenant struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+//unameKey is the key of the username index, usernames are unique within a tenant.
+type unameKey struct {
+	Tenant   uuid.UUID
+	Username string
+}
+
+func nameKey(u *User) unameKey {
+	return unameKey{Tenant: u.TenantID, Username: u.Username}
+}
+
+//WithTenant returns a handle of the same storage that sees only the users of the tenant.
+//Users created through it belong to the tenant. The handles of New and Open work with DefaultTenant.
+func (db *DB) WithTenant(tid uuid.UUID) *DB {
+	return &DB{state: db.state, actor: db.actor, tenant: tid}
+}
+
+//TenantID returns the tenant of the handle.
+func (db *DB) TenantID() uuid.UUID {
+	return db.tenant
+}
+
+//user finds a user of the tenant of the handle. The caller must hold the lock.
+func (db *DB) user(uid uuid.UUID) (*User, bool) {
+	u, ok := db.store[uid]
+	if !ok || u.TenantID != db.tenant {
+		return nil, false
+	}
+
+	return u, true
+}
+
+//NewTenant saves a tenant, generates its ID. The name must be unique.
+func (db *DB) NewTenant(t *Tenant) error {
+	if !tenantNameRe.MatchString(t.Name) {
+		return ErrTenantNameInvalid
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, existing := range db.tenants {
+		if existing.Name == t.Name {
+			return ErrTenantNameExist
+		}
+	}
+
+	t.ID = uuid.New()
+	c := *t
+	db.tenants[t.ID] = &c
+
+	return db.persist()
+}
+
+//GetTenants returns copies of all tenants sorted by name.
+func (db *DB) GetTenants() []*Tenant {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	tenants := make([]*Tenant, 0, len(db.tenants))
+	for _, t := range db.tenants {
+		c := *t
+		tenants = append(tenants, &c)
+	}
+
+	sort.Slice(tenants, func(i, j int) bool {
+		return tenants[i].Name < tenants[j].Name
+	})
+
+	return tenants
+}
+
+//GetTenant finds a tenant by ID, returns a copy.
+func (db *DB) GetTenant(id uuid.UUID) (*Tenant, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	t, ok := db.tenants[id]
+	if !ok {
+		return nil, ErrTenantNotExist
+	}
+
+	c := *t
+	return &c, nil
+}
+
+//GetTenantByName finds a tenant by name, returns a copy.
+func (db *DB) GetTenantByName(name string) (*Tenant, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, t := range db.tenants {
+		if t.Name == name {
+			c := *t
+			return &c, nil
+		}
+	}
+
+	return nil, ErrTenantNotExist
+}
+
+//DeleteTenant deletes a tenant with all its users, groups, webhooks and attribute definitions.
+func (db *DB) DeleteTenant(id uuid.UUID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.tenants[id]; !ok {
+		return ErrTenantNotExist
+	}
+
+	for _, u := range db.store {
+		if u.TenantID == id {
+			db.deleteUser(u)
+		}
+	}
+	for gid, g := range db.groups {
+		if g.TenantID == id {
+			db.deleteGroup(gid)
+		}
+	}
+	for hid, h := range db.webhooks {
+		if h.TenantID == id {
+			db.deleteWebhook(hid)
+		}
+	}
+	for key := range db.attributes {
+		if key.Tenant == id {
+			delete(db.attributes, key)
+		}
+	}
+	for cid, c := range db.oauthClients {
+		if c.TenantID == id {
+			db.deleteOAuthClient(cid)
+		}
+	}
+	delete(db.tenants, id)
+
+	return db.persist()
+}
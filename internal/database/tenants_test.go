@@ -0,0 +1,63 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Tenants(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	db, err := Open(path)
+	assert.Nil(t, err)
+
+	assert.ErrorIs(t, db.NewTenant(&Tenant{Name: "Acme Inc"}), ErrTenantNameInvalid)
+
+	acme := &Tenant{Name: "acme"}
+	assert.Nil(t, db.NewTenant(acme))
+	assert.ErrorIs(t, db.NewTenant(&Tenant{Name: "acme"}), ErrTenantNameExist)
+
+	root := &User{Username: "user", Password: "pass"}
+	assert.Nil(t, db.NewUser(root))
+
+	tenant := db.WithTenant(acme.ID)
+	u := &User{Username: "user", Password: "pass"}
+	assert.Nil(t, tenant.NewUser(u), "Usernames are unique within a tenant")
+	assert.Equal(t, acme.ID, u.TenantID)
+	assert.ErrorIs(t, tenant.NewUser(&User{Username: "user", Password: "pass"}), ErrNameAlreadyExist)
+
+	_, err = db.GetUserByID(u.ID)
+	assert.ErrorIs(t, err, ErrUserNotExist, "Users of other tenants are not visible")
+	assert.ErrorIs(t, db.UpdateUser(&User{ID: u.ID, Email: "u@mai.l"}), ErrUserNotExist)
+	assert.ErrorIs(t, db.DeleteUser(u.ID), ErrUserNotExist)
+	assert.Equal(t, 1, len(db.GetAllUsers()))
+
+	found, err := tenant.GetUserByName("user")
+	assert.Nil(t, err)
+	assert.Equal(t, u.ID, found.ID)
+
+	assert.Nil(t, tenant.UpdateUser(&User{ID: u.ID, Username: "renamed"}))
+	found, err = tenant.GetUserByID(u.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, acme.ID, found.TenantID, "The tenant is kept on update")
+
+	errs := db.ApplyBatch([]BatchOp{{Kind: BatchReplace, User: User{ID: u.ID, Username: "moved", Password: "hash"}}}, true)
+	assert.ErrorIs(t, errs[0], ErrUserNotExist)
+
+	reopened, err := Open(path)
+	assert.Nil(t, err)
+
+	loaded, err := reopened.GetTenantByName("acme")
+	assert.Nil(t, err)
+	assert.Equal(t, acme.ID, loaded.ID)
+
+	_, err = reopened.WithTenant(acme.ID).GetUserByName("renamed")
+	assert.Nil(t, err)
+
+	assert.Nil(t, reopened.DeleteTenant(acme.ID))
+	assert.Empty(t, reopened.WithTenant(acme.ID).GetAllUsers(), "Users are deleted with the tenant")
+	assert.Equal(t, 1, len(reopened.GetAllUsers()))
+	_, err = reopened.GetTenant(acme.ID)
+	assert.ErrorIs(t, err, ErrTenantNotExist)
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/google/uuid"
+)
+
+//TOTP is a two-factor authentication enrollment of a user.
+type TOTP struct {
+	UserID        uuid.UUID
+	URL           string
+	Enabled       bool
+	RecoveryCodes []string
+	//LastStep is the time step of the last accepted one-time code, the codes of it and earlier steps
+	//are rejected, so an intercepted code can not be replayed.
+	LastStep int64 `json:",omitempty"`
+}
+
+//HashSecret returns a hash of a high-entropy secret (token, recovery code) to keep at rest.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+//SetTOTP saves the two-factor enrollment of a user.
+func (db *DB) SetTOTP(t *TOTP) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.user(t.UserID); !ok {
+		return ErrUserNotExist
+	}
+
+	db.totp[t.UserID] = t
+	return db.persist()
+}
+
+//GetTOTP returns a copy of the two-factor enrollment of a user.
+func (db *DB) GetTOTP(uid uuid.UUID) (*TOTP, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	t, ok := db.totp[uid]
+	if _, exists := db.user(uid); !ok || !exists {
+		return nil, ErrTOTPNotExist
+	}
+
+	c := *t
+	c.RecoveryCodes = append([]string(nil), t.RecoveryCodes...)
+	return &c, nil
+}
+
+//DeleteTOTP removes the two-factor enrollment of a user.
+func (db *DB) DeleteTOTP(uid uuid.UUID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	_, ok := db.totp[uid]
+	if _, exists := db.user(uid); !ok || !exists {
+		return ErrTOTPNotExist
+	}
+
+	delete(db.totp, uid)
+	return db.persist()
+}
+
+//enabledTOTP finds the enabled enrollment of a user. The caller must hold the lock.
+func (db *DB) enabledTOTP(uid uuid.UUID) (*TOTP, error) {
+	t, ok := db.totp[uid]
+	if _, exists := db.user(uid); !ok || !exists || !t.Enabled {
+		return nil, ErrTOTPNotExist
+	}
+
+	return t, nil
+}
+
+//ConsumeRecoveryCode checks the code against the recovery codes of the enabled enrollment and removes it
+//if found. The check and the removal are done under one lock, so the code can be used only once.
+func (db *DB) ConsumeRecoveryCode(uid uuid.UUID, code string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.enabledTOTP(uid)
+	if err != nil {
+		return false, err
+	}
+
+	hash := HashSecret(code)
+	for i, c := range t.RecoveryCodes {
+		if c == hash {
+			t.RecoveryCodes = append(t.RecoveryCodes[:i], t.RecoveryCodes[i+1:]...)
+			return true, db.persist()
+		}
+	}
+
+	return false, nil
+}
+
+//AcceptTOTPStep records the time step of an accepted one-time code. It reports false if the code of this
+//or a later step has already been accepted.
+func (db *DB) AcceptTOTPStep(uid uuid.UUID, step int64) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.enabledTOTP(uid)
+	if err != nil {
+		return false, err
+	}
+
+	if step <= t.LastStep {
+		return false, nil
+	}
+
+	t.LastStep = step
+	return true, db.persist()
+}
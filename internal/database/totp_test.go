@@ -0,0 +1,66 @@
+package database
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_ConsumeRecoveryCode(t *testing.T) {
+	db := New()
+	u := &User{Username: "user", Password: "pass"}
+	assert.Nil(t, db.NewUser(u))
+
+	_, err := db.ConsumeRecoveryCode(u.ID, "code")
+	assert.ErrorIs(t, err, ErrTOTPNotExist)
+
+	assert.Nil(t, db.SetTOTP(&TOTP{UserID: u.ID, Enabled: true, RecoveryCodes: []string{HashSecret("code"), HashSecret("other")}}))
+
+	var used int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := db.ConsumeRecoveryCode(u.ID, "code")
+			assert.Nil(t, err)
+			if ok {
+				atomic.AddInt32(&used, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), used, "Concurrent requests must not use a code twice")
+
+	stored, err := db.GetTOTP(u.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{HashSecret("other")}, stored.RecoveryCodes)
+
+	assert.Nil(t, db.DeleteTOTP(u.ID))
+	_, err = db.ConsumeRecoveryCode(u.ID, "other")
+	assert.ErrorIs(t, err, ErrTOTPNotExist, "A removed enrollment is not restored")
+	_, err = db.GetTOTP(u.ID)
+	assert.ErrorIs(t, err, ErrTOTPNotExist)
+}
+
+func TestDB_AcceptTOTPStep(t *testing.T) {
+	db := New()
+	u := &User{Username: "user", Password: "pass"}
+	assert.Nil(t, db.NewUser(u))
+	assert.Nil(t, db.SetTOTP(&TOTP{UserID: u.ID, Enabled: true}))
+
+	ok, err := db.AcceptTOTPStep(u.ID, 10)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	for _, step := range []int64{10, 9} {
+		ok, err = db.AcceptTOTPStep(u.ID, step)
+		assert.Nil(t, err)
+		assert.False(t, ok, "Codes of the accepted and earlier steps are rejected")
+	}
+
+	ok, _ = db.AcceptTOTPStep(u.ID, 11)
+	assert.True(t, ok)
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+//EmailVerification is a token confirming that the user owns the email. Only the token hash is stored.
+type EmailVerification struct {
+	TokenHash string
+	UserID    uuid.UUID
+	Email     string
+	ExpiresAt time.Time
+}
+
+//NewEmailVerification saves a verification token.
+func (db *DB) NewEmailVerification(v *EmailVerification) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.user(v.UserID); !ok {
+		return ErrUserNotExist
+	}
+
+	db.verifications[v.TokenHash] = v
+	return nil
+}
+
+//VerifyEmail consumes the verification token and marks the email of the user as verified.
+//The token is rejected if the user has changed the email since it was issued.
+func (db *DB) VerifyEmail(token string) (*User, error) {
+	hash := HashSecret(token)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	v, ok := db.verifications[hash]
+	if !ok {
+		return nil, ErrVerificationNotExist
+	}
+	//токен другого тенанта не расходуется
+	if _, ok := db.user(v.UserID); !ok {
+		return nil, ErrVerificationNotExist
+	}
+
+	delete(db.verifications, hash)
+
+	if time.Now().After(v.ExpiresAt) {
+		return nil, ErrVerificationNotExist
+	}
+
+	u, ok := db.user(v.UserID)
+	if !ok || u.Email != v.Email {
+		return nil, ErrVerificationNotExist
+	}
+
+	verified := *u
+	verified.EmailVerified = true
+	db.store[u.ID] = &verified
+	db.emit(EventUserUpdated, &verified)
+
+	return &verified, db.persist()
+}
@@ -0,0 +1,305 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+//maxDeliveredPerWebhook limits the history of successful deliveries of a webhook,
+//pending and failed deliveries are always kept.
+const maxDeliveredPerWebhook int = 100
+
+var ErrWebhookNotExist error = errors.New("webhook does not exist")
+var ErrDeliveryNotExist error = errors.New("delivery does not exist")
+
+//Webhook is a subscription of an external URL to user events. An empty list of events means all events.
+//A webhook receives only the events of the users of its tenant.
+type Webhook struct {
+	ID        uuid.UUID   `json:"id"`
+	TenantID  uuid.UUID   `json:"tenant_id,omitzero"`
+	URL       string      `json:"url"`
+	Events    []EventType `json:"events"`
+	Secret    string      `json:"-"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+//webhookRecord is the on-disk representation of Webhook, it keeps the secret.
+type webhookRecord struct {
+	Webhook
+	Secret string
+}
+
+//Accepts reports whether the webhook is subscribed to the event type.
+func (h *Webhook) Accepts(t EventType) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+
+	for _, e := range h.Events {
+		if e == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	//DeliveryFailed is the status of dead letters: deliveries that have run out of attempts.
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+//WebhookDelivery is an event sent to a webhook with the results of the attempts.
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	WebhookID      uuid.UUID       `json:"webhook_id"`
+	EventID        uuid.UUID       `json:"event_id"`
+	Event          EventType       `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         DeliveryStatus  `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+//NewWebhook saves a webhook of the tenant of the handle, generates its ID.
+func (db *DB) NewWebhook(h *Webhook) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	h.ID = uuid.New()
+	h.TenantID = db.tenant
+	c := *h
+	db.webhooks[h.ID] = &c
+
+	return db.persist()
+}
+
+//GetWebhooks returns copies of the webhooks of the tenant sorted by creation time.
+func (db *DB) GetWebhooks() []*Webhook {
+	return db.findWebhooks(func(h *Webhook) bool {
+		return h.TenantID == db.tenant
+	})
+}
+
+//GetAllWebhooks returns copies of the webhooks of all tenants sorted by creation time,
+//the dispatcher delivers the events of all of them.
+func (db *DB) GetAllWebhooks() []*Webhook {
+	return db.findWebhooks(func(*Webhook) bool {
+		return true
+	})
+}
+
+func (db *DB) findWebhooks(match func(*Webhook) bool) []*Webhook {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	hooks := make([]*Webhook, 0)
+	for _, h := range db.webhooks {
+		if match(h) {
+			c := *h
+			hooks = append(hooks, &c)
+		}
+	}
+
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].CreatedAt.Before(hooks[j].CreatedAt)
+	})
+
+	return hooks
+}
+
+//webhook finds a webhook of the tenant of the handle. The caller must hold the lock.
+func (db *DB) webhook(id uuid.UUID) (*Webhook, bool) {
+	h, ok := db.webhooks[id]
+	if !ok || h.TenantID != db.tenant {
+		return nil, false
+	}
+
+	return h, true
+}
+
+//GetWebhook finds a webhook of the tenant by ID, returns a copy.
+func (db *DB) GetWebhook(id uuid.UUID) (*Webhook, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	h, ok := db.webhook(id)
+	if !ok {
+		return nil, ErrWebhookNotExist
+	}
+
+	c := *h
+	return &c, nil
+}
+
+//UpdateWebhook replaces the URL, the events and the secret of a webhook of the tenant.
+func (db *DB) UpdateWebhook(h *Webhook) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	old, ok := db.webhook(h.ID)
+	if !ok {
+		return ErrWebhookNotExist
+	}
+
+	c := *h
+	c.TenantID = old.TenantID
+	db.webhooks[h.ID] = &c
+
+	return db.persist()
+}
+
+//DeleteWebhook deletes a webhook of the tenant with its deliveries.
+func (db *DB) DeleteWebhook(id uuid.UUID) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.webhook(id); !ok {
+		return ErrWebhookNotExist
+	}
+
+	db.deleteWebhook(id)
+	return db.persist()
+}
+
+//deleteWebhook removes the webhook and its deliveries. The caller must hold the lock.
+func (db *DB) deleteWebhook(id uuid.UUID) {
+	delete(db.webhooks, id)
+	for did, d := range db.deliveries {
+		if d.WebhookID == id {
+			delete(db.deliveries, did)
+		}
+	}
+}
+
+//NewWebhookDeliveries saves deliveries, generates their IDs. Deliveries of deleted webhooks are dropped.
+func (db *DB) NewWebhookDeliveries(ds []*WebhookDelivery) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, d := range ds {
+		if _, ok := db.webhooks[d.WebhookID]; !ok {
+			continue
+		}
+
+		d.ID = uuid.New()
+		c := *d
+		db.deliveries[d.ID] = &c
+	}
+
+	return db.persist()
+}
+
+//GetWebhookDelivery finds a delivery of a webhook of the tenant by ID, returns a copy.
+func (db *DB) GetWebhookDelivery(id uuid.UUID) (*WebhookDelivery, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	d, ok := db.deliveries[id]
+	if !ok {
+		return nil, ErrDeliveryNotExist
+	}
+	if _, ok := db.webhook(d.WebhookID); !ok {
+		return nil, ErrDeliveryNotExist
+	}
+
+	c := *d
+	return &c, nil
+}
+
+//GetWebhookDeliveries returns copies of the deliveries of a webhook of the tenant, the newest first.
+func (db *DB) GetWebhookDeliveries(webhookID uuid.UUID) []*WebhookDelivery {
+	return db.findDeliveries(func(d *WebhookDelivery) bool {
+		_, ok := db.webhook(d.WebhookID)
+		return ok && d.WebhookID == webhookID
+	})
+}
+
+//GetDeliveriesByStatus returns copies of the deliveries of the webhooks of the tenant with the status, the newest first.
+func (db *DB) GetDeliveriesByStatus(status DeliveryStatus) []*WebhookDelivery {
+	return db.findDeliveries(func(d *WebhookDelivery) bool {
+		_, ok := db.webhook(d.WebhookID)
+		return ok && d.Status == status
+	})
+}
+
+//GetAllDeliveriesByStatus returns copies of the deliveries of the webhooks of all tenants with the status,
+//the newest first.
+func (db *DB) GetAllDeliveriesByStatus(status DeliveryStatus) []*WebhookDelivery {
+	return db.findDeliveries(func(d *WebhookDelivery) bool {
+		return d.Status == status
+	})
+}
+
+//findDeliveries returns copies of the matching deliveries, match is called with the lock held.
+func (db *DB) findDeliveries(match func(*WebhookDelivery) bool) []*WebhookDelivery {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	ds := make([]*WebhookDelivery, 0)
+	for _, d := range db.deliveries {
+		if match(d) {
+			c := *d
+			ds = append(ds, &c)
+		}
+	}
+
+	sort.Slice(ds, func(i, j int) bool {
+		return ds[i].CreatedAt.After(ds[j].CreatedAt)
+	})
+
+	return ds
+}
+
+//UpdateWebhookDelivery saves the result of an attempt. Only the last successful deliveries
+//of the webhook are kept in the history.
+func (db *DB) UpdateWebhookDelivery(d *WebhookDelivery) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.deliveries[d.ID]; !ok {
+		return ErrDeliveryNotExist
+	}
+
+	c := *d
+	db.deliveries[d.ID] = &c
+
+	if d.Status == DeliveryDelivered {
+		db.trimDeliveries(d.WebhookID)
+	}
+
+	return db.persist()
+}
+
+//trimDeliveries removes the oldest successful deliveries of the webhook over the limit. The caller must hold the lock.
+func (db *DB) trimDeliveries(webhookID uuid.UUID) {
+	delivered := make([]*WebhookDelivery, 0)
+	for _, d := range db.deliveries {
+		if d.WebhookID == webhookID && d.Status == DeliveryDelivered {
+			delivered = append(delivered, d)
+		}
+	}
+
+	if len(delivered) <= maxDeliveredPerWebhook {
+		return
+	}
+
+	sort.Slice(delivered, func(i, j int) bool {
+		return delivered[i].CreatedAt.Before(delivered[j].CreatedAt)
+	})
+	for _, d := range delivered[:len(delivered)-maxDeliveredPerWebhook] {
+		delete(db.deliveries, d.ID)
+	}
+}
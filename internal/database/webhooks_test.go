@@ -0,0 +1,124 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_AddListener_Events(t *testing.T) {
+	db := New()
+
+	var events []EventType
+	db.AddListener(func(e Event) {
+		events = append(events, e.Type)
+		assert.NotEqual(t, uuid.Nil, e.User.ID)
+	})
+
+	u := &User{Username: "user", Email: "u@mai.l", Password: "pass"}
+	assert.Nil(t, db.NewUser(u))
+	assert.Nil(t, db.UpdateUser(&User{ID: u.ID, Email: "new@mai.l"}))
+	_, err := db.SetUserPending(u.ID, true)
+	assert.Nil(t, err)
+	_, err = db.SetUserPending(u.ID, true)
+	assert.Nil(t, err)
+	_, err = db.ApproveUser(u.ID)
+	assert.Nil(t, err)
+
+	errs := db.ApplyBatch([]BatchOp{
+		{Kind: BatchCreate, User: User{Username: "batch", Password: "hash"}},
+		{Kind: BatchCreate, User: User{Username: "user", Password: "hash"}},
+	}, true)
+	assert.ErrorIs(t, errs[1], ErrNameAlreadyExist)
+
+	errs = db.ApplyBatch([]BatchOp{
+		{Kind: BatchCreate, User: User{Username: "batch", Password: "hash"}},
+	}, true)
+	assert.Nil(t, errs[0])
+
+	assert.Nil(t, db.DeleteUser(u.ID))
+
+	assert.Equal(t, []EventType{
+		EventUserCreated, EventUserUpdated, EventUserDisabled, EventUserEnabled, EventUserCreated, EventUserDeleted,
+	}, events, "Rolled back batches and unchanged states do not produce events")
+}
+
+func TestDB_Webhooks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	db, err := Open(path)
+	assert.Nil(t, err)
+
+	h := &Webhook{URL: "http://example.com", Events: []EventType{EventUserDeleted}, Secret: "secret", CreatedAt: time.Now()}
+	assert.Nil(t, db.NewWebhook(h))
+	assert.True(t, h.Accepts(EventUserDeleted))
+	assert.False(t, h.Accepts(EventUserCreated))
+
+	start := time.Now()
+	ds := make([]*WebhookDelivery, 0)
+	for i := 0; i < maxDeliveredPerWebhook+2; i++ {
+		ds = append(ds, &WebhookDelivery{WebhookID: h.ID, Status: DeliveryPending, CreatedAt: start.Add(time.Duration(i) * time.Second)})
+	}
+	ds = append(ds, &WebhookDelivery{WebhookID: uuid.New(), Status: DeliveryPending})
+	assert.Nil(t, db.NewWebhookDeliveries(ds))
+	assert.Equal(t, maxDeliveredPerWebhook+2, len(db.GetWebhookDeliveries(h.ID)), "Deliveries of unknown webhooks are dropped")
+
+	ds[1].Status = DeliveryFailed
+	assert.Nil(t, db.UpdateWebhookDelivery(ds[1]))
+	for _, d := range ds[2 : len(ds)-1] {
+		d.Status = DeliveryDelivered
+		assert.Nil(t, db.UpdateWebhookDelivery(d))
+	}
+
+	got := db.GetWebhookDeliveries(h.ID)
+	assert.Equal(t, maxDeliveredPerWebhook+2, len(got))
+	assert.Equal(t, ds[len(ds)-2].ID, got[0].ID, "The newest delivery is the first")
+
+	ds[0].Status = DeliveryDelivered
+	assert.Nil(t, db.UpdateWebhookDelivery(ds[0]))
+	assert.Equal(t, maxDeliveredPerWebhook+1, len(db.GetWebhookDeliveries(h.ID)), "The oldest delivered is removed")
+	assert.Equal(t, 1, len(db.GetDeliveriesByStatus(DeliveryFailed)), "Failed deliveries are kept")
+
+	reopened, err := Open(path)
+	assert.Nil(t, err)
+	got2, err := reopened.GetWebhook(h.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", got2.Secret)
+	assert.Equal(t, maxDeliveredPerWebhook+1, len(reopened.GetWebhookDeliveries(h.ID)))
+
+	assert.Nil(t, db.DeleteWebhook(h.ID))
+	assert.Empty(t, db.GetDeliveriesByStatus(DeliveryFailed))
+	_, err = db.GetWebhook(h.ID)
+	assert.ErrorIs(t, err, ErrWebhookNotExist)
+}
+
+func TestDB_Webhooks_Tenants(t *testing.T) {
+	db := New()
+	other := db.WithTenant(uuid.New())
+
+	h := &Webhook{URL: "http://example.com", Secret: "secret"}
+	assert.Nil(t, other.NewWebhook(h))
+	assert.Nil(t, db.NewWebhook(&Webhook{URL: "http://example.org"}))
+	assert.Nil(t, other.NewWebhookDeliveries([]*WebhookDelivery{{WebhookID: h.ID, Status: DeliveryFailed}}))
+
+	assert.Equal(t, 1, len(db.GetWebhooks()), "Webhooks of other tenants are not listed")
+	assert.Equal(t, 2, len(db.GetAllWebhooks()))
+	_, err := db.GetWebhook(h.ID)
+	assert.ErrorIs(t, err, ErrWebhookNotExist)
+	assert.ErrorIs(t, db.UpdateWebhook(&Webhook{ID: h.ID, URL: "http://evil.com"}), ErrWebhookNotExist)
+	assert.ErrorIs(t, db.DeleteWebhook(h.ID), ErrWebhookNotExist)
+	assert.Empty(t, db.GetWebhookDeliveries(h.ID))
+	assert.Empty(t, db.GetDeliveriesByStatus(DeliveryFailed))
+	assert.Equal(t, 1, len(db.GetAllDeliveriesByStatus(DeliveryFailed)))
+
+	got, err := other.GetWebhook(h.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "http://example.com", got.URL)
+	ds := other.GetDeliveriesByStatus(DeliveryFailed)
+	assert.Equal(t, 1, len(ds))
+	_, err = db.GetWebhookDelivery(ds[0].ID)
+	assert.ErrorIs(t, err, ErrDeliveryNotExist)
+	assert.Nil(t, other.DeleteWebhook(h.ID))
+}
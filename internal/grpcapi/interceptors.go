@@ -0,0 +1,156 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/base64"
+	"expvar"
+	"strings"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/api"
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/MarySmirnova/api_users/userspb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type contextKey string
+
+const contextUserKey contextKey = "user"
+
+//readMethods do not change data, API keys with the read scope can call them.
+var readMethods = map[string]bool{
+	userspb.UserService_ListUsers_FullMethodName: true,
+	userspb.UserService_GetUser_FullMethodName:   true,
+}
+
+var (
+	metrics      = expvar.NewMap("grpc")
+	requestCount = new(expvar.Map).Init()
+	requestTime  = new(expvar.Map).Init()
+)
+
+func init() {
+	metrics.Set("requests", requestCount)
+	metrics.Set("duration_microseconds", requestTime)
+}
+
+//AuthInterceptor authenticates the call by the metadata and puts the user to the context.
+func (s *Server) AuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	c := credentials(ctx)
+	if name := metadataValue(ctx, strings.ToLower(api.HeaderTenant)); name != "" {
+		t, err := s.store.GetTenantByName(name)
+		if err != nil {
+			return nil, statusError(err)
+		}
+		c.Tenant = t.ID
+	}
+
+	user, err := s.auth.Authenticate(c, !readMethods[info.FullMethod], false)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return handler(context.WithValue(ctx, contextUserKey, user), req)
+}
+
+//LoggingInterceptor logs every call with its status and duration.
+func (s *Server) LoggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	entry := log.WithFields(log.Fields{
+		"method":   info.FullMethod,
+		"code":     status.Code(err).String(),
+		"duration": time.Since(start),
+	})
+	if err != nil {
+		entry.WithError(err).Error("grpc call failed")
+	} else {
+		entry.Debug("grpc call")
+	}
+
+	return resp, err
+}
+
+//MetricsInterceptor counts calls by method and status and sums their duration, the values are published by expvar.
+func (s *Server) MetricsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	requestCount.Add(info.FullMethod+" "+status.Code(err).String(), 1)
+	requestTime.Add(info.FullMethod, time.Since(start).Microseconds())
+
+	return resp, err
+}
+
+//credentials reads the credentials from the metadata in the same form as the REST headers.
+func credentials(ctx context.Context) api.Credentials {
+	var c api.Credentials
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return c
+	}
+
+	get := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+
+	if key := get(strings.ToLower(api.HeaderAPIKey)); key != "" {
+		c.APIKey = key
+		return c
+	}
+
+	auth := get("authorization")
+	scheme, value, _ := strings.Cut(auth, " ")
+	value = strings.TrimSpace(value)
+
+	switch strings.ToLower(scheme) {
+	case "apikey":
+		c.APIKey = value
+	case "bearer":
+		c.Token = value
+	case "basic":
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err == nil {
+			c.Username, c.Password, _ = strings.Cut(string(decoded), ":")
+		}
+		c.OTPCode = get(strings.ToLower(api.HeaderOTPCode))
+	}
+
+	return c
+}
+
+func currentUser(ctx context.Context) *database.User {
+	u, _ := ctx.Value(contextUserKey).(*database.User)
+	return u
+}
+
+//storeFor returns the storage of the tenant of the current user that records the user as the actor of the changes.
+func (s *Server) storeFor(ctx context.Context) api.Storage {
+	u := currentUser(ctx)
+	if u == nil {
+		return s.store
+	}
+
+	return s.store.WithTenant(u.TenantID).WithActor(u.ID.String())
+}
+
+func metadataValue(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
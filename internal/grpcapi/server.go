@@ -0,0 +1,76 @@
+package grpcapi
+
+import (
+	"errors"
+
+	"github.com/MarySmirnova/api_users/internal/api"
+	"github.com/MarySmirnova/api_users/internal/config"
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/MarySmirnova/api_users/userspb"
+	"github.com/go-playground/validator"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var validate = validator.New()
+
+//Authenticator checks credentials and access policies, *api.API implements it.
+type Authenticator interface {
+	Authenticate(c api.Credentials, write, setup bool) (*database.User, error)
+}
+
+//Server is the gRPC API. It uses the same storage and access rules as the REST API.
+type Server struct {
+	userspb.UnimplementedUserServiceServer
+
+	listen     string
+	store      api.Storage
+	auth       Authenticator
+	grpcServer *grpc.Server
+}
+
+func New(cfg config.GRPC, s api.Storage, auth Authenticator) *Server {
+	srv := &Server{
+		listen: cfg.GRPCListen,
+		store:  s,
+		auth:   auth,
+	}
+
+	srv.grpcServer = grpc.NewServer(grpc.ChainUnaryInterceptor(
+		srv.LoggingInterceptor,
+		srv.MetricsInterceptor,
+		srv.AuthInterceptor,
+	))
+	userspb.RegisterUserServiceServer(srv.grpcServer, srv)
+
+	return srv
+}
+
+func (s *Server) GetGRPCServer() *grpc.Server {
+	return s.grpcServer
+}
+
+func (s *Server) Listen() string {
+	return s.listen
+}
+
+//statusError converts errors of the storage and the authentication to gRPC statuses.
+func statusError(err error) error {
+	switch {
+	case errors.Is(err, database.ErrUserNotExist), errors.Is(err, database.ErrTenantNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, database.ErrNameAlreadyExist), errors.Is(err, database.ErrAttributeNotUnique):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, database.ErrAttributeNotExist), errors.Is(err, database.ErrAttributeInvalid),
+		errors.Is(err, database.ErrAttributeRequired):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, api.ErrUnauthorized), errors.Is(err, api.ErrOTPRequired), errors.Is(err, api.ErrOTPInvalid):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, api.ErrPermissionsDenied), errors.Is(err, api.ErrAccountPending), errors.Is(err, api.ErrEmailNotVerified),
+		errors.Is(err, api.ErrTwoFactorRequired), errors.Is(err, api.ErrScopeDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	return status.Error(codes.Internal, "something went wrong")
+}
@@ -0,0 +1,165 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/api"
+	"github.com/MarySmirnova/api_users/internal/config"
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/MarySmirnova/api_users/userspb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	adminUname string = "IsAdmin"
+	adminPass  string = "IsAdmin"
+
+	notAdminUname string = "IsNotAdmin"
+	notAdminPass  string = "IsNotAdmin"
+)
+
+func testBootstrap(t *testing.T) (userspb.UserServiceClient, *database.DB) {
+	db := database.New()
+	assert.Nil(t, db.NewUser(&database.User{Username: adminUname, Password: adminPass, Admin: true}))
+	assert.Nil(t, db.NewUser(&database.User{Username: notAdminUname, Password: notAdminPass}))
+
+	store := api.NewStorage(db)
+	rest := api.New(config.API{Auth: config.Auth{SessionTTL: time.Hour}}, store)
+	srv := New(config.GRPC{}, store, rest)
+
+	lis := bufconn.Listen(1024 * 1024)
+	go func() { _ = srv.GetGRPCServer().Serve(lis) }()
+	t.Cleanup(srv.GetGRPCServer().Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return userspb.NewUserServiceClient(conn), db
+}
+
+func basicAuth(username, password string) context.Context {
+	creds := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+creds)
+}
+
+func TestServer_Unauthenticated(t *testing.T) {
+	client, _ := testBootstrap(t)
+
+	_, err := client.ListUsers(context.Background(), &userspb.ListUsersRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.ListUsers(basicAuth(adminUname, "wrong"), &userspb.ListUsersRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestServer_PermissionDenied(t *testing.T) {
+	client, _ := testBootstrap(t)
+
+	_, err := client.CreateUser(basicAuth(notAdminUname, notAdminPass), &userspb.CreateUserRequest{
+		Email:    "new@example.com",
+		Username: "new",
+		Password: "new",
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestServer_CRUD(t *testing.T) {
+	client, db := testBootstrap(t)
+	ctx := basicAuth(adminUname, adminPass)
+
+	_, err := client.CreateUser(ctx, &userspb.CreateUserRequest{Email: "bad", Username: "new", Password: "new"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	created, err := client.CreateUser(ctx, &userspb.CreateUserRequest{
+		Email:    "new@example.com",
+		Username: "new",
+		Password: "new",
+	})
+	assert.Nil(t, err)
+
+	_, err = client.CreateUser(ctx, &userspb.CreateUserRequest{Email: "new@example.com", Username: "new", Password: "new"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	list, err := client.ListUsers(basicAuth(notAdminUname, notAdminPass), &userspb.ListUsersRequest{Limit: 1, Offset: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), list.Total)
+	assert.Equal(t, 1, len(list.Users))
+	assert.Equal(t, notAdminUname, list.Users[0].Username)
+
+	name := "renamed"
+	admin := true
+	updated, err := client.UpdateUser(ctx, &userspb.UpdateUserRequest{Id: created.Id, Username: &name, Admin: &admin})
+	assert.Nil(t, err)
+	assert.Equal(t, "renamed", updated.Username)
+	assert.Equal(t, "new@example.com", updated.Email)
+	assert.True(t, updated.Admin)
+
+	u, err := db.GetUserByName("renamed")
+	assert.Nil(t, err)
+	assert.True(t, u.CheckPassword("new"))
+
+	got, err := client.GetUser(ctx, &userspb.GetUserRequest{Id: created.Id})
+	assert.Nil(t, err)
+	assert.Equal(t, "renamed", got.Username)
+
+	_, err = client.DeleteUser(ctx, &userspb.DeleteUserRequest{Id: created.Id})
+	assert.Nil(t, err)
+
+	_, err = client.GetUser(ctx, &userspb.GetUserRequest{Id: created.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.GetUser(ctx, &userspb.GetUserRequest{Id: "not-uuid"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_Metrics(t *testing.T) {
+	client, _ := testBootstrap(t)
+
+	_, err := client.GetUser(context.Background(), &userspb.GetUserRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	v := requestCount.Get(userspb.UserService_GetUser_FullMethodName + " " + codes.Unauthenticated.String())
+	assert.NotNil(t, v)
+}
+
+func TestServer_Attributes(t *testing.T) {
+	client, db := testBootstrap(t)
+	ctx := basicAuth(adminUname, adminPass)
+	assert.Nil(t, db.NewAttribute(&database.AttributeDefinition{Name: "department", Type: database.AttributeString, Required: true}))
+
+	_, err := client.CreateUser(ctx, &userspb.CreateUserRequest{Email: "new@example.com", Username: "new", Password: "new"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "The required attribute must be set")
+
+	attrs, _ := structpb.NewStruct(map[string]interface{}{"department": "sales"})
+	created, err := client.CreateUser(ctx, &userspb.CreateUserRequest{Email: "new@example.com", Username: "new", Password: "new", Attributes: attrs})
+	assert.Nil(t, err)
+
+	got, err := client.GetUser(ctx, &userspb.GetUserRequest{Id: created.Id})
+	assert.Nil(t, err)
+	assert.Equal(t, "sales", got.GetAttributes().AsMap()["department"])
+
+	attrs, _ = structpb.NewStruct(map[string]interface{}{"department": "dev"})
+	updated, err := client.UpdateUser(ctx, &userspb.UpdateUserRequest{Id: created.Id, Attributes: attrs})
+	assert.Nil(t, err)
+	assert.Equal(t, "dev", updated.GetAttributes().AsMap()["department"])
+
+	name := "renamed"
+	updated, err = client.UpdateUser(ctx, &userspb.UpdateUserRequest{Id: created.Id, Username: &name})
+	assert.Nil(t, err, "Attributes not passed to the update are kept")
+	assert.Equal(t, "dev", updated.GetAttributes().AsMap()["department"])
+}
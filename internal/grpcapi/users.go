@@ -0,0 +1,182 @@
+package grpcapi
+
+import (
+	"context"
+	"sort"
+
+	"github.com/MarySmirnova/api_users/internal/api"
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/MarySmirnova/api_users/userspb"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func (s *Server) CreateUser(ctx context.Context, req *userspb.CreateUserRequest) (*userspb.CreateUserResponse, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	u := database.User{
+		Email:      req.GetEmail(),
+		Username:   req.GetUsername(),
+		Password:   req.GetPassword(),
+		Admin:      req.GetAdmin(),
+		Attributes: fromProtoAttributes(req.GetAttributes()),
+	}
+
+	if err := validate.Struct(u); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid data passed: %s", err)
+	}
+
+	if err := s.storeFor(ctx).NewUser(&u); err != nil {
+		return nil, statusError(err)
+	}
+
+	return &userspb.CreateUserResponse{Id: u.ID.String()}, nil
+}
+
+//ListUsers returns users sorted by name, with a positive limit returns one page.
+func (s *Server) ListUsers(ctx context.Context, req *userspb.ListUsersRequest) (*userspb.ListUsersResponse, error) {
+	if req.GetLimit() < 0 || req.GetOffset() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit and offset must not be negative")
+	}
+
+	users := s.storeFor(ctx).GetAllUsers()
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	resp := &userspb.ListUsersResponse{Total: int32(len(users))}
+
+	offset := int(req.GetOffset())
+	if offset > len(users) {
+		offset = len(users)
+	}
+	users = users[offset:]
+	if limit := int(req.GetLimit()); limit > 0 && limit < len(users) {
+		users = users[:limit]
+	}
+
+	for _, u := range users {
+		resp.Users = append(resp.Users, toProto(u))
+	}
+
+	return resp, nil
+}
+
+func (s *Server) GetUser(ctx context.Context, req *userspb.GetUserRequest) (*userspb.User, error) {
+	uid, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := s.storeFor(ctx).GetUserByID(uid)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return toProto(u), nil
+}
+
+//UpdateUser changes only the fields set in the request.
+func (s *Server) UpdateUser(ctx context.Context, req *userspb.UpdateUserRequest) (*userspb.User, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	uid, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	old, err := s.storeFor(ctx).GetUserByID(uid)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	if req.Email != nil {
+		if err := validate.Var(req.GetEmail(), "email"); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid data passed: %s", err)
+		}
+	}
+
+	u := database.User{
+		ID:         uid,
+		Email:      req.GetEmail(),
+		Username:   req.GetUsername(),
+		Password:   req.GetPassword(),
+		Admin:      old.Admin,
+		Attributes: fromProtoAttributes(req.GetAttributes()),
+	}
+	if req.Admin != nil {
+		u.Admin = req.GetAdmin()
+	}
+
+	if err := s.storeFor(ctx).UpdateUser(&u); err != nil {
+		return nil, statusError(err)
+	}
+
+	return toProto(&u), nil
+}
+
+func (s *Server) DeleteUser(ctx context.Context, req *userspb.DeleteUserRequest) (*userspb.DeleteUserResponse, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	uid, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.storeFor(ctx).DeleteUser(uid); err != nil {
+		return nil, statusError(err)
+	}
+
+	return &userspb.DeleteUserResponse{}, nil
+}
+
+func requireAdmin(ctx context.Context) error {
+	if u := currentUser(ctx); u == nil || !u.Admin {
+		return statusError(api.ErrPermissionsDenied)
+	}
+
+	return nil
+}
+
+func parseID(id string) (uuid.UUID, error) {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, status.Errorf(codes.InvalidArgument, "invalid parameter passed: %s", err)
+	}
+
+	return uid, nil
+}
+
+func fromProtoAttributes(s *structpb.Struct) map[string]interface{} {
+	if s == nil {
+		return nil
+	}
+
+	return s.AsMap()
+}
+
+func toProto(u *database.User) *userspb.User {
+	p := &userspb.User{
+		Id:            u.ID.String(),
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		Username:      u.Username,
+		Admin:         u.Admin,
+		Pending:       u.Pending,
+	}
+
+	if len(u.Attributes) > 0 {
+		//значения атрибутов - строки, числа и булевы, они всегда представимы в Struct
+		p.Attributes, _ = structpb.NewStruct(u.Attributes)
+	}
+
+	return p
+}
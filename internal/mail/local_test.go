@@ -0,0 +1,26 @@
+package mail
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileMailer_Send(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	m := NewFileMailer(path)
+
+	err := m.Send(Message{To: "a@b.c", Subject: "first", Body: "hello"})
+	assert.Nil(t, err)
+
+	err = m.Send(Message{To: "d@e.f", Subject: "second", Body: "world"})
+	assert.Nil(t, err)
+
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "To: a@b.c\r\n")
+	assert.Contains(t, string(data), "Subject: second\r\n")
+	assert.Contains(t, string(data), "\r\n\r\nworld\r\n")
+}
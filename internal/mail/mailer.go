@@ -0,0 +1,55 @@
+package mail
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MarySmirnova/api_users/internal/config"
+)
+
+const (
+	DriverLog  string = "log"
+	DriverFile string = "file"
+	DriverSMTP string = "smtp"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+//Mailer delivers messages to users.
+type Mailer interface {
+	Send(Message) error
+}
+
+//New creates a mailer for the driver set in the config.
+func New(cfg config.Mail) (Mailer, error) {
+	switch cfg.Driver {
+	case DriverLog, "":
+		return NewLogMailer(), nil
+	case DriverFile:
+		return NewFileMailer(cfg.FilePath), nil
+	case DriverSMTP:
+		return NewSMTPMailer(cfg), nil
+	}
+
+	return nil, fmt.Errorf("unknown mail driver: %s", cfg.Driver)
+}
+
+//format renders the message in the RFC 5322 format.
+func format(from string, m Message) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+
+	return []byte(b.String())
+}
@@ -0,0 +1,32 @@
+package mail
+
+import (
+	"net"
+	"net/smtp"
+
+	"github.com/MarySmirnova/api_users/internal/config"
+)
+
+type SMTPMailer struct {
+	cfg config.Mail
+}
+
+func NewSMTPMailer(cfg config.Mail) *SMTPMailer {
+	return &SMTPMailer{
+		cfg: cfg,
+	}
+}
+
+//Send delivers the message through the SMTP server. Authentication is used if the username is set.
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.cfg.SMTPUsername != "" {
+		host, _, err := net.SplitHostPort(m.cfg.SMTPAddr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.cfg.SMTPUsername, m.cfg.SMTPPassword, host)
+	}
+
+	return smtp.SendMail(m.cfg.SMTPAddr, auth, m.cfg.From, []string{msg.To}, format(m.cfg.From, msg))
+}
@@ -0,0 +1,148 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+//AlgRS256 is the only signing algorithm, OpenID Connect requires providers to support it.
+const AlgRS256 string = "RS256"
+
+var ErrInvalidToken error = errors.New("invalid token")
+var ErrTokenExpired error = errors.New("token has expired")
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+//JWK is the public part of a signing key, RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+//JWKS is the set of the public keys published to the clients.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func publicJWK(kid string, pub *rsa.PublicKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: AlgRS256,
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+func (k JWK) publicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+//sign encodes the claims as a JWT signed with RS256, RFC 7519.
+func sign(key *rsa.PrivateKey, kid string, claims interface{}) (string, error) {
+	h, err := json.Marshal(header{Alg: AlgRS256, Typ: "JWT", Kid: kid})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+//Verify checks the signature of the token with the key of the set it names and the expiration time,
+//returns the claims.
+func Verify(token string, set *JWKS) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var h header
+	if err := decodePart(parts[0], &h); err != nil || h.Alg != AlgRS256 {
+		return nil, ErrInvalidToken
+	}
+
+	var pub *rsa.PublicKey
+	for _, k := range set.Keys {
+		if k.Kid == h.Kid {
+			var err error
+			if pub, err = k.publicKey(); err != nil {
+				return nil, ErrInvalidToken
+			}
+		}
+	}
+	if pub == nil {
+		return nil, ErrInvalidToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodePart(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if exp, ok := claims["exp"].(float64); ok && time.Now().Unix() >= int64(exp) {
+		return claims, ErrTokenExpired
+	}
+
+	return claims, nil
+}
+
+func decodePart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+//AccessTokenHash returns the at_hash claim of an ID token issued with the access token:
+//the left half of its SHA-256 hash.
+func AccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
@@ -0,0 +1,148 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+)
+
+const keyBits int = 2048
+
+//KeyStore keeps the signing keys, database.DB implements it.
+type KeyStore interface {
+	NewSigningKey(*database.SigningKey) error
+	GetSigningKeys() []*database.SigningKey
+	DeleteSigningKey(string) error
+}
+
+//Keys signs the tokens and rotates the signing keys. The current key is replaced when it is older
+//than the rotation period, the retired keys stay published for the retention period,
+//so the tokens they have signed can still be verified.
+type Keys struct {
+	mu        sync.Mutex
+	store     KeyStore
+	rotation  time.Duration
+	retention time.Duration
+}
+
+//NewKeys creates the key manager. A zero rotation period turns the automatic rotation off.
+func NewKeys(s KeyStore, rotation, retention time.Duration) *Keys {
+	return &Keys{store: s, rotation: rotation, retention: retention}
+}
+
+//Sign signs the claims with the current key, the key is generated or rotated if needed.
+func (k *Keys) Sign(claims interface{}) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	current, err := k.current()
+	if err != nil {
+		return "", err
+	}
+
+	key, err := privateKey(current)
+	if err != nil {
+		return "", err
+	}
+
+	return sign(key, current.ID, claims)
+}
+
+//Rotate replaces the current key with a new one, e.g. when the current key may be compromised.
+func (k *Keys) Rotate() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	_, err := k.generate()
+	return err
+}
+
+//JWKS returns the public keys of the current and the retired keys that are still kept.
+func (k *Keys) JWKS() (*JWKS, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, err := k.current(); err != nil {
+		return nil, err
+	}
+
+	set := &JWKS{Keys: []JWK{}}
+	for _, sk := range k.store.GetSigningKeys() {
+		key, err := privateKey(sk)
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, publicJWK(sk.ID, &key.PublicKey))
+	}
+
+	return set, nil
+}
+
+//current returns the current key, generates a new one if there is none or it is too old and deletes
+//the retired keys after the retention period. The caller must hold the lock.
+func (k *Keys) current() (*database.SigningKey, error) {
+	now := time.Now()
+
+	var current *database.SigningKey
+	for _, sk := range k.store.GetSigningKeys() {
+		if sk.RetiredAt == nil {
+			current = sk
+			continue
+		}
+		if now.Sub(*sk.RetiredAt) >= k.retention {
+			if err := k.store.DeleteSigningKey(sk.ID); err != nil && !errors.Is(err, database.ErrSigningKeyNotExist) {
+				return nil, err
+			}
+		}
+	}
+
+	if current != nil && (k.rotation == 0 || now.Sub(current.CreatedAt) < k.rotation) {
+		return current, nil
+	}
+
+	return k.generate()
+}
+
+//generate saves a new current key. The caller must hold the lock.
+func (k *Keys) generate() (*database.SigningKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sk := &database.SigningKey{
+		ID:         uuid.NewString(),
+		PrivateKey: der,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := k.store.NewSigningKey(sk); err != nil {
+		return nil, err
+	}
+
+	return sk, nil
+}
+
+func privateKey(sk *database.SigningKey) (*rsa.PrivateKey, error) {
+	parsed, err := x509.ParsePKCS8PrivateKey(sk.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key is not an RSA key")
+	}
+
+	return key, nil
+}
@@ -0,0 +1,73 @@
+package oidc
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeys_SignAndRotate(t *testing.T) {
+	db := database.New()
+	keys := NewKeys(db, 0, time.Hour)
+
+	claims := map[string]interface{}{"sub": "user", "exp": time.Now().Add(time.Minute).Unix()}
+	token, err := keys.Sign(claims)
+	assert.Nil(t, err)
+
+	set, err := keys.JWKS()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(set.Keys))
+
+	verified, err := Verify(token, set)
+	assert.Nil(t, err)
+	assert.Equal(t, "user", verified["sub"])
+
+	_, err = Verify(token[:len(token)-4]+"AAAA", set)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	assert.Nil(t, keys.Rotate())
+	set, err = keys.JWKS()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(set.Keys), "The retired key stays published")
+	_, err = Verify(token, set)
+	assert.Nil(t, err, "Tokens signed by the retired key are still valid")
+
+	rotated, err := keys.Sign(claims)
+	assert.Nil(t, err)
+	assert.Equal(t, set.Keys[0].Kid, headerKid(t, rotated), "The new key signs")
+
+	expired, err := keys.Sign(map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()})
+	assert.Nil(t, err)
+	_, err = Verify(expired, set)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+}
+
+func TestKeys_Retention(t *testing.T) {
+	db := database.New()
+	keys := NewKeys(db, time.Nanosecond, 0)
+
+	first, err := keys.Sign(map[string]interface{}{})
+	assert.Nil(t, err)
+	second, err := keys.Sign(map[string]interface{}{})
+	assert.Nil(t, err)
+	assert.NotEqual(t, headerKid(t, first), headerKid(t, second), "Keys older than the rotation period are replaced")
+
+	set, err := keys.JWKS()
+	assert.Nil(t, err)
+	_, err = Verify(first, set)
+	assert.ErrorIs(t, err, ErrInvalidToken, "Retired keys are deleted after the retention period")
+}
+
+func TestAccessTokenHash(t *testing.T) {
+	//пример из OpenID Connect Core 1.0, приложение A.3
+	assert.Equal(t, "77QmUPtjPfzWtF2AnpK9RQ", AccessTokenHash("jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y"))
+}
+
+func headerKid(t *testing.T, token string) string {
+	var h header
+	assert.Nil(t, decodePart(strings.Split(token, ".")[0], &h))
+	return h.Kid
+}
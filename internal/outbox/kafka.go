@@ -0,0 +1,44 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+//KafkaPublisher publishes messages to a Kafka topic. The user ID is the message key, so the messages
+//of a user go to one partition and keep their order. A message is published when all in-sync
+//replicas have it.
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaPublisher(brokers []string, topic string) *KafkaPublisher {
+	return &KafkaPublisher{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			//сообщения отправляются по одному, ждать наполнения пачки незачем
+			BatchTimeout: 10 * time.Millisecond,
+		},
+	}
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, m Message) error {
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(m.Key),
+		Value: m.Data,
+		Headers: []kafka.Header{
+			{Key: "event-id", Value: []byte(m.ID)},
+			{Key: "event-type", Value: []byte(m.Type)},
+		},
+		Time: m.Time,
+	})
+}
+
+func (p *KafkaPublisher) Close() error {
+	return p.writer.Close()
+}
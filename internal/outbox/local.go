@@ -0,0 +1,91 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+//MemoryPublisher keeps messages in memory, it is a stand-in for a broker in tests.
+//If Fail is set, it is called before every message and its error fails the publishing.
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	messages []Message
+	Fail     func(Message) error
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(_ context.Context, m Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Fail != nil {
+		if err := p.Fail(m); err != nil {
+			return err
+		}
+	}
+
+	p.messages = append(p.messages, m)
+	return nil
+}
+
+//Messages returns the published messages in order.
+func (p *MemoryPublisher) Messages() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Message(nil), p.messages...)
+}
+
+func (p *MemoryPublisher) Close() error {
+	return nil
+}
+
+//FilePublisher appends messages to a file as JSON lines, it is a stand-in for a broker
+//in local development and tests.
+type FilePublisher struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFilePublisher(path string) *FilePublisher {
+	return &FilePublisher{
+		path: path,
+	}
+}
+
+func (p *FilePublisher) Publish(_ context.Context, m Message) error {
+	line, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f, err := os.OpenFile(p.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	//сообщение считается опубликованным, только когда оно на диске
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func (p *FilePublisher) Close() error {
+	return nil
+}
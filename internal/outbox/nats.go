@@ -0,0 +1,49 @@
+package outbox
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+//NATSPublisher publishes messages to NATS JetStream on the subjects "<subject>.<event type>",
+//e.g. "users.user.created". A stream must capture these subjects, JetStream acknowledges the
+//messages and drops duplicates by the Nats-Msg-Id header within its duplicate window.
+type NATSPublisher struct {
+	conn    *nats.Conn
+	js      jetstream.JetStream
+	subject string
+}
+
+func NewNATSPublisher(url, subject string) (*NATSPublisher, error) {
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &NATSPublisher{
+		conn:    conn,
+		js:      js,
+		subject: subject,
+	}, nil
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, m Message) error {
+	msg := nats.NewMsg(p.subject + "." + string(m.Type))
+	msg.Data = m.Data
+	msg.Header.Set("User-ID", m.Key)
+
+	_, err := p.js.PublishMsg(ctx, msg, jetstream.WithMsgID(m.ID))
+	return err
+}
+
+func (p *NATSPublisher) Close() error {
+	return p.conn.Drain()
+}
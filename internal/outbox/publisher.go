@@ -0,0 +1,74 @@
+//Package outbox publishes user events from the storage outbox to a message broker.
+//
+//The storage writes an event to the outbox together with the change, the relay publishes the
+//messages and deletes them only after the broker has accepted them. So every event is published
+//at least once, consumers must drop duplicates by the message ID. Messages of a user are published
+//in the order of the changes: if one fails, the later messages of the same user wait for it until
+//it is published or becomes a dead letter after the last attempt.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/config"
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/MarySmirnova/api_users/internal/webhook"
+)
+
+const (
+	PublisherNATS  string = "nats"
+	PublisherKafka string = "kafka"
+	PublisherFile  string = "file"
+)
+
+//Message is an event prepared for the broker. Key is the user ID, brokers use it to keep
+//the messages of a user in order. Data is the same JSON payload as webhook deliveries have.
+type Message struct {
+	ID   string             `json:"id"`
+	Type database.EventType `json:"type"`
+	Key  string             `json:"key"`
+	Data json.RawMessage    `json:"data"`
+	Time time.Time          `json:"time"`
+}
+
+//Publisher sends messages to a message broker. Publish must return only after the broker
+//has accepted the message.
+type Publisher interface {
+	Publish(ctx context.Context, m Message) error
+	Close() error
+}
+
+//NewPublisher creates the publisher set in the config. An empty name means the outbox is disabled,
+//nil is returned then.
+func NewPublisher(cfg config.Outbox) (Publisher, error) {
+	switch cfg.OutboxPublisher {
+	case "":
+		return nil, nil
+	case PublisherNATS:
+		return NewNATSPublisher(cfg.OutboxNATSURL, cfg.OutboxNATSSubject)
+	case PublisherKafka:
+		return NewKafkaPublisher(cfg.OutboxKafkaBrokers, cfg.OutboxKafkaTopic), nil
+	case PublisherFile:
+		return NewFilePublisher(cfg.OutboxFile), nil
+	}
+
+	return nil, fmt.Errorf("unknown outbox publisher: %s", cfg.OutboxPublisher)
+}
+
+func newMessage(e database.Event) (Message, error) {
+	data, err := json.Marshal(webhook.NewPayload(e))
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		ID:   e.ID.String(),
+		Type: e.Type,
+		Key:  e.User.ID.String(),
+		Data: data,
+		Time: e.Time,
+	}, nil
+}
@@ -0,0 +1,150 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/config"
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type Storage interface {
+	EnableOutbox()
+	AddListener(database.Listener)
+	GetDueOutbox(int, time.Time) []*database.OutboxMessage
+	DeleteOutbox(...uint64) error
+	FailOutbox(uint64, string, *time.Time) error
+}
+
+//Relay moves messages from the storage outbox to the publisher.
+type Relay struct {
+	cfg   config.Outbox
+	store Storage
+	pub   Publisher
+	wake  chan struct{}
+}
+
+//NewRelay enables the outbox of the storage and wakes up on its changes.
+func NewRelay(cfg config.Outbox, s Storage, p Publisher) *Relay {
+	r := &Relay{
+		cfg:   cfg,
+		store: s,
+		pub:   p,
+		wake:  make(chan struct{}, 1),
+	}
+
+	s.EnableOutbox()
+	s.AddListener(func(database.Event) {
+		select {
+		case r.wake <- struct{}{}:
+		default:
+		}
+	})
+
+	return r
+}
+
+//Run publishes the outbox until the context is canceled, then closes the publisher.
+//Messages left after a failure are retried every poll interval.
+func (r *Relay) Run(ctx context.Context) {
+	defer r.pub.Close()
+
+	interval := r.cfg.OutboxPollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for r.publishBatch(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+//publishBatch publishes the oldest due messages and deletes the published ones. After a failure
+//the later messages of the same user are left for the next try to keep the order. A failed message is
+//retried with an exponential backoff, while it waits the storage returns the messages of the other users
+//past it. After the last attempt it becomes a dead letter and no longer holds back the messages behind it.
+//Returns true if the whole batch is published and more messages may be waiting.
+func (r *Relay) publishBatch(ctx context.Context) bool {
+	msgs := r.store.GetDueOutbox(r.cfg.OutboxBatchSize, time.Now())
+	if len(msgs) == 0 {
+		return false
+	}
+
+	blocked := make(map[uuid.UUID]bool)
+	published := make([]uint64, 0, len(msgs))
+
+	for _, m := range msgs {
+		uid := m.Event.User.ID
+		if blocked[uid] {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		msg, err := newMessage(m.Event)
+		if err == nil {
+			err = r.pub.Publish(ctx, msg)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				r.fail(m, err)
+			}
+			blocked[uid] = true
+			continue
+		}
+
+		published = append(published, m.Seq)
+	}
+
+	if err := r.store.DeleteOutbox(published...); err != nil {
+		log.WithError(err).Error("unable to delete published outbox messages")
+		return false
+	}
+
+	return len(published) == len(msgs) && ctx.Err() == nil
+}
+
+//fail saves the failed attempt: schedules the next one or moves the message to the dead letters.
+func (r *Relay) fail(m *database.OutboxMessage, err error) {
+	logger := log.WithError(err).WithField("event_id", m.Event.ID)
+
+	var next *time.Time
+	if attempts := m.Attempts + 1; r.cfg.OutboxMaxAttempts <= 0 || attempts < r.cfg.OutboxMaxAttempts {
+		at := time.Now().Add(r.backoff(attempts))
+		next = &at
+		logger.Warn("unable to publish outbox message")
+	} else {
+		logger.Error("outbox message moved to dead letters")
+	}
+
+	if err := r.store.FailOutbox(m.Seq, err.Error(), next); err != nil && !errors.Is(err, database.ErrOutboxMessageNotExist) {
+		log.WithError(err).Error("unable to save failed outbox message")
+	}
+}
+
+//backoff returns the delay before the next attempt: the base delay doubled after every failed attempt.
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.cfg.OutboxBaseDelay << (attempts - 1)
+	if delay > r.cfg.OutboxMaxDelay || delay <= 0 {
+		delay = r.cfg.OutboxMaxDelay
+	}
+
+	return delay
+}
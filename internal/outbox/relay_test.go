@@ -0,0 +1,189 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/config"
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/MarySmirnova/api_users/internal/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelay_OrderPerUser(t *testing.T) {
+	db := database.New()
+	pub := NewMemoryPublisher()
+	r := NewRelay(config.Outbox{OutboxBatchSize: 100}, db, pub)
+
+	first := &database.User{Username: "first", Email: "f@mai.l", Password: "pass"}
+	second := &database.User{Username: "second", Email: "s@mai.l", Password: "pass"}
+	assert.Nil(t, db.NewUser(first))
+	assert.Nil(t, db.NewUser(second))
+	assert.Nil(t, db.UpdateUser(&database.User{ID: first.ID, Email: "new@mai.l"}))
+	assert.Nil(t, db.UpdateUser(&database.User{ID: second.ID, Email: "new2@mai.l"}))
+
+	failed := false
+	pub.Fail = func(m Message) error {
+		if m.Key == first.ID.String() && !failed {
+			failed = true
+			return errors.New("broker is unavailable")
+		}
+		return nil
+	}
+
+	assert.False(t, r.publishBatch(context.Background()))
+
+	msgs := pub.Messages()
+	if assert.Equal(t, 2, len(msgs), "Messages of other users are published") {
+		for _, m := range msgs {
+			assert.Equal(t, second.ID.String(), m.Key)
+		}
+		assert.Equal(t, database.EventUserCreated, msgs[0].Type)
+		assert.Equal(t, database.EventUserUpdated, msgs[1].Type)
+	}
+	assert.Equal(t, 2, len(db.GetOutbox(0)), "The failed message and the later one of the same user wait")
+
+	assert.True(t, r.publishBatch(context.Background()))
+	assert.False(t, r.publishBatch(context.Background()))
+	assert.Empty(t, db.GetOutbox(0))
+
+	msgs = pub.Messages()
+	if assert.Equal(t, 4, len(msgs)) {
+		assert.Equal(t, first.ID.String(), msgs[2].Key)
+		assert.Equal(t, database.EventUserCreated, msgs[2].Type)
+		assert.Equal(t, database.EventUserUpdated, msgs[3].Type)
+
+		var p webhook.Payload
+		assert.Nil(t, json.Unmarshal(msgs[3].Data, &p))
+		assert.Equal(t, "new@mai.l", p.Data.Email)
+		assert.Equal(t, p.ID.String(), msgs[3].ID)
+	}
+}
+
+func TestRelay_DeadLetter(t *testing.T) {
+	db := database.New()
+	pub := NewMemoryPublisher()
+	r := NewRelay(config.Outbox{OutboxBatchSize: 100, OutboxMaxAttempts: 3, OutboxBaseDelay: 50 * time.Millisecond, OutboxMaxDelay: 50 * time.Millisecond}, db, pub)
+
+	u := &database.User{Username: "user", Email: "u@mai.l", Password: "pass"}
+	assert.Nil(t, db.NewUser(u))
+	assert.Nil(t, db.UpdateUser(&database.User{ID: u.ID, Email: "new@mai.l"}))
+
+	pub.Fail = func(m Message) error {
+		if m.Type == database.EventUserCreated {
+			return errors.New("message too large")
+		}
+		return nil
+	}
+
+	assert.False(t, r.publishBatch(context.Background()))
+	msgs := db.GetOutbox(0)
+	if assert.Equal(t, 2, len(msgs)) {
+		assert.Equal(t, 1, msgs[0].Attempts)
+		assert.Equal(t, "message too large", msgs[0].LastError)
+		assert.NotNil(t, msgs[0].NextAttemptAt)
+	}
+
+	assert.False(t, r.publishBatch(context.Background()))
+	assert.Equal(t, 1, db.GetOutbox(0)[0].Attempts, "The message is not retried before the backoff delay")
+	assert.Empty(t, pub.Messages(), "The later message of the user waits")
+
+	assert.Eventually(t, func() bool {
+		r.publishBatch(context.Background())
+		return len(db.GetOutboxDeadLetters()) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	dead := db.GetOutboxDeadLetters()
+	if assert.Equal(t, 1, len(dead), "The message becomes a dead letter after the last attempt") {
+		assert.Equal(t, database.EventUserCreated, dead[0].Event.Type)
+		assert.Equal(t, 3, dead[0].Attempts)
+		assert.NotNil(t, dead[0].FailedAt)
+	}
+
+	assert.True(t, r.publishBatch(context.Background()))
+	assert.Empty(t, db.GetOutbox(0))
+	published := pub.Messages()
+	if assert.Equal(t, 1, len(published), "The dead letter no longer holds back the later messages") {
+		assert.Equal(t, database.EventUserUpdated, published[0].Type)
+	}
+}
+
+func TestRelay_BackoffDoesNotBlockOtherUsers(t *testing.T) {
+	db := database.New()
+	pub := NewMemoryPublisher()
+	r := NewRelay(config.Outbox{OutboxBatchSize: 2, OutboxBaseDelay: time.Hour, OutboxMaxDelay: time.Hour}, db, pub)
+
+	failing := &database.User{Username: "failing", Email: "f@mai.l", Password: "pass"}
+	assert.Nil(t, db.NewUser(failing))
+	assert.Nil(t, db.UpdateUser(&database.User{ID: failing.ID, Email: "new@mai.l"}))
+	assert.Nil(t, db.UpdateUser(&database.User{ID: failing.ID, Email: "newer@mai.l"}))
+	other := &database.User{Username: "other", Email: "o@mai.l", Password: "pass"}
+	assert.Nil(t, db.NewUser(other))
+
+	pub.Fail = func(m Message) error {
+		if m.Key == failing.ID.String() {
+			return errors.New("message too large")
+		}
+		return nil
+	}
+
+	assert.False(t, r.publishBatch(context.Background()))
+	assert.Empty(t, pub.Messages(), "The batch is filled with the messages of the failing user")
+
+	assert.True(t, r.publishBatch(context.Background()))
+	msgs := pub.Messages()
+	if assert.Equal(t, 1, len(msgs), "The messages waiting for the backoff are skipped") {
+		assert.Equal(t, other.ID.String(), msgs[0].Key)
+	}
+	assert.Equal(t, 3, len(db.GetOutbox(0)))
+}
+
+func TestRelay_Run(t *testing.T) {
+	db := database.New()
+	path := filepath.Join(t.TempDir(), "outbox.ndjson")
+
+	pub, err := NewPublisher(config.Outbox{OutboxPublisher: PublisherFile, OutboxFile: path})
+	assert.Nil(t, err)
+	r := NewRelay(config.Outbox{OutboxPollInterval: time.Hour}, db, pub)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+
+	u := &database.User{Username: "user", Email: "u@mai.l", Password: "pass"}
+	assert.Nil(t, db.NewUser(u))
+	assert.Nil(t, db.DeleteUser(u.ID))
+
+	assert.Eventually(t, func() bool {
+		return len(db.GetOutbox(0)) == 0
+	}, 5*time.Second, 10*time.Millisecond, "The relay wakes up on changes")
+
+	cancel()
+	<-done
+
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	types := []database.EventType{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var m Message
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &m))
+		assert.Equal(t, u.ID.String(), m.Key)
+		types = append(types, m.Type)
+	}
+	assert.Equal(t, []database.EventType{database.EventUserCreated, database.EventUserDeleted}, types)
+
+	_, err = NewPublisher(config.Outbox{OutboxPublisher: "carrier-pigeon"})
+	assert.NotNil(t, err)
+}
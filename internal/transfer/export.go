@@ -0,0 +1,58 @@
+package transfer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+)
+
+//Export writes all users sorted by name, every user is encoded and written as soon as it is read.
+func Export(w io.Writer, format Format, s Storage) error {
+	users := s.GetAllUsers()
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	if format == FormatCSV {
+		return exportCSV(w, users)
+	}
+
+	enc := json.NewEncoder(w)
+	for _, u := range users {
+		if err := enc.Encode(newRecord(u)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func exportCSV(w io.Writer, users []*database.User) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		r := newRecord(u)
+		err := cw.Write([]string{
+			r.ID.String(),
+			r.Username,
+			r.Email,
+			strconv.FormatBool(r.EmailVerified),
+			r.PasswordHash,
+			strconv.FormatBool(r.Admin),
+			strconv.FormatBool(r.Pending),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,319 @@
+package transfer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/go-playground/validator"
+	"github.com/google/uuid"
+)
+
+type ConflictPolicy string
+
+const (
+	//ConflictSkip leaves existing users unchanged.
+	ConflictSkip ConflictPolicy = "skip"
+	//ConflictOverwrite replaces existing users, they keep their IDs.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	//ConflictFail cancels the whole import if any user exists.
+	ConflictFail ConflictPolicy = "fail"
+)
+
+const maxLineSize int = 1024 * 1024
+
+var ErrUnknownConflictPolicy error = errors.New("unknown conflict policy, use skip, overwrite or fail")
+var ErrConflict error = errors.New("import is canceled, some users already exist")
+
+var validate = validator.New()
+
+//ParseConflictPolicy checks the policy name, an empty name means skip.
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	switch ConflictPolicy(name) {
+	case "", ConflictSkip:
+		return ConflictSkip, nil
+	case ConflictOverwrite, ConflictFail:
+		return ConflictPolicy(name), nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrUnknownConflictPolicy, name)
+}
+
+type Options struct {
+	Format   Format
+	Conflict ConflictPolicy
+	//DryRun checks the file and reports what would be done without changing the storage.
+	DryRun bool
+}
+
+//RowIssue explains why a row of the file was not imported. Lines start from one.
+type RowIssue struct {
+	Line     int    `json:"line"`
+	Username string `json:"username,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+type Report struct {
+	DryRun      bool       `json:"dry_run"`
+	Total       int        `json:"total"`
+	Created     int        `json:"created"`
+	Overwritten int        `json:"overwritten"`
+	Skipped     []RowIssue `json:"skipped"`
+	Rejected    []RowIssue `json:"rejected"`
+}
+
+type row struct {
+	line   int
+	record Record
+	err    error
+}
+
+//Import reads users from the file and stores them. Invalid rows are rejected and reported, the rest are imported.
+//With the fail policy nothing is imported if any user exists and ErrConflict is returned with the report.
+//An error is returned without a report only if the file can not be read.
+func Import(r io.Reader, opts Options, s Storage) (*Report, error) {
+	var rows []row
+	var err error
+	if opts.Format == FormatCSV {
+		rows, err = readCSV(r)
+	} else {
+		rows, err = readNDJSON(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		DryRun:   opts.DryRun,
+		Total:    len(rows),
+		Skipped:  []RowIssue{},
+		Rejected: []RowIssue{},
+	}
+	reject := func(rw row, reason string) {
+		report.Rejected = append(report.Rejected, RowIssue{Line: rw.line, Username: rw.record.Username, Reason: reason})
+	}
+
+	ops := []database.BatchOp{}
+	opRows := []row{}
+	names := map[string]bool{}
+	ids := map[uuid.UUID]bool{}
+	conflict := false
+
+	for _, rw := range rows {
+		if rw.err != nil {
+			reject(rw, rw.err.Error())
+			continue
+		}
+		if err := validateRecord(rw.record); err != nil {
+			reject(rw, err.Error())
+			continue
+		}
+		if names[rw.record.Username] || (rw.record.ID != uuid.Nil && ids[rw.record.ID]) {
+			reject(rw, "duplicate user in the file")
+			continue
+		}
+		names[rw.record.Username] = true
+		ids[rw.record.ID] = true
+
+		existing, err := findExisting(rw.record, s)
+		if err != nil {
+			reject(rw, err.Error())
+			continue
+		}
+
+		op := database.BatchOp{Kind: database.BatchCreate, User: rw.record.user()}
+		if existing != nil {
+			switch opts.Conflict {
+			case ConflictOverwrite:
+				op.Kind = database.BatchReplace
+				op.User.ID = existing.ID
+				//в CSV нет атрибутов, они сохраняются
+				if op.User.Attributes == nil {
+					op.User.Attributes = existing.Attributes
+				}
+			case ConflictFail:
+				conflict = true
+				reject(rw, "user already exists")
+				continue
+			default:
+				report.Skipped = append(report.Skipped, RowIssue{Line: rw.line, Username: rw.record.Username, Reason: "user already exists"})
+				continue
+			}
+		}
+
+		ops = append(ops, op)
+		opRows = append(opRows, rw)
+	}
+
+	if conflict {
+		return report, ErrConflict
+	}
+
+	var errs []error
+	if opts.DryRun {
+		errs = make([]error, len(ops))
+	} else {
+		errs = s.ApplyBatch(ops, opts.Conflict == ConflictFail)
+	}
+
+	for i, err := range errs {
+		switch {
+		case err != nil:
+			reject(opRows[i], err.Error())
+		case ops[i].Kind == database.BatchReplace:
+			report.Overwritten++
+		default:
+			report.Created++
+		}
+	}
+
+	return report, nil
+}
+
+//findExisting returns the user with the ID or the name of the record, nil if there is no such user.
+func findExisting(r Record, s Storage) (*database.User, error) {
+	var byID, byName *database.User
+	if r.ID != uuid.Nil {
+		byID, _ = s.GetUserByID(r.ID)
+	}
+	byName, _ = s.GetUserByName(r.Username)
+
+	if byID != nil && byName != nil && byID.ID != byName.ID {
+		return nil, errors.New("id and username belong to different users")
+	}
+	if byID != nil {
+		return byID, nil
+	}
+
+	return byName, nil
+}
+
+func validateRecord(r Record) error {
+	if r.Username == "" {
+		return errors.New("username is empty")
+	}
+	if r.Email != "" {
+		if err := validate.Var(r.Email, "email"); err != nil {
+			return errors.New("email is invalid")
+		}
+	}
+	if err := database.ValidPasswordHash(r.PasswordHash); err != nil {
+		return fmt.Errorf("password_hash: %s", err)
+	}
+
+	return nil
+}
+
+func readNDJSON(r io.Reader) ([]row, error) {
+	rows := []row{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		rw := row{line: line}
+		if err := json.Unmarshal([]byte(text), &rw.record); err != nil {
+			rw.err = fmt.Errorf("invalid JSON: %s", err)
+		}
+		rows = append(rows, rw)
+	}
+
+	return rows, scanner.Err()
+}
+
+func readCSV(r io.Reader) ([]row, error) {
+	cr := csv.NewReader(r)
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CSV header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"username", "password_hash"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV column %q is missing", name)
+		}
+	}
+
+	rows := []row{}
+	for {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+
+		line, _ := cr.FieldPos(0)
+		if err != nil {
+			if !errors.Is(err, csv.ErrFieldCount) {
+				return nil, err
+			}
+			rows = append(rows, row{line: line, err: errors.New("wrong number of fields")})
+			continue
+		}
+
+		rw := row{line: line}
+		rw.record, rw.err = csvRecord(fields, columns)
+		rows = append(rows, rw)
+	}
+
+	return rows, nil
+}
+
+func csvRecord(fields []string, columns map[string]int) (Record, error) {
+	get := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return fields[i]
+		}
+		return ""
+	}
+	flag := func(name string) (bool, error) {
+		v := get(name)
+		if v == "" {
+			return false, nil
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, fmt.Errorf("%s is not a boolean", name)
+		}
+		return b, nil
+	}
+
+	r := Record{
+		Username:     get("username"),
+		Email:        get("email"),
+		PasswordHash: get("password_hash"),
+	}
+
+	var err error
+	if id := get("id"); id != "" {
+		if r.ID, err = uuid.Parse(id); err != nil {
+			return r, errors.New("id is not a UUID")
+		}
+	}
+	if r.EmailVerified, err = flag("email_verified"); err != nil {
+		return r, err
+	}
+	if r.Admin, err = flag("admin"); err != nil {
+		return r, err
+	}
+	if r.Pending, err = flag("pending"); err != nil {
+		return r, err
+	}
+
+	return r, nil
+}
@@ -0,0 +1,88 @@
+//Package transfer exports users to NDJSON or CSV files and imports them back, the files keep password hashes,
+//so users can be moved between environments.
+package transfer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+)
+
+type Format string
+
+const (
+	FormatNDJSON Format = "ndjson"
+	FormatCSV    Format = "csv"
+)
+
+var ErrUnknownFormat error = errors.New("unknown format, use ndjson or csv")
+
+//ContentType returns the media type of the format.
+func (f Format) ContentType() string {
+	if f == FormatCSV {
+		return "text/csv"
+	}
+	return "application/x-ndjson"
+}
+
+//ParseFormat checks the format name, an empty name means NDJSON.
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case "", FormatNDJSON:
+		return FormatNDJSON, nil
+	case FormatCSV:
+		return FormatCSV, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrUnknownFormat, name)
+}
+
+type Storage interface {
+	GetAllUsers() []*database.User
+	GetUserByID(uuid.UUID) (*database.User, error)
+	GetUserByName(string) (*database.User, error)
+	ApplyBatch([]database.BatchOp, bool) []error
+}
+
+//Record is a user in an export file. Custom attributes are written only to NDJSON.
+type Record struct {
+	ID            uuid.UUID              `json:"id"`
+	Username      string                 `json:"username"`
+	Email         string                 `json:"email"`
+	EmailVerified bool                   `json:"email_verified"`
+	PasswordHash  string                 `json:"password_hash"`
+	Admin         bool                   `json:"admin"`
+	Pending       bool                   `json:"pending"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+}
+
+//csvHeader lists the CSV columns, they are named like the NDJSON fields.
+var csvHeader = []string{"id", "username", "email", "email_verified", "password_hash", "admin", "pending"}
+
+func newRecord(u *database.User) Record {
+	return Record{
+		ID:            u.ID,
+		Username:      u.Username,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		PasswordHash:  u.Password,
+		Admin:         u.Admin,
+		Pending:       u.Pending,
+		Attributes:    u.Attributes,
+	}
+}
+
+func (r Record) user() database.User {
+	return database.User{
+		ID:            r.ID,
+		Email:         r.Email,
+		EmailVerified: r.EmailVerified,
+		Username:      r.Username,
+		Password:      r.PasswordHash,
+		Admin:         r.Admin,
+		Pending:       r.Pending,
+		Attributes:    r.Attributes,
+	}
+}
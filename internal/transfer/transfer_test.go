@@ -0,0 +1,118 @@
+package transfer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func testStorage(t *testing.T) *database.DB {
+	db := database.New()
+
+	for _, u := range []*database.User{
+		{Username: "alice", Email: "alice@mail.ru", Password: "alice", Admin: true},
+		{Username: "bob", Email: "bob@mail.ru", Password: "bob", Pending: true},
+	} {
+		assert.Nil(t, db.NewUser(u))
+	}
+
+	return db
+}
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	for _, format := range []Format{FormatNDJSON, FormatCSV} {
+		src := testStorage(t)
+
+		var buf bytes.Buffer
+		assert.Nil(t, Export(&buf, format, src))
+
+		dst := database.New()
+		report, err := Import(&buf, Options{Format: format}, dst)
+		assert.Nil(t, err, format)
+		assert.Equal(t, 2, report.Created, format)
+		assert.Empty(t, report.Rejected, format)
+
+		for _, want := range src.GetAllUsers() {
+			got, err := dst.GetUserByID(want.ID)
+			if assert.Nil(t, err, format) {
+				assert.Equal(t, want, got, format)
+			}
+		}
+
+		got, _ := dst.GetUserByName("alice")
+		assert.True(t, got.CheckPassword("alice"), format)
+	}
+}
+
+func TestImport_Conflicts(t *testing.T) {
+	db := testStorage(t)
+	alice, _ := db.GetUserByName("alice")
+
+	var buf bytes.Buffer
+	assert.Nil(t, Export(&buf, FormatNDJSON, db))
+	file := buf.String()
+
+	changed := strings.Replace(file, "alice@mail.ru", "new@mail.ru", 1) + `{"username": "carol", "password_hash": "` + alice.Password + `"}` + "\n"
+
+	report, err := Import(strings.NewReader(changed), Options{Conflict: ConflictSkip}, db)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Created)
+	assert.Equal(t, 2, len(report.Skipped))
+
+	report, err = Import(strings.NewReader(changed), Options{Conflict: ConflictFail}, db)
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.Equal(t, 3, len(report.Rejected))
+
+	report, err = Import(strings.NewReader(changed), Options{Conflict: ConflictOverwrite, DryRun: true}, db)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, report.Overwritten)
+	u, _ := db.GetUserByName("alice")
+	assert.Equal(t, "alice@mail.ru", u.Email, "Dry run does not change users")
+
+	report, err = Import(strings.NewReader(changed), Options{Conflict: ConflictOverwrite}, db)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, report.Overwritten)
+	u, _ = db.GetUserByName("alice")
+	assert.Equal(t, "new@mail.ru", u.Email)
+	assert.Equal(t, alice.ID, u.ID)
+}
+
+func TestImport_RejectedRows(t *testing.T) {
+	db := database.New()
+
+	file := "id,username,email,password_hash,admin\n" +
+		",nohash,a@mail.ru,plain,false\n" +
+		"bad-id,badid,b@mail.ru,$2a$10$abcdefghijklmnopqrstuuJ0BvbFlgKYQfW3i5bCVn2wpsN1MjU5y,false\n" +
+		",,c@mail.ru,$2a$10$abcdefghijklmnopqrstuuJ0BvbFlgKYQfW3i5bCVn2wpsN1MjU5y,false\n" +
+		",flag,d@mail.ru,$2a$10$abcdefghijklmnopqrstuuJ0BvbFlgKYQfW3i5bCVn2wpsN1MjU5y,maybe\n" +
+		",good,e@mail.ru,$2a$10$abcdefghijklmnopqrstuuJ0BvbFlgKYQfW3i5bCVn2wpsN1MjU5y,true\n" +
+		",good,f@mail.ru,$2a$10$abcdefghijklmnopqrstuuJ0BvbFlgKYQfW3i5bCVn2wpsN1MjU5y,false\n" +
+		",short\n" +
+		",legacy,g@mail.ru,sha1$salt$da00ec2e6ff9ed4d342b24a16e262c82f3c8b10b,false\n" +
+		",costly,h@mail.ru,pbkdf2_sha256$1000000000$salt$qN+JnzxPIE2WfgrWPAkph8EAVeuwF7PZ0ordIY1Peq0=,false\n"
+
+	report, err := Import(strings.NewReader(file), Options{Format: FormatCSV}, db)
+	assert.Nil(t, err)
+	assert.Equal(t, 9, report.Total)
+	assert.Equal(t, 2, report.Created)
+
+	lines := []int{}
+	for _, r := range report.Rejected {
+		lines = append(lines, r.Line)
+	}
+	assert.Equal(t, []int{2, 3, 4, 5, 7, 8, 10}, lines, "Hashes with too high costs are rejected")
+
+	u, err := db.GetUserByName("good")
+	assert.Nil(t, err)
+	assert.True(t, u.Admin)
+
+	u, err = db.GetUserByName("legacy")
+	assert.Nil(t, err)
+	assert.True(t, u.CheckPassword("secret"))
+
+	_, err = Import(strings.NewReader("username,email\n"), Options{Format: FormatCSV}, db)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,291 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/config"
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const maxResponseBody int64 = 64 * 1024
+
+//Dispatcher turns the events of the storage into deliveries and sends them.
+//Deliveries are saved in the storage, so pending ones are sent after a restart too.
+type Dispatcher struct {
+	cfg    config.Webhooks
+	store  Storage
+	client *http.Client
+
+	mu       sync.Mutex
+	events   []database.Event
+	inFlight map[uuid.UUID]bool
+
+	wake    chan struct{}
+	workers chan struct{}
+	wg      sync.WaitGroup
+}
+
+//New creates a dispatcher and subscribes it to the events of the storage. The guard checks every address
+//the deliveries connect to.
+func New(cfg config.Webhooks, s Storage, g *Guard) *Dispatcher {
+	if cfg.WebhookWorkers < 1 {
+		cfg.WebhookWorkers = 1
+	}
+	if cfg.WebhookMaxAttempts < 1 {
+		cfg.WebhookMaxAttempts = 1
+	}
+
+	d := &Dispatcher{
+		cfg:      cfg,
+		store:    s,
+		client:   &http.Client{Timeout: cfg.WebhookTimeout, Transport: guardedTransport(g)},
+		inFlight: make(map[uuid.UUID]bool),
+		wake:     make(chan struct{}, 1),
+		workers:  make(chan struct{}, cfg.WebhookWorkers),
+	}
+
+	s.AddListener(d.enqueue)
+
+	return d
+}
+
+//guardedTransport connects only to the addresses the guard allows. Proxies are not used: the guard
+//would check the address of the proxy instead of the receiver.
+func guardedTransport(g *Guard) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   g.control,
+	}).DialContext
+
+	return t
+}
+
+//enqueue is the storage listener, it is called under the storage lock, so only remembers the event.
+func (d *Dispatcher) enqueue(e database.Event) {
+	d.mu.Lock()
+	d.events = append(d.events, e)
+	d.mu.Unlock()
+
+	d.notify()
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+//Run sends deliveries until the context is canceled, then waits for the started attempts.
+func (d *Dispatcher) Run(ctx context.Context) {
+	interval := d.cfg.WebhookPollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		d.createDeliveries()
+		d.deliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			d.wg.Wait()
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+//createDeliveries saves a delivery for every queued event and every webhook subscribed to it.
+func (d *Dispatcher) createDeliveries() {
+	d.mu.Lock()
+	events := d.events
+	d.events = nil
+	d.mu.Unlock()
+
+	if len(events) == 0 {
+		return
+	}
+
+	hooks := d.store.GetAllWebhooks()
+	ds := make([]*database.WebhookDelivery, 0)
+
+	for _, e := range events {
+		payload, err := json.Marshal(NewPayload(e))
+		if err != nil {
+			log.WithError(err).Error("unable to encode webhook payload")
+			continue
+		}
+
+		for _, h := range hooks {
+			if h.TenantID != e.User.TenantID || !h.Accepts(e.Type) {
+				continue
+			}
+
+			next := e.Time
+			ds = append(ds, &database.WebhookDelivery{
+				WebhookID:     h.ID,
+				EventID:       e.ID,
+				Event:         e.Type,
+				Payload:       payload,
+				Status:        database.DeliveryPending,
+				CreatedAt:     e.Time,
+				NextAttemptAt: &next,
+			})
+		}
+	}
+
+	if len(ds) == 0 {
+		return
+	}
+
+	if err := d.store.NewWebhookDeliveries(ds); err != nil {
+		log.WithError(err).Error("unable to save webhook deliveries")
+	}
+}
+
+//deliverDue starts attempts of the pending deliveries whose time has come, the oldest first,
+//as long as there are free workers.
+func (d *Dispatcher) deliverDue(ctx context.Context) {
+	now := time.Now()
+	ds := d.store.GetAllDeliveriesByStatus(database.DeliveryPending)
+	hooks := make(map[uuid.UUID]*database.Webhook)
+	for _, h := range d.store.GetAllWebhooks() {
+		hooks[h.ID] = h
+	}
+
+	for i := len(ds) - 1; i >= 0; i-- {
+		dl := ds[i]
+		if dl.NextAttemptAt != nil && dl.NextAttemptAt.After(now) {
+			continue
+		}
+
+		hook, ok := hooks[dl.WebhookID]
+		if !ok {
+			//вебхук удален вместе со своими доставками
+			continue
+		}
+
+		d.mu.Lock()
+		busy := d.inFlight[dl.ID]
+		d.mu.Unlock()
+		if busy {
+			continue
+		}
+
+		select {
+		case d.workers <- struct{}{}:
+		default:
+			return
+		}
+
+		d.mu.Lock()
+		d.inFlight[dl.ID] = true
+		d.mu.Unlock()
+
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+
+			d.attempt(ctx, hook, dl)
+
+			d.mu.Lock()
+			delete(d.inFlight, dl.ID)
+			d.mu.Unlock()
+			<-d.workers
+
+			d.notify()
+		}()
+	}
+}
+
+//attempt sends the delivery once and saves the result.
+func (d *Dispatcher) attempt(ctx context.Context, hook *database.Webhook, dl *database.WebhookDelivery) {
+	code, err := d.send(ctx, hook, dl)
+	if err != nil && ctx.Err() != nil {
+		//остановка сервиса, попытка не засчитывается
+		return
+	}
+
+	now := time.Now().UTC()
+	dl.Attempts++
+	dl.LastStatusCode = code
+	dl.LastError = ""
+	dl.NextAttemptAt = nil
+
+	switch {
+	case err == nil:
+		dl.Status = database.DeliveryDelivered
+		dl.DeliveredAt = &now
+	case dl.Attempts >= d.cfg.WebhookMaxAttempts:
+		dl.Status = database.DeliveryFailed
+		dl.LastError = err.Error()
+		log.WithError(err).WithField("delivery_id", dl.ID).Warn("webhook delivery moved to dead letters")
+	default:
+		next := now.Add(d.backoff(dl.Attempts))
+		dl.NextAttemptAt = &next
+		dl.LastError = err.Error()
+	}
+
+	if err := d.store.UpdateWebhookDelivery(dl); err != nil && !errors.Is(err, database.ErrDeliveryNotExist) {
+		log.WithError(err).Error("unable to save webhook delivery")
+	}
+}
+
+//send posts the signed payload, any status other than 2xx is an error.
+func (d *Dispatcher) send(ctx context.Context, hook *database.Webhook, dl *database.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(dl.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderDeliveryID, dl.ID.String())
+	req.Header.Set(HeaderEvent, string(dl.Event))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, ts, dl.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+//backoff returns the delay before the next attempt: the base delay doubled after every failed attempt.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.cfg.WebhookBaseDelay << (attempts - 1)
+	if delay > d.cfg.WebhookMaxDelay || delay <= 0 {
+		delay = d.cfg.WebhookMaxDelay
+	}
+
+	return delay
+}
@@ -0,0 +1,158 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/config"
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+var testConfig = config.Webhooks{
+	WebhookMaxAttempts:  3,
+	WebhookBaseDelay:    10 * time.Millisecond,
+	WebhookMaxDelay:     20 * time.Millisecond,
+	WebhookTimeout:      time.Second,
+	WebhookWorkers:      2,
+	WebhookPollInterval: 5 * time.Millisecond,
+}
+
+//testGuard lets the deliveries reach the test servers on the loopback interface.
+var testGuard, _ = NewGuard([]string{"127.0.0.0/8", "::1"})
+
+func startDispatcher(t *testing.T, db *database.DB, g *Guard) {
+	d := New(testConfig, db, g)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func waitDeliveries(t *testing.T, db *database.DB, status database.DeliveryStatus, n int) []*database.WebhookDelivery {
+	var ds []*database.WebhookDelivery
+	assert.Eventually(t, func() bool {
+		ds = db.GetDeliveriesByStatus(status)
+		return len(ds) == n
+	}, 5*time.Second, 5*time.Millisecond)
+
+	return ds
+}
+
+func TestDispatcher_SignedDelivery(t *testing.T) {
+	var mu sync.Mutex
+	var payloads []Payload
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		assert.Nil(t, err)
+		assert.Equal(t, Sign("secret", ts, body), r.Header.Get(HeaderSignature))
+		assert.NotEmpty(t, r.Header.Get(HeaderDeliveryID))
+
+		var p Payload
+		assert.Nil(t, json.Unmarshal(body, &p))
+		assert.Equal(t, string(p.Type), r.Header.Get(HeaderEvent))
+
+		mu.Lock()
+		payloads = append(payloads, p)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	db := database.New()
+	assert.Nil(t, db.NewWebhook(&database.Webhook{URL: srv.URL, Events: []database.EventType{database.EventUserCreated}, Secret: "secret"}))
+	startDispatcher(t, db, testGuard)
+
+	u := &database.User{Username: "user", Email: "u@mai.l", Password: "pass"}
+	assert.Nil(t, db.NewUser(u))
+	assert.Nil(t, db.DeleteUser(u.ID))
+
+	ds := waitDeliveries(t, db, database.DeliveryDelivered, 1)
+	assert.Equal(t, 1, ds[0].Attempts)
+	assert.Equal(t, http.StatusOK, ds[0].LastStatusCode)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, len(payloads), "The webhook receives only subscribed events")
+	assert.Equal(t, u.ID, payloads[0].Data.ID)
+	assert.Equal(t, "user", payloads[0].Data.Username)
+}
+
+func TestDispatcher_RetryAndDeadLetter(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	db := database.New()
+	assert.Nil(t, db.NewWebhook(&database.Webhook{URL: srv.URL, Secret: "secret"}))
+	startDispatcher(t, db, testGuard)
+
+	assert.Nil(t, db.NewUser(&database.User{Username: "user", Email: "u@mai.l", Password: "pass"}))
+
+	ds := waitDeliveries(t, db, database.DeliveryFailed, 1)
+	assert.Equal(t, testConfig.WebhookMaxAttempts, ds[0].Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, ds[0].LastStatusCode)
+	assert.NotEmpty(t, ds[0].LastError)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, testConfig.WebhookMaxAttempts, calls)
+}
+
+func TestDispatcher_InternalAddressBlocked(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	db := database.New()
+	assert.Nil(t, db.NewWebhook(&database.Webhook{URL: srv.URL, Secret: "secret"}))
+	startDispatcher(t, db, &Guard{})
+
+	assert.Nil(t, db.NewUser(&database.User{Username: "user", Email: "u@mai.l", Password: "pass"}))
+
+	ds := waitDeliveries(t, db, database.DeliveryFailed, 1)
+	assert.Contains(t, ds[0].LastError, ErrAddressNotAllowed.Error())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 0, calls, "The loopback address is checked when the connection is made")
+}
+
+func TestDispatcher_Backoff(t *testing.T) {
+	d := &Dispatcher{cfg: config.Webhooks{WebhookBaseDelay: time.Second, WebhookMaxDelay: 5 * time.Second}}
+
+	assert.Equal(t, time.Second, d.backoff(1))
+	assert.Equal(t, 2*time.Second, d.backoff(2))
+	assert.Equal(t, 4*time.Second, d.backoff(3))
+	assert.Equal(t, 5*time.Second, d.backoff(4))
+	assert.Equal(t, 5*time.Second, d.backoff(100))
+}
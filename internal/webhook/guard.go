@@ -0,0 +1,138 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+var ErrAddressNotAllowed error = errors.New("loopback, private and link-local addresses are not allowed")
+
+//blockedNetworks are the special-purpose ranges not covered by the checks of net.IP.
+var blockedNetworks = mustParseNetworks("0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15")
+
+//Guard keeps webhooks from reaching the internal network of the service: a tenant administrator must not
+//be able to make the server send requests to the loopback, private or link-local addresses
+//(e.g. the cloud metadata at 169.254.169.254). The allowed networks are exempt from the check.
+type Guard struct {
+	allowed []*net.IPNet
+}
+
+//NewGuard creates a guard, the allowed networks are CIDRs or single IP addresses.
+func NewGuard(allowed []string) (*Guard, error) {
+	g := &Guard{}
+	for _, s := range allowed {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		n, err := parseNetwork(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed webhook network %q: %s", s, err)
+		}
+		g.allowed = append(g.allowed, n)
+	}
+
+	return g, nil
+}
+
+//Allowed reports whether webhooks may be sent to the address.
+func (g *Guard) Allowed(ip net.IP) bool {
+	for _, n := range g.allowed {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range blockedNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+//CheckURL resolves the host of the URL, all its addresses must be allowed. A host that does not resolve
+//is accepted: the address is checked again on every delivery, when the connection is made.
+func (g *Guard) CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !g.Allowed(ip) {
+			return ErrAddressNotAllowed
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if !g.Allowed(addr.IP) {
+			return ErrAddressNotAllowed
+		}
+	}
+
+	return nil
+}
+
+//control is the Control function of the dialer of the deliveries. It checks the address the connection
+//is actually made to, so neither DNS rebinding nor redirects bypass the guard.
+func (g *Guard) control(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !g.Allowed(ip) {
+		return fmt.Errorf("%w: %s", ErrAddressNotAllowed, host)
+	}
+
+	return nil
+}
+
+func parseNetwork(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, errors.New("not an IP address or CIDR")
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, n, err := net.ParseCIDR(s)
+	return n, err
+}
+
+func mustParseNetworks(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+
+	return nets
+}
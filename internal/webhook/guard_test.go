@@ -0,0 +1,42 @@
+package webhook
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuard_Allowed(t *testing.T) {
+	g, err := NewGuard(nil)
+	assert.Nil(t, err)
+
+	for _, ip := range []string{"127.0.0.1", "::1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+		"fe80::1", "fd00::1", "0.0.0.0", "100.64.0.1", "::ffff:127.0.0.1", "::ffff:169.254.169.254"} {
+		assert.False(t, g.Allowed(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"93.184.216.34", "8.8.8.8", "2606:4700::1111"} {
+		assert.True(t, g.Allowed(net.ParseIP(ip)), ip)
+	}
+
+	g, err = NewGuard([]string{"10.0.0.0/8", " 127.0.0.1 "})
+	assert.Nil(t, err)
+	assert.True(t, g.Allowed(net.ParseIP("10.1.2.3")), "The allowed networks are exempt")
+	assert.True(t, g.Allowed(net.ParseIP("127.0.0.1")))
+	assert.False(t, g.Allowed(net.ParseIP("127.0.0.2")))
+	assert.False(t, g.Allowed(net.ParseIP("169.254.169.254")))
+
+	_, err = NewGuard([]string{"internal"})
+	assert.NotNil(t, err)
+}
+
+func TestGuard_CheckURL(t *testing.T) {
+	g, _ := NewGuard(nil)
+	ctx := context.Background()
+
+	for _, u := range []string{"http://127.0.0.1:8080/hook", "http://169.254.169.254/latest/meta-data", "https://[::1]/hook", "http://localhost/hook"} {
+		assert.ErrorIs(t, g.CheckURL(ctx, u), ErrAddressNotAllowed, u)
+	}
+	assert.Nil(t, g.CheckURL(ctx, "https://93.184.216.34/hook"))
+}
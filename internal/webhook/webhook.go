@@ -0,0 +1,84 @@
+//Package webhook delivers user lifecycle events to the subscribed URLs.
+//
+//Every delivery is a POST request with the JSON Payload. The request is signed: the X-Webhook-Signature
+//header is "v1=" followed by the hex HMAC-SHA256 of "<X-Webhook-Timestamp>.<body>" with the webhook secret,
+//so receivers can check the sender and reject old requests. Failed deliveries are retried with an
+//exponential backoff, after the last attempt they become dead letters.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/MarySmirnova/api_users/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	HeaderDeliveryID string = "X-Webhook-ID"
+	HeaderEvent      string = "X-Webhook-Event"
+	HeaderTimestamp  string = "X-Webhook-Timestamp"
+	HeaderSignature  string = "X-Webhook-Signature"
+
+	signatureVersion string = "v1="
+)
+
+type Storage interface {
+	AddListener(database.Listener)
+	GetAllWebhooks() []*database.Webhook
+	NewWebhookDeliveries([]*database.WebhookDelivery) error
+	GetAllDeliveriesByStatus(database.DeliveryStatus) []*database.WebhookDelivery
+	UpdateWebhookDelivery(*database.WebhookDelivery) error
+}
+
+//Payload is the body of a delivery. ID is the same for all webhooks receiving the event.
+type Payload struct {
+	ID        uuid.UUID          `json:"id"`
+	Type      database.EventType `json:"type"`
+	CreatedAt time.Time          `json:"created_at"`
+	Data      UserData           `json:"data"`
+}
+
+//UserData is the user in the payload, without the password hash.
+type UserData struct {
+	ID            uuid.UUID              `json:"id"`
+	TenantID      uuid.UUID              `json:"tenant_id,omitzero"`
+	Username      string                 `json:"username"`
+	Email         string                 `json:"email"`
+	EmailVerified bool                   `json:"email_verified"`
+	Admin         bool                   `json:"admin"`
+	Pending       bool                   `json:"pending"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+}
+
+//NewPayload converts the storage event, the same payload is used by the event stream of the API.
+func NewPayload(e database.Event) Payload {
+	return Payload{
+		ID:        e.ID,
+		Type:      e.Type,
+		CreatedAt: e.Time,
+		Data: UserData{
+			ID:            e.User.ID,
+			TenantID:      e.User.TenantID,
+			Username:      e.User.Username,
+			Email:         e.User.Email,
+			EmailVerified: e.User.EmailVerified,
+			Admin:         e.User.Admin,
+			Pending:       e.User.Pending,
+			Attributes:    e.User.Attributes,
+		},
+	}
+}
+
+//Sign returns the value of the signature header for the body sent at the timestamp (Unix seconds).
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return signatureVersion + hex.EncodeToString(mac.Sum(nil))
+}
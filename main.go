@@ -1,6 +1,7 @@
 package main
 
 import (
+	"os"
 	"time"
 
 	"github.com/MarySmirnova/api_users/internal"
@@ -32,6 +33,11 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:])
+		return
+	}
+
 	app, err := internal.NewApplication(cfg)
 	if err != nil {
 		panic(err)
@@ -39,3 +45,18 @@ func main() {
 
 	app.StartServer()
 }
+
+func runCommand(args []string) {
+	app, err := internal.NewCommandApplication(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = app.RunCommand(args, os.Stdout)
+	if closeErr := app.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,4 @@
+//Package userspb contains the gRPC API definition and the generated code.
+package userspb
+
+//go:generate sh -c "cd .. && buf generate"